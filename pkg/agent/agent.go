@@ -16,7 +16,9 @@ import (
 
 	"github.com/spidernet-io/egressgateway/pkg/agent/metrics"
 	"github.com/spidernet-io/egressgateway/pkg/config"
+	"github.com/spidernet-io/egressgateway/pkg/lease"
 	"github.com/spidernet-io/egressgateway/pkg/logger"
+	"github.com/spidernet-io/egressgateway/pkg/portblock"
 	"github.com/spidernet-io/egressgateway/pkg/profiling"
 	"github.com/spidernet-io/egressgateway/pkg/schema"
 	"github.com/spidernet-io/egressgateway/pkg/types"
@@ -31,9 +33,14 @@ func New(cfg *config.Config) (types.Service, error) {
 	syncPeriod := time.Second * 15
 	log := logger.NewLogger(cfg.EnvConfig.Logger)
 	t := time.Duration(0)
+	byObject := portblock.CacheByObject()
+	for obj, opts := range lease.CacheByObject(cfg.FileConfig.GatewayFailover.LeaseNamespace) {
+		byObject[obj] = opts
+	}
 	mgrOpts := manager.Options{
 		Cache: cache.Options{
 			SyncPeriod: &syncPeriod,
+			ByObject:   byObject,
 		},
 		Scheme:                  schema.GetScheme(),
 		Logger:                  log,
@@ -78,12 +85,32 @@ func New(cfg *config.Config) (types.Service, error) {
 		return nil, fmt.Errorf("failed to create node controller: %w", err)
 	}
 
-	err = newPolicyController(mgr, log, cfg)
+	liveness, err := newPeerLiveness(mgr, cfg, log)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeLease, err := newNodeLease(mgr, cfg, log)
+	if err != nil {
+		return nil, err
+	}
+
+	ctSync, err := newCtSync(mgr, cfg, log)
+	if err != nil {
+		return nil, err
+	}
+
+	snatUsage, err := newSnatUsage(mgr, cfg, log)
+	if err != nil {
+		return nil, err
+	}
+
+	err = newPolicyController(mgr, log, cfg, liveness, nodeLease, ctSync, snatUsage)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create egress gateway policy controller: %w", err)
 	}
 
-	err = newEipCtrl(mgr, log, cfg)
+	err = newEipCtrl(mgr, log, cfg, liveness, nodeLease)
 	if err != nil {
 		return nil, fmt.Errorf("failed to eip controller: %w", err)
 	}
@@ -0,0 +1,112 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/spidernet-io/egressgateway/pkg/cidrgroup"
+	"github.com/spidernet-io/egressgateway/pkg/ipset"
+)
+
+const groupIPSetPrefix = "egress-grp-"
+
+// updateGroupIPSets keeps an ipset of each EgressCIDRGroup with the CIDRs of the group and
+// the groups it includes, the ipset is shared by all the policies referencing the group
+func (r *policeReconciler) updateGroupIPSets(ctx context.Context) error {
+	groups, err := cidrgroup.Groups(ctx, r.client)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool)
+	for name := range groups {
+		ipv4List, ipv6List, err := r.getDstCIDR(cidrgroup.CIDRs(groups, name))
+		if err != nil {
+			r.log.Error(err, "skip the EgressCIDRGroup with invalid cidrs", "group", name)
+			continue
+		}
+		err = buildIPSetNamesByGroup(name, r.cfg.FileConfig.EnableIPv4, r.cfg.FileConfig.EnableIPv6).Map(func(set SetName) error {
+			wanted[set.Name] = true
+			if err := r.createIPSet(r.log, set); err != nil {
+				return err
+			}
+			if set.Stack == IPv4 {
+				return r.updateIPSetEntries(set.Name, ipv4List)
+			}
+			return r.updateIPSetEntries(set.Name, ipv6List)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// the ipsets of the deleted groups are destroyed with the other stale ipsets,
+	// after they are removed from the destination ipsets of the policies
+	r.ipsetMap.Range(func(name string, _ *ipset.IPSet) bool {
+		if strings.HasPrefix(name, groupIPSetPrefix) && !wanted[name] {
+			r.ipsetMap.Delete(name)
+		}
+		return true
+	})
+	return nil
+}
+
+// updateIPSetEntries updates the entries of the ipset to the list
+func (r *policeReconciler) updateIPSetEntries(name string, list []string) error {
+	set, ok := r.ipsetMap.Load(name)
+	if !ok {
+		return nil
+	}
+	oldList, err := r.ipset.ListEntries(name)
+	if err != nil {
+		return err
+	}
+	toAdd, toDel := findDiff(oldList, list)
+	for _, entry := range toAdd {
+		err := r.ipset.AddEntry(entry, set, true)
+		if err != nil && !errors.Is(err, ipset.ErrAlreadyAddedEntry) {
+			return err
+		}
+	}
+	for _, entry := range toDel {
+		if err := r.ipset.DelEntry(entry, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupIPSets returns the ipsets of the groups of the policy, the groups which do not
+// exist are skipped
+func (r *policeReconciler) groupIPSets(groups []string, stack IPStack) []string {
+	res := make([]string, 0, len(groups))
+	for _, group := range groups {
+		name := groupIPSetName(group, stack)
+		if _, ok := r.ipsetMap.Load(name); ok {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+func buildIPSetNamesByGroup(name string, enableIPv4, enableIPv6 bool) SetNames {
+	res := make([]SetName, 0)
+	if enableIPv4 {
+		res = append(res, SetName{Name: groupIPSetName(name, IPv4), Stack: IPv4, Kind: IPGroup})
+	}
+	if enableIPv6 {
+		res = append(res, SetName{Name: groupIPSetName(name, IPv6), Stack: IPv6, Kind: IPGroup})
+	}
+	return res
+}
+
+func groupIPSetName(group string, stack IPStack) string {
+	if stack == IPv6 {
+		return formatIPSetName(groupIPSetPrefix+"v6-", group)
+	}
+	return formatIPSetName(groupIPSetPrefix+"v4-", group)
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/spidernet-io/egressgateway/pkg/config"
+	"github.com/spidernet-io/egressgateway/pkg/ipset"
+	ipsettest "github.com/spidernet-io/egressgateway/pkg/ipset/testing"
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/schema"
+	"github.com/spidernet-io/egressgateway/pkg/utils"
+)
+
+func TestCIDRGroupIPSets(t *testing.T) {
+	partner := &egressv1.EgressCIDRGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: "partner"},
+		Spec:       egressv1.EgressCIDRGroupSpec{CIDRs: []string{"1.1.1.0/24"}, Includes: []string{"backup"}},
+	}
+	backup := &egressv1.EgressCIDRGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: "backup"},
+		Spec:       egressv1.EgressCIDRGroupSpec{CIDRs: []string{"2.2.2.2/32", "fd00::/64"}},
+	}
+	cli := fake.NewClientBuilder().WithScheme(schema.GetScheme()).WithObjects(partner, backup).Build()
+
+	cfg := &config.Config{}
+	cfg.FileConfig.EnableIPv4 = true
+	cfg.FileConfig.EnableIPv6 = true
+	fakeIPSet := ipsettest.NewFake("7.1")
+	r := &policeReconciler{
+		client:   cli,
+		log:      logr.Discard(),
+		cfg:      cfg,
+		ipset:    fakeIPSet,
+		ipsetMap: utils.NewSyncMap[string, *ipset.IPSet](),
+	}
+	ctx := context.Background()
+
+	assert.NoError(t, r.updateGroupIPSets(ctx))
+	assert.Equal(t, sets.New("1.1.1.0/24", "2.2.2.2"), fakeIPSet.Entries[groupIPSetName("partner", IPv4)])
+	assert.Equal(t, sets.New("fd00::/64"), fakeIPSet.Entries[groupIPSetName("partner", IPv6)])
+	assert.Equal(t, sets.New("2.2.2.2"), fakeIPSet.Entries[groupIPSetName("backup", IPv4)])
+
+	// the destination list of the policy holds its destSubnet ipset and the ipsets of its groups
+	dest := policyDest{subnet: []string{"3.3.3.0/24"}, groups: []string{"partner", "unknown"}}
+	assert.NoError(t, r.updatePolicyIPSet("default", "p1", true, dest))
+	listName := formatIPSetName(dstListIPSetPrefix+"v4-", "default-p1")
+	assert.Equal(t, ipset.ListSet, fakeIPSet.Sets[listName].SetType)
+	assert.Equal(t, sets.New(dstIPSetName("default", "p1", IPv4), groupIPSetName("partner", IPv4)),
+		fakeIPSet.Entries[listName])
+	assert.Equal(t, sets.New("3.3.3.0/24"), fakeIPSet.Entries[dstIPSetName("default", "p1", IPv4)])
+
+	// the ipset of the deleted group is left to the cleanup of the stale ipsets
+	assert.NoError(t, cli.Delete(ctx, partner))
+	assert.NoError(t, r.updateGroupIPSets(ctx))
+	_, ok := r.ipsetMap.Load(groupIPSetName("partner", IPv4))
+	assert.False(t, ok)
+	assert.NoError(t, r.updatePolicyIPSet("default", "p1", true, dest))
+	assert.Equal(t, sets.New(dstIPSetName("default", "p1", IPv4)), fakeIPSet.Entries[listName])
+}
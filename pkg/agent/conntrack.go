@@ -0,0 +1,105 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"net"
+	"strings"
+
+	"github.com/spidernet-io/egressgateway/pkg/conntrack"
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+// policyDatapath is the datapath of a policy applied on this node, the traffic of the
+// policy is either SNATed to the EIP, or forwarded with the mark to the EgressTunnel
+// of the node which holds the EIP.
+type policyDatapath struct {
+	snatIP IP
+	mark   uint32
+	srcIPs map[string]struct{}
+}
+
+func (d policyDatapath) equal(other policyDatapath) bool {
+	return d.snatIP == other.snatIP && d.mark == other.mark
+}
+
+// staleDatapaths returns the datapaths of the policies which are removed or changed
+func staleDatapaths(old, current map[egressv1.Policy]policyDatapath) map[egressv1.Policy]policyDatapath {
+	stale := make(map[egressv1.Policy]policyDatapath)
+	for policy, datapath := range old {
+		if item, ok := current[policy]; ok && item.equal(datapath) {
+			continue
+		}
+		stale[policy] = datapath
+	}
+	return stale
+}
+
+// flushStaleFlows deletes the conntrack entries of the datapaths which are removed or
+// changed, otherwise the established flows keep the previous SNAT address until they
+// time out, e.g. after the EIP moves to another node
+func (r *policeReconciler) flushStaleFlows(current map[egressv1.Policy]policyDatapath) {
+	old := r.datapaths
+	r.datapaths = current
+	// the datapaths applied before the agent starts are unknown
+	if old == nil {
+		return
+	}
+
+	var clusterCIDRs []*net.IPNet
+	for policy, datapath := range staleDatapaths(old, current) {
+		if len(datapath.srcIPs) == 0 {
+			continue
+		}
+		if datapath.mark != 0 && clusterCIDRs == nil {
+			clusterCIDRs = r.clusterCIDRs()
+		}
+		var filters []*conntrack.Filter
+		for _, ip := range []string{datapath.snatIP.V4, datapath.snatIP.V6} {
+			if ip != "" {
+				filters = append(filters, &conntrack.Filter{SrcIPs: datapath.srcIPs, SnatIP: net.ParseIP(ip)})
+			}
+		}
+		if datapath.mark != 0 {
+			filters = append(filters, &conntrack.Filter{SrcIPs: datapath.srcIPs, Mark: datapath.mark,
+				MarkMask: policyMarkMask, ExcludeDstNets: clusterCIDRs})
+		}
+		for _, filter := range filters {
+			count, err := r.deleteFlows(filter)
+			if err != nil {
+				r.log.Error(err, "failed to flush conntrack entries", "policy", policy)
+				continue
+			}
+			r.log.Info("flush stale conntrack entries", "policy", policy, "snatIP", filter.SnatIP, "count", count)
+		}
+	}
+}
+
+// clusterCIDRs returns the CIDRs in the egress-cluster-cidr ipsets, the flows to them
+// are not forwarded to the EgressTunnel even though they are not SNATed
+func (r *policeReconciler) clusterCIDRs() []*net.IPNet {
+	res := make([]*net.IPNet, 0)
+	for _, name := range []string{EgressClusterCIDRIPv4, EgressClusterCIDRIPv6} {
+		entries, err := r.ipset.ListEntries(name)
+		if err != nil {
+			r.log.Error(err, "failed to list cluster cidr ipset", "ipset", name)
+			continue
+		}
+		for _, entry := range entries {
+			if !strings.Contains(entry, "/") {
+				if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+					entry += "/32"
+				} else {
+					entry += "/128"
+				}
+			}
+			_, ipNet, err := net.ParseCIDR(entry)
+			if err != nil {
+				continue
+			}
+			res = append(res, ipNet)
+		}
+	}
+	return res
+}
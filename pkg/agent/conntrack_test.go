@@ -0,0 +1,69 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/spidernet-io/egressgateway/pkg/conntrack"
+	ipsettest "github.com/spidernet-io/egressgateway/pkg/ipset/testing"
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+func TestFlushStaleFlows(t *testing.T) {
+	srcIPs := map[string]struct{}{"10.21.0.5": {}}
+	moved := egressv1.Policy{Name: "moved", Namespace: "default"}
+	remarked := egressv1.Policy{Name: "remarked", Namespace: "default"}
+	kept := egressv1.Policy{Name: "kept", Namespace: "default"}
+	deleted := egressv1.Policy{Name: "deleted", Namespace: "default"}
+
+	fakeIPSet := ipsettest.NewFake("7.1")
+	fakeIPSet.Entries[EgressClusterCIDRIPv4] = sets.New("10.21.0.0/16", "172.18.0.2")
+
+	var filters []*conntrack.Filter
+	r := &policeReconciler{
+		log:   logr.Discard(),
+		ipset: fakeIPSet,
+		deleteFlows: func(filter *conntrack.Filter) (uint, error) {
+			filters = append(filters, filter)
+			return 1, nil
+		},
+	}
+
+	// the datapaths applied before the agent starts are unknown
+	r.flushStaleFlows(map[egressv1.Policy]policyDatapath{
+		moved:    {snatIP: IP{V4: "10.6.1.1"}, srcIPs: srcIPs},
+		remarked: {mark: 0x26000001, srcIPs: srcIPs},
+		kept:     {mark: 0x26000001, srcIPs: srcIPs},
+		deleted:  {snatIP: IP{V4: "10.6.1.2"}, srcIPs: srcIPs},
+	})
+	assert.Empty(t, filters)
+
+	r.flushStaleFlows(map[egressv1.Policy]policyDatapath{
+		moved:    {mark: 0x26000002, srcIPs: srcIPs},
+		remarked: {mark: 0x26000002, srcIPs: srcIPs},
+		kept:     {mark: 0x26000001, srcIPs: srcIPs},
+	})
+
+	snatIPs := make([]string, 0)
+	marks := make([]uint32, 0)
+	for _, filter := range filters {
+		if filter.SnatIP != nil {
+			snatIPs = append(snatIPs, filter.SnatIP.String())
+			continue
+		}
+		marks = append(marks, filter.Mark)
+		excluded := make([]string, 0)
+		for _, ipNet := range filter.ExcludeDstNets {
+			excluded = append(excluded, ipNet.String())
+		}
+		assert.ElementsMatch(t, []string{"10.21.0.0/16", "172.18.0.2/32"}, excluded)
+	}
+	assert.ElementsMatch(t, []string{"10.6.1.1", "10.6.1.2"}, snatIPs)
+	assert.Equal(t, []uint32{0x26000001}, marks)
+}
@@ -0,0 +1,358 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/spidernet-io/egressgateway/pkg/config"
+	"github.com/spidernet-io/egressgateway/pkg/conntrack"
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+// ctSyncMessage is the conntrack snapshot of an EIP sent by the node which holds it
+type ctSyncMessage struct {
+	EIP   string           `json:"eip"`
+	Flows []conntrack.Flow `json:"flows"`
+}
+
+// maxCtSyncSize is the max size of the conntrack entries sent in a connection
+const maxCtSyncSize = 64 << 20
+
+type ctSnapshot struct {
+	flows    []conntrack.Flow
+	received time.Time
+}
+
+// ctSync replicates the conntrack entries of the EIPs held by this node to their
+// standby nodes over a dedicated TCP channel, the standby node inserts the entries of
+// an EIP when it takes the EIP over, so the established connections are not reset
+// by the new gateway node. The entries are signed by HMAC-SHA256 with the secret shared
+// by the agents.
+type ctSync struct {
+	client   client.Client
+	log      logr.Logger
+	ct       conntrack.Interface
+	port     int
+	interval time.Duration
+	secret   []byte
+
+	mu sync.Mutex
+	// held is the EIPs held by this node and their standby nodes
+	held map[string]string
+	// snapshots is the latest conntrack entries received from the holders of the EIPs
+	snapshots map[string]ctSnapshot
+	// peers is the underlay addresses of the EgressTunnels, refreshed every interval
+	peers map[string]struct{}
+}
+
+func newCtSync(mgr manager.Manager, cfg *config.Config, log logr.Logger) (*ctSync, error) {
+	opt := cfg.FileConfig.GatewayFailover.ConntrackSync
+	if !cfg.FileConfig.GatewayFailover.Enable || !opt.Enable {
+		return nil, nil
+	}
+	if cfg.EnvConfig.ConntrackSyncSecret == "" {
+		return nil, fmt.Errorf("the secret of conntrack sync is empty")
+	}
+	s := &ctSync{
+		client:    mgr.GetClient(),
+		log:       log.WithName("conntrack-sync"),
+		ct:        conntrack.New(),
+		port:      opt.Port,
+		interval:  time.Second * time.Duration(opt.IntervalSeconds),
+		secret:    []byte(cfg.EnvConfig.ConntrackSyncSecret),
+		held:      make(map[string]string),
+		snapshots: make(map[string]ctSnapshot),
+		peers:     make(map[string]struct{}),
+	}
+	if err := mgr.Add(s); err != nil {
+		return nil, fmt.Errorf("failed to add conntrack sync: %w", err)
+	}
+	return s, nil
+}
+
+func (s *ctSync) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	if err != nil {
+		return fmt.Errorf("failed to listen conntrack sync port %d: %w", s.port, err)
+	}
+	s.log.Info("start conntrack sync", "address", listener.Addr().String(), "interval", s.interval)
+
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+	s.refreshPeers(ctx)
+	go s.accept(listener)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			s.refreshPeers(ctx)
+			s.export(ctx)
+		}
+	}
+}
+
+// hold sets the EIPs held by this node and their standby nodes, the entries received
+// for the EIPs newly held are inserted into the conntrack table in the background
+func (s *ctSync) hold(eips map[string]string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	taken := make(map[string]ctSnapshot)
+	for eip := range eips {
+		if _, ok := s.held[eip]; ok {
+			continue
+		}
+		if snapshot, ok := s.snapshots[eip]; ok {
+			taken[eip] = snapshot
+		}
+		delete(s.snapshots, eip)
+	}
+	s.held = eips
+	s.mu.Unlock()
+
+	if len(taken) > 0 {
+		go s.restore(taken, time.Now())
+	}
+}
+
+func (s *ctSync) restore(taken map[string]ctSnapshot, now time.Time) {
+	for eip, snapshot := range taken {
+		count := 0
+		for _, flow := range restoreFlows(snapshot, now) {
+			if err := s.ct.Create(flow); err != nil {
+				s.log.V(1).Info("failed to restore conntrack flow", "eip", eip, "error", err.Error())
+				continue
+			}
+			count++
+		}
+		s.log.Info("restore conntrack flows of the taken over EIP", "eip", eip, "count", count)
+	}
+}
+
+// restoreFlows returns the flows of the snapshot which have not expired, their
+// timeouts are reduced by the age of the snapshot
+func restoreFlows(snapshot ctSnapshot, now time.Time) []conntrack.Flow {
+	age := int(now.Sub(snapshot.received) / time.Second)
+	flows := make([]conntrack.Flow, 0, len(snapshot.flows))
+	for _, flow := range snapshot.flows {
+		if flow.Timeout <= age {
+			continue
+		}
+		flow.Timeout -= age
+		flows = append(flows, flow)
+	}
+	return flows
+}
+
+func (s *ctSync) export(ctx context.Context) {
+	s.mu.Lock()
+	peers := make(map[string][]string)
+	var eips []string
+	for eip, standby := range s.held {
+		if standby != "" {
+			peers[standby] = append(peers[standby], eip)
+			eips = append(eips, eip)
+		}
+	}
+	s.mu.Unlock()
+	if len(eips) == 0 {
+		return
+	}
+
+	// the conntrack table is dumped once for all the EIPs of the cycle
+	flows, err := s.ct.ListByReplyDsts(eips)
+	if err != nil {
+		s.log.Error(err, "failed to list conntrack flows")
+		return
+	}
+
+	for standby, eips := range peers {
+		addr, err := s.peerAddr(ctx, standby)
+		if err != nil {
+			s.log.Error(err, "failed to get the address of standby node", "node", standby)
+			continue
+		}
+		messages := make([]ctSyncMessage, 0, len(eips))
+		for _, eip := range eips {
+			messages = append(messages, ctSyncMessage{EIP: eip, Flows: flows[eip]})
+		}
+		if err := s.send(ctx, addr, messages); err != nil {
+			s.log.V(1).Info("failed to send conntrack flows", "node", standby, "error", err.Error())
+		}
+	}
+}
+
+func (s *ctSync) send(ctx context.Context, addr string, messages []ctSyncMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, s.interval)
+	defer cancel()
+	payload, err := json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxCtSyncSize {
+		return fmt.Errorf("the size %d of conntrack flows exceeds %d", len(payload), maxCtSyncSize)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	// the signature is followed by the payload
+	if _, err := conn.Write(s.sign(payload)); err != nil {
+		return err
+	}
+	_, err = conn.Write(payload)
+	return err
+}
+
+func (s *ctSync) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// decode verifies the signature of the data and decodes the conntrack entries
+func (s *ctSync) decode(r io.Reader) ([]ctSyncMessage, error) {
+	data, err := io.ReadAll(io.LimitReader(r, sha256.Size+maxCtSyncSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < sha256.Size {
+		return nil, fmt.Errorf("the message is too short")
+	}
+	if len(data) > sha256.Size+maxCtSyncSize {
+		return nil, fmt.Errorf("the message exceeds %d bytes", maxCtSyncSize)
+	}
+	signature, payload := data[:sha256.Size], data[sha256.Size:]
+	if !hmac.Equal(signature, s.sign(payload)) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+	var messages []ctSyncMessage
+	if err := json.NewDecoder(bytes.NewReader(payload)).Decode(&messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (s *ctSync) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.log.V(1).Info("failed to accept conntrack sync connection", "error", err.Error())
+			continue
+		}
+		go s.receive(conn)
+	}
+}
+
+func (s *ctSync) receive(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(s.interval))
+
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return
+	}
+	if !s.isPeer(host) {
+		s.log.V(1).Info("drop conntrack sync connection of unknown peer", "peer", host)
+		return
+	}
+
+	messages, err := s.decode(conn)
+	if err != nil {
+		s.log.V(1).Info("failed to decode conntrack sync message", "peer", host, "error", err.Error())
+		return
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, message := range messages {
+		// the EIP has been taken over by this node, the holder is stale
+		if _, ok := s.held[message.EIP]; ok {
+			continue
+		}
+		s.snapshots[message.EIP] = ctSnapshot{flows: message.Flows, received: now}
+	}
+}
+
+// peerAddr returns the underlay address of the conntrack sync channel of the node
+func (s *ctSync) peerAddr(ctx context.Context, node string) (string, error) {
+	tunnel := new(egressv1.EgressTunnel)
+	if err := s.client.Get(ctx, types.NamespacedName{Name: node}, tunnel); err != nil {
+		return "", err
+	}
+	parent := tunnel.Status.Tunnel.Parent.IPv4
+	if parent == "" {
+		parent = tunnel.Status.Tunnel.Parent.IPv6
+	}
+	if parent == "" {
+		return "", fmt.Errorf("the parent address of egress tunnel %s is empty", node)
+	}
+	return net.JoinHostPort(parent, strconv.Itoa(s.port)), nil
+}
+
+// refreshPeers caches the underlay addresses of the EgressTunnels
+func (s *ctSync) refreshPeers(ctx context.Context) {
+	list := new(egressv1.EgressTunnelList)
+	if err := s.client.List(ctx, list); err != nil {
+		s.log.Error(err, "failed to list egress tunnel")
+		return
+	}
+	peers := make(map[string]struct{})
+	for _, tunnel := range list.Items {
+		for _, parent := range []string{tunnel.Status.Tunnel.Parent.IPv4, tunnel.Status.Tunnel.Parent.IPv6} {
+			if ip := net.ParseIP(parent); ip != nil {
+				peers[ip.String()] = struct{}{}
+			}
+		}
+	}
+	s.mu.Lock()
+	s.peers = peers
+	s.mu.Unlock()
+}
+
+// isPeer reports whether the address is the underlay address of a node, only the
+// entries sent by the agents are accepted
+func (s *ctSync) isPeer(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.peers[ip.String()]
+	return ok
+}
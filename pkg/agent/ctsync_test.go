@@ -0,0 +1,110 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/spidernet-io/egressgateway/pkg/conntrack"
+)
+
+type fakeConntrack struct {
+	mu      sync.Mutex
+	created []conntrack.Flow
+}
+
+func (f *fakeConntrack) ListByReplyDsts([]string) (map[string][]conntrack.Flow, error) {
+	return nil, nil
+}
+
+func (f *fakeConntrack) Create(flow conntrack.Flow) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.created = append(f.created, flow)
+	return nil
+}
+
+func (f *fakeConntrack) flows() []conntrack.Flow {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]conntrack.Flow(nil), f.created...)
+}
+
+func TestCtSyncHold(t *testing.T) {
+	ct := &fakeConntrack{}
+	s := &ctSync{
+		log:       logr.Discard(),
+		ct:        ct,
+		held:      map[string]string{},
+		snapshots: map[string]ctSnapshot{},
+	}
+	s.snapshots["10.6.1.1"] = ctSnapshot{
+		received: time.Now().Add(-time.Second * 10),
+		flows: []conntrack.Flow{
+			{Proto: "tcp", Src: "10.21.0.5", Timeout: 300},
+			{Proto: "udp", Src: "10.21.0.6", Timeout: 5},
+		},
+	}
+
+	// the snapshot is kept while the EIP is held by another node
+	s.hold(map[string]string{"10.6.1.2": "node2"})
+	assert.Contains(t, s.snapshots, "10.6.1.1")
+
+	// the unexpired flows are restored in the background when the EIP is taken over
+	s.hold(map[string]string{"10.6.1.1": "", "10.6.1.2": "node2"})
+	assert.NotContains(t, s.snapshots, "10.6.1.1")
+	assert.Eventually(t, func() bool { return len(ct.flows()) == 1 }, time.Second, time.Millisecond*10)
+	created := ct.flows()
+	assert.Equal(t, "10.21.0.5", created[0].Src)
+	assert.InDelta(t, 290, created[0].Timeout, 1)
+
+	// the flows are restored only once
+	s.hold(map[string]string{"10.6.1.1": "", "10.6.1.2": "node2"})
+	time.Sleep(time.Millisecond * 50)
+	assert.Len(t, ct.flows(), 1)
+}
+
+func TestCtSyncDecode(t *testing.T) {
+	s := &ctSync{secret: []byte("secret")}
+	messages := []ctSyncMessage{{EIP: "10.6.1.1", Flows: []conntrack.Flow{{Proto: "tcp", Src: "10.21.0.5"}}}}
+	payload, err := json.Marshal(messages)
+	assert.NoError(t, err)
+
+	decoded, err := s.decode(bytes.NewReader(append(s.sign(payload), payload...)))
+	assert.NoError(t, err)
+	assert.Equal(t, messages, decoded)
+
+	// signed by another secret
+	other := &ctSync{secret: []byte("other")}
+	_, err = s.decode(bytes.NewReader(append(other.sign(payload), payload...)))
+	assert.Error(t, err)
+
+	// too short
+	_, err = s.decode(bytes.NewReader([]byte("short")))
+	assert.Error(t, err)
+
+	// too large
+	_, err = s.decode(bytes.NewReader(make([]byte, 32+maxCtSyncSize+1)))
+	assert.Error(t, err)
+}
+
+func TestCtSyncIsPeer(t *testing.T) {
+	s := &ctSync{peers: map[string]struct{}{"172.18.0.2": {}, "fc00::2": {}}}
+	assert.True(t, s.isPeer("172.18.0.2"))
+	assert.True(t, s.isPeer("fc00:0::2"))
+	assert.False(t, s.isPeer("172.18.0.3"))
+	assert.False(t, s.isPeer("invalid"))
+}
+
+func TestCtSyncHoldNil(t *testing.T) {
+	var s *ctSync
+	s.hold(map[string]string{"10.6.1.1": ""})
+}
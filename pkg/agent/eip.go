@@ -10,6 +10,7 @@ import (
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
@@ -29,7 +30,12 @@ type eip struct {
 	log    logr.Logger
 	cfg    *config.Config
 
-	announce *layer2.Announce
+	announce eipAnnouncer
+	// rescan makes the announcer scan the interfaces created for the EIPs
+	rescan   func()
+	vmac     *virtualMACs
+	liveness *peerLiveness
+	lease    *nodeLease
 }
 
 func (r *eip) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
@@ -44,6 +50,8 @@ func (r *eip) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.R
 		res, err = r.reconcileClusterPolicy(ctx, newReq, log)
 	case "EgressPolicy":
 		res, err = r.reconcilePolicy(ctx, newReq, log)
+	case "EgressTunnel", "Lease":
+		res, err = r.reconcileAllPolicies(ctx, newReq, log)
 	default:
 		return reconcile.Result{}, nil
 	}
@@ -66,28 +74,21 @@ func (r *eip) reconcilePolicy(ctx context.Context, req reconcile.Request, log lo
 	deleted = deleted || !policy.GetDeletionTimestamp().IsZero()
 
 	if deleted {
-		r.announce.DeleteBalancer(req.NamespacedName.String())
+		r.withdraw(req.NamespacedName.String())
 		return reconcile.Result{}, nil
 	}
 
-	if policy.Status.Node != r.cfg.NodeName {
-		r.announce.DeleteBalancer(req.NamespacedName.String())
-		return reconcile.Result{}, nil
-	}
-
-	ip := net.ParseIP(policy.Status.Eip.Ipv4)
-	if ip.To4() != nil {
-		adv := layer2.NewIPAdvertisement(ip, true, sets.Set[string]{})
-		r.announce.SetBalancer(req.NamespacedName.String(), adv)
+	node, err := r.holder(ctx, policy.Spec.EgressGatewayName, policy.Namespace, policy.Name, policy.Status.Node)
+	if err != nil {
+		return reconcile.Result{}, err
 	}
-
-	ip = net.ParseIP(policy.Status.Eip.Ipv6)
-	if ip.To16() != nil {
-		adv := layer2.NewIPAdvertisement(ip, true, sets.Set[string]{})
-		r.announce.SetBalancer(req.NamespacedName.String(), adv)
+	if node != r.cfg.NodeName || !r.lease.isHeld() {
+		r.withdraw(req.NamespacedName.String())
+		return reconcile.Result{}, nil
 	}
 
-	return reconcile.Result{}, nil
+	err = r.advertise(ctx, req.NamespacedName.String(), policy.Spec.EgressGatewayName, policy.Status.Eip)
+	return reconcile.Result{}, err
 }
 
 func (r *eip) reconcileClusterPolicy(ctx context.Context, req reconcile.Request, log logr.Logger) (reconcile.Result, error) {
@@ -106,35 +107,169 @@ func (r *eip) reconcileClusterPolicy(ctx context.Context, req reconcile.Request,
 	deleted = deleted || !policy.GetDeletionTimestamp().IsZero()
 
 	if deleted {
-		r.announce.DeleteBalancer(req.NamespacedName.String())
+		r.withdraw(req.NamespacedName.String())
 		return reconcile.Result{}, nil
 	}
 
-	if policy.Status.Node != r.cfg.NodeName {
-		r.announce.DeleteBalancer(req.NamespacedName.String())
+	node, err := r.holder(ctx, policy.Spec.EgressGatewayName, policy.Namespace, policy.Name, policy.Status.Node)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if node != r.cfg.NodeName || !r.lease.isHeld() {
+		r.withdraw(req.NamespacedName.String())
 		return reconcile.Result{}, nil
 	}
 
-	ip := net.ParseIP(policy.Status.Eip.Ipv4)
+	err = r.advertise(ctx, req.NamespacedName.String(), policy.Spec.EgressGatewayName, policy.Status.Eip)
+	return reconcile.Result{}, err
+}
+
+// advertise announces the EIPs of the policy. The EIPs of an uplink are configured and
+// announced on the link of the uplink, e.g. its VLAN sub-interface, and through their
+// virtual MAC interfaces on it if the virtual MAC is enabled
+func (r *eip) advertise(ctx context.Context, name, gatewayName string, status egressv1.Eip) error {
+	var eips []net.IP
+	ip := net.ParseIP(status.Ipv4)
 	if ip.To4() != nil {
-		adv := layer2.NewIPAdvertisement(ip, true, sets.Set[string]{})
-		r.announce.SetBalancer(req.NamespacedName.String(), adv)
+		eips = append(eips, ip)
 	}
-
-	ip = net.ParseIP(policy.Status.Eip.Ipv6)
+	ip = net.ParseIP(status.Ipv6)
 	if ip.To16() != nil {
-		adv := layer2.NewIPAdvertisement(ip, true, sets.Set[string]{})
-		r.announce.SetBalancer(req.NamespacedName.String(), adv)
+		eips = append(eips, ip)
+	}
+
+	gateway := new(egressv1.EgressGateway)
+	err := r.client.Get(ctx, types.NamespacedName{Name: gatewayName}, gateway)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	uplinks := make(map[string]string)
+	created := false
+	for _, eip := range eips {
+		uplink := eipUplink(gateway.Spec.Ippools, eip)
+		if uplink == nil {
+			continue
+		}
+		link := uplinkLinkName(*uplink)
+		if uplink.VlanID != 0 {
+			ok, err := ensureVlan(link, uplink.Interface, int(uplink.VlanID))
+			if err != nil {
+				r.log.Error(err, "failed to ensure vlan sub-interface", "policy", name, "interface", link)
+				continue
+			}
+			created = created || ok
+		}
+		uplinks[eip.String()] = link
+	}
+	// the announcer answers on the VLAN sub-interfaces after it scans them
+	if created && r.rescan != nil {
+		r.rescan()
+	}
+
+	links := make(map[string]string)
+	if r.vmac != nil {
+		links, err = r.vmac.set(name, gateway.Spec.Ippools, eips, uplinks)
+		if err != nil {
+			r.log.Error(err, "failed to bind virtual MAC", "policy", name)
+		}
+	}
+
+	for _, eip := range eips {
+		adv := layer2.NewIPAdvertisement(eip, true, sets.Set[string]{})
+		if link, ok := links[eip.String()]; ok {
+			adv = layer2.NewIPAdvertisement(eip, false, sets.New[string](link))
+		} else if link, ok := uplinks[eip.String()]; ok {
+			adv = layer2.NewIPAdvertisement(eip, false, sets.New[string](link))
+		}
+		r.announce.SetBalancer(name, adv)
+	}
+	return nil
+}
+
+// withdraw stops announcing the EIPs of the policy
+func (r *eip) withdraw(name string) {
+	r.announce.DeleteBalancer(name)
+	if r.vmac != nil {
+		r.vmac.release(name)
+	}
+}
+
+// holder returns the node which announces the EIP of the policy, the standby node
+// takes over the EIP once the agent of the node in the gateway status is dead.
+func (r *eip) holder(ctx context.Context, gatewayName, ns, name, statusNode string) (string, error) {
+	gateway := new(egressv1.EgressGateway)
+	err := r.client.Get(ctx, types.NamespacedName{Name: gatewayName}, gateway)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return statusNode, nil
+		}
+		return "", err
+	}
+	node, _ := r.liveness.policyHolder(gateway, ns, name)
+	if node == "" {
+		return statusNode, nil
+	}
+	return node, nil
+}
+
+// reconcileAllPolicies re-announces the EIPs when the liveness of a peer changes or
+// when the agent starts or stops holding the lease of the node
+func (r *eip) reconcileAllPolicies(ctx context.Context, req reconcile.Request, log logr.Logger) (reconcile.Result, error) {
+	log = log.WithValues("name", req.Name)
+	log.V(1).Info("reconcile")
+
+	policies := new(egressv1.EgressPolicyList)
+	if err := r.client.List(ctx, policies); err != nil {
+		return reconcile.Result{}, err
+	}
+	for _, item := range policies.Items {
+		policyReq := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: item.Namespace, Name: item.Name}}
+		if _, err := r.reconcilePolicy(ctx, policyReq, log); err != nil {
+			return reconcile.Result{}, err
+		}
 	}
 
+	clusterPolicies := new(egressv1.EgressClusterPolicyList)
+	if err := r.client.List(ctx, clusterPolicies); err != nil {
+		return reconcile.Result{}, err
+	}
+	for _, item := range clusterPolicies.Items {
+		policyReq := reconcile.Request{NamespacedName: types.NamespacedName{Name: item.Name}}
+		if _, err := r.reconcileClusterPolicy(ctx, policyReq, log); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
 	return reconcile.Result{}, nil
 }
 
 // newEipCtrl return a new egress ip controller
-func newEipCtrl(mgr manager.Manager, log logr.Logger, cfg *config.Config) error {
-	an, err := layer2.New(log, cfg.FileConfig.AnnounceExcludeRegexp)
-	if err != nil {
-		return err
+func newEipCtrl(mgr manager.Manager, log logr.Logger, cfg *config.Config, liveness *peerLiveness, lease *nodeLease) error {
+	if cfg.FileConfig.EipMode == config.EipModeNone {
+		return nil
+	}
+
+	var an eipAnnouncer
+	var rescan func()
+	var vmac *virtualMACs
+	if cfg.FileConfig.EipMode == config.EipModeInterfaceAddress {
+		addr := newEipAddress(mgr.GetClient(), log, cfg.NodeName, cfg.FileConfig.EipInterface,
+			mgr.GetEventRecorderFor("egress-agent"))
+		if err := mgr.Add(addr); err != nil {
+			return fmt.Errorf("failed to add eip address: %w", err)
+		}
+		an = addr
+	} else {
+		announce, err := layer2.New(log, cfg.FileConfig.AnnounceExcludeRegexp)
+		if err != nil {
+			return err
+		}
+		an = announce
+		rescan = announce.Rescan
+		vmac = newVirtualMACs(log, cfg.FileConfig.EipInterface, announce.Rescan)
+		if err := mgr.Add(vmac); err != nil {
+			return fmt.Errorf("failed to add virtual MAC: %w", err)
+		}
 	}
 
 	eip := &eip{
@@ -142,6 +277,10 @@ func newEipCtrl(mgr manager.Manager, log logr.Logger, cfg *config.Config) error
 		log:      log,
 		client:   mgr.GetClient(),
 		announce: an,
+		rescan:   rescan,
+		vmac:     vmac,
+		liveness: liveness,
+		lease:    lease,
 	}
 
 	c, err := controller.New("eip", mgr, controller.Options{Reconciler: eip})
@@ -159,5 +298,15 @@ func newEipCtrl(mgr manager.Manager, log logr.Logger, cfg *config.Config) error
 		return fmt.Errorf("failed to watch EgressClusterPolicy: %w", err)
 	}
 
+	if err := c.Watch(&source.Channel{Source: liveness.subscribe()},
+		handler.EnqueueRequestsFromMapFunc(utils.KindToMapFlat("EgressTunnel"))); err != nil {
+		return fmt.Errorf("failed to watch peer liveness: %w", err)
+	}
+
+	if err := c.Watch(&source.Channel{Source: lease.subscribe()},
+		handler.EnqueueRequestsFromMapFunc(utils.KindToMapFlat("Lease"))); err != nil {
+		return fmt.Errorf("failed to watch node lease: %w", err)
+	}
+
 	return nil
 }
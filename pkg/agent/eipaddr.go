@@ -0,0 +1,371 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/spidernet-io/egressgateway/pkg/agent/vxlan"
+	"github.com/spidernet-io/egressgateway/pkg/constant"
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/layer2"
+	"github.com/spidernet-io/egressgateway/pkg/utils/ip"
+)
+
+// errDuplicateAddress the duplicate address detection found the IPv6 EIP on another host
+var errDuplicateAddress = errors.New("duplicate address detected")
+
+// eipAnnouncer makes the EIPs held by this node reachable from the neighbours
+type eipAnnouncer interface {
+	SetBalancer(name string, adv layer2.IPAdvertisement)
+	DeleteBalancer(name string)
+}
+
+// eipAddress configures the EIPs held by this node as /32 or /128 addresses on the
+// interface, so the kernel answers ARP, NDP and ICMP of the EIPs. The address is
+// removed once the EIP moves to another node.
+type eipAddress struct {
+	client   client.Client
+	log      logr.Logger
+	node     string
+	recorder record.EventRecorder
+
+	getParent  func(version int) (*vxlan.Parent, error)
+	linkParent func(name string) (*vxlan.Parent, error)
+	addrList   func(index, family int) ([]netlink.Addr, error)
+	addrAdd    func(index int, addr *netlink.Addr) error
+	addrDel    func(index int, addr *netlink.Addr) error
+	gratuitous func(index int, ip net.IP) error
+	// dadTimeout limits the wait for the duplicate address detection of the IPv6 EIP
+	dadTimeout  time.Duration
+	dadInterval time.Duration
+
+	mu sync.Mutex
+	// ips is the EIPs of the policies
+	ips map[string][]string
+	// refcnt is the number of policies using the EIP
+	refcnt map[string]int
+	// links is the interface on which the EIP is configured
+	links map[string]int
+	// adding is the EIPs being added, the lock is not held while the duplicate address
+	// detection of the IPv6 EIP runs
+	adding map[string]struct{}
+}
+
+func newEipAddress(cli client.Client, log logr.Logger, node, intf string, recorder record.EventRecorder) *eipAddress {
+	netLink := vxlan.NetLink{
+		RouteListFiltered: netlink.RouteListFiltered,
+		LinkByIndex:       netlink.LinkByIndex,
+		AddrList:          netlink.AddrList,
+		LinkByName:        netlink.LinkByName,
+	}
+	getParent := vxlan.GetParentByDefaultRoute(netLink)
+	if intf != "" {
+		getParent = vxlan.GetParentByName(netLink, intf)
+	}
+	return &eipAddress{
+		client:      cli,
+		log:         log.WithName("eip-address"),
+		node:        node,
+		recorder:    recorder,
+		getParent:   getParent,
+		linkParent:  linkParent,
+		addrList:    addrListByIndex,
+		addrAdd:     addrReplaceByIndex,
+		addrDel:     addrDelByIndex,
+		gratuitous:  gratuitousByIndex,
+		dadTimeout:  5 * time.Second,
+		dadInterval: 100 * time.Millisecond,
+		ips:         make(map[string][]string),
+		refcnt:      make(map[string]int),
+		links:       make(map[string]int),
+		adding:      make(map[string]struct{}),
+	}
+}
+
+// SetBalancer configures the EIP of the policy on the interface of the advertisement, e.g.
+// the VLAN sub-interface of its uplink, or on the interface of the node. The address is
+// added without holding the lock, as the duplicate address detection takes seconds, the
+// address is removed at once if the EIP has been released in the meantime.
+func (a *eipAddress) SetBalancer(name string, adv layer2.IPAdvertisement) {
+	eip := adv.IP()
+	key := eip.String()
+
+	a.mu.Lock()
+	used := false
+	for _, item := range a.ips[name] {
+		if item == key {
+			used = true
+			break
+		}
+	}
+	if !used {
+		a.ips[name] = append(a.ips[name], key)
+		a.refcnt[key]++
+	}
+	// the address has been configured for another policy, or is being added, it is
+	// added again if the previous attempt failed
+	_, added := a.links[key]
+	_, adding := a.adding[key]
+	if added || adding {
+		a.mu.Unlock()
+		return
+	}
+	a.adding[key] = struct{}{}
+	a.mu.Unlock()
+
+	var intf string
+	if interfaces := adv.Interfaces(); len(interfaces) > 0 {
+		intf = interfaces[0]
+	}
+	index, err := a.addAddr(eip, intf)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.adding, key)
+	if err != nil {
+		a.log.Error(err, "failed to add eip address", "ip", key)
+		return
+	}
+	if a.refcnt[key] == 0 {
+		if err := a.addrDel(index, eipAddr(eip)); err != nil {
+			a.log.Error(err, "failed to delete eip address", "ip", key)
+		}
+		return
+	}
+	a.links[key] = index
+	a.log.Info("add eip address", "ip", key, "index", index)
+}
+
+// DeleteBalancer removes the EIPs of the policy which are not used by other policies
+func (a *eipAddress) DeleteBalancer(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	keys, ok := a.ips[name]
+	if !ok {
+		return
+	}
+	delete(a.ips, name)
+
+	for _, key := range keys {
+		a.refcnt[key]--
+		if a.refcnt[key] > 0 {
+			continue
+		}
+		delete(a.refcnt, key)
+		index, ok := a.links[key]
+		if !ok {
+			continue
+		}
+		delete(a.links, key)
+		if err := a.addrDel(index, eipAddr(net.ParseIP(key))); err != nil {
+			a.log.Error(err, "failed to delete eip address", "ip", key)
+			continue
+		}
+		a.log.Info("delete eip address", "ip", key, "index", index)
+	}
+}
+
+func (a *eipAddress) addAddr(eip net.IP, intf string) (int, error) {
+	version := 4
+	if eip.To4() == nil {
+		version = 6
+	}
+	var parent *vxlan.Parent
+	var err error
+	if intf != "" {
+		parent, err = a.linkParent(intf)
+	} else {
+		parent, err = a.getParent(version)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := a.addrAdd(parent.Index, eipAddr(eip)); err != nil {
+		return 0, fmt.Errorf("failed to add %s to %s: %w", eip, parent.Name, err)
+	}
+	if version == 6 {
+		if err := a.waitDAD(parent.Index, eip); err != nil {
+			if delErr := a.addrDel(parent.Index, eipAddr(eip)); delErr != nil {
+				a.log.Error(delErr, "failed to delete eip address", "ip", eip.String())
+			}
+			if errors.Is(err, errDuplicateAddress) {
+				a.recordConflict(eip, parent.Name)
+			}
+			return 0, fmt.Errorf("failed to add %s to %s: %w", eip, parent.Name, err)
+		}
+	}
+	if err := a.gratuitous(parent.Index, eip); err != nil {
+		a.log.V(1).Info("failed to send gratuitous advertisement", "ip", eip.String(), "error", err.Error())
+	}
+	return parent.Index, nil
+}
+
+// recordConflict records the EIPConflict event on the EgressTunnel of this node
+func (a *eipAddress) recordConflict(eip net.IP, intf string) {
+	tunnel := new(egressv1.EgressTunnel)
+	if err := a.client.Get(context.Background(), types.NamespacedName{Name: a.node}, tunnel); err != nil {
+		a.log.Error(err, "failed to get egress tunnel, skip recording the eip conflict", "ip", eip.String())
+		return
+	}
+	a.recorder.Eventf(tunnel, corev1.EventTypeWarning, egressv1.ReasonEIPConflict,
+		"EIP %s is used by another host on %s, duplicate address detection failed.", eip, intf)
+}
+
+// waitDAD waits for the duplicate address detection of the IPv6 EIP to finish, i.e. the
+// address is no longer tentative, it returns errDuplicateAddress if the detection failed
+func (a *eipAddress) waitDAD(index int, eip net.IP) error {
+	deadline := time.Now().Add(a.dadTimeout)
+	for {
+		addrs, err := a.addrList(index, netlink.FAMILY_V6)
+		if err != nil {
+			return fmt.Errorf("failed to list addresses: %w", err)
+		}
+		tentative := false
+		for _, addr := range addrs {
+			if addr.IPNet == nil || !addr.IP.Equal(eip) {
+				continue
+			}
+			if addr.Flags&unix.IFA_F_DADFAILED != 0 {
+				return errDuplicateAddress
+			}
+			tentative = addr.Flags&unix.IFA_F_TENTATIVE != 0
+		}
+		if !tentative {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("duplicate address detection timed out after %s", a.dadTimeout)
+		}
+		time.Sleep(a.dadInterval)
+	}
+}
+
+// Start removes the EIPs left on the interface by the previous agent, which may have
+// been moved to another node while the agent was restarting
+func (a *eipAddress) Start(ctx context.Context) error {
+	gateways := new(egressv1.EgressGatewayList)
+	if err := a.client.List(ctx, gateways); err != nil {
+		return fmt.Errorf("failed to list egress gateway: %w", err)
+	}
+	var ipv4Ranges, ipv6Ranges []string
+	for _, item := range gateways.Items {
+		ipv4Ranges = append(ipv4Ranges, item.Spec.Ippools.IPv4...)
+		ipv6Ranges = append(ipv6Ranges, item.Spec.Ippools.IPv6...)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, pool := range []struct {
+		version constant.IPVersion
+		family  int
+		ranges  []string
+	}{
+		{constant.IPv4, netlink.FAMILY_V4, ipv4Ranges},
+		{constant.IPv6, netlink.FAMILY_V6, ipv6Ranges},
+	} {
+		if len(pool.ranges) == 0 {
+			continue
+		}
+		parent, err := a.getParent(int(pool.version))
+		if err != nil {
+			a.log.V(1).Info("skip cleaning eip address", "version", pool.version, "error", err.Error())
+			continue
+		}
+		addrs, err := a.addrList(parent.Index, pool.family)
+		if err != nil {
+			return fmt.Errorf("failed to list addresses of %s: %w", parent.Name, err)
+		}
+		for _, stale := range staleEipAddrs(addrs, pool.version, pool.ranges, a.refcnt) {
+			a.log.Info("delete stale eip address", "ip", stale.IP.String(), "interface", parent.Name)
+			if err := a.addrDel(parent.Index, &stale); err != nil {
+				a.log.Error(err, "failed to delete stale eip address", "ip", stale.IP.String())
+			}
+		}
+	}
+	return nil
+}
+
+// staleEipAddrs returns the host addresses in the ippools which are not used by the policies
+func staleEipAddrs(addrs []netlink.Addr, version constant.IPVersion, ranges []string, used map[string]int) []netlink.Addr {
+	var res []netlink.Addr
+	for _, addr := range addrs {
+		if addr.IPNet == nil {
+			continue
+		}
+		ones, bits := addr.Mask.Size()
+		if ones != bits {
+			continue
+		}
+		if used[addr.IP.String()] > 0 {
+			continue
+		}
+		ok, err := ip.IsIPIncludedRange(version, addr.IP.String(), ranges)
+		if err != nil || !ok {
+			continue
+		}
+		res = append(res, addr)
+	}
+	return res
+}
+
+// eipAddr returns the host address of the EIP. The IPv6 EIP goes through duplicate address
+// detection, see waitDAD, and the address is deprecated so it is not selected as the source
+// address of the traffic of the node.
+func eipAddr(eip net.IP) *netlink.Addr {
+	if eip.To4() != nil {
+		return &netlink.Addr{IPNet: &net.IPNet{IP: eip, Mask: net.CIDRMask(32, 32)}}
+	}
+	return &netlink.Addr{
+		IPNet:       &net.IPNet{IP: eip, Mask: net.CIDRMask(128, 128)},
+		ValidLft:    0xffffffff,
+		PreferedLft: 0,
+	}
+}
+
+func addrListByIndex(index, family int) ([]netlink.Addr, error) {
+	link, err := netlink.LinkByIndex(index)
+	if err != nil {
+		return nil, err
+	}
+	return netlink.AddrList(link, family)
+}
+
+func addrReplaceByIndex(index int, addr *netlink.Addr) error {
+	link, err := netlink.LinkByIndex(index)
+	if err != nil {
+		return err
+	}
+	return netlink.AddrReplace(link, addr)
+}
+
+func addrDelByIndex(index int, addr *netlink.Addr) error {
+	link, err := netlink.LinkByIndex(index)
+	if err != nil {
+		return err
+	}
+	return netlink.AddrDel(link, addr)
+}
+
+func gratuitousByIndex(index int, eip net.IP) error {
+	ifi, err := net.InterfaceByIndex(index)
+	if err != nil {
+		return err
+	}
+	return layer2.Gratuitous(ifi, eip)
+}
@@ -0,0 +1,198 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/spidernet-io/egressgateway/pkg/agent/vxlan"
+	"github.com/spidernet-io/egressgateway/pkg/constant"
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/layer2"
+	"github.com/spidernet-io/egressgateway/pkg/schema"
+)
+
+type fakeEipLink struct {
+	addrs   map[string]int
+	addErr  error
+	added   int
+	deleted int
+	// flags returns the flags of the address after it is listed for the nth time
+	flags func(n int) int
+	lists int
+}
+
+func newFakeEipAddress(link *fakeEipLink) *eipAddress {
+	tunnel := &egressv1.EgressTunnel{ObjectMeta: metav1.ObjectMeta{Name: "node1", UID: "uid1"}}
+	return &eipAddress{
+		client:   fake.NewClientBuilder().WithScheme(schema.GetScheme()).WithObjects(tunnel).Build(),
+		log:      logr.Discard(),
+		node:     "node1",
+		recorder: record.NewFakeRecorder(10),
+		getParent: func(version int) (*vxlan.Parent, error) {
+			return &vxlan.Parent{Name: "eth0", Index: version}, nil
+		},
+		linkParent: func(name string) (*vxlan.Parent, error) {
+			return &vxlan.Parent{Name: name, Index: 100}, nil
+		},
+		addrAdd: func(index int, addr *netlink.Addr) error {
+			if link.addErr != nil {
+				return link.addErr
+			}
+			link.added++
+			link.addrs[addr.IPNet.String()] = index
+			return nil
+		},
+		addrDel: func(index int, addr *netlink.Addr) error {
+			link.deleted++
+			delete(link.addrs, addr.IPNet.String())
+			return nil
+		},
+		addrList: func(index, family int) ([]netlink.Addr, error) {
+			link.lists++
+			var res []netlink.Addr
+			for key := range link.addrs {
+				ip, ipNet, _ := net.ParseCIDR(key)
+				ipNet.IP = ip
+				flags := 0
+				if link.flags != nil {
+					flags = link.flags(link.lists)
+				}
+				res = append(res, netlink.Addr{IPNet: ipNet, Flags: flags})
+			}
+			return res, nil
+		},
+		gratuitous:  func(index int, ip net.IP) error { return nil },
+		dadTimeout:  time.Second,
+		dadInterval: time.Millisecond,
+		ips:         make(map[string][]string),
+		refcnt:      make(map[string]int),
+		links:       make(map[string]int),
+		adding:      make(map[string]struct{}),
+	}
+}
+
+func TestEipAddress(t *testing.T) {
+	link := &fakeEipLink{addrs: make(map[string]int)}
+	a := newFakeEipAddress(link)
+
+	ipv4 := layer2.NewIPAdvertisement(net.ParseIP("10.6.1.21"), true, sets.Set[string]{})
+	ipv6 := layer2.NewIPAdvertisement(net.ParseIP("fd00::21"), true, sets.Set[string]{})
+
+	a.SetBalancer("default/p1", ipv4)
+	a.SetBalancer("default/p1", ipv6)
+	a.SetBalancer("default/p1", ipv4)
+	a.SetBalancer("default/p2", ipv4)
+	assert.Equal(t, map[string]int{"10.6.1.21/32": 4, "fd00::21/128": 6}, link.addrs)
+	assert.Equal(t, 2, link.added)
+
+	// the EIP is still used by p2
+	a.DeleteBalancer("default/p1")
+	assert.Equal(t, map[string]int{"10.6.1.21/32": 4}, link.addrs)
+
+	a.DeleteBalancer("default/p2")
+	a.DeleteBalancer("default/p2")
+	assert.Empty(t, link.addrs)
+	assert.Equal(t, 2, link.deleted)
+}
+
+func TestEipAddressOnUplink(t *testing.T) {
+	link := &fakeEipLink{addrs: make(map[string]int)}
+	a := newFakeEipAddress(link)
+
+	// the EIP of a VLAN uplink is configured on the VLAN sub-interface
+	adv := layer2.NewIPAdvertisement(net.ParseIP("10.7.1.21"), false, sets.New[string]("eth0.100"))
+	a.SetBalancer("default/p1", adv)
+	assert.Equal(t, map[string]int{"10.7.1.21/32": 100}, link.addrs)
+}
+
+func TestEipAddressRetry(t *testing.T) {
+	link := &fakeEipLink{addrs: make(map[string]int), addErr: errors.New("no such device")}
+	a := newFakeEipAddress(link)
+
+	adv := layer2.NewIPAdvertisement(net.ParseIP("10.6.1.21"), true, sets.Set[string]{})
+	a.SetBalancer("default/p1", adv)
+	assert.Empty(t, link.addrs)
+
+	link.addErr = nil
+	a.SetBalancer("default/p1", adv)
+	assert.Equal(t, map[string]int{"10.6.1.21/32": 4}, link.addrs)
+	assert.Equal(t, 1, a.refcnt["10.6.1.21"])
+}
+
+func TestStaleEipAddrs(t *testing.T) {
+	addr := func(s string) netlink.Addr {
+		ipn, err := netlink.ParseIPNet(s)
+		assert.NoError(t, err)
+		return netlink.Addr{IPNet: ipn}
+	}
+	addrs := []netlink.Addr{
+		addr("10.6.0.10/16"),
+		addr("10.6.1.21/32"),
+		addr("10.6.1.22/32"),
+		addr("10.7.1.21/32"),
+	}
+	got := staleEipAddrs(addrs, constant.IPv4, []string{"10.6.1.20-10.6.1.30"}, map[string]int{"10.6.1.22": 1})
+	assert.Equal(t, []netlink.Addr{addr("10.6.1.21/32")}, got)
+}
+
+func TestEipAddressDAD(t *testing.T) {
+	adv := layer2.NewIPAdvertisement(net.ParseIP("fd00::21"), true, sets.Set[string]{})
+
+	// the address is tentative until the detection finishes
+	link := &fakeEipLink{addrs: make(map[string]int), flags: func(n int) int {
+		if n < 3 {
+			return unix.IFA_F_TENTATIVE
+		}
+		return 0
+	}}
+	a := newFakeEipAddress(link)
+	a.SetBalancer("default/p1", adv)
+	assert.Equal(t, map[string]int{"fd00::21/128": 6}, link.addrs)
+	assert.Equal(t, 3, link.lists)
+	assert.Equal(t, 6, a.links["fd00::21"])
+
+	// the address is used by another host
+	link = &fakeEipLink{addrs: make(map[string]int), flags: func(int) int {
+		return unix.IFA_F_TENTATIVE | unix.IFA_F_DADFAILED
+	}}
+	a = newFakeEipAddress(link)
+	a.SetBalancer("default/p1", adv)
+	assert.Empty(t, link.addrs)
+	assert.NotContains(t, a.links, "fd00::21")
+	recorder := a.recorder.(*record.FakeRecorder)
+	assert.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, egressv1.ReasonEIPConflict)
+
+	// the EIP is released while the detection runs
+	link = &fakeEipLink{addrs: make(map[string]int)}
+	a = newFakeEipAddress(link)
+	link.flags = func(int) int {
+		a.DeleteBalancer("default/p1")
+		return 0
+	}
+	a.SetBalancer("default/p1", adv)
+	assert.Empty(t, link.addrs)
+	assert.NotContains(t, a.links, "fd00::21")
+
+	// the detection does not finish in time
+	link = &fakeEipLink{addrs: make(map[string]int), flags: func(int) int { return unix.IFA_F_TENTATIVE }}
+	a = newFakeEipAddress(link)
+	a.dadTimeout = 10 * time.Millisecond
+	a.SetBalancer("default/p1", adv)
+	assert.Empty(t, link.addrs)
+	assert.NotContains(t, a.links, "fd00::21")
+}
@@ -0,0 +1,134 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/spidernet-io/egressgateway/pkg/iptables"
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+const (
+	// blockChain blocks the traffic of the pods in the FORWARD chain of the filter table,
+	// for the policies whose failurePolicy is closed while they have no gateway node
+	blockChain = "EGRESSGATEWAY-BLOCK"
+	// blockHostChain blocks the host network traffic of the nodes in the OUTPUT chain
+	blockHostChain = "EGRESSGATEWAY-BLOCK-HOST"
+)
+
+// listClosedPolicies returns the policies whose failurePolicy is closed, the value is true
+// when their traffic is rejected instead of dropped
+func (r *policeReconciler) listClosedPolicies(ctx context.Context) (map[egressv1.Policy]bool, error) {
+	res := make(map[egressv1.Policy]bool)
+
+	policies := new(egressv1.EgressPolicyList)
+	if err := r.client.List(ctx, policies); err != nil {
+		return nil, fmt.Errorf("failed to list EgressPolicy: %w", err)
+	}
+	for _, item := range policies.Items {
+		if item.Spec.FailurePolicy == egressv1.FailurePolicyClosed && item.DeletionTimestamp.IsZero() {
+			res[egressv1.Policy{Name: item.Name, Namespace: item.Namespace}] = item.Spec.FailureAction == egressv1.FailureActionReject
+		}
+	}
+
+	clusterPolicies := new(egressv1.EgressClusterPolicyList)
+	if err := r.client.List(ctx, clusterPolicies); err != nil {
+		return nil, fmt.Errorf("failed to list EgressClusterPolicy: %w", err)
+	}
+	for _, item := range clusterPolicies.Items {
+		if item.Spec.FailurePolicy == egressv1.FailurePolicyClosed && item.DeletionTimestamp.IsZero() {
+			res[egressv1.Policy{Name: item.Name}] = item.Spec.FailureAction == egressv1.FailureActionReject
+		}
+	}
+	return res, nil
+}
+
+// isFailurePolicyChanged is true when the failurePolicy or the failureAction of the policy
+// differs from the applied rules
+func (r *policeReconciler) isFailurePolicyChanged(policy egressv1.Policy, failurePolicy, failureAction string) bool {
+	reject, ok := r.closedPolicies[policy]
+	if failurePolicy != egressv1.FailurePolicyClosed {
+		return ok
+	}
+	return !ok || reject != (failureAction == egressv1.FailureActionReject)
+}
+
+// getBlockedHostTraffic returns the host network traffic of the closed EgressClusterPolicy which
+// is blocked on this node. It is nil when the policy does not filter the host network traffic
+// by the processes, as blocking all the host network traffic cuts the node off, or when this
+// node is a member of the EgressGateway of the policy.
+func (r *policeReconciler) getBlockedHostTraffic(ctx context.Context, policy egressv1.Policy,
+	gateways *egressv1.EgressGatewayList) (*egressv1.HostTraffic, error) {
+
+	if policy.Namespace != "" {
+		return nil, nil
+	}
+	obj := new(egressv1.EgressClusterPolicy)
+	if err := r.client.Get(ctx, types.NamespacedName{Name: policy.Name}, obj); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	traffic := hostTrafficOf(obj)
+	if traffic == nil || (len(traffic.UIDs) == 0 && len(traffic.CgroupPaths) == 0) {
+		return nil, nil
+	}
+
+	for _, gateway := range gateways.Items {
+		if gateway.Name != obj.Spec.EgressGatewayName {
+			continue
+		}
+		for _, item := range gateway.Status.NodeList {
+			if item.Name == r.cfg.NodeName {
+				return nil, nil
+			}
+		}
+		if gateway.Spec.NodeSelector.Selector == nil {
+			break
+		}
+		selector, err := metav1.LabelSelectorAsSelector(gateway.Spec.NodeSelector.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the node selector of gateway %s: %w", gateway.Name, err)
+		}
+		node := new(corev1.Node)
+		if err := r.client.Get(ctx, types.NamespacedName{Name: r.cfg.NodeName}, node); err != nil {
+			return nil, fmt.Errorf("failed to get node %s: %w", r.cfg.NodeName, err)
+		}
+		if selector.Matches(labels.Set(node.Labels)) {
+			return nil, nil
+		}
+	}
+	return traffic, nil
+}
+
+// buildBlockRules returns the rules blocking the traffic of the policy from the pods, and the
+// rules blocking the host network traffic of the nodes when hostTraffic is not nil
+func buildBlockRules(policyName string, version uint8, isIgnoreInternalCIDR bool, reject bool,
+	hostTraffic *egressv1.HostTraffic) ([]iptables.Rule, []iptables.Rule) {
+
+	var action iptables.Action = iptables.DropAction{}
+	if reject {
+		action = iptables.RejectAction{}
+	}
+	comment := []string{fmt.Sprintf("Block the traffic of policy %s without gateway node", policyName)}
+
+	rules := []iptables.Rule{{
+		Match:   policyMatch(policyName, version, isIgnoreInternalCIDR),
+		Action:  action,
+		Comment: comment,
+	}}
+	hostRules := make([]iptables.Rule, 0)
+	if hostTraffic != nil {
+		for _, match := range hostTrafficMatches(policyName, version, isIgnoreInternalCIDR, hostTraffic) {
+			hostRules = append(hostRules, iptables.Rule{Match: match, Action: action, Comment: comment})
+		}
+	}
+	return rules, hostRules
+}
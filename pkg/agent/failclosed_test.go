@@ -0,0 +1,114 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/spidernet-io/egressgateway/pkg/config"
+	"github.com/spidernet-io/egressgateway/pkg/iptables"
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/schema"
+)
+
+func TestBuildBlockRules(t *testing.T) {
+	rules, hostRules := buildBlockRules("default-p1", 4, true, false, nil)
+	assert.Len(t, rules, 1)
+	assert.Empty(t, hostRules)
+	assert.Equal(t, policyMatch("default-p1", 4, true), rules[0].Match)
+	assert.Equal(t, iptables.DropAction{}, rules[0].Action)
+
+	traffic := &egressv1.HostTraffic{UIDs: []int64{1000}, CgroupPaths: []string{"system.slice/backup.service"}}
+	rules, hostRules = buildBlockRules("p1", 6, false, true, traffic)
+	assert.Len(t, rules, 1)
+	assert.Equal(t, iptables.RejectAction{}, rules[0].Action)
+	assert.Len(t, hostRules, 2)
+	for i, match := range hostTrafficMatches("p1", 6, false, traffic) {
+		assert.Equal(t, match, hostRules[i].Match)
+		assert.Equal(t, iptables.RejectAction{}, hostRules[i].Action)
+	}
+}
+
+func TestGetBlockedHostTraffic(t *testing.T) {
+	gatewayNodes := map[string]string{"egress": "true"}
+	objs := []client.Object{
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2", Labels: gatewayNodes}},
+		&egressv1.EgressClusterPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "all"},
+			Spec: egressv1.EgressClusterPolicySpec{EgressGatewayName: "egw",
+				AppliedTo: egressv1.ClusterAppliedTo{NodeSelector: &metav1.LabelSelector{}}},
+		},
+		&egressv1.EgressClusterPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup"},
+			Spec: egressv1.EgressClusterPolicySpec{EgressGatewayName: "egw",
+				AppliedTo: egressv1.ClusterAppliedTo{NodeSelector: &metav1.LabelSelector{},
+					HostTraffic: &egressv1.HostTraffic{UIDs: []int64{1000}}}},
+		},
+	}
+	cli := fake.NewClientBuilder().WithScheme(schema.GetScheme()).WithObjects(objs...).Build()
+	gateways := &egressv1.EgressGatewayList{Items: []egressv1.EgressGateway{{
+		ObjectMeta: metav1.ObjectMeta{Name: "egw"},
+		Spec: egressv1.EgressGatewaySpec{NodeSelector: egressv1.NodeSelector{
+			Selector: &metav1.LabelSelector{MatchLabels: gatewayNodes}}},
+	}}}
+
+	cases := map[string]struct {
+		node   string
+		policy egressv1.Policy
+		expect *egressv1.HostTraffic
+	}{
+		"EgressPolicy": {
+			node:   "node1",
+			policy: egressv1.Policy{Name: "backup", Namespace: "default"},
+		},
+		"all the host traffic is not blocked": {
+			node:   "node1",
+			policy: egressv1.Policy{Name: "all"},
+		},
+		"the traffic of the processes is blocked": {
+			node:   "node1",
+			policy: egressv1.Policy{Name: "backup"},
+			expect: &egressv1.HostTraffic{UIDs: []int64{1000}},
+		},
+		"the gateway node is not blocked": {
+			node:   "node2",
+			policy: egressv1.Policy{Name: "backup"},
+		},
+		"not found": {
+			node:   "node1",
+			policy: egressv1.Policy{Name: "unknown"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.NodeName = c.node
+			r := &policeReconciler{client: cli, cfg: cfg}
+			traffic, err := r.getBlockedHostTraffic(context.Background(), c.policy, gateways)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expect, traffic)
+		})
+	}
+}
+
+func TestIsFailurePolicyChanged(t *testing.T) {
+	policy := egressv1.Policy{Name: "p1", Namespace: "default"}
+	r := &policeReconciler{}
+	assert.False(t, r.isFailurePolicyChanged(policy, "", ""))
+	assert.False(t, r.isFailurePolicyChanged(policy, egressv1.FailurePolicyOpen, egressv1.FailureActionDrop))
+	assert.True(t, r.isFailurePolicyChanged(policy, egressv1.FailurePolicyClosed, egressv1.FailureActionDrop))
+
+	r.closedPolicies = map[egressv1.Policy]bool{policy: false}
+	assert.False(t, r.isFailurePolicyChanged(policy, egressv1.FailurePolicyClosed, egressv1.FailureActionDrop))
+	assert.True(t, r.isFailurePolicyChanged(policy, egressv1.FailurePolicyClosed, egressv1.FailureActionReject))
+	assert.True(t, r.isFailurePolicyChanged(policy, egressv1.FailurePolicyOpen, egressv1.FailureActionDrop))
+}
@@ -0,0 +1,130 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/spidernet-io/egressgateway/pkg/iptables"
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+// hostMarkChain marks the host network traffic of the node in the OUTPUT chain, the marked
+// traffic is sent to the EgressGateway through the tunnel like the traffic of the pods
+const hostMarkChain = "EGRESSGATEWAY-MARK-HOST"
+
+// getHostTraffic returns the filter of the host network traffic of the EgressClusterPolicy,
+// it is nil when the policy does not select the host network traffic of the nodes
+func (r *policeReconciler) getHostTraffic(policy egressv1.Policy) (*egressv1.HostTraffic, error) {
+	if policy.Namespace != "" {
+		return nil, nil
+	}
+	obj := new(egressv1.EgressClusterPolicy)
+	if err := r.client.Get(context.Background(), types.NamespacedName{Name: policy.Name}, obj); err != nil {
+		if apierr.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return hostTrafficOf(obj), nil
+}
+
+func hostTrafficOf(policy *egressv1.EgressClusterPolicy) *egressv1.HostTraffic {
+	if policy.Spec.AppliedTo.NodeSelector == nil {
+		return nil
+	}
+	if policy.Spec.AppliedTo.HostTraffic == nil {
+		return &egressv1.HostTraffic{}
+	}
+	return policy.Spec.AppliedTo.HostTraffic
+}
+
+// isHostTrafficChanged is true when the host network traffic of the policy differs from the
+// applied rules
+func (r *policeReconciler) isHostTrafficChanged(policy *egressv1.EgressClusterPolicy) bool {
+	applied, ok := r.hostPolicies[policy.Name]
+	traffic := hostTrafficOf(policy)
+	if traffic == nil {
+		return ok
+	}
+	return !ok || !reflect.DeepEqual(applied, *traffic)
+}
+
+// buildHostSkipRules returns the rules at the head of the host chains, they skip the traffic
+// of the tunnel, which is sent from the node IP to the gateway nodes, and the traffic which
+// has been marked, e.g. the traffic of the pods going to the tunnel
+func buildHostSkipRules(vxlanName string, vxlanPort int) []iptables.Rule {
+	rules := []iptables.Rule{{
+		Match:   iptables.MatchCriteria{}.OutInterface(vxlanName),
+		Action:  iptables.ReturnAction{},
+		Comment: []string{"Skip the traffic going to the EgressTunnel"},
+	}, {
+		Match:   iptables.MatchCriteria{}.Protocol("udp").DestPorts(uint16(vxlanPort)),
+		Action:  iptables.ReturnAction{},
+		Comment: []string{"Skip the VXLAN traffic of the EgressTunnel"},
+	}, {
+		Match:   iptables.MatchCriteria{}.NotMarkMatchesWithMask(0, policyMarkMask),
+		Action:  iptables.ReturnAction{},
+		Comment: []string{"Skip the traffic marked by the policies"},
+	}}
+	return rules
+}
+
+// buildHostPolicyRules returns the rules marking the host network traffic of the policy. The
+// source ipset of the policy has the IPs of the node when the node is selected, the traffic
+// to the cluster is skipped, the traffic of the tunnel is skipped by buildHostSkipRules.
+func buildHostPolicyRules(policyName string, mark uint32, version uint8, isIgnoreInternalCIDR bool, traffic *egressv1.HostTraffic) []iptables.Rule {
+	matches := hostTrafficMatches(policyName, version, isIgnoreInternalCIDR, traffic)
+	rules := make([]iptables.Rule, 0, len(matches))
+	for _, match := range matches {
+		rules = append(rules, iptables.Rule{
+			Match:  match,
+			Action: iptables.SetMaskedMarkAction{Mark: mark, Mask: 0xffffffff},
+			Comment: []string{
+				fmt.Sprintf("Set mark for the host traffic of EgressClusterPolicy %s", policyName),
+			},
+		})
+	}
+	return rules
+}
+
+// hostTrafficMatches returns the match criteria of the host network traffic of the policy,
+// one for each user and cgroup of the processes
+func hostTrafficMatches(policyName string, version uint8, isIgnoreInternalCIDR bool, traffic *egressv1.HostTraffic) []iptables.MatchCriteria {
+	tmp := "v4-"
+	ignoreInternalCIDRName := EgressClusterCIDRIPv4
+	if version == 6 {
+		tmp = "v6-"
+		ignoreInternalCIDRName = EgressClusterCIDRIPv6
+	}
+	srcName := formatIPSetName("egress-src-"+tmp, policyName)
+	dstName := formatIPSetName(dstListIPSetPrefix+tmp, policyName)
+	excName := formatIPSetName("egress-exc-"+tmp, policyName)
+
+	base := iptables.MatchCriteria{}.SourceIPSet(srcName)
+	if !isIgnoreInternalCIDR {
+		base = base.DestIPSet(dstName)
+	}
+	base = base.NotDestIPSet(ignoreInternalCIDRName).NotDestIPSet(excName).
+		CTDirectionOriginal(iptables.DirectionOriginal)
+
+	matches := make([]iptables.MatchCriteria, 0)
+	if traffic != nil {
+		for _, uid := range traffic.UIDs {
+			matches = append(matches, append(iptables.MatchCriteria{}, base...).OwnerUID(uid))
+		}
+		for _, path := range traffic.CgroupPaths {
+			matches = append(matches, append(iptables.MatchCriteria{}, base...).CgroupPath(path))
+		}
+	}
+	if len(matches) == 0 {
+		matches = append(matches, base)
+	}
+	return matches
+}
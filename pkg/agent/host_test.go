@@ -0,0 +1,84 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/spidernet-io/egressgateway/pkg/iptables"
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+func TestBuildHostPolicyRules(t *testing.T) {
+	cases := map[string]struct {
+		traffic *egressv1.HostTraffic
+		expect  []string
+	}{
+		"all host traffic": {
+			traffic: &egressv1.HostTraffic{},
+			expect:  []string{""},
+		},
+		"users and cgroups": {
+			traffic: &egressv1.HostTraffic{UIDs: []int64{0, 1000}, CgroupPaths: []string{"system.slice/backup.service"}},
+			expect: []string{
+				" -m owner --uid-owner 0",
+				" -m owner --uid-owner 1000",
+				" -m cgroup --path system.slice/backup.service",
+			},
+		},
+	}
+	base := fmt.Sprintf("-m set --match-set %s src -m set --match-set %s dst "+
+		"-m set ! --match-set %s dst -m set ! --match-set %s dst -m conntrack --ctdir ORIGINAL",
+		formatIPSetName("egress-src-v4-", "p1"), formatIPSetName(dstListIPSetPrefix+"v4-", "p1"),
+		EgressClusterCIDRIPv4, formatIPSetName("egress-exc-v4-", "p1"))
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			rules := buildHostPolicyRules("p1", 0x26000001, 4, false, c.traffic)
+			matches := make([]string, 0, len(rules))
+			for _, rule := range rules {
+				matches = append(matches, rule.Match.Render())
+			}
+			expect := make([]string, 0, len(c.expect))
+			for _, item := range c.expect {
+				expect = append(expect, base+item)
+			}
+			assert.Equal(t, expect, matches)
+		})
+	}
+}
+
+func TestBuildHostSkipRules(t *testing.T) {
+	matches := make([]string, 0)
+	for _, rule := range buildHostSkipRules("egress.vxlan", 7789) {
+		assert.Equal(t, iptables.ReturnAction{}, rule.Action)
+		matches = append(matches, rule.Match.Render())
+	}
+	assert.Equal(t, []string{
+		"--out-interface egress.vxlan",
+		"-p udp -m multiport --destination-ports 7789",
+		"-m mark ! --mark 0x0/0xff000000",
+	}, matches)
+}
+
+func TestIsHostTrafficChanged(t *testing.T) {
+	policy := &egressv1.EgressClusterPolicy{ObjectMeta: metav1.ObjectMeta{Name: "p1"}}
+	r := &policeReconciler{}
+	assert.False(t, r.isHostTrafficChanged(policy))
+
+	policy.Spec.AppliedTo.NodeSelector = &metav1.LabelSelector{}
+	assert.True(t, r.isHostTrafficChanged(policy))
+
+	r.hostPolicies = map[string]egressv1.HostTraffic{"p1": {}}
+	assert.False(t, r.isHostTrafficChanged(policy))
+
+	policy.Spec.AppliedTo.HostTraffic = &egressv1.HostTraffic{UIDs: []int64{1000}}
+	assert.True(t, r.isHostTrafficChanged(policy))
+
+	policy.Spec.AppliedTo.NodeSelector = nil
+	assert.True(t, r.isHostTrafficChanged(policy))
+}
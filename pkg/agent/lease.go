@@ -0,0 +1,161 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/spidernet-io/egressgateway/pkg/config"
+	"github.com/spidernet-io/egressgateway/pkg/lease"
+)
+
+// nodeLease renews the lease of the node, the agent fences itself when it can not renew
+// the lease before it expires: it stops announcing the EIPs and withdraws the SNAT rules,
+// the controller only moves the EIPs of the node after the lease has expired.
+type nodeLease struct {
+	client   client.Client
+	reader   client.Reader
+	log      logr.Logger
+	key      types.NamespacedName
+	node     string
+	enable   bool
+	duration time.Duration
+
+	current     *coordinationv1.Lease
+	renewTime   atomic.Int64
+	held        atomic.Bool
+	subscribers []chan event.GenericEvent
+}
+
+func newNodeLease(mgr manager.Manager, cfg *config.Config, log logr.Logger) (*nodeLease, error) {
+	l := &nodeLease{
+		client:   mgr.GetClient(),
+		reader:   mgr.GetAPIReader(),
+		log:      log.WithName("lease"),
+		key:      types.NamespacedName{Namespace: cfg.FileConfig.GatewayFailover.LeaseNamespace, Name: lease.Name(cfg.NodeName)},
+		node:     cfg.NodeName,
+		enable:   cfg.FileConfig.GatewayFailover.Enable,
+		duration: time.Second * time.Duration(cfg.FileConfig.GatewayFailover.LeaseDuration),
+	}
+	if err := mgr.Add(l); err != nil {
+		return nil, fmt.Errorf("failed to add node lease: %w", err)
+	}
+	return l, nil
+}
+
+// subscribe returns a channel which receives the lease when the agent starts or stops
+// holding it, it must be called before the manager starts.
+func (l *nodeLease) subscribe() <-chan event.GenericEvent {
+	ch := make(chan event.GenericEvent, 16)
+	l.subscribers = append(l.subscribers, ch)
+	return ch
+}
+
+// isHeld reports whether the agent holds the lease of the node, it is always true
+// when the gateway failover is disabled, as the EIPs are never moved.
+func (l *nodeLease) isHeld() bool {
+	if l == nil || !l.enable {
+		return true
+	}
+	return l.held.Load()
+}
+
+func (l *nodeLease) Start(ctx context.Context) error {
+	if !l.enable {
+		return nil
+	}
+	l.log.Info("start renewing lease", "lease", l.key.String(), "duration", l.duration)
+	ticker := time.NewTicker(l.duration / 3)
+	defer ticker.Stop()
+	for {
+		if err := l.renew(ctx); err != nil {
+			l.log.Error(err, "failed to renew lease")
+		}
+		l.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *nodeLease) renew(ctx context.Context) error {
+	// the renew time is taken before the request, so the agent always considers the
+	// lease expired before the controller does
+	now := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, l.duration/3)
+	defer cancel()
+
+	if l.current == nil {
+		current := new(coordinationv1.Lease)
+		err := l.reader.Get(ctx, l.key, current)
+		if err != nil {
+			if !apierr.IsNotFound(err) {
+				return err
+			}
+			current = &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{Namespace: l.key.Namespace, Name: l.key.Name},
+			}
+		}
+		l.current = current
+	}
+
+	current := l.current.DeepCopy()
+	current.Spec.HolderIdentity = ptr.To(l.node)
+	current.Spec.LeaseDurationSeconds = ptr.To(int32(l.duration / time.Second))
+	current.Spec.RenewTime = &metav1.MicroTime{Time: now}
+
+	var err error
+	if current.ResourceVersion == "" {
+		err = l.client.Create(ctx, current)
+	} else {
+		err = l.client.Update(ctx, current)
+	}
+	if err != nil {
+		// get the latest lease on the next renewal
+		l.current = nil
+		return err
+	}
+	l.current = current
+	l.renewTime.Store(now.UnixNano())
+	return nil
+}
+
+func (l *nodeLease) check(ctx context.Context) {
+	// the check runs once per renewal period, give up the lease one period before it
+	// expires, so the agent is fenced before the controller moves the EIPs
+	period := l.duration / 3
+	held := time.Since(time.Unix(0, l.renewTime.Load())) < l.duration-period
+	if l.held.Swap(held) == held {
+		return
+	}
+	if held {
+		l.log.Info("lease acquired", "lease", l.key.String())
+	} else {
+		l.log.Info("lease expired, withdraw the EIPs of the node", "lease", l.key.String())
+	}
+	obj := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Namespace: l.key.Namespace, Name: l.key.Name}}
+	for _, ch := range l.subscribers {
+		select {
+		case ch <- event.GenericEvent{Object: obj}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
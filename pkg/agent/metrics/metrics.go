@@ -5,6 +5,7 @@ package metrics
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spidernet-io/egressgateway/pkg/conntrack"
 	"github.com/spidernet-io/egressgateway/pkg/iptables"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
@@ -12,6 +13,7 @@ import (
 func RegisterMetricCollectors() {
 	var metricCollectors []prometheus.Collector
 	metricCollectors = append(metricCollectors, iptables.MetricCollectors()...)
+	metricCollectors = append(metricCollectors, conntrack.MetricCollectors()...)
 	for _, collector := range metricCollectors {
 		metrics.Registry.MustRegister(collector)
 	}
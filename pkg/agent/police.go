@@ -10,17 +10,23 @@ import (
 	"fmt"
 	"net"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/spidernet-io/egressgateway/pkg/agent/route"
 	"github.com/spidernet-io/egressgateway/pkg/config"
+	"github.com/spidernet-io/egressgateway/pkg/conntrack"
 	"github.com/spidernet-io/egressgateway/pkg/ipset"
 	"github.com/spidernet-io/egressgateway/pkg/iptables"
 	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/portblock"
+	"github.com/spidernet-io/egressgateway/pkg/schedule"
 	"github.com/spidernet-io/egressgateway/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
 	apierr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -38,6 +44,11 @@ import (
 const (
 	EgressClusterCIDRIPv4 = "egress-cluster-cidr-ipv4"
 	EgressClusterCIDRIPv6 = "egress-cluster-cidr-ipv6"
+
+	dstListIPSetPrefix = "egress-dsl-"
+
+	// policyMarkMask the bits of the packet mark and the connmark owned by the policies
+	policyMarkMask = 0xff000000
 )
 
 type policeReconciler struct {
@@ -54,6 +65,21 @@ type policeReconciler struct {
 	filterTables  []*iptables.Table
 	natTables     []*iptables.Table
 	policyMapNode *utils.SyncMap[egressv1.Policy, string]
+	liveness      *peerLiveness
+	lease         *nodeLease
+	ctSync        *ctSync
+	snatUsage     *snatUsage
+	datapaths     map[egressv1.Policy]policyDatapath
+	deleteFlows   func(filter *conntrack.Filter) (uint, error)
+	ruleRoute     *route.RuleRoute
+	uplinkTables  map[int]struct{}
+	// hostPolicies the host network traffic of the EgressClusterPolicies in the applied rules
+	hostPolicies map[string]egressv1.HostTraffic
+	// inactivePolicies the policies out of the windows of their schedules in the applied rules
+	inactivePolicies map[egressv1.Policy]bool
+	// closedPolicies the policies whose failurePolicy is closed in the applied rules, the
+	// value is true when their traffic is rejected
+	closedPolicies map[egressv1.Policy]bool
 }
 
 func (r *policeReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
@@ -73,7 +99,7 @@ func (r *policeReconciler) Reconcile(ctx context.Context, req reconcile.Request)
 	log := r.log.WithValues("kind", kind)
 	var res reconcile.Result
 	switch kind {
-	case "EgressGateway":
+	case "EgressGateway", "EgressTunnel", "Lease", "EgressCIDRGroup":
 		res, err = r.reconcileGateway(ctx, newReq, log)
 	case "EgressClusterPolicy":
 		res, err = r.reconcileClusterPolicy(ctx, newReq, log)
@@ -90,7 +116,22 @@ func (r *policeReconciler) Reconcile(ctx context.Context, req reconcile.Request)
 type PolicyCommon struct {
 	NodeName   string
 	DestSubnet []string
-	IP         IP
+	// DestCIDRGroups the EgressCIDRGroups of the destinations
+	DestCIDRGroups []string
+	IP             IP
+	Uplink         *egressv1.EipUplink
+	// SnatPorts the source port range of the SNAT rules
+	SnatPorts string
+	// PortBlocks the source ports of the EIP allocated to the source IPs
+	PortBlocks []portblock.Block
+	// HostTraffic the host network traffic of the nodes selected by the EgressClusterPolicy
+	HostTraffic *egressv1.HostTraffic
+}
+
+// isIgnoreInternalCIDR is true when the policy has no destination, then it matches the
+// traffic to the outside of the cluster
+func (p *PolicyCommon) isIgnoreInternalCIDR() bool {
+	return len(p.DestSubnet) <= 0 && len(p.DestCIDRGroups) <= 0
 }
 
 type IP struct {
@@ -115,57 +156,181 @@ func (r *policeReconciler) initApplyPolicy() error {
 		return fmt.Errorf("failed to list gateway: %v", err)
 	}
 
-	if len(gateways.Items) == 0 {
-		return nil
-	}
-
+	// the rules are applied even without gateways, the policies whose failurePolicy is
+	// closed block their traffic
 	err = r.ensureClusterInfoIPSet()
 	if err != nil {
 		return fmt.Errorf("ensure cluster info ipset with error: %v", err)
 	}
 
+	err = r.updateGroupIPSets(ctx)
+	if err != nil {
+		return fmt.Errorf("update cidr group ipset with error: %v", err)
+	}
+
 	unSnatPolicies := make(map[egressv1.Policy]*PolicyCommon)
 	snatPolicies := make(map[egressv1.Policy]*PolicyCommon)
+	// the policies whose EIP uses this node as the standby node, their ipsets and
+	// SNAT rules are pre-installed to take over the EIP
+	standbyPolicies := make(map[egressv1.Policy]*PolicyCommon)
+	// the EIPs held by this node and their standby nodes
+	heldEips := make(map[string]string)
+	// the number of the source ports of the EIPs held by this node
+	heldPorts := make(map[string]int)
 	isEgressNode := false
+	fenced := !r.lease.isHeld()
 	for _, item := range gateways.Items {
+		portBlocks, err := r.gatewayPortBlocks(ctx, item)
+		if err != nil {
+			return fmt.Errorf("failed to get port blocks of gateway %s: %w", item.Name, err)
+		}
 		for _, list := range item.Status.NodeList {
 			if list.Name == r.cfg.NodeName {
 				isEgressNode = true
-				for _, eip := range list.Eips {
-					for _, policy := range eip.Policies {
-						snatPolicies[policy] = &PolicyCommon{
-							NodeName: list.Name,
-							IP:       IP{V4: eip.IPv4, V6: eip.IPv6},
+			}
+			for _, eip := range list.Eips {
+				holder := r.liveness.holder(list.Name, eip)
+				if holder == r.cfg.NodeName && !fenced {
+					for _, ip := range []string{eip.IPv4, eip.IPv6} {
+						if ip != "" {
+							heldEips[ip] = eip.StandbyNode
+							heldPorts[ip] = snatPortCount(item.Spec.Snat)
 						}
 					}
 				}
-			} else {
-				for _, eip := range list.Eips {
-					for _, policy := range eip.Policies {
-						unSnatPolicies[policy] = &PolicyCommon{NodeName: list.Name}
+				for _, policy := range eip.Policies {
+					if holder == r.cfg.NodeName && fenced {
+						// the node may have lost the EIP, withdraw its SNAT rules
+						r.log.Info("node lease is not held, skip the snat policy", "policy", policy)
+						continue
+					}
+					if holder == r.cfg.NodeName {
+						snatPolicies[policy] = &PolicyCommon{
+							NodeName:   holder,
+							IP:         IP{V4: eip.IPv4, V6: eip.IPv6},
+							Uplink:     uplinkOf(item.Spec.Ippools, eip.IPv4, eip.IPv6),
+							SnatPorts:  snatPorts(item.Spec.Snat),
+							PortBlocks: portBlocks[policyKey(policy)],
+						}
+						continue
+					}
+					unSnatPolicies[policy] = &PolicyCommon{NodeName: holder}
+					if eip.StandbyNode == r.cfg.NodeName && !fenced {
+						standbyPolicies[policy] = &PolicyCommon{
+							NodeName:   holder,
+							IP:         IP{V4: eip.IPv4, V6: eip.IPv6},
+							SnatPorts:  snatPorts(item.Spec.Snat),
+							PortBlocks: portBlocks[policyKey(policy)],
+						}
 					}
 				}
 			}
 		}
 	}
 
+	// the policies out of the windows of their schedules have no rules, their traffic uses the node IP
+	inactivePolicies, err := r.listInactivePolicies(ctx)
+	if err != nil {
+		return err
+	}
+	for policy := range inactivePolicies {
+		delete(unSnatPolicies, policy)
+		delete(snatPolicies, policy)
+		delete(standbyPolicies, policy)
+	}
+
+	// the active policies whose failurePolicy is closed block their traffic instead of using
+	// the node IP when they have no gateway node
+	closedPolicies, err := r.listClosedPolicies(ctx)
+	if err != nil {
+		return err
+	}
+	blockedPolicies := make(map[egressv1.Policy]*PolicyCommon)
+	for policy := range closedPolicies {
+		_, unSnat := unSnatPolicies[policy]
+		_, snat := snatPolicies[policy]
+		if !unSnat && !snat && !inactivePolicies[policy] {
+			blockedPolicies[policy] = &PolicyCommon{}
+		}
+	}
+
+	datapaths := make(map[egressv1.Policy]policyDatapath)
+	hostPolicies := make(map[string]egressv1.HostTraffic)
+	allSrcIPs := func(policy egressv1.Policy) (map[string]struct{}, error) {
+		ipv4List, ipv6List, err := r.getPolicySrcIPs(policy.Namespace, policy.Name, func(egressv1.EgressEndpoint) bool {
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		ips := make(map[string]struct{})
+		for _, ip := range append(ipv4List, ipv6List...) {
+			ips[ip] = struct{}{}
+		}
+		return ips, nil
+	}
+
 	for policy, val := range unSnatPolicies {
-		val.DestSubnet, err = r.getPolicySubnet(policy.Namespace, policy.Name)
+		dest, err := r.getPolicyDest(policy.Namespace, policy.Name)
 		if err != nil {
 			return err
 		}
-		err := r.updatePolicyIPSet(policy.Namespace, policy.Name, false, val.DestSubnet)
+		val.DestSubnet, val.DestCIDRGroups = dest.subnet, dest.groups
+		val.HostTraffic, err = r.getHostTraffic(policy)
 		if err != nil {
 			return err
 		}
+		if val.HostTraffic != nil {
+			hostPolicies[policy.Name] = *val.HostTraffic
+		}
+		_, isStandby := standbyPolicies[policy]
+		err = r.updatePolicyIPSet(policy.Namespace, policy.Name, isStandby, dest)
+		if err != nil {
+			return err
+		}
+		srcIPs, err := allSrcIPs(policy)
+		if err != nil {
+			return err
+		}
+		datapaths[policy] = policyDatapath{srcIPs: srcIPs}
 	}
 
 	for policy, val := range snatPolicies {
-		val.DestSubnet, err = r.getPolicySubnet(policy.Namespace, policy.Name)
+		dest, err := r.getPolicyDest(policy.Namespace, policy.Name)
+		if err != nil {
+			return err
+		}
+		val.DestSubnet, val.DestCIDRGroups = dest.subnet, dest.groups
+		// the host network traffic of this node is SNATed without the mark
+		hostTraffic, err := r.getHostTraffic(policy)
+		if err != nil {
+			return err
+		}
+		if hostTraffic != nil {
+			hostPolicies[policy.Name] = *hostTraffic
+		}
+		err = r.updatePolicyIPSet(policy.Namespace, policy.Name, true, dest)
+		if err != nil {
+			return err
+		}
+		srcIPs, err := allSrcIPs(policy)
+		if err != nil {
+			return err
+		}
+		datapaths[policy] = policyDatapath{snatIP: val.IP, srcIPs: srcIPs}
+	}
+
+	for policy, val := range blockedPolicies {
+		dest, err := r.getPolicyDest(policy.Namespace, policy.Name)
+		if err != nil {
+			return err
+		}
+		val.DestSubnet, val.DestCIDRGroups = dest.subnet, dest.groups
+		val.HostTraffic, err = r.getBlockedHostTraffic(ctx, policy, gateways)
 		if err != nil {
 			return err
 		}
-		err := r.updatePolicyIPSet(policy.Namespace, policy.Name, true, val.DestSubnet)
+		err = r.updatePolicyIPSet(policy.Namespace, policy.Name, false, dest)
 		if err != nil {
 			return err
 		}
@@ -177,15 +342,44 @@ func (r *policeReconciler) initApplyPolicy() error {
 	}
 
 	for _, table := range r.filterTables {
+		rules := make([]iptables.Rule, 0)
+		hostRules := make([]iptables.Rule, 0)
+		for policy, val := range blockedPolicies {
+			policyName := policy.Name
+			if policy.Namespace != "" {
+				policyName = fmt.Sprintf("%s-%s", policy.Namespace, policy.Name)
+			}
+			podRules, nodeRules := buildBlockRules(policyName, table.IPVersion,
+				val.isIgnoreInternalCIDR(), closedPolicies[policy], val.HostTraffic)
+			rules = append(rules, podRules...)
+			hostRules = append(hostRules, nodeRules...)
+		}
+		table.UpdateChain(&iptables.Chain{Name: blockChain, Rules: rules})
+		if len(hostRules) > 0 {
+			hostRules = append(buildHostSkipRules(r.cfg.FileConfig.VXLAN.Name, r.cfg.FileConfig.VXLAN.Port), hostRules...)
+		}
+		table.UpdateChain(&iptables.Chain{Name: blockHostChain, Rules: hostRules})
+
 		chainMapRules := buildFilterStaticRule(baseMark)
 		for chain, rules := range chainMapRules {
 			table.InsertOrAppendRules(chain, rules)
 		}
 	}
 
+	uplinks := make(map[string]egressv1.EipUplink)
+	for _, val := range snatPolicies {
+		if val.Uplink != nil {
+			uplinks[uplinkKey(*val.Uplink)] = *val.Uplink
+		}
+	}
+	r.ensureVlans(uplinks)
+	uplinkMarks := r.ensureUplinks(uplinks)
+
 	for _, table := range r.mangleTables {
 		table.UpdateChain(&iptables.Chain{Name: "EGRESSGATEWAY-REPLY-ROUTING"})
 		table.UpdateChain(&iptables.Chain{Name: "EGRESSGATEWAY-MARK-REQUEST"})
+		table.UpdateChain(&iptables.Chain{Name: hostMarkChain})
+		table.UpdateChain(&iptables.Chain{Name: "EGRESSGATEWAY-UPLINK-ROUTING"})
 		chainMapRules := buildMangleStaticRule(
 			baseMark,
 			isEgressNode,
@@ -213,6 +407,7 @@ func (r *policeReconciler) initApplyPolicy() error {
 
 	for _, table := range r.mangleTables {
 		rules := make([]iptables.Rule, 0)
+		hostRules := make([]iptables.Rule, 0)
 		for policy, val := range unSnatPolicies {
 			node := new(egressv1.EgressTunnel)
 			err := r.client.Get(context.Background(), types.NamespacedName{Name: val.NodeName}, node)
@@ -229,24 +424,55 @@ func (r *policeReconciler) initApplyPolicy() error {
 			if err != nil {
 				return err
 			}
-
-			isIgnoreInternalCIDR := false
-			if len(val.DestSubnet) <= 0 {
-				isIgnoreInternalCIDR = true
+			if datapath, ok := datapaths[policy]; ok {
+				datapath.mark = mark
+				datapaths[policy] = datapath
 			}
 
-			rule := r.buildPolicyRule(policyName, mark, table.IPVersion, isIgnoreInternalCIDR)
+			rule := r.buildPolicyRule(policyName, mark, table.IPVersion, val.isIgnoreInternalCIDR())
 			rules = append(rules, *rule)
+			if val.HostTraffic != nil {
+				hostRules = append(hostRules, buildHostPolicyRules(policyName, mark,
+					table.IPVersion, val.isIgnoreInternalCIDR(), val.HostTraffic)...)
+			}
 		}
 		table.UpdateChain(&iptables.Chain{
 			Name:  "EGRESSGATEWAY-MARK-REQUEST",
 			Rules: rules,
 		})
+		if len(hostRules) > 0 {
+			hostRules = append(buildHostSkipRules(r.cfg.FileConfig.VXLAN.Name, r.cfg.FileConfig.VXLAN.Port), hostRules...)
+		}
+		table.UpdateChain(&iptables.Chain{
+			Name:  hostMarkChain,
+			Rules: hostRules,
+		})
 		table.UpdateChain(&iptables.Chain{
 			Name: "EGRESSGATEWAY-REPLY-ROUTING",
 			Rules: buildPreroutingReplyRouting(r.cfg.FileConfig.VXLAN.Name,
-				uint32(r.cfg.FileConfig.GatewayReplyRouteMark)),
+				uint32(r.cfg.FileConfig.GatewayReplyRouteMark), baseMark),
 		})
+
+		uplinkRules := make([]iptables.Rule, 0)
+		for policy, val := range snatPolicies {
+			if val.Uplink == nil {
+				continue
+			}
+			mark, ok := uplinkMarks[uplinkKey(*val.Uplink)]
+			if !ok {
+				continue
+			}
+			if (table.IPVersion == 4 && val.IP.V4 == "") || (table.IPVersion == 6 && val.IP.V6 == "") {
+				continue
+			}
+			policyName := policy.Name
+			if policy.Namespace != "" {
+				policyName = fmt.Sprintf("%s-%s", policy.Namespace, policy.Name)
+			}
+			rule := r.buildUplinkRule(policyName, mark, table.IPVersion, val.isIgnoreInternalCIDR())
+			uplinkRules = append(uplinkRules, *rule)
+		}
+		table.UpdateChain(&iptables.Chain{Name: "EGRESSGATEWAY-UPLINK-ROUTING", Rules: uplinkRules})
 	}
 
 	for _, table := range r.natTables {
@@ -257,14 +483,22 @@ func (r *policeReconciler) initApplyPolicy() error {
 				policyName = fmt.Sprintf("%s-%s", policy.Namespace, policy.Name)
 			}
 
-			isIgnoreInternalCIDR := false
-			if len(val.DestSubnet) <= 0 {
-				isIgnoreInternalCIDR = true
+			rule := buildEipRule(policyName, val.IP, table.IPVersion, val.isIgnoreInternalCIDR())
+			if rule != nil {
+				rules = append(rules, portBlockRules(rule, val.PortBlocks)...)
+				rules = append(rules, snatPortRules(rule, val.SnatPorts)...)
+			}
+		}
+		for policy, val := range standbyPolicies {
+			policyName := policy.Name
+			if policy.Namespace != "" {
+				policyName = fmt.Sprintf("%s-%s", policy.Namespace, policy.Name)
 			}
 
-			rule := buildEipRule(policyName, val.IP, table.IPVersion, isIgnoreInternalCIDR)
+			rule := buildStandbyEipRule(policyName, val.IP, table.IPVersion, unSnatPolicies[policy].isIgnoreInternalCIDR(), baseMark)
 			if rule != nil {
-				rules = append(rules, *rule)
+				rules = append(rules, portBlockRules(rule, val.PortBlocks)...)
+				rules = append(rules, snatPortRules(rule, val.SnatPorts)...)
 			}
 		}
 
@@ -283,6 +517,12 @@ func (r *policeReconciler) initApplyPolicy() error {
 			return fmt.Errorf("failed to apply rule %v: %v", table.Name, err)
 		}
 	}
+	r.hostPolicies = hostPolicies
+	r.inactivePolicies = inactivePolicies
+	r.closedPolicies = closedPolicies
+	r.ctSync.hold(heldEips)
+	r.snatUsage.hold(heldPorts)
+	r.flushStaleFlows(datapaths)
 
 	setList, err := r.ipset.ListSets()
 	if err != nil {
@@ -290,6 +530,10 @@ func (r *policeReconciler) initApplyPolicy() error {
 		return err
 	}
 
+	// the destination list ipsets go first, the ipsets in a list cannot be destroyed
+	sort.SliceStable(setList, func(i, j int) bool {
+		return strings.HasPrefix(setList[i], dstListIPSetPrefix) && !strings.HasPrefix(setList[j], dstListIPSetPrefix)
+	})
 	for _, name := range setList {
 		if !strings.HasPrefix(name, "egress-") {
 			continue
@@ -310,34 +554,31 @@ func (r *policeReconciler) initApplyPolicy() error {
 	return nil
 }
 
-func (r *policeReconciler) getPolicySubnet(ns, name string) ([]string, error) {
-	var obj client.Object
+// policyDest is the destinations of the policy
+type policyDest struct {
+	subnet        []string
+	excludeSubnet []string
+	groups        []string
+}
+
+// getPolicyDest returns the destinations of the policy
+func (r *policeReconciler) getPolicyDest(ns, name string) (policyDest, error) {
 	key := types.NamespacedName{Namespace: ns, Name: name}
-	getSubnet := func(obj client.Object) []string {
-		switch obj := obj.(type) {
-		case *egressv1.EgressPolicy:
-			return obj.Spec.DestSubnet
-		case *egressv1.EgressClusterPolicy:
-			return obj.Spec.DestSubnet
-		default:
-			return nil
-		}
-	}
 	if ns != "" {
-		obj = new(egressv1.EgressPolicy)
-	} else {
-		obj = new(egressv1.EgressClusterPolicy)
-	}
-	err := r.client.Get(context.Background(), key, obj)
-	if err != nil {
-		if !apierr.IsNotFound(err) {
-			return nil, err
+		obj := new(egressv1.EgressPolicy)
+		if err := r.client.Get(context.Background(), key, obj); err != nil && !apierr.IsNotFound(err) {
+			return policyDest{}, err
 		}
+		return policyDest{obj.Spec.DestSubnet, obj.Spec.ExcludeDestSubnet, obj.Spec.DestCIDRGroups}, nil
+	}
+	obj := new(egressv1.EgressClusterPolicy)
+	if err := r.client.Get(context.Background(), key, obj); err != nil && !apierr.IsNotFound(err) {
+		return policyDest{}, err
 	}
-	return getSubnet(obj), nil
+	return policyDest{obj.Spec.DestSubnet, obj.Spec.ExcludeDestSubnet, obj.Spec.DestCIDRGroups}, nil
 }
 
-func (r *policeReconciler) updatePolicyIPSet(policyNs string, policyName string, isEipNodeSet bool, destSubnet []string) error {
+func (r *policeReconciler) updatePolicyIPSet(policyNs string, policyName string, isEipNodeSet bool, dest policyDest) error {
 	// calculate src ip list
 	srcIPv4List, srcIPv6List, err := r.getPolicySrcIPs(policyNs, policyName, func(e egressv1.EgressEndpoint) bool {
 		if e.Node == r.cfg.EnvConfig.NodeName {
@@ -354,7 +595,11 @@ func (r *policeReconciler) updatePolicyIPSet(policyNs string, policyName string,
 	}
 
 	// calculate dst ip list
-	dstIPv4List, dstIPv6List, err := r.getDstCIDR(destSubnet)
+	dstIPv4List, dstIPv6List, err := r.getDstCIDR(dest.subnet)
+	if err != nil {
+		return err
+	}
+	excIPv4List, excIPv6List, err := r.getDstCIDR(dest.excludeSubnet)
 	if err != nil {
 		return err
 	}
@@ -392,6 +637,16 @@ func (r *policeReconciler) updatePolicyIPSet(policyNs string, policyName string,
 			} else if r.cfg.FileConfig.EnableIPv6 {
 				toAddList[set.Name], toDelList[set.Name] = findDiff(oldIPList, dstIPv6List)
 			}
+		case IPExclude:
+			if set.Stack == IPv4 && r.cfg.FileConfig.EnableIPv4 {
+				toAddList[set.Name], toDelList[set.Name] = findDiff(oldIPList, excIPv4List)
+			} else if r.cfg.FileConfig.EnableIPv6 {
+				toAddList[set.Name], toDelList[set.Name] = findDiff(oldIPList, excIPv6List)
+			}
+		case IPDstList:
+			// the destSubnet ipset and the ipsets of the groups
+			members := append([]string{dstIPSetName(policyNs, policyName, set.Stack)}, r.groupIPSets(dest.groups, set.Stack)...)
+			toAddList[set.Name], toDelList[set.Name] = findDiff(oldIPList, members)
 		}
 		return nil
 	})
@@ -489,14 +744,15 @@ func buildEipRule(policyName string, eip IP, version uint8, isIgnoreInternalCIDR
 		ignoreName = EgressClusterCIDRIPv6
 	}
 	srcName := formatIPSetName("egress-src-"+tmp, policyName)
-	dstName := formatIPSetName("egress-dst-"+tmp, policyName)
+	dstName := formatIPSetName(dstListIPSetPrefix+tmp, policyName)
+	excName := formatIPSetName("egress-exc-"+tmp, policyName)
 
 	matchCriteria := iptables.MatchCriteria{}.SourceIPSet(srcName).DestIPSet(dstName).
-		CTDirectionOriginal(iptables.DirectionOriginal)
+		NotDestIPSet(excName).CTDirectionOriginal(iptables.DirectionOriginal)
 
 	if isIgnoreInternalCIDR {
 		matchCriteria = iptables.MatchCriteria{}.SourceIPSet(srcName).NotDestIPSet(ignoreName).
-			CTDirectionOriginal(iptables.DirectionOriginal)
+			NotDestIPSet(excName).CTDirectionOriginal(iptables.DirectionOriginal)
 	}
 
 	action := iptables.SNATAction{ToAddr: ip}
@@ -506,6 +762,37 @@ func buildEipRule(policyName string, eip IP, version uint8, isIgnoreInternalCIDR
 	return rule
 }
 
+// snatPortRules returns the SNAT rules of the port range, the port range only applies to
+// the tcp and udp traffic, the traffic of the other protocols is SNATed by the rule itself
+func snatPortRules(rule *iptables.Rule, ports string) []iptables.Rule {
+	action, ok := rule.Action.(iptables.SNATAction)
+	if !ok || ports == "" {
+		return []iptables.Rule{*rule}
+	}
+	action.ToPorts = ports
+	rules := make([]iptables.Rule, 0, 3)
+	for _, proto := range []string{"tcp", "udp"} {
+		rules = append(rules, iptables.Rule{
+			Match:   append(iptables.MatchCriteria{}, rule.Match...).Protocol(proto),
+			Action:  action,
+			Comment: rule.Comment,
+		})
+	}
+	return append(rules, *rule)
+}
+
+// snatPortCount returns the number of the source ports of the SNAT rules
+func snatPortCount(snat egressv1.Snat) int {
+	if snat.PortRange == "" {
+		return conntrack.DefaultSnatPorts
+	}
+	start, end, err := snat.Ports()
+	if err != nil {
+		return conntrack.DefaultSnatPorts
+	}
+	return end - start + 1
+}
+
 func parseMark(mark string) (uint32, error) {
 	tmp := strings.ReplaceAll(mark, "0x", "")
 	i64, err := strconv.ParseInt(tmp, 16, 32)
@@ -517,6 +804,16 @@ func parseMark(mark string) (uint32, error) {
 }
 
 func (r *policeReconciler) buildPolicyRule(policyName string, mark uint32, version uint8, isIgnoreInternalCIDR bool) *iptables.Rule {
+	action := iptables.SetMaskedMarkAction{Mark: mark, Mask: 0xffffffff}
+	rule := &iptables.Rule{Match: policyMatch(policyName, version, isIgnoreInternalCIDR), Action: action, Comment: []string{
+		fmt.Sprintf("Set mark for EgressPolicy %s", policyName),
+	}}
+	return rule
+}
+
+// policyMatch returns the match criteria of the traffic from the source IPs of the policy
+// to its destinations
+func policyMatch(policyName string, version uint8, isIgnoreInternalCIDR bool) iptables.MatchCriteria {
 	tmp := "v4-"
 	ignoreInternalCIDRName := EgressClusterCIDRIPv4
 	if version == 6 {
@@ -524,21 +821,17 @@ func (r *policeReconciler) buildPolicyRule(policyName string, mark uint32, versi
 		ignoreInternalCIDRName = EgressClusterCIDRIPv6
 	}
 	srcName := formatIPSetName("egress-src-"+tmp, policyName)
-	dstName := formatIPSetName("egress-dst-"+tmp, policyName)
+	dstName := formatIPSetName(dstListIPSetPrefix+tmp, policyName)
+	excName := formatIPSetName("egress-exc-"+tmp, policyName)
 
 	matchCriteria := iptables.MatchCriteria{}.SourceIPSet(srcName).DestIPSet(dstName).
-		CTDirectionOriginal(iptables.DirectionOriginal)
+		NotDestIPSet(excName).CTDirectionOriginal(iptables.DirectionOriginal)
 
 	if isIgnoreInternalCIDR {
 		matchCriteria = iptables.MatchCriteria{}.SourceIPSet(srcName).NotDestIPSet(ignoreInternalCIDRName).
-			CTDirectionOriginal(iptables.DirectionOriginal)
+			NotDestIPSet(excName).CTDirectionOriginal(iptables.DirectionOriginal)
 	}
-
-	action := iptables.SetMaskedMarkAction{Mark: mark, Mask: 0xffffffff}
-	rule := &iptables.Rule{Match: matchCriteria, Action: action, Comment: []string{
-		fmt.Sprintf("Set mark for EgressPolicy %s", policyName),
-	}}
-	return rule
+	return matchCriteria
 }
 
 func buildNatStaticRule(base uint32) map[string][]iptables.Rule {
@@ -740,6 +1033,12 @@ func buildFilterStaticRule(base uint32) map[string][]iptables.Rule {
 			Comment: []string{
 				"Accept for egress traffic from pod going to EgressTunnel",
 			},
+		}, {
+			Match:  iptables.MatchCriteria{},
+			Action: iptables.JumpAction{Target: blockChain},
+			Comment: []string{
+				"Block the traffic of the closed policies without gateway node",
+			},
 		}},
 		"OUTPUT": {{
 			Match:  iptables.MatchCriteria{}.MarkMatchesWithMask(base, 0xffffffff),
@@ -747,6 +1046,12 @@ func buildFilterStaticRule(base uint32) map[string][]iptables.Rule {
 			Comment: []string{
 				"Accept for egress traffic from pod going to EgressTunnel",
 			},
+		}, {
+			Match:  iptables.MatchCriteria{},
+			Action: iptables.JumpAction{Target: blockHostChain},
+			Comment: []string{
+				"Block the host traffic of the closed policies without gateway node",
+			},
 		}},
 	}
 	return res
@@ -781,7 +1086,7 @@ func buildMangleStaticRule(base uint32,
 		Comment: []string{
 			"Checking for EgressPolicy matched traffic",
 		},
-	})
+	}, saveMarkRule(base))
 
 	if isEgressNode && enableGatewayReplyRoute {
 		prerouting = append(prerouting, iptables.Rule{
@@ -800,15 +1105,51 @@ func buildMangleStaticRule(base uint32,
 		})
 	}
 
+	// the uplink mark overrides the reply mark, the reply mark has been saved to the connection
+	if isEgressNode {
+		prerouting = append(prerouting, iptables.Rule{
+			Match:  iptables.MatchCriteria{},
+			Action: iptables.JumpAction{Target: "EGRESSGATEWAY-UPLINK-ROUTING"},
+			Comment: []string{
+				"egressGateway uplink datapath rule, rule is from the EgressGateway",
+			},
+		})
+	}
+
+	output := []iptables.Rule{{
+		Match:  iptables.MatchCriteria{},
+		Action: iptables.JumpAction{Target: hostMarkChain},
+		Comment: []string{
+			"Checking for EgressClusterPolicy matched host traffic",
+		},
+	}, saveMarkRule(base)}
+
 	res := map[string][]iptables.Rule{
 		"FORWARD":     forward,
+		"OUTPUT":      output,
 		"POSTROUTING": postrouting,
 		"PREROUTING":  prerouting,
 	}
 	return res
 }
 
-func buildPreroutingReplyRouting(vxlanName string, replyMark uint32) []iptables.Rule {
+// saveMarkRule saves the mark of the policy to the new connections, so the flows forwarded
+// to the EgressTunnel are flushed by the mark once the datapath of the policy changes. Only
+// the bits of the policy mark are saved, the other bits of the connmark are kept.
+func saveMarkRule(base uint32) iptables.Rule {
+	return iptables.Rule{
+		Match:  iptables.MatchCriteria{}.MarkMatchesWithMask(base, policyMarkMask).ConntrackState("NEW"),
+		Action: iptables.SaveConnMarkAction{SaveMask: policyMarkMask},
+		Comment: []string{
+			"save the mark of EgressPolicy to the connection",
+		},
+	}
+}
+
+// buildPreroutingReplyRouting builds the rules of the reply datapath on the gateway node,
+// the connections which carry the mark of a policy are skipped, their replies from the
+// tunnel go back to the local pods.
+func buildPreroutingReplyRouting(vxlanName string, replyMark uint32, base uint32) []iptables.Rule {
 	return []iptables.Rule{
 		{
 			Match:  iptables.MatchCriteria{}.InInterface(vxlanName),
@@ -818,14 +1159,15 @@ func buildPreroutingReplyRouting(vxlanName string, replyMark uint32) []iptables.
 			},
 		},
 		{
-			Match:  iptables.MatchCriteria{}.MarkMatchesWithMask(replyMark, 0xffffffff),
+			Match: iptables.MatchCriteria{}.MarkMatchesWithMask(replyMark, 0xffffffff).
+				NotConnmarkMatchesWithMask(base, 0xff000000),
 			Action: iptables.SaveConnMarkAction{SaveMask: replyMark},
 			Comment: []string{
 				"save mark to the connection, rule is from the EgressGateway",
 			},
 		},
 		{
-			Match:  iptables.MatchCriteria{}.ConntrackState("ESTABLISHED"),
+			Match:  iptables.MatchCriteria{}.ConntrackState("ESTABLISHED").NotConnmarkMatchesWithMask(base, 0xff000000),
 			Action: iptables.RestoreConnMarkAction{RestoreMask: 0},
 			Comment: []string{
 				"label for restoring connections, rule is from the EgressGateway",
@@ -854,8 +1196,15 @@ func (r *policeReconciler) reconcilePolicy(ctx context.Context, req reconcile.Re
 
 	// delete event
 	if deleted {
-		setNames := buildIPSetNamesByPolicy(req.Namespace, req.Name, true, true)
 		log.Info("request item deleted, delete related policies")
+		// the block rules of the policy refer to its ipsets, they are removed before the
+		// ipsets, otherwise the ipsets in use can not be destroyed
+		if _, ok := r.closedPolicies[egressv1.Policy{Name: req.Name, Namespace: req.Namespace}]; ok {
+			if err := r.initApplyPolicy(); err != nil {
+				return reconcile.Result{Requeue: true}, err
+			}
+		}
+		setNames := buildIPSetNamesByPolicy(req.Namespace, req.Name, true, true)
 		_ = setNames.Map(func(set SetName) error {
 			r.removeIPSet(log, set.Name)
 			return nil
@@ -872,27 +1221,29 @@ func (r *policeReconciler) reconcilePolicy(ctx context.Context, req reconcile.Re
 		return reconcile.Result{}, nil
 	}
 
-	nodeName := ""
-	for _, node := range gateway.Status.NodeList {
-		for _, eip := range node.Eips {
-			for _, p := range eip.Policies {
-				if p.Name == policy.Name && p.Namespace == policy.Namespace {
-					nodeName = node.Name
-				}
-			}
-		}
-	}
-
+	// the holder and the standby node of the EIP match the traffic from all nodes
+	holder, standby := r.liveness.policyHolder(gateway, policy.Namespace, policy.Name)
 	flag := false
-	if nodeName == r.cfg.EnvConfig.NodeName {
+	if holder == r.cfg.EnvConfig.NodeName || standby == r.cfg.EnvConfig.NodeName {
 		flag = true
 	}
 
 	// update event
-	err = r.updatePolicyIPSet(policy.Namespace, policy.Name, flag, policy.Spec.DestSubnet)
+	err = r.updatePolicyIPSet(policy.Namespace, policy.Name, flag,
+		policyDest{policy.Spec.DestSubnet, policy.Spec.ExcludeDestSubnet, policy.Spec.DestCIDRGroups})
 	if err != nil {
 		return reconcile.Result{Requeue: true}, err
 	}
+
+	// the rules follow the Active condition of the schedule and the failurePolicy
+	key := egressv1.Policy{Name: policy.Name, Namespace: policy.Namespace}
+	active := schedule.IsActive(policy.Spec.Schedule, policy.Status)
+	if r.isActiveChanged(key, active) ||
+		r.isFailurePolicyChanged(key, policy.Spec.FailurePolicy, policy.Spec.FailureAction) {
+		if err := r.initApplyPolicy(); err != nil {
+			return reconcile.Result{Requeue: true}, err
+		}
+	}
 	return reconcile.Result{}, nil
 }
 
@@ -916,8 +1267,15 @@ func (r *policeReconciler) reconcileClusterPolicy(ctx context.Context, req recon
 
 	// delete event
 	if deleted {
-		setNames := buildIPSetNamesByPolicy(req.Namespace, req.Name, true, true)
 		log.Info("request item deleted, delete related policies")
+		// the block rules of the policy refer to its ipsets, they are removed before the
+		// ipsets, otherwise the ipsets in use can not be destroyed
+		if _, ok := r.closedPolicies[egressv1.Policy{Name: req.Name, Namespace: req.Namespace}]; ok {
+			if err := r.initApplyPolicy(); err != nil {
+				return reconcile.Result{Requeue: true}, err
+			}
+		}
+		setNames := buildIPSetNamesByPolicy(req.Namespace, req.Name, true, true)
 		_ = setNames.Map(func(set SetName) error {
 			r.removeIPSet(log, set.Name)
 			return nil
@@ -934,27 +1292,30 @@ func (r *policeReconciler) reconcileClusterPolicy(ctx context.Context, req recon
 		return reconcile.Result{Requeue: false}, nil
 	}
 
-	nodeName := ""
-	for _, node := range gateway.Status.NodeList {
-		for _, eip := range node.Eips {
-			for _, p := range eip.Policies {
-				if p.Name == policy.Name && p.Namespace == policy.Namespace {
-					nodeName = node.Name
-				}
-			}
-		}
-	}
-
+	// the holder and the standby node of the EIP match the traffic from all nodes
+	holder, standby := r.liveness.policyHolder(gateway, policy.Namespace, policy.Name)
 	flag := false
-	if nodeName == r.cfg.EnvConfig.NodeName {
+	if holder == r.cfg.EnvConfig.NodeName || standby == r.cfg.EnvConfig.NodeName {
 		flag = true
 	}
 
 	// update event
-	err = r.updatePolicyIPSet(policy.Namespace, policy.Name, flag, policy.Spec.DestSubnet)
+	err = r.updatePolicyIPSet(policy.Namespace, policy.Name, flag,
+		policyDest{policy.Spec.DestSubnet, policy.Spec.ExcludeDestSubnet, policy.Spec.DestCIDRGroups})
 	if err != nil {
 		return reconcile.Result{Requeue: true}, err
 	}
+
+	// the rules of the host network traffic follow the nodeSelector and the hostTraffic,
+	// and the rules follow the Active condition of the schedule and the failurePolicy
+	key := egressv1.Policy{Name: policy.Name}
+	active := schedule.IsActive(policy.Spec.Schedule, policy.Status)
+	if r.isHostTrafficChanged(policy) || r.isActiveChanged(key, active) ||
+		r.isFailurePolicyChanged(key, policy.Spec.FailurePolicy, policy.Spec.FailureAction) {
+		if err := r.initApplyPolicy(); err != nil {
+			return reconcile.Result{Requeue: true}, err
+		}
+	}
 	return reconcile.Result{}, nil
 }
 
@@ -1056,6 +1417,9 @@ func (r *policeReconciler) createIPSet(log logr.Logger, set SetName) error {
 			HashFamily: set.Stack.HashFamily(),
 			Comment:    "",
 		}
+		if set.Kind == IPDstList {
+			ipSet.SetType = ipset.ListSet
+		}
 		err := r.ipset.CreateSet(ipSet, true)
 		if err != nil {
 			log.Error(err, "add src ipset with error", err)
@@ -1066,7 +1430,7 @@ func (r *policeReconciler) createIPSet(log logr.Logger, set SetName) error {
 	return nil
 }
 
-func newPolicyController(mgr manager.Manager, log logr.Logger, cfg *config.Config) error {
+func newPolicyController(mgr manager.Manager, log logr.Logger, cfg *config.Config, liveness *peerLiveness, lease *nodeLease, ctSync *ctSync, snatUsage *snatUsage) error {
 	iptablesCfg := cfg.FileConfig.IPTables
 	opt := iptables.Options{
 		HistoricChainPrefixes:    []string{"egw"},
@@ -1140,6 +1504,12 @@ func newPolicyController(mgr manager.Manager, log logr.Logger, cfg *config.Confi
 		natTables:    natTables,
 		ruleV4Map:    utils.NewSyncMap[string, iptables.Rule](),
 		ruleV6Map:    utils.NewSyncMap[string, iptables.Rule](),
+		liveness:     liveness,
+		lease:        lease,
+		ctSync:       ctSync,
+		snatUsage:    snatUsage,
+		deleteFlows:  conntrack.DeleteFlows,
+		ruleRoute:    route.NewRuleRoute(log),
 	}
 
 	c, err := controller.New("policy", mgr, controller.Options{Reconciler: r})
@@ -1178,11 +1548,32 @@ func newPolicyController(mgr manager.Manager, log logr.Logger, cfg *config.Confi
 		return fmt.Errorf("failed to watch EgressClusterEndpointSlice: %w", err)
 	}
 
+	// the port block allocation tables
+	if err := c.Watch(source.Kind(mgr.GetCache(), &corev1.ConfigMap{}),
+		handler.EnqueueRequestsFromMapFunc(utils.KindToMapFlat("EgressGateway"))); err != nil {
+		return fmt.Errorf("failed to watch ConfigMap: %w", err)
+	}
+
+	if err := c.Watch(source.Kind(mgr.GetCache(), &egressv1.EgressCIDRGroup{}),
+		handler.EnqueueRequestsFromMapFunc(utils.KindToMapFlat("EgressCIDRGroup"))); err != nil {
+		return fmt.Errorf("failed to watch EgressCIDRGroup: %w", err)
+	}
+
 	if err := c.Watch(source.Kind(mgr.GetCache(), &egressv1.EgressClusterInfo{}),
 		handler.EnqueueRequestsFromMapFunc(utils.KindToMapFlat("EgressClusterInfo"))); err != nil {
 		return fmt.Errorf("failed to watch EgressClusterInfo: %w", err)
 	}
 
+	if err := c.Watch(&source.Channel{Source: liveness.subscribe()},
+		handler.EnqueueRequestsFromMapFunc(utils.KindToMapFlat("EgressTunnel"))); err != nil {
+		return fmt.Errorf("failed to watch peer liveness: %w", err)
+	}
+
+	if err := c.Watch(&source.Channel{Source: lease.subscribe()},
+		handler.EnqueueRequestsFromMapFunc(utils.KindToMapFlat("Lease"))); err != nil {
+		return fmt.Errorf("failed to watch node lease: %w", err)
+	}
+
 	return nil
 }
 
@@ -1194,19 +1585,34 @@ func buildIPSetNamesByPolicy(ns, name string, enableIPv4, enableIPv6 bool) SetNa
 	res := make([]SetName, 0)
 	if enableIPv4 {
 		res = append(res, []SetName{
+			{Name: formatIPSetName(dstListIPSetPrefix+"v4-", name), Stack: IPv4, Kind: IPDstList},
 			{Name: formatIPSetName("egress-src-v4-", name), Stack: IPv4, Kind: IPSrc},
 			{Name: formatIPSetName("egress-dst-v4-", name), Stack: IPv4, Kind: IPDst},
+			{Name: formatIPSetName("egress-exc-v4-", name), Stack: IPv4, Kind: IPExclude},
 		}...)
 	}
 	if enableIPv6 {
 		res = append(res, []SetName{
+			{Name: formatIPSetName(dstListIPSetPrefix+"v6-", name), Stack: IPv6, Kind: IPDstList},
 			{Name: formatIPSetName("egress-src-v6-", name), Stack: IPv6, Kind: IPSrc},
 			{Name: formatIPSetName("egress-dst-v6-", name), Stack: IPv6, Kind: IPDst},
+			{Name: formatIPSetName("egress-exc-v6-", name), Stack: IPv6, Kind: IPExclude},
 		}...)
 	}
 	return res
 }
 
+// dstIPSetName returns the destSubnet ipset of the policy
+func dstIPSetName(ns, name string, stack IPStack) string {
+	if ns != "" {
+		name = ns + "-" + name
+	}
+	if stack == IPv6 {
+		return formatIPSetName("egress-dst-v6-", name)
+	}
+	return formatIPSetName("egress-dst-v4-", name)
+}
+
 type SetNames []SetName
 
 type SetName struct {
@@ -1236,6 +1642,13 @@ type IPKind int
 const (
 	IPSrc IPKind = iota
 	IPDst
+	// IPExclude is the excludeDestSubnet of the policy
+	IPExclude
+	// IPDstList is the list of the destSubnet ipset and the ipsets of the
+	// EgressCIDRGroups of the policy, the rules of the policy match it
+	IPDstList
+	// IPGroup is the CIDRs of an EgressCIDRGroup
+	IPGroup
 )
 
 type IPStack int
@@ -0,0 +1,87 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/spidernet-io/egressgateway/pkg/iptables"
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/portblock"
+)
+
+// gatewayPortBlocks returns the port blocks of the EgressGateway by policy, the blocks are
+// allocated by the controller
+func (r *policeReconciler) gatewayPortBlocks(ctx context.Context, gateway egressv1.EgressGateway) (map[string][]portblock.Block, error) {
+	if gateway.Spec.Snat.PortBlockSize == 0 {
+		return nil, nil
+	}
+	cm := new(corev1.ConfigMap)
+	key := types.NamespacedName{Namespace: r.cfg.PodNamespace, Name: portblock.ConfigMapName(gateway.Name)}
+	if err := r.client.Get(ctx, key, cm); err != nil {
+		if apierr.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	blocks, err := portblock.Decode(cm)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string][]portblock.Block)
+	for _, block := range blocks {
+		res[block.Policy] = append(res[block.Policy], block)
+	}
+	return res, nil
+}
+
+// snatPorts returns the ports of the SNAT rules of the policies of the EgressGateway, the
+// source IPs without a port block share the fallback ports, which no block overlaps
+func snatPorts(snat egressv1.Snat) string {
+	if snat.PortBlockSize == 0 {
+		return snat.PortRange
+	}
+	first, last, err := portblock.Range(snat)
+	if err != nil {
+		return snat.PortRange
+	}
+	return portblock.Fallback(first, last, int(snat.PortBlockSize))
+}
+
+// policyKey returns the policy of the port blocks, `<namespace>/<name>` for the EgressPolicy
+func policyKey(policy egressv1.Policy) string {
+	if policy.Namespace == "" {
+		return policy.Name
+	}
+	return policy.Namespace + "/" + policy.Name
+}
+
+// portBlockRules returns the SNAT rules of the port blocks of the source IPs of the policy,
+// they go before the rules of the policy, so the source IPs without a block, and the traffic
+// other than tcp and udp, are SNATed by the rules of the policy, see snatPorts
+func portBlockRules(rule *iptables.Rule, blocks []portblock.Block) []iptables.Rule {
+	action, ok := rule.Action.(iptables.SNATAction)
+	if !ok {
+		return nil
+	}
+	var rules []iptables.Rule
+	for _, block := range blocks {
+		if block.EIP != action.ToAddr {
+			continue
+		}
+		blockAction := iptables.SNATAction{ToAddr: action.ToAddr, ToPorts: block.Ports}
+		for _, proto := range []string{"tcp", "udp"} {
+			rules = append(rules, iptables.Rule{
+				Match:   append(iptables.MatchCriteria{}, rule.Match...).SourceNet(block.Source).Protocol(proto),
+				Action:  blockAction,
+				Comment: rule.Comment,
+			})
+		}
+	}
+	return rules
+}
@@ -0,0 +1,39 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/spidernet-io/egressgateway/pkg/iptables"
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/portblock"
+)
+
+func TestPortBlockRules(t *testing.T) {
+	opts := &iptables.Options{}
+	rule := buildEipRule("default-p1", IP{V4: "10.6.1.21"}, 4, true)
+	blocks := []portblock.Block{
+		{EIP: "10.6.1.21", Source: "10.21.0.9", Ports: "20000-20499"},
+		{EIP: "10.6.1.22", Source: "10.21.0.10", Ports: "20000-20499"},
+	}
+	rules := portBlockRules(rule, blocks)
+	if assert.Len(t, rules, 2) {
+		assert.Contains(t, rules[0].Match, "--source 10.21.0.9")
+		assert.Contains(t, rules[0].Match, "-p tcp")
+		assert.Contains(t, rules[1].Match, "-p udp")
+		assert.Equal(t, "--jump SNAT --to-source 10.6.1.21:20000-20499", rules[1].Action.ToFragment(opts))
+	}
+	assert.Empty(t, portBlockRules(rule, nil))
+	assert.Equal(t, "default/p1", policyKey(egressv1.Policy{Namespace: "default", Name: "p1"}))
+}
+
+func TestSnatPorts(t *testing.T) {
+	assert.Equal(t, "", snatPorts(egressv1.Snat{}))
+	assert.Equal(t, "20000-29999", snatPorts(egressv1.Snat{PortRange: "20000-29999"}))
+	assert.Equal(t, "29500-29999", snatPorts(egressv1.Snat{PortRange: "20000-29999", PortBlockSize: 500}))
+	assert.Equal(t, "65024-65535", snatPorts(egressv1.Snat{PortBlockSize: 512}))
+}
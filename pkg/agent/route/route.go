@@ -25,12 +25,16 @@ func (r *RuleRoute) PurgeStaleRules(marks map[int]struct{}, baseMark string) err
 	if err != nil {
 		return err
 	}
+	return r.PurgeStaleRulesInRange(marks, int(start), int(end))
+}
 
+// PurgeStaleRulesInRange deletes the mark rules whose mark is in [start, end] and is not in marks
+func (r *RuleRoute) PurgeStaleRulesInRange(marks map[int]struct{}, start, end int) error {
 	clean := func(rules []netlink.Rule, family int) error {
 		for _, rule := range rules {
 			rule.Family = family
 			if _, ok := marks[rule.Mark]; !ok {
-				if int(start) <= rule.Mark && int(end) >= rule.Mark {
+				if start <= rule.Mark && end >= rule.Mark {
 					err := netlink.RuleDel(&rule)
 					if err != nil {
 						return err
@@ -190,3 +194,53 @@ func (r *RuleRoute) EnsureRule(family int, table int, mark int, log logr.Logger)
 	}
 	return nil
 }
+
+// EnsureLinkRoute ensures the default route of the table goes through the link, via the
+// gateway if it is not nil, otherwise the destinations are on-link
+func (r *RuleRoute) EnsureLinkRoute(link netlink.Link, gw *net.IP, family int, table int, log logr.Logger) error {
+	log = log.WithValues("family", family, "gw", gw)
+	log.V(1).Info("ensure link route")
+
+	routeFilter := &netlink.Route{Table: table}
+	routes, err := netlink.RouteListFiltered(family, routeFilter, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return err
+	}
+
+	index := link.Attrs().Index
+	var find bool
+	for _, route := range routes {
+		if route.Table != table {
+			continue
+		}
+		sameGw := (gw == nil && route.Gw == nil) || (gw != nil && gw.Equal(route.Gw))
+		if route.LinkIndex != index || !sameGw || find {
+			log.Info("delete route", "route", route.String())
+			err := netlink.RouteDel(&route)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		find = true
+	}
+	if find {
+		return nil
+	}
+
+	route := &netlink.Route{LinkIndex: index, Table: table}
+	switch {
+	case gw != nil:
+		// the link may have no address in the subnet of the gateway, e.g. a VLAN
+		// sub-interface created for the EIPs
+		route.Gw = *gw
+		route.Flags = int(netlink.FLAG_ONLINK)
+	case family == netlink.FAMILY_V6:
+		route.Dst = &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+		route.Scope = netlink.SCOPE_LINK
+	default:
+		route.Dst = &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}
+		route.Scope = netlink.SCOPE_LINK
+	}
+	return netlink.RouteAdd(route)
+}
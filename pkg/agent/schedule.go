@@ -0,0 +1,45 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/schedule"
+)
+
+// listInactivePolicies returns the policies out of the windows of their schedules, they
+// have no mark and SNAT rules, and their traffic uses the node IP
+func (r *policeReconciler) listInactivePolicies(ctx context.Context) (map[egressv1.Policy]bool, error) {
+	res := make(map[egressv1.Policy]bool)
+
+	policies := new(egressv1.EgressPolicyList)
+	if err := r.client.List(ctx, policies); err != nil {
+		return nil, fmt.Errorf("failed to list EgressPolicy: %w", err)
+	}
+	for _, item := range policies.Items {
+		if !schedule.IsActive(item.Spec.Schedule, item.Status) {
+			res[egressv1.Policy{Name: item.Name, Namespace: item.Namespace}] = true
+		}
+	}
+
+	clusterPolicies := new(egressv1.EgressClusterPolicyList)
+	if err := r.client.List(ctx, clusterPolicies); err != nil {
+		return nil, fmt.Errorf("failed to list EgressClusterPolicy: %w", err)
+	}
+	for _, item := range clusterPolicies.Items {
+		if !schedule.IsActive(item.Spec.Schedule, item.Status) {
+			res[egressv1.Policy{Name: item.Name}] = true
+		}
+	}
+	return res, nil
+}
+
+// isActiveChanged is true when the policy enters or leaves a window of its schedule after
+// the rules are applied
+func (r *policeReconciler) isActiveChanged(policy egressv1.Policy, active bool) bool {
+	return r.inactivePolicies[policy] == active
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/spidernet-io/egressgateway/pkg/config"
+	"github.com/spidernet-io/egressgateway/pkg/conntrack"
+)
+
+// snatUsage exports the conntrack usage of the EIPs held by this node, so the source
+// ports of an EIP towards a destination can be alerted before they are exhausted
+type snatUsage struct {
+	log      logr.Logger
+	interval time.Duration
+	top      int
+	list     func(eips map[string]int) (map[string]*conntrack.SnatUsage, error)
+
+	mu sync.Mutex
+	// held is the EIPs held by this node and the number of their source ports
+	held map[string]int
+}
+
+func newSnatUsage(mgr manager.Manager, cfg *config.Config, log logr.Logger) (*snatUsage, error) {
+	opt := cfg.FileConfig.SnatMetrics
+	if !opt.Enable {
+		return nil, nil
+	}
+	s := &snatUsage{
+		log:      log.WithName("snat-usage"),
+		interval: time.Second * time.Duration(opt.IntervalSeconds),
+		top:      opt.TopDestinations,
+		list:     conntrack.ListSnatUsage,
+		held:     make(map[string]int),
+	}
+	if err := mgr.Add(s); err != nil {
+		return nil, fmt.Errorf("failed to add snat usage: %w", err)
+	}
+	return s, nil
+}
+
+func (s *snatUsage) Start(ctx context.Context) error {
+	s.log.Info("start snat usage", "interval", s.interval)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			s.record()
+		}
+	}
+}
+
+// hold sets the EIPs held by this node and the number of their source ports
+func (s *snatUsage) hold(eips map[string]int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.held = eips
+}
+
+func (s *snatUsage) record() {
+	s.mu.Lock()
+	held := make(map[string]int, len(s.held))
+	for eip, ports := range s.held {
+		held[eip] = ports
+	}
+	s.mu.Unlock()
+
+	usages, err := s.list(held)
+	if err != nil {
+		s.log.Error(err, "failed to list snat usage")
+		return
+	}
+	conntrack.RecordSnatUsage(usages, held, s.top)
+}
@@ -0,0 +1,40 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/spidernet-io/egressgateway/pkg/conntrack"
+	"github.com/spidernet-io/egressgateway/pkg/iptables"
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+func TestSnatPortRules(t *testing.T) {
+	opts := &iptables.Options{}
+
+	rule := buildEipRule("default-p1", IP{V4: "10.6.1.21", V6: "fd00::21"}, 4, true)
+	rules := snatPortRules(rule, "")
+	assert.Equal(t, []iptables.Rule{*rule}, rules)
+
+	rules = snatPortRules(rule, "20000-29999")
+	if assert.Len(t, rules, 3) {
+		assert.Contains(t, rules[0].Match, "-p tcp")
+		assert.Equal(t, "--jump SNAT --to-source 10.6.1.21:20000-29999", rules[0].Action.ToFragment(opts))
+		assert.Contains(t, rules[1].Match, "-p udp")
+		assert.Equal(t, *rule, rules[2])
+	}
+	assert.NotContains(t, rule.Match, "-p tcp")
+
+	rule = buildEipRule("default-p1", IP{V4: "10.6.1.21", V6: "fd00::21"}, 6, true)
+	rules = snatPortRules(rule, "20000-29999")
+	assert.Equal(t, "--jump SNAT --to-source [fd00::21]:20000-29999", rules[0].Action.ToFragment(opts))
+}
+
+func TestSnatPortCount(t *testing.T) {
+	assert.Equal(t, conntrack.DefaultSnatPorts, snatPortCount(egressv1.Snat{}))
+	assert.Equal(t, 10000, snatPortCount(egressv1.Snat{PortRange: "20000-29999"}))
+}
@@ -0,0 +1,320 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/go-logr/logr"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/spidernet-io/egressgateway/pkg/config"
+	"github.com/spidernet-io/egressgateway/pkg/echo"
+	"github.com/spidernet-io/egressgateway/pkg/iptables"
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/lease"
+	"github.com/spidernet-io/egressgateway/pkg/utils"
+)
+
+// peerLiveness tracks the liveness of the peer agents by their EgressTunnel, so the
+// standby node of an EIP takes it over as soon as the agent of the active node is
+// dead, without waiting for the controller to rewrite the gateway status.
+//
+// In the lease heartbeat mode, the agent reads the node leases from the cache, which
+// only watches the lease namespace, it checks the leases of the nodes whose EIPs it
+// stands by for, and relies on the phase of EgressTunnel for the other nodes.
+//
+// The heartbeats of EgressTunnel are too slow to detect a dead agent in seconds, the
+// local takeover is opt-in by the peer probe: the agent probes the gateway nodes over
+// the underlay, and a gateway node which does not reply within peerProbe.timeoutMillis
+// is dead. Without the peer probe, the agent follows the phase of EgressTunnel set by
+// the controller.
+type peerLiveness struct {
+	client         client.Client
+	log            logr.Logger
+	node           string
+	leaseMode      bool
+	leaseNamespace string
+	period         time.Duration
+	alive          *utils.SyncMap[string, bool]
+	subscribers    []chan event.GenericEvent
+	probe          *echo.Prober
+	probePort      int
+	kick           chan struct{}
+	recorder       record.EventRecorder
+}
+
+func newPeerLiveness(mgr manager.Manager, cfg *config.Config, log logr.Logger) (*peerLiveness, error) {
+	p := &peerLiveness{
+		client:         mgr.GetClient(),
+		log:            log.WithName("liveness"),
+		node:           cfg.NodeName,
+		leaseMode:      cfg.FileConfig.GatewayFailover.HeartbeatMode == config.HeartbeatModeLease,
+		leaseNamespace: cfg.FileConfig.GatewayFailover.LeaseNamespace,
+		period:         time.Second,
+		alive:          utils.NewSyncMap[string, bool](),
+		kick:           make(chan struct{}, 1),
+		recorder:       mgr.GetEventRecorderFor("egress-agent"),
+	}
+	if probe := cfg.FileConfig.GatewayFailover.PeerProbe; cfg.FileConfig.GatewayFailover.Enable && probe.Enable {
+		p.probePort = probe.Port
+		p.probe = echo.New(fmt.Sprintf(":%d", probe.Port),
+			time.Millisecond*time.Duration(probe.IntervalMillis), time.Millisecond*time.Duration(probe.TimeoutMillis),
+			func(string, bool) { p.trigger() }, log.WithName("echo"))
+		if err := mgr.Add(p.probe); err != nil {
+			return nil, fmt.Errorf("failed to add peer probe: %w", err)
+		}
+	}
+	if err := mgr.Add(p); err != nil {
+		return nil, fmt.Errorf("failed to add peer liveness: %w", err)
+	}
+	return p, nil
+}
+
+// subscribe returns a channel which receives the EgressTunnel whose liveness changes,
+// it must be called before the manager starts.
+func (p *peerLiveness) subscribe() <-chan event.GenericEvent {
+	ch := make(chan event.GenericEvent, 16)
+	p.subscribers = append(p.subscribers, ch)
+	return ch
+}
+
+func (p *peerLiveness) Start(ctx context.Context) error {
+	ticker := time.NewTicker(p.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			p.check(ctx)
+		case <-p.kick:
+			p.check(ctx)
+		}
+	}
+}
+
+// trigger checks the liveness at once, it is called when the peer probe detects a change
+func (p *peerLiveness) trigger() {
+	select {
+	case p.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (p *peerLiveness) check(ctx context.Context) {
+	list := new(egressv1.EgressTunnelList)
+	if err := p.client.List(ctx, list); err != nil {
+		p.log.Error(err, "failed to list egress tunnel")
+		return
+	}
+
+	var gateways *egressv1.EgressGatewayList
+	if p.leaseMode || p.probe != nil {
+		gateways = new(egressv1.EgressGatewayList)
+		if err := p.client.List(ctx, gateways); err != nil {
+			p.log.Error(err, "failed to list egress gateway")
+			return
+		}
+	}
+
+	var leases map[string]*coordinationv1.Lease
+	if p.leaseMode {
+		leases = p.standbyLeases(ctx, gateways)
+	}
+	if p.probe != nil {
+		p.probe.SetPeers(p.probePeers(gateways, list))
+	}
+
+	now := time.Now()
+	for i := range list.Items {
+		tunnel := &list.Items[i]
+		alive := tunnel.Status.Phase == egressv1.EgressTunnelReady
+		if l, ok := leases[tunnel.Name]; ok {
+			// the agent of the active node has withdrawn the EIPs once its lease expired
+			alive = alive && lease.Held(l, now)
+		}
+		if p.probe != nil {
+			// the peers which have never replied are not judged by the probe
+			if probed, known := p.probe.Alive(tunnel.Name); known {
+				p.reportProbe(ctx, tunnel, probed)
+				alive = alive && probed
+			}
+		}
+		old, ok := p.alive.Load(tunnel.Name)
+		p.alive.Store(tunnel.Name, alive)
+		// the unknown nodes are considered alive, see isAlive
+		if (ok && old == alive) || (!ok && alive) {
+			continue
+		}
+		p.log.Info("peer liveness changed", "node", tunnel.Name, "alive", alive)
+		for _, ch := range p.subscribers {
+			select {
+			case ch <- event.GenericEvent{Object: tunnel}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// reportProbe reports the result of the peer probe to the controller in the unreachableFrom
+// of the EgressTunnel, the agent only adds or removes its own node, so the reports of the
+// agents do not overwrite each other. The tunnel listed from the cache is compared first,
+// the agent re-reports whenever the status does not match its probe.
+func (p *peerLiveness) reportProbe(ctx context.Context, tunnel *egressv1.EgressTunnel, reachable bool) {
+	if !setUnreachableFrom(tunnel.DeepCopy(), p.node, reachable) {
+		return
+	}
+	if !reachable {
+		p.log.Info("peer is unreachable by the peer probe", "node", tunnel.Name)
+		p.recorder.Eventf(tunnel, corev1.EventTypeWarning, egressv1.ReasonPeerUnreachable,
+			"EgressTunnel is unreachable from node %s by the peer probe.", p.node)
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current := new(egressv1.EgressTunnel)
+		if err := p.client.Get(ctx, types.NamespacedName{Name: tunnel.Name}, current); err != nil {
+			return err
+		}
+		if !setUnreachableFrom(current, p.node, reachable) {
+			return nil
+		}
+		return p.client.Status().Update(ctx, current)
+	})
+	if err != nil {
+		p.log.Error(err, "failed to report the peer probe", "node", tunnel.Name)
+	}
+}
+
+// setUnreachableFrom adds the reporter to the unreachableFrom of the tunnel, or removes it
+// if the tunnel is reachable, it returns true if the unreachableFrom has been changed.
+func setUnreachableFrom(tunnel *egressv1.EgressTunnel, reporter string, reachable bool) bool {
+	from := tunnel.Status.UnreachableFrom
+	index := slices.Index(from, reporter)
+	switch {
+	case reachable && index >= 0:
+		tunnel.Status.UnreachableFrom = slices.Delete(from, index, index+1)
+	case !reachable && index < 0:
+		from = append(from, reporter)
+		slices.Sort(from)
+		tunnel.Status.UnreachableFrom = from
+	default:
+		return false
+	}
+	return true
+}
+
+// probePeers returns the underlay addresses of the gateway nodes to probe
+func (p *peerLiveness) probePeers(gateways *egressv1.EgressGatewayList, tunnels *egressv1.EgressTunnelList) map[string]*net.UDPAddr {
+	gatewayNodes := make(map[string]struct{})
+	for _, gateway := range gateways.Items {
+		for _, node := range gateway.Status.NodeList {
+			gatewayNodes[node.Name] = struct{}{}
+		}
+	}
+
+	peers := make(map[string]*net.UDPAddr)
+	for _, tunnel := range tunnels.Items {
+		if _, ok := gatewayNodes[tunnel.Name]; !ok || tunnel.Name == p.node {
+			continue
+		}
+		parent := tunnel.Status.Tunnel.Parent.IPv4
+		if parent == "" {
+			parent = tunnel.Status.Tunnel.Parent.IPv6
+		}
+		ip := net.ParseIP(parent)
+		if ip == nil {
+			continue
+		}
+		peers[tunnel.Name] = &net.UDPAddr{IP: ip, Port: p.probePort}
+	}
+	return peers
+}
+
+// standbyLeases returns the node leases of the active nodes of the EIPs whose standby
+// node is this node
+func (p *peerLiveness) standbyLeases(ctx context.Context, gateways *egressv1.EgressGatewayList) map[string]*coordinationv1.Lease {
+	leases := make(map[string]*coordinationv1.Lease)
+	for _, gateway := range gateways.Items {
+		for _, node := range gateway.Status.NodeList {
+			if _, ok := leases[node.Name]; ok {
+				continue
+			}
+			for _, eip := range node.Eips {
+				if eip.StandbyNode != p.node {
+					continue
+				}
+				nodeLease, err := lease.Get(ctx, p.client, p.leaseNamespace, node.Name)
+				if err != nil {
+					p.log.Error(err, "failed to get node lease", "node", node.Name)
+					break
+				}
+				if nodeLease != nil {
+					leases[node.Name] = nodeLease
+				}
+				break
+			}
+		}
+	}
+	return leases
+}
+
+// isAlive reports whether the agent of the node is alive, the unknown nodes are
+// considered alive, the controller takes care of them.
+func (p *peerLiveness) isAlive(node string) bool {
+	if p == nil {
+		return true
+	}
+	alive, ok := p.alive.Load(node)
+	return !ok || alive
+}
+
+// holder returns the node which holds the EIP now, it is the active node in the
+// gateway status, or the standby node of the EIP once the active node is dead.
+func (p *peerLiveness) holder(active string, eip egressv1.Eips) string {
+	if eip.StandbyNode == "" || p.isAlive(active) || !p.isAlive(eip.StandbyNode) {
+		return active
+	}
+	return eip.StandbyNode
+}
+
+// policyHolder returns the holder and the standby node of the EIP of the policy, it
+// returns empty nodes if the policy is not in the gateway status.
+func (p *peerLiveness) policyHolder(gateway *egressv1.EgressGateway, ns, name string) (string, string) {
+	for _, node := range gateway.Status.NodeList {
+		for _, eip := range node.Eips {
+			for _, policy := range eip.Policies {
+				if policy.Name == name && policy.Namespace == ns {
+					return p.holder(node.Name, eip), eip.StandbyNode
+				}
+			}
+		}
+	}
+	return "", ""
+}
+
+// buildStandbyEipRule builds the SNAT rule pre-installed on the standby node of the
+// EIP, it skips the traffic marked to the EgressTunnel, so it only takes effect once
+// the standby node holds the EIP and stops marking the traffic of the policy.
+func buildStandbyEipRule(policyName string, eip IP, version uint8, isIgnoreInternalCIDR bool, baseMark uint32) *iptables.Rule {
+	rule := buildEipRule(policyName, eip, version, isIgnoreInternalCIDR)
+	if rule == nil {
+		return nil
+	}
+	rule.Match = rule.Match.NotMarkMatchesWithMask(baseMark, 0xff000000)
+	rule.Comment = []string{fmt.Sprintf("standby snat policy %s", policyName)}
+	return rule
+}
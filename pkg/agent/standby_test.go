@@ -0,0 +1,28 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+func TestSetUnreachableFrom(t *testing.T) {
+	tunnel := new(egressv1.EgressTunnel)
+
+	assert.True(t, setUnreachableFrom(tunnel, "node2", false))
+	assert.True(t, setUnreachableFrom(tunnel, "node1", false))
+	assert.Equal(t, []string{"node1", "node2"}, tunnel.Status.UnreachableFrom)
+
+	// each agent only reports once
+	assert.False(t, setUnreachableFrom(tunnel, "node1", false))
+	assert.False(t, setUnreachableFrom(tunnel, "node3", true))
+
+	// the recovery seen by one agent does not clear the report of the others
+	assert.True(t, setUnreachableFrom(tunnel, "node1", true))
+	assert.Equal(t, []string{"node2"}, tunnel.Status.UnreachableFrom)
+}
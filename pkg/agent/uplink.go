@@ -0,0 +1,154 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/spidernet-io/egressgateway/pkg/iptables"
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/utils/ip"
+)
+
+func uplinkKey(uplink egressv1.EipUplink) string {
+	return uplinkLinkName(uplink) + "/" + uplink.NextHopIPv4 + "/" + uplink.NextHopIPv6
+}
+
+// uplinkOf returns the uplink of spec.ippools.uplinks which covers the EIP, it returns
+// nil if the EIP uses the main routing table
+func uplinkOf(ippools egressv1.Ippools, ipv4, ipv6 string) *egressv1.EipUplink {
+	for _, eip := range []string{ipv4, ipv6} {
+		if eip == "" {
+			continue
+		}
+		for i, item := range ippools.Uplinks {
+			ok, err := ip.CheckIPIncluded(eip, item.IPs)
+			if err == nil && ok {
+				return &ippools.Uplinks[i]
+			}
+		}
+	}
+	return nil
+}
+
+// eipUplink returns the uplink of spec.ippools.uplinks which covers the EIP, it returns
+// nil if the EIP is announced on the interface of the node
+func eipUplink(ippools egressv1.Ippools, eip net.IP) *egressv1.EipUplink {
+	if eip.To4() != nil {
+		return uplinkOf(ippools, eip.String(), "")
+	}
+	return uplinkOf(ippools, "", eip.String())
+}
+
+// uplinkOffsets returns the offset of the routing table and the mark of each uplink, the
+// uplinks are sorted so the offsets are stable, the uplinks beyond maxUplinks, the number
+// of the routing tables and marks reserved by gatewayUplinkRouteCount, are dropped
+func uplinkOffsets(uplinks map[string]egressv1.EipUplink, maxUplinks int) map[string]int {
+	keys := make([]string, 0, len(uplinks))
+	for key := range uplinks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	offsets := make(map[string]int, len(keys))
+	for i, key := range keys {
+		if i >= maxUplinks {
+			break
+		}
+		offsets[key] = i
+	}
+	return offsets
+}
+
+// ensureUplinks programs the mark rules and the routing tables of the uplinks used by
+// the EIPs held by this node, and removes the ones which are not used, it returns the
+// mark of each uplink
+func (r *policeReconciler) ensureUplinks(uplinks map[string]egressv1.EipUplink) map[string]uint32 {
+	tableBase := r.cfg.FileConfig.GatewayUplinkRouteTable
+	markBase := r.cfg.FileConfig.GatewayUplinkRouteMark
+	maxUplinks := r.cfg.FileConfig.GatewayUplinkRouteCount
+	if len(uplinks) > maxUplinks {
+		r.log.Info("too many uplinks, the EIPs of the extra ones use the main routing table", "max", maxUplinks)
+	}
+
+	marks := make(map[string]uint32)
+	used := make(map[int]struct{})
+	for key, offset := range uplinkOffsets(uplinks, maxUplinks) {
+		uplink := uplinks[key]
+		table, mark := tableBase+offset, markBase+offset
+		log := r.log.WithValues("interface", uplinkLinkName(uplink), "table", table, "mark", mark)
+		used[offset] = struct{}{}
+
+		link, err := netlink.LinkByName(uplinkLinkName(uplink))
+		if err != nil {
+			log.Error(err, "failed to get the link of uplink")
+			continue
+		}
+		families := []struct {
+			enable  bool
+			family  int
+			nextHop string
+		}{
+			{r.cfg.FileConfig.EnableIPv4, netlink.FAMILY_V4, uplink.NextHopIPv4},
+			{r.cfg.FileConfig.EnableIPv6, netlink.FAMILY_V6, uplink.NextHopIPv6},
+		}
+		ok := true
+		for _, item := range families {
+			if !item.enable {
+				continue
+			}
+			var gw *net.IP
+			if item.nextHop != "" {
+				nextHop := net.ParseIP(item.nextHop)
+				gw = &nextHop
+			}
+			if err := r.ruleRoute.EnsureRule(item.family, table, mark, log); err != nil {
+				log.Error(err, "failed to ensure the rule of uplink")
+				ok = false
+				continue
+			}
+			if err := r.ruleRoute.EnsureLinkRoute(link, gw, item.family, table, log); err != nil {
+				log.Error(err, "failed to ensure the route of uplink")
+				ok = false
+			}
+		}
+		if ok {
+			marks[key] = uint32(mark)
+		}
+	}
+
+	usedMarks := make(map[int]struct{}, len(used))
+	for offset := range used {
+		usedMarks[markBase+offset] = struct{}{}
+	}
+	if err := r.ruleRoute.PurgeStaleRulesInRange(usedMarks, markBase, markBase+maxUplinks-1); err != nil {
+		r.log.Error(err, "failed to purge the stale rules of uplinks")
+	}
+	// the routing tables are only flushed once they are released, or when the agent starts
+	for offset := 0; offset < maxUplinks; offset++ {
+		_, isUsed := used[offset]
+		_, wasUsed := r.uplinkTables[offset]
+		if isUsed || (r.uplinkTables != nil && !wasUsed) {
+			continue
+		}
+		for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+			if err := r.ruleRoute.EnsureRoute(nil, nil, family, tableBase+offset, r.log); err != nil {
+				r.log.Error(err, "failed to flush the routing table of uplink", "table", tableBase+offset)
+			}
+		}
+	}
+	r.uplinkTables = used
+	return marks
+}
+
+// buildUplinkRule marks the traffic of the policy SNATed on this node, so it is routed
+// by the routing table of the uplink
+func (r *policeReconciler) buildUplinkRule(policyName string, mark uint32, version uint8, isIgnoreInternalCIDR bool) *iptables.Rule {
+	rule := r.buildPolicyRule(policyName, mark, version, isIgnoreInternalCIDR)
+	rule.Comment = []string{fmt.Sprintf("Set uplink mark for EgressPolicy %s", policyName)}
+	return rule
+}
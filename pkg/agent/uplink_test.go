@@ -0,0 +1,62 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+func TestUplinkOf(t *testing.T) {
+	ippools := egressv1.Ippools{
+		IPv4: []string{"10.6.1.1-10.6.1.20"},
+		IPv6: []string{"fd00::1-fd00::20"},
+		Uplinks: []egressv1.EipUplink{
+			{IPs: []string{"10.6.1.1-10.6.1.10"}, Interface: "eth1", NextHopIPv4: "10.6.1.254"},
+			{IPs: []string{"fd00::11-fd00::20"}, Interface: "eth2", NextHopIPv6: "fd00::fe"},
+		},
+	}
+
+	cases := map[string]struct {
+		ipv4, ipv6 string
+		expect     string
+	}{
+		"ipv4 covered":          {ipv4: "10.6.1.5", expect: "eth1"},
+		"ipv6 covered":          {ipv6: "fd00::15", expect: "eth2"},
+		"dual stack, ipv4 wins": {ipv4: "10.6.1.5", ipv6: "fd00::15", expect: "eth1"},
+		"not covered":           {ipv4: "10.6.1.15", ipv6: "fd00::5"},
+		"node ip":               {},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			uplink := uplinkOf(ippools, c.ipv4, c.ipv6)
+			if c.expect == "" {
+				assert.Nil(t, uplink)
+				return
+			}
+			if assert.NotNil(t, uplink) {
+				assert.Equal(t, c.expect, uplink.Interface)
+			}
+		})
+	}
+}
+
+func TestUplinkOffsets(t *testing.T) {
+	maxUplinks := 16
+	uplinks := make(map[string]egressv1.EipUplink)
+	for i := 0; i < maxUplinks+2; i++ {
+		uplink := egressv1.EipUplink{Interface: fmt.Sprintf("eth%02d", i)}
+		uplinks[uplinkKey(uplink)] = uplink
+	}
+
+	offsets := uplinkOffsets(uplinks, maxUplinks)
+	assert.Len(t, offsets, maxUplinks)
+	assert.Equal(t, 0, offsets["eth00//"])
+	assert.Equal(t, maxUplinks-1, offsets[fmt.Sprintf("eth%02d//", maxUplinks-1)])
+	assert.NotContains(t, offsets, fmt.Sprintf("eth%02d//", maxUplinks))
+}
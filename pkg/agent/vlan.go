@@ -0,0 +1,113 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+
+	"github.com/vishvananda/netlink"
+
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+// vlanAlias marks the VLAN sub-interfaces and the virtual MAC interfaces created by the
+// agent, so the stale ones are removed after the agent restarts
+const vlanAlias = "egressgateway"
+
+// uplinkLinkName returns the name of the link the traffic of the uplink leaves through
+func uplinkLinkName(uplink egressv1.EipUplink) string {
+	if uplink.VlanID == 0 {
+		return uplink.Interface
+	}
+	return vlanName(uplink.Interface, int(uplink.VlanID))
+}
+
+// vlanName returns the name of the VLAN sub-interface, it is `<parent>.<id>`, or a name
+// derived from the hash of the parent if it exceeds the limit of the interface name
+func vlanName(parent string, id int) string {
+	name := fmt.Sprintf("%s.%d", parent, id)
+	if len(name) <= 15 {
+		return name
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(parent))
+	return fmt.Sprintf("eg%08x.%d", h.Sum32(), id)
+}
+
+// ensureVlans creates the VLAN sub-interfaces of the uplinks used by the EIPs held by
+// this node and brings them up, the sub-interfaces created by the agent which are not
+// used are removed
+func (r *policeReconciler) ensureVlans(uplinks map[string]egressv1.EipUplink) {
+	used := make(map[string]struct{})
+	for _, uplink := range uplinks {
+		if uplink.VlanID == 0 {
+			continue
+		}
+		name := uplinkLinkName(uplink)
+		used[name] = struct{}{}
+		if _, err := ensureVlan(name, uplink.Interface, int(uplink.VlanID)); err != nil {
+			r.log.Error(err, "failed to ensure vlan sub-interface", "interface", name)
+		}
+	}
+
+	links, err := netlink.LinkList()
+	if err != nil {
+		r.log.Error(err, "failed to list links")
+		return
+	}
+	for _, link := range links {
+		if _, ok := link.(*netlink.Vlan); !ok || link.Attrs().Alias != vlanAlias {
+			continue
+		}
+		if _, ok := used[link.Attrs().Name]; ok {
+			continue
+		}
+		r.log.Info("delete vlan sub-interface which is not used", "interface", link.Attrs().Name)
+		if err := netlink.LinkDel(link); err != nil {
+			r.log.Error(err, "failed to delete vlan sub-interface", "interface", link.Attrs().Name)
+		}
+	}
+}
+
+// ensureVlan creates the VLAN sub-interface of the parent and brings it up, it reports
+// whether the sub-interface is created
+func ensureVlan(name, parent string, id int) (bool, error) {
+	parentLink, err := netlink.LinkByName(parent)
+	if err != nil {
+		return false, fmt.Errorf("failed to get parent interface %s: %w", parent, err)
+	}
+
+	created := false
+	link, err := netlink.LinkByName(name)
+	if err == nil {
+		vlan, ok := link.(*netlink.Vlan)
+		if !ok || vlan.VlanId != id || vlan.ParentIndex != parentLink.Attrs().Index {
+			return false, fmt.Errorf("interface %s exists and is not the vlan %d of %s", name, id, parent)
+		}
+	} else {
+		if _, ok := err.(netlink.LinkNotFoundError); !ok {
+			return false, err
+		}
+		link = &netlink.Vlan{
+			LinkAttrs: netlink.LinkAttrs{Name: name, ParentIndex: parentLink.Attrs().Index},
+			VlanId:    id,
+		}
+		if err := netlink.LinkAdd(link); err != nil {
+			return false, fmt.Errorf("failed to add vlan sub-interface %s: %w", name, err)
+		}
+		if err := netlink.LinkSetAlias(link, vlanAlias); err != nil {
+			return false, fmt.Errorf("failed to set alias of vlan sub-interface %s: %w", name, err)
+		}
+		created = true
+	}
+
+	if link.Attrs().Flags&net.FlagUp == 0 {
+		if err := netlink.LinkSetUp(link); err != nil {
+			return created, fmt.Errorf("failed to set vlan sub-interface %s up: %w", name, err)
+		}
+	}
+	return created, nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+func TestUplinkLinkName(t *testing.T) {
+	cases := map[string]struct {
+		uplink egressv1.EipUplink
+		expect string
+	}{
+		"no vlan": {
+			uplink: egressv1.EipUplink{Interface: "eth1"},
+			expect: "eth1",
+		},
+		"vlan": {
+			uplink: egressv1.EipUplink{Interface: "eth1", VlanID: 100},
+			expect: "eth1.100",
+		},
+		"long parent name": {
+			uplink: egressv1.EipUplink{Interface: "enp0s31f6abcd", VlanID: 4094},
+			expect: vlanName("enp0s31f6abcd", 4094),
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := uplinkLinkName(c.uplink)
+			assert.Equal(t, c.expect, got)
+			assert.LessOrEqual(t, len(got), 15)
+		})
+	}
+
+	assert.NotEqual(t, vlanName("enp0s31f6abcd", 100), vlanName("enp0s31f6abce", 100))
+}
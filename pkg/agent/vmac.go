@@ -0,0 +1,276 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/vishvananda/netlink"
+
+	"github.com/spidernet-io/egressgateway/pkg/agent/vxlan"
+	"github.com/spidernet-io/egressgateway/pkg/constant"
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/utils/ip"
+)
+
+// virtualMAC returns the VRRP virtual MAC of the virtual router id
+func virtualMAC(id int, ipv6 bool) net.HardwareAddr {
+	if ipv6 {
+		return net.HardwareAddr{0x00, 0x00, 0x5e, 0x00, 0x02, byte(id)}
+	}
+	return net.HardwareAddr{0x00, 0x00, 0x5e, 0x00, 0x01, byte(id)}
+}
+
+// vmacLinkName returns the name of the macvlan interface of the virtual MAC
+func vmacLinkName(id int, ipv6 bool) string {
+	if ipv6 {
+		return fmt.Sprintf("egvmac6.%d", id)
+	}
+	return fmt.Sprintf("egvmac4.%d", id)
+}
+
+// eipVirtualRouterID returns the virtual router id of the EIP, it is 0 if the virtual
+// MAC is not enabled or the EIP is not in the ippools
+func eipVirtualRouterID(ippools egressv1.Ippools, eip net.IP) (int, error) {
+	if ippools.VirtualRouterID == 0 {
+		return 0, nil
+	}
+	version, ranges := constant.IPv4, ippools.IPv4
+	if eip.To4() == nil {
+		version, ranges = constant.IPv6, ippools.IPv6
+	}
+	ok, err := ip.IsIPIncludedRange(version, eip.String(), ranges)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return ippools.EipVirtualRouterID(eip), nil
+}
+
+// virtualMACs binds the virtual MACs of the EIPs held by this node through macvlan
+// interfaces, so the MAC of an EIP stays the same when the EIP moves to another node
+// and the neighbours which ignore gratuitous ARP keep reaching it
+type virtualMACs struct {
+	log       logr.Logger
+	getParent func(version int) (*vxlan.Parent, error)
+	// rescan is called once a macvlan interface is created
+	rescan func()
+
+	mu sync.Mutex
+	// links is the macvlan interfaces used by the EIPs of the policies
+	links map[string]map[string]string
+}
+
+func newVirtualMACs(log logr.Logger, intf string, rescan func()) *virtualMACs {
+	netLink := vxlan.NetLink{
+		RouteListFiltered: netlink.RouteListFiltered,
+		LinkByIndex:       netlink.LinkByIndex,
+		AddrList:          netlink.AddrList,
+		LinkByName:        netlink.LinkByName,
+	}
+	getParent := vxlan.GetParentByDefaultRoute(netLink)
+	if intf != "" {
+		getParent = vxlan.GetParentByName(netLink, intf)
+	}
+	return &virtualMACs{
+		log:       log.WithName("virtual-mac"),
+		getParent: getParent,
+		rescan:    rescan,
+		links:     make(map[string]map[string]string),
+	}
+}
+
+// set binds the virtual MACs of the EIPs of the policy, the macvlan interface of an EIP is
+// created on the link of its uplink in parents, or on the interface of the node, it returns
+// the macvlan interfaces of the EIPs
+func (v *virtualMACs) set(name string, ippools egressv1.Ippools, eips []net.IP, parents map[string]string) (map[string]string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	links := make(map[string]string)
+	created := false
+	var errs error
+	for _, eip := range eips {
+		id, err := eipVirtualRouterID(ippools, eip)
+		if err != nil {
+			errs = err
+			continue
+		}
+		if id == 0 {
+			continue
+		}
+		ipv6 := eip.To4() == nil
+		link := vmacLinkName(id, ipv6)
+		ok, err := v.ensure(link, virtualMAC(id, ipv6), ipv6, parents[eip.String()])
+		if err != nil {
+			errs = fmt.Errorf("failed to ensure virtual MAC interface %s: %w", link, err)
+			continue
+		}
+		created = created || ok
+		links[eip.String()] = link
+	}
+
+	old := v.links[name]
+	if len(links) == 0 {
+		delete(v.links, name)
+	} else {
+		v.links[name] = links
+	}
+	v.prune(old)
+
+	if created && v.rescan != nil {
+		v.rescan()
+	}
+	return links, errs
+}
+
+// release unbinds the virtual MACs of the EIPs of the policy
+func (v *virtualMACs) release(name string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	old, ok := v.links[name]
+	if !ok {
+		return
+	}
+	delete(v.links, name)
+	v.prune(old)
+}
+
+// prune deletes the macvlan interfaces which are not used by any policy
+func (v *virtualMACs) prune(candidates map[string]string) {
+	for _, link := range candidates {
+		if v.used(link) {
+			continue
+		}
+		if err := deleteVirtualMAC(link); err != nil {
+			v.log.Error(err, "failed to delete virtual MAC interface", "interface", link)
+			continue
+		}
+		v.log.Info("delete virtual MAC interface", "interface", link)
+	}
+}
+
+func (v *virtualMACs) used(link string) bool {
+	for _, links := range v.links {
+		for _, item := range links {
+			if item == link {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ensure creates the macvlan interface of the virtual MAC on the parent interface, which
+// is the interface of the node if parentName is empty, it reports whether the interface
+// is created
+func (v *virtualMACs) ensure(name string, mac net.HardwareAddr, ipv6 bool, parentName string) (bool, error) {
+	version := 4
+	if ipv6 {
+		version = 6
+	}
+	var parent *vxlan.Parent
+	var err error
+	if parentName != "" {
+		parent, err = linkParent(parentName)
+	} else {
+		parent, err = v.getParent(version)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	link, err := netlink.LinkByName(name)
+	if err == nil {
+		if link.Attrs().HardwareAddr.String() != mac.String() {
+			return false, fmt.Errorf("interface %s exists with MAC %s", name, link.Attrs().HardwareAddr)
+		}
+		if link.Attrs().ParentIndex != parent.Index {
+			return false, fmt.Errorf("interface %s exists on another interface than %s", name, parent.Name)
+		}
+		if link.Attrs().Flags&net.FlagUp == 0 {
+			return false, netlink.LinkSetUp(link)
+		}
+		return false, nil
+	}
+	if _, ok := err.(netlink.LinkNotFoundError); !ok {
+		return false, err
+	}
+
+	link = &netlink.Macvlan{
+		LinkAttrs: netlink.LinkAttrs{Name: name, ParentIndex: parent.Index, HardwareAddr: mac},
+		Mode:      netlink.MACVLAN_MODE_BRIDGE,
+	}
+	if err := netlink.LinkAdd(link); err != nil {
+		return false, fmt.Errorf("failed to add macvlan on %s: %w", parent.Name, err)
+	}
+	if err := netlink.LinkSetAlias(link, vlanAlias); err != nil {
+		return false, fmt.Errorf("failed to set alias: %w", err)
+	}
+	// the node addresses are answered by the parent interface only
+	if err := os.WriteFile(fmt.Sprintf("/proc/sys/net/ipv4/conf/%s/arp_ignore", name), []byte("1"), 0); err != nil {
+		return false, fmt.Errorf("failed to set arp_ignore: %w", err)
+	}
+	// the traffic to the EIP comes in through the macvlan while the route back to its source
+	// goes through the parent interface, the loose mode accepts it whatever conf/all is
+	if err := os.WriteFile(fmt.Sprintf("/proc/sys/net/ipv4/conf/%s/rp_filter", name), []byte("2"), 0); err != nil {
+		return false, fmt.Errorf("failed to set rp_filter: %w", err)
+	}
+	if err := netlink.LinkSetUp(link); err != nil {
+		return false, fmt.Errorf("failed to set up: %w", err)
+	}
+	v.log.Info("add virtual MAC interface", "interface", name, "mac", mac.String(), "parent", parent.Name)
+	return true, nil
+}
+
+// Start removes the macvlan interfaces left by the previous agent, whose EIPs may have
+// been moved to another node while the agent was restarting
+func (v *virtualMACs) Start(ctx context.Context) error {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return fmt.Errorf("failed to list links: %w", err)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, link := range links {
+		if _, ok := link.(*netlink.Macvlan); !ok || link.Attrs().Alias != vlanAlias {
+			continue
+		}
+		if v.used(link.Attrs().Name) {
+			continue
+		}
+		v.log.Info("delete stale virtual MAC interface", "interface", link.Attrs().Name)
+		if err := netlink.LinkDel(link); err != nil {
+			v.log.Error(err, "failed to delete stale virtual MAC interface", "interface", link.Attrs().Name)
+		}
+	}
+	return nil
+}
+
+// linkParent returns the link of the uplink by its name, the link of a VLAN uplink may
+// have no address
+func linkParent(name string) (*vxlan.Parent, error) {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get interface %s: %w", name, err)
+	}
+	return &vxlan.Parent{Name: name, Index: link.Attrs().Index}, nil
+}
+
+func deleteVirtualMAC(name string) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+	return netlink.LinkDel(link)
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+func TestVirtualMAC(t *testing.T) {
+	assert.Equal(t, "00:00:5e:00:01:15", virtualMAC(21, false).String())
+	assert.Equal(t, "00:00:5e:00:02:ff", virtualMAC(255, true).String())
+	assert.Equal(t, "egvmac4.21", vmacLinkName(21, false))
+	assert.LessOrEqual(t, len(vmacLinkName(255, true)), 15)
+}
+
+func TestEipVirtualRouterID(t *testing.T) {
+	ippools := egressv1.Ippools{
+		IPv4:            []string{"10.6.1.21-10.6.1.23", "10.6.1.30"},
+		IPv6:            []string{"fd00::21-fd00::22"},
+		VirtualRouterID: 10,
+	}
+	cases := map[string]struct {
+		ippools egressv1.Ippools
+		eip     string
+		expect  int
+		err     bool
+	}{
+		"ipv4": {
+			ippools: ippools,
+			eip:     "10.6.1.21",
+			expect:  31,
+		},
+		"ipv4 in another range": {
+			ippools: ippools,
+			eip:     "10.6.1.30",
+			expect:  40,
+		},
+		"ipv6": {
+			ippools: ippools,
+			eip:     "fd00::22",
+			expect:  44,
+		},
+		"the id does not depend on the ippool": {
+			ippools: egressv1.Ippools{IPv4: []string{"10.6.1.30"}, VirtualRouterID: 10},
+			eip:     "10.6.1.30",
+			expect:  40,
+		},
+		"not in ippools": {
+			ippools: ippools,
+			eip:     "10.6.1.40",
+			expect:  0,
+		},
+		"disabled": {
+			ippools: egressv1.Ippools{IPv4: []string{"10.6.1.21"}},
+			eip:     "10.6.1.21",
+			expect:  0,
+		},
+		"wraps around 255": {
+			ippools: egressv1.Ippools{IPv4: []string{"10.6.1.21-10.6.1.22"}, VirtualRouterID: 255},
+			eip:     "10.6.1.22",
+			expect:  22,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			id, err := eipVirtualRouterID(c.ippools, net.ParseIP(c.eip))
+			if c.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.expect, id)
+		})
+	}
+}
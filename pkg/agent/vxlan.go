@@ -868,6 +868,10 @@ func (r *vxlanReconciler) Start(ctx context.Context) error {
 	if !r.cfg.FileConfig.GatewayFailover.Enable {
 		return nil
 	}
+	// the heartbeats are the renewals of the node lease, see nodeLease
+	if r.cfg.FileConfig.GatewayFailover.HeartbeatMode == config.HeartbeatModeLease {
+		return nil
+	}
 	return r.syncLastHeartbeatTime(ctx)
 }
 
@@ -0,0 +1,102 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+// Package cidrgroup resolves the EgressCIDRGroups, the named lists of destination CIDRs
+// shared by the policies, and maintains the policies referencing them in their status.
+package cidrgroup
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+// Groups returns the EgressCIDRGroups by name
+func Groups(ctx context.Context, cli client.Reader) (map[string]egressv1.EgressCIDRGroup, error) {
+	list := new(egressv1.EgressCIDRGroupList)
+	if err := cli.List(ctx, list); err != nil {
+		return nil, fmt.Errorf("failed to list EgressCIDRGroup: %w", err)
+	}
+	res := make(map[string]egressv1.EgressCIDRGroup, len(list.Items))
+	for _, item := range list.Items {
+		res[item.Name] = item
+	}
+	return res, nil
+}
+
+// Expand returns the groups and the groups they include recursively, each group is
+// returned once. The groups which do not exist are skipped.
+func Expand(groups map[string]egressv1.EgressCIDRGroup, names []string) []string {
+	res := make([]string, 0)
+	visited := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		group, ok := groups[name]
+		if !ok {
+			return
+		}
+		res = append(res, name)
+		for _, include := range group.Spec.Includes {
+			visit(include)
+		}
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return res
+}
+
+// CIDRs returns the CIDRs of the group and the groups it includes
+func CIDRs(groups map[string]egressv1.EgressCIDRGroup, name string) []string {
+	res := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, item := range Expand(groups, []string{name}) {
+		for _, cidr := range groups[item].Spec.CIDRs {
+			if !seen[cidr] {
+				seen[cidr] = true
+				res = append(res, cidr)
+			}
+		}
+	}
+	return res
+}
+
+// FindCycle returns the groups of an include cycle through the group, it is nil when the
+// group is not in a cycle
+func FindCycle(groups map[string]egressv1.EgressCIDRGroup, name string) []string {
+	path := []string{name}
+	onPath := map[string]bool{name: true}
+	done := make(map[string]bool)
+	var visit func(name string) bool
+	visit = func(cur string) bool {
+		for _, include := range groups[cur].Spec.Includes {
+			if include == name {
+				path = append(path, include)
+				return true
+			}
+			if onPath[include] || done[include] {
+				continue
+			}
+			path = append(path, include)
+			onPath[include] = true
+			if visit(include) {
+				return true
+			}
+			path = path[:len(path)-1]
+			onPath[include] = false
+			done[include] = true
+		}
+		return false
+	}
+	if visit(name) {
+		return path
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package cidrgroup
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/schema"
+)
+
+func group(name string, cidrs []string, includes ...string) egressv1.EgressCIDRGroup {
+	return egressv1.EgressCIDRGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       egressv1.EgressCIDRGroupSpec{CIDRs: cidrs, Includes: includes},
+	}
+}
+
+func TestCIDRs(t *testing.T) {
+	groups := map[string]egressv1.EgressCIDRGroup{
+		"a": group("a", []string{"10.0.0.0/8"}, "b", "c", "missing"),
+		"b": group("b", []string{"10.0.0.0/8", "20.0.0.0/8"}, "c"),
+		"c": group("c", []string{"30.0.0.0/8"}, "a"),
+	}
+
+	cases := map[string]struct {
+		group string
+		want  []string
+	}{
+		"includes are resolved once": {group: "a", want: []string{"10.0.0.0/8", "20.0.0.0/8", "30.0.0.0/8"}},
+		"cycle ends at the start":    {group: "c", want: []string{"30.0.0.0/8", "10.0.0.0/8", "20.0.0.0/8"}},
+		"missing group has no cidrs": {group: "missing", want: []string{}},
+		"missing include is skipped": {group: "b", want: []string{"10.0.0.0/8", "20.0.0.0/8", "30.0.0.0/8"}},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, c.want, CIDRs(groups, c.group))
+		})
+	}
+}
+
+func TestFindCycle(t *testing.T) {
+	groups := map[string]egressv1.EgressCIDRGroup{
+		"a": group("a", nil, "b"),
+		"b": group("b", nil, "c", "d"),
+		"c": group("c", nil),
+		"d": group("d", nil, "a"),
+		"e": group("e", nil, "a"),
+	}
+	assert.Equal(t, []string{"a", "b", "d", "a"}, FindCycle(groups, "a"))
+	assert.Nil(t, FindCycle(groups, "c"))
+	// e includes a cycle but is not in it
+	assert.Nil(t, FindCycle(groups, "e"))
+}
+
+func TestReconcile(t *testing.T) {
+	partner := group("partner", []string{"1.1.1.0/24"})
+	all := group("all", nil, "partner")
+	policy := &egressv1.EgressPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "default"},
+		Spec:       egressv1.EgressPolicySpec{DestCIDRGroups: []string{"all"}},
+	}
+	clusterPolicy := &egressv1.EgressClusterPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "c1"},
+		Spec:       egressv1.EgressClusterPolicySpec{DestCIDRGroups: []string{"partner"}},
+	}
+	other := &egressv1.EgressClusterPolicy{ObjectMeta: metav1.ObjectMeta{Name: "c2"}}
+	cli := fake.NewClientBuilder().WithScheme(schema.GetScheme()).
+		WithObjects(&partner, &all, policy, clusterPolicy, other).
+		WithStatusSubresource(&partner, &all).Build()
+
+	r := &groupReconciler{client: cli, log: logr.Discard()}
+	ctx := context.Background()
+	status := func(name string) []egressv1.Policy {
+		_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: name}})
+		assert.NoError(t, err)
+		res := new(egressv1.EgressCIDRGroup)
+		assert.NoError(t, cli.Get(ctx, types.NamespacedName{Name: name}, res))
+		return res.Status.Policies
+	}
+
+	assert.Equal(t, []egressv1.Policy{{Name: "c1"}, {Name: "p1", Namespace: "default"}}, status("partner"))
+	assert.Equal(t, []egressv1.Policy{{Name: "p1", Namespace: "default"}}, status("all"))
+
+	assert.NoError(t, cli.Delete(ctx, policy))
+	assert.Equal(t, []egressv1.Policy{{Name: "c1"}}, status("partner"))
+	assert.Empty(t, status("all"))
+}
@@ -0,0 +1,140 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package cidrgroup
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+// groupReconciler updates the policies referencing the EgressCIDRGroup in its status
+type groupReconciler struct {
+	client client.Client
+	log    logr.Logger
+}
+
+func (r *groupReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	log := r.log.WithValues("name", req.Name)
+	log.V(1).Info("reconcile")
+
+	group := new(egressv1.EgressCIDRGroup)
+	if err := r.client.Get(ctx, req.NamespacedName, group); err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	policies, err := r.referencingPolicies(ctx, group.Name)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if reflect.DeepEqual(policies, group.Status.Policies) {
+		return reconcile.Result{}, nil
+	}
+	group.Status.Policies = policies
+	if err := r.client.Status().Update(ctx, group); err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to update status of EgressCIDRGroup %s: %w", group.Name, err)
+	}
+	return reconcile.Result{}, nil
+}
+
+// referencingPolicies returns the policies which reference the group, directly or through
+// the groups including it
+func (r *groupReconciler) referencingPolicies(ctx context.Context, name string) ([]egressv1.Policy, error) {
+	groups, err := Groups(ctx, r.client)
+	if err != nil {
+		return nil, err
+	}
+	references := func(names []string) bool {
+		for _, item := range Expand(groups, names) {
+			if item == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	var res []egressv1.Policy
+	policies := new(egressv1.EgressPolicyList)
+	if err := r.client.List(ctx, policies); err != nil {
+		return nil, fmt.Errorf("failed to list EgressPolicy: %w", err)
+	}
+	for _, item := range policies.Items {
+		if references(item.Spec.DestCIDRGroups) {
+			res = append(res, egressv1.Policy{Name: item.Name, Namespace: item.Namespace})
+		}
+	}
+	clusterPolicies := new(egressv1.EgressClusterPolicyList)
+	if err := r.client.List(ctx, clusterPolicies); err != nil {
+		return nil, fmt.Errorf("failed to list EgressClusterPolicy: %w", err)
+	}
+	for _, item := range clusterPolicies.Items {
+		if references(item.Spec.DestCIDRGroups) {
+			res = append(res, egressv1.Policy{Name: item.Name})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Namespace != res[j].Namespace {
+			return res[i].Namespace < res[j].Namespace
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res, nil
+}
+
+// allGroups maps the event to all the groups, a change of the includes of a group or the
+// groups of a policy may change the status of any group
+func (r *groupReconciler) allGroups(ctx context.Context, _ client.Object) []reconcile.Request {
+	list := new(egressv1.EgressCIDRGroupList)
+	if err := r.client.List(ctx, list); err != nil {
+		r.log.Error(err, "failed to list EgressCIDRGroup")
+		return nil
+	}
+	res := make([]reconcile.Request, 0, len(list.Items))
+	for _, item := range list.Items {
+		res = append(res, reconcile.Request{NamespacedName: types.NamespacedName{Name: item.Name}})
+	}
+	return res
+}
+
+// NewEgressCIDRGroupController returns the controller which maintains the status of the
+// EgressCIDRGroups
+func NewEgressCIDRGroupController(mgr manager.Manager, log logr.Logger) error {
+	r := &groupReconciler{
+		client: mgr.GetClient(),
+		log:    log.WithName("egress-cidr-group"),
+	}
+	c, err := controller.New("egressCIDRGroup", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+	if err := c.Watch(source.Kind(mgr.GetCache(), &egressv1.EgressCIDRGroup{}),
+		handler.EnqueueRequestsFromMapFunc(r.allGroups)); err != nil {
+		return fmt.Errorf("failed to watch EgressCIDRGroup: %w", err)
+	}
+	if err := c.Watch(source.Kind(mgr.GetCache(), &egressv1.EgressPolicy{}),
+		handler.EnqueueRequestsFromMapFunc(r.allGroups)); err != nil {
+		return fmt.Errorf("failed to watch EgressPolicy: %w", err)
+	}
+	if err := c.Watch(source.Kind(mgr.GetCache(), &egressv1.EgressClusterPolicy{}),
+		handler.EnqueueRequestsFromMapFunc(r.allGroups)); err != nil {
+		return fmt.Errorf("failed to watch EgressClusterPolicy: %w", err)
+	}
+	return nil
+}
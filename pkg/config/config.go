@@ -22,6 +22,7 @@ import (
 
 	"github.com/spidernet-io/egressgateway/pkg/iptables"
 	"github.com/spidernet-io/egressgateway/pkg/logger"
+	"github.com/spidernet-io/egressgateway/pkg/markallocator"
 )
 
 type Config struct {
@@ -43,26 +44,28 @@ func (cfg *Config) PrintPrettyConfig() {
 }
 
 type EnvConfig struct {
-	NodeName                  string        `mapstructure:"NODE_NAME"`
-	LeaderElection            bool          `mapstructure:"LEADER_ELECTION"`
-	LeaderElectionNamespace   string        `mapstructure:"LEADER_ELECTION_NAMESPACE"`
-	LeaderElectionID          string        `mapstructure:"LEADER_ELECTION_ID"`
-	LeaderElectionLostRestart bool          `mapstructure:"LEADER_ELECTION_LOST_RESTART"`
-	MetricsBindAddress        string        `mapstructure:"METRICS_BIND_ADDRESS"`
-	HealthProbeBindAddress    string        `mapstructure:"HEALTH_PROBE_BIND_ADDRESS"`
-	GopsPort                  int           `mapstructure:"GOPS_PORT"`
-	WebhookPort               int           `mapstructure:"WEBHOOK_PORT"`
-	PyroscopeServerAddr       string        `mapstructure:"PYROSCOPE_SERVER_ADDR"`
-	PodName                   string        `mapstructure:"POD_NAME"`
-	PodNamespace              string        `mapstructure:"POD_NAMESPACE"`
-	GolangMaxProcs            int32         `mapstructure:"GOLANG_MAX_PROCS"`
-	TLSCertDir                string        `mapstructure:"TLS_CERT_DIR"`
-	ConfigMapPath             string        `mapstructure:"CONFIGMAP_PATH"`
-	UseDevMode                bool          `mapstructure:"LOG_USE_DEV_MODE"`
-	Level                     string        `mapstructure:"LOG_LEVEL"`
-	WithCaller                bool          `mapstructure:"LOG_WITH_CALLER"`
-	Encoder                   string        `mapstructure:"LOG_ENCODER"`
-	Logger                    logger.Config `json:"-"`
+	NodeName                  string `mapstructure:"NODE_NAME"`
+	LeaderElection            bool   `mapstructure:"LEADER_ELECTION"`
+	LeaderElectionNamespace   string `mapstructure:"LEADER_ELECTION_NAMESPACE"`
+	LeaderElectionID          string `mapstructure:"LEADER_ELECTION_ID"`
+	LeaderElectionLostRestart bool   `mapstructure:"LEADER_ELECTION_LOST_RESTART"`
+	MetricsBindAddress        string `mapstructure:"METRICS_BIND_ADDRESS"`
+	HealthProbeBindAddress    string `mapstructure:"HEALTH_PROBE_BIND_ADDRESS"`
+	GopsPort                  int    `mapstructure:"GOPS_PORT"`
+	WebhookPort               int    `mapstructure:"WEBHOOK_PORT"`
+	PyroscopeServerAddr       string `mapstructure:"PYROSCOPE_SERVER_ADDR"`
+	PodName                   string `mapstructure:"POD_NAME"`
+	PodNamespace              string `mapstructure:"POD_NAMESPACE"`
+	GolangMaxProcs            int32  `mapstructure:"GOLANG_MAX_PROCS"`
+	TLSCertDir                string `mapstructure:"TLS_CERT_DIR"`
+	ConfigMapPath             string `mapstructure:"CONFIGMAP_PATH"`
+	UseDevMode                bool   `mapstructure:"LOG_USE_DEV_MODE"`
+	Level                     string `mapstructure:"LOG_LEVEL"`
+	WithCaller                bool   `mapstructure:"LOG_WITH_CALLER"`
+	Encoder                   string `mapstructure:"LOG_ENCODER"`
+	// ConntrackSyncSecret signs the conntrack entries sent between the agents
+	ConntrackSyncSecret string        `mapstructure:"CONNTRACK_SYNC_SECRET"`
+	Logger              logger.Config `json:"-"`
 }
 
 type FileConfig struct {
@@ -80,10 +83,25 @@ type FileConfig struct {
 	Mark                         string          `yaml:"mark"`
 	AnnouncedInterfacesToExclude []string        `yaml:"announcedInterfacesToExclude"`
 	AnnounceExcludeRegexp        *regexp.Regexp  `json:"-"`
+	EipMode                      string          `yaml:"eipMode"`
+	EipInterface                 string          `yaml:"eipInterface"`
+	EipProvider                  EipProvider     `yaml:"eipProvider"`
 	EnableGatewayReplyRoute      bool            `yaml:"enableGatewayReplyRoute"`
 	GatewayReplyRouteTable       int             `yaml:"gatewayReplyRouteTable"`
 	GatewayReplyRouteMark        int             `yaml:"gatewayReplyRouteMark"`
+	GatewayUplinkRouteTable      int             `yaml:"gatewayUplinkRouteTable"`
+	GatewayUplinkRouteMark       int             `yaml:"gatewayUplinkRouteMark"`
+	GatewayUplinkRouteCount      int             `yaml:"gatewayUplinkRouteCount"`
 	GatewayFailover              GatewayFailover `yaml:"gatewayFailover"`
+	SnatMetrics                  SnatMetrics     `yaml:"snatMetrics"`
+}
+
+// SnatMetrics the gateway nodes export the conntrack usage of the EIPs they hold
+type SnatMetrics struct {
+	Enable          bool `yaml:"enable"`
+	IntervalSeconds int  `yaml:"intervalSeconds"`
+	// TopDestinations is the number of the destinations exported of each EIP
+	TopDestinations int `yaml:"topDestinations"`
 }
 
 type GatewayFailover struct {
@@ -91,8 +109,67 @@ type GatewayFailover struct {
 	TunnelMonitorPeriod int  `yaml:"tunnelMonitorPeriod"`
 	TunnelUpdatePeriod  int  `yaml:"tunnelUpdatePeriod"`
 	EipEvictionTimeout  int  `yaml:"eipEvictionTimeout"`
+	LeaseDuration       int  `yaml:"leaseDuration"`
+	// HeartbeatMode is where the agents write their heartbeats, `status` updates the
+	// status of EgressTunnel, `lease` only renews the node leases
+	HeartbeatMode string `yaml:"heartbeatMode"`
+	// LeaseNamespace is the namespace of the node leases, default is the namespace of
+	// the pod
+	LeaseNamespace string `yaml:"leaseNamespace"`
+	// PeerProbe the agents probe the gateway nodes over the underlay to detect the
+	// failure of a peer in sub-second
+	PeerProbe PeerProbe `yaml:"peerProbe"`
+	// ConntrackSync the gateway nodes replicate the conntrack entries of the EIPs to
+	// their standby nodes, so the established connections survive the failover
+	ConntrackSync ConntrackSync `yaml:"conntrackSync"`
+}
+
+// PeerProbe is the opt-in liveness of the gateway nodes used by the standby nodes to
+// take the EIPs over, a gateway node is dead when it does not reply for TimeoutMillis
+type PeerProbe struct {
+	Enable         bool `yaml:"enable"`
+	Port           int  `yaml:"port"`
+	IntervalMillis int  `yaml:"intervalMillis"`
+	TimeoutMillis  int  `yaml:"timeoutMillis"`
+}
+
+type ConntrackSync struct {
+	Enable          bool `yaml:"enable"`
+	Port            int  `yaml:"port"`
+	IntervalSeconds int  `yaml:"intervalSeconds"`
 }
 
+const (
+	HeartbeatModeStatus = "status"
+	HeartbeatModeLease  = "lease"
+)
+
+const (
+	// EipModeLayer2 the agent answers the ARP and NDP requests of the EIPs
+	EipModeLayer2 = "layer2"
+	// EipModeInterfaceAddress the agent configures the EIPs on the interface
+	EipModeInterfaceAddress = "interfaceAddress"
+	// EipModeNone the agent does not announce the EIPs, they are attached by the eip provider
+	EipModeNone = "none"
+)
+
+// EipProvider the external system the controller informs when an EIP is allocated,
+// moved or released
+type EipProvider struct {
+	// Type is `webhook` or `file`, no provider is used if it is empty
+	Type string `yaml:"type"`
+	// URL the endpoint the webhook provider posts the events to
+	URL            string `yaml:"url"`
+	TimeoutSeconds int    `yaml:"timeoutSeconds"`
+	// Path the file the file provider keeps the attached EIPs in, it is used for testing
+	Path string `yaml:"path"`
+}
+
+const (
+	EipProviderWebhook = "webhook"
+	EipProviderFile    = "file"
+)
+
 const TunnelInterfaceDefaultRoute = "defaultRouteInterface"
 const TunnelInterfaceSpecific = "interface="
 
@@ -156,12 +233,34 @@ func LoadConfig(isAgent bool) (*Config, error) {
 				LockFilePath:            "/run/xtables.lock",
 				RestoreSupportsLock:     restoreSupportsLock,
 			},
-			Mark: "0x26000000",
+			Mark:                    "0x26000000",
+			EipMode:                 EipModeLayer2,
+			GatewayUplinkRouteTable: 700,
+			GatewayUplinkRouteMark:  40,
+			GatewayUplinkRouteCount: 16,
+			EipProvider: EipProvider{
+				TimeoutSeconds: 10,
+			},
+			SnatMetrics: SnatMetrics{
+				IntervalSeconds: 30,
+				TopDestinations: 10,
+			},
 			GatewayFailover: GatewayFailover{
 				Enable:              true,
 				TunnelMonitorPeriod: 5,
 				TunnelUpdatePeriod:  5,
 				EipEvictionTimeout:  15,
+				LeaseDuration:       10,
+				HeartbeatMode:       HeartbeatModeStatus,
+				PeerProbe: PeerProbe{
+					Port:           4794,
+					IntervalMillis: 300,
+					TimeoutMillis:  2000,
+				},
+				ConntrackSync: ConntrackSync{
+					Port:            4795,
+					IntervalSeconds: 5,
+				},
 			},
 		},
 	}
@@ -246,14 +345,100 @@ func LoadConfig(isAgent bool) (*Config, error) {
 		return nil, fmt.Errorf("failed to load kubeconfig, error: %w", err)
 	}
 
+	if config.FileConfig.GatewayFailover.LeaseNamespace == "" {
+		config.FileConfig.GatewayFailover.LeaseNamespace = config.PodNamespace
+	}
+
 	// validate config
+	switch config.FileConfig.EipMode {
+	case EipModeLayer2, EipModeInterfaceAddress, EipModeNone:
+	default:
+		return nil, fmt.Errorf("eipMode should be %s, %s or %s", EipModeLayer2, EipModeInterfaceAddress, EipModeNone)
+	}
+	switch provider := config.FileConfig.EipProvider; provider.Type {
+	case "":
+	case EipProviderWebhook:
+		if provider.URL == "" || provider.TimeoutSeconds <= 0 {
+			return nil, fmt.Errorf("url of eipProvider should not be empty and timeoutSeconds should be greater than 0")
+		}
+	case EipProviderFile:
+		if provider.Path == "" {
+			return nil, fmt.Errorf("path of eipProvider should not be empty")
+		}
+	default:
+		return nil, fmt.Errorf("type of eipProvider should be %s or %s", EipProviderWebhook, EipProviderFile)
+	}
+	if err := validateRoutes(config.FileConfig); err != nil {
+		return nil, err
+	}
+	if m := config.FileConfig.SnatMetrics; m.Enable && (m.IntervalSeconds <= 0 || m.TopDestinations <= 0) {
+		return nil, fmt.Errorf("intervalSeconds and topDestinations of snatMetrics should be greater than 0")
+	}
 	if config.FileConfig.GatewayFailover.Enable {
 		if config.FileConfig.GatewayFailover.EipEvictionTimeout <
 			(config.FileConfig.GatewayFailover.TunnelUpdatePeriod +
 				config.FileConfig.GatewayFailover.TunnelMonitorPeriod) {
 			return nil, fmt.Errorf("eipEvictionTimeout should be greater than the sum of tunnelUpdatePeriod and tunnelMonitorPeriod")
 		}
+		if config.FileConfig.GatewayFailover.LeaseDuration <= 0 ||
+			config.FileConfig.GatewayFailover.LeaseDuration > config.FileConfig.GatewayFailover.EipEvictionTimeout {
+			return nil, fmt.Errorf("leaseDuration should be greater than 0 and not greater than eipEvictionTimeout")
+		}
+		switch config.FileConfig.GatewayFailover.HeartbeatMode {
+		case HeartbeatModeStatus, HeartbeatModeLease:
+		default:
+			return nil, fmt.Errorf("heartbeatMode should be %s or %s", HeartbeatModeStatus, HeartbeatModeLease)
+		}
+		if probe := config.FileConfig.GatewayFailover.PeerProbe; probe.Enable &&
+			(probe.Port <= 0 || probe.IntervalMillis <= 0 || probe.TimeoutMillis <= probe.IntervalMillis) {
+			return nil, fmt.Errorf("port and intervalMillis of peerProbe should be greater than 0, and timeoutMillis should be greater than intervalMillis")
+		}
+		if sync := config.FileConfig.GatewayFailover.ConntrackSync; sync.Enable &&
+			(sync.Port <= 0 || sync.IntervalSeconds <= 0) {
+			return nil, fmt.Errorf("port and intervalSeconds of conntrackSync should be greater than 0")
+		}
 	}
 
 	return config, nil
 }
+
+// validateRoutes checks the routing tables and the marks reserved for the uplinks, from
+// gatewayUplinkRouteTable and gatewayUplinkRouteMark for gatewayUplinkRouteCount uplinks,
+// do not overlap the ones of the reply route, the reserved routing tables and the marks
+// of the policies
+func validateRoutes(c FileConfig) error {
+	count := c.GatewayUplinkRouteCount
+	if count <= 0 || c.GatewayUplinkRouteTable <= 0 || c.GatewayUplinkRouteMark <= 0 {
+		return fmt.Errorf("gatewayUplinkRouteTable, gatewayUplinkRouteMark and gatewayUplinkRouteCount should be greater than 0")
+	}
+	tableStart, tableEnd := c.GatewayUplinkRouteTable, c.GatewayUplinkRouteTable+count-1
+	markStart, markEnd := c.GatewayUplinkRouteMark, c.GatewayUplinkRouteMark+count-1
+	overlap := func(start, end, otherStart, otherEnd int) bool {
+		return start <= otherEnd && otherStart <= end
+	}
+
+	// the default, main and local tables
+	if overlap(tableStart, tableEnd, 253, 255) {
+		return fmt.Errorf("the uplink routing tables [%d, %d] overlap the reserved tables [253, 255]",
+			tableStart, tableEnd)
+	}
+	if c.EnableGatewayReplyRoute {
+		if overlap(tableStart, tableEnd, c.GatewayReplyRouteTable, c.GatewayReplyRouteTable) {
+			return fmt.Errorf("the uplink routing tables [%d, %d] overlap gatewayReplyRouteTable %d",
+				tableStart, tableEnd, c.GatewayReplyRouteTable)
+		}
+		if overlap(markStart, markEnd, c.GatewayReplyRouteMark, c.GatewayReplyRouteMark) {
+			return fmt.Errorf("the uplink marks [%d, %d] overlap gatewayReplyRouteMark %d",
+				markStart, markEnd, c.GatewayReplyRouteMark)
+		}
+	}
+	start, end, err := markallocator.RangeSize(c.Mark)
+	if err != nil {
+		return fmt.Errorf("invalid mark %s: %w", c.Mark, err)
+	}
+	if uint64(markStart) <= end && start <= uint64(markEnd) {
+		return fmt.Errorf("the uplink marks [%#x, %#x] overlap the policy marks [%#x, %#x]",
+			markStart, markEnd, start, end)
+	}
+	return nil
+}
@@ -275,3 +275,63 @@ func err_LoadConfig_ParseCIDR_v4() []gomonkey.Patches {
 
 	return []gomonkey.Patches{*patch1}
 }
+
+func TestValidateRoutes(t *testing.T) {
+	valid := FileConfig{
+		Mark:                    "0x26000000",
+		EnableGatewayReplyRoute: true,
+		GatewayReplyRouteTable:  600,
+		GatewayReplyRouteMark:   39,
+		GatewayUplinkRouteTable: 700,
+		GatewayUplinkRouteMark:  40,
+		GatewayUplinkRouteCount: 16,
+	}
+
+	cases := map[string]struct {
+		update func(c *FileConfig)
+		expErr bool
+	}{
+		"default": {
+			update: func(c *FileConfig) {},
+		},
+		"uplink marks overlap the reply mark": {
+			update: func(c *FileConfig) { c.GatewayUplinkRouteMark = 30 },
+			expErr: true,
+		},
+		"the reply route is disabled": {
+			update: func(c *FileConfig) {
+				c.EnableGatewayReplyRoute = false
+				c.GatewayUplinkRouteMark = 30
+			},
+		},
+		"uplink tables overlap the reply table": {
+			update: func(c *FileConfig) { c.GatewayUplinkRouteTable = 590 },
+			expErr: true,
+		},
+		"uplink tables overlap the main table": {
+			update: func(c *FileConfig) { c.GatewayUplinkRouteTable = 250 },
+			expErr: true,
+		},
+		"uplink marks overlap the policy marks": {
+			update: func(c *FileConfig) { c.GatewayUplinkRouteMark = 0x26000010 },
+			expErr: true,
+		},
+		"no uplink": {
+			update: func(c *FileConfig) { c.GatewayUplinkRouteCount = 0 },
+			expErr: true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg := valid
+			c.update(&cfg)
+			err := validateRoutes(cfg)
+			if c.expErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
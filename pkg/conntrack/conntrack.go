@@ -0,0 +1,244 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package conntrack
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// Interface is an injectable interface for reading and writing the conntrack table
+type Interface interface {
+	// ListByReplyDsts lists the TCP and UDP flows whose reply destination is one of the IPs,
+	// i.e. the flows SNATed to the IPs, grouped by the IP. The conntrack table of each IP
+	// family is dumped once, however many IPs are listed.
+	ListByReplyDsts(ips []string) (map[string][]Flow, error)
+	// Create inserts the flow into the conntrack table, the flow is source NATed to its
+	// reply destination, so the reply packets are translated back
+	Create(flow Flow) error
+}
+
+type Flow struct {
+	Family       string `json:"family"`
+	Proto        string `json:"proto"`
+	Timeout      int    `json:"timeout"`
+	Src          string `json:"src"`
+	Dst          string `json:"dst"`
+	SrcPort      int    `json:"sport"`
+	DstPort      int    `json:"dport"`
+	ReplySrc     string `json:"replySrc"`
+	ReplyDst     string `json:"replyDst"`
+	ReplySrcPort int    `json:"replySport"`
+	ReplyDstPort int    `json:"replyDport"`
+	Mark         uint32 `json:"mark"`
+}
+
+// the attributes which are not defined by the netlink package, see
+// include/uapi/linux/netfilter/nfnetlink_conntrack.h
+const (
+	ipctnlMsgCtNew = 0
+
+	ctaNatSrc   = 6
+	ctaNatV4Min = 1
+	ctaNatV4Max = 2
+	ctaNatProto = 3
+	ctaNatV6Min = 4
+	ctaNatV6Max = 5
+
+	ctaProtoNatPortMin = 1
+	ctaProtoNatPortMax = 2
+
+	ipsSeenReply = 1 << 1
+	ipsAssured   = 1 << 2
+
+	tcpConntrackEstablished = 3
+)
+
+var protos = map[string]uint8{"tcp": unix.IPPROTO_TCP, "udp": unix.IPPROTO_UDP}
+
+type handle struct{}
+
+// New returns a new Interface which accesses the conntrack table through netlink
+func New() Interface {
+	return &handle{}
+}
+
+func (h *handle) ListByReplyDsts(ips []string) (map[string][]Flow, error) {
+	// the canonical form of the reply destinations to the listed IPs, by family
+	replyDsts := map[netlink.InetFamily]map[string]string{}
+	for _, ip := range ips {
+		replyDst := net.ParseIP(ip)
+		if replyDst == nil {
+			return nil, fmt.Errorf("invalid ip %s", ip)
+		}
+		family := netlink.InetFamily(netlink.FAMILY_V4)
+		if replyDst.To4() == nil {
+			family = netlink.FAMILY_V6
+		}
+		if replyDsts[family] == nil {
+			replyDsts[family] = make(map[string]string)
+		}
+		replyDsts[family][replyDst.String()] = ip
+	}
+
+	flows := make(map[string][]Flow, len(ips))
+	for family, dsts := range replyDsts {
+		list, err := netlink.ConntrackTableList(netlink.ConntrackTable, family)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list conntrack flows: %w", err)
+		}
+		for ip, items := range groupFlows(list, dsts) {
+			flows[ip] = items
+		}
+	}
+	return flows, nil
+}
+
+// groupFlows converts the TCP and UDP flows SNATed to the reply destinations, which map
+// the canonical form of the IPs to the listed IPs, and groups them by the listed IP
+func groupFlows(list []*netlink.ConntrackFlow, replyDsts map[string]string) map[string][]Flow {
+	flows := make(map[string][]Flow)
+	for _, item := range list {
+		ip, ok := replyDsts[item.Reverse.DstIP.String()]
+		if !ok {
+			continue
+		}
+		proto := nl.L4ProtoMap[item.Forward.Protocol]
+		if _, ok := protos[proto]; !ok {
+			continue
+		}
+		family := "ipv4"
+		if item.Reverse.DstIP.To4() == nil {
+			family = "ipv6"
+		}
+		flows[ip] = append(flows[ip], Flow{
+			Family:       family,
+			Proto:        proto,
+			Timeout:      int(item.TimeOut),
+			Src:          item.Forward.SrcIP.String(),
+			Dst:          item.Forward.DstIP.String(),
+			SrcPort:      int(item.Forward.SrcPort),
+			DstPort:      int(item.Forward.DstPort),
+			ReplySrc:     item.Reverse.SrcIP.String(),
+			ReplyDst:     item.Reverse.DstIP.String(),
+			ReplySrcPort: int(item.Reverse.SrcPort),
+			ReplyDstPort: int(item.Reverse.DstPort),
+			Mark:         item.Mark,
+		})
+	}
+	return flows
+}
+
+func (h *handle) Create(flow Flow) error {
+	family, attrs, err := createAttrs(flow)
+	if err != nil {
+		return err
+	}
+	req := nl.NewNetlinkRequest(int(netlink.ConntrackTable)<<8|ipctnlMsgCtNew,
+		unix.NLM_F_CREATE|unix.NLM_F_EXCL|unix.NLM_F_ACK)
+	req.AddData(&nl.Nfgenmsg{NfgenFamily: family, Version: nl.NFNETLINK_V0})
+	for _, attr := range attrs {
+		req.AddData(attr)
+	}
+	_, err = req.Execute(unix.NETLINK_NETFILTER, 0)
+	// the flow may have been created by the traffic
+	if errors.Is(err, unix.EEXIST) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create conntrack flow %s %s:%d -> %s:%d: %w",
+			flow.Proto, flow.Src, flow.SrcPort, flow.Dst, flow.DstPort, err)
+	}
+	return nil
+}
+
+// createAttrs returns the family and the attributes of the IPCTNL_MSG_CT_NEW request
+// of the flow. The TCP state is not exported by the netlink dump, the TCP flows are
+// created as established. The flow carries CTA_NAT_SRC to its reply destination, so
+// the kernel sets the SNAT status and de-NATs the reply packets as the original node.
+func createAttrs(flow Flow) (uint8, []*nl.RtAttr, error) {
+	proto, ok := protos[flow.Proto]
+	if !ok {
+		return 0, nil, fmt.Errorf("unsupported protocol %s", flow.Proto)
+	}
+	ips := make([]net.IP, 0, 4)
+	for _, s := range []string{flow.Src, flow.Dst, flow.ReplySrc, flow.ReplyDst} {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return 0, nil, fmt.Errorf("invalid ip %q of conntrack flow", s)
+		}
+		ips = append(ips, ip)
+	}
+
+	family := uint8(unix.AF_INET6)
+	srcType, dstType, natMin, natMax := nl.CTA_IP_V6_SRC, nl.CTA_IP_V6_DST, ctaNatV6Min, ctaNatV6Max
+	if ips[0].To4() != nil {
+		family = unix.AF_INET
+		srcType, dstType, natMin, natMax = nl.CTA_IP_V4_SRC, nl.CTA_IP_V4_DST, ctaNatV4Min, ctaNatV4Max
+		for i := range ips {
+			ips[i] = ips[i].To4()
+		}
+	}
+	for _, ip := range ips {
+		if (ip.To4() != nil) != (family == unix.AF_INET) {
+			return 0, nil, fmt.Errorf("mixed ip families of conntrack flow")
+		}
+	}
+
+	tuple := func(attrType int, src, dst net.IP, sport, dport int) *nl.RtAttr {
+		attr := nl.NewRtAttr(attrType|int(nl.NLA_F_NESTED), nil)
+		ip := attr.AddRtAttr(nl.CTA_TUPLE_IP|int(nl.NLA_F_NESTED), nil)
+		ip.AddRtAttr(srcType, src)
+		ip.AddRtAttr(dstType, dst)
+		l4 := attr.AddRtAttr(nl.CTA_TUPLE_PROTO|int(nl.NLA_F_NESTED), nil)
+		l4.AddRtAttr(nl.CTA_PROTO_NUM, []byte{proto})
+		l4.AddRtAttr(nl.CTA_PROTO_SRC_PORT, be16(sport))
+		l4.AddRtAttr(nl.CTA_PROTO_DST_PORT, be16(dport))
+		return attr
+	}
+
+	status := uint32(ipsSeenReply)
+	attrs := []*nl.RtAttr{
+		tuple(nl.CTA_TUPLE_ORIG, ips[0], ips[1], flow.SrcPort, flow.DstPort),
+		tuple(nl.CTA_TUPLE_REPLY, ips[2], ips[3], flow.ReplySrcPort, flow.ReplyDstPort),
+		nl.NewRtAttr(nl.CTA_TIMEOUT, be32(uint32(flow.Timeout))),
+		nl.NewRtAttr(nl.CTA_MARK, be32(flow.Mark)),
+	}
+	if proto == unix.IPPROTO_TCP {
+		status |= ipsAssured
+		info := nl.NewRtAttr(nl.CTA_PROTOINFO|int(nl.NLA_F_NESTED), nil)
+		tcp := info.AddRtAttr(nl.CTA_PROTOINFO_TCP|int(nl.NLA_F_NESTED), nil)
+		tcp.AddRtAttr(nl.CTA_PROTOINFO_TCP_STATE, []byte{tcpConntrackEstablished})
+		attrs = append(attrs, info)
+	}
+	attrs = append(attrs, nl.NewRtAttr(nl.CTA_STATUS, be32(status)))
+
+	nat := nl.NewRtAttr(ctaNatSrc|int(nl.NLA_F_NESTED), nil)
+	nat.AddRtAttr(natMin, ips[3])
+	nat.AddRtAttr(natMax, ips[3])
+	natProto := nat.AddRtAttr(ctaNatProto|int(nl.NLA_F_NESTED), nil)
+	natProto.AddRtAttr(ctaProtoNatPortMin, be16(flow.ReplyDstPort))
+	natProto.AddRtAttr(ctaProtoNatPortMax, be16(flow.ReplyDstPort))
+	attrs = append(attrs, nat)
+
+	return family, attrs, nil
+}
+
+func be16(v int) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, uint16(v))
+	return b
+}
+
+func be32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
@@ -0,0 +1,118 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package conntrack
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+func TestGroupFlows(t *testing.T) {
+	newFlow := func(proto uint8, src, dst string, sport, dport uint16, replyDst string) *netlink.ConntrackFlow {
+		flow := new(netlink.ConntrackFlow)
+		flow.Forward.Protocol = proto
+		flow.Forward.SrcIP = net.ParseIP(src)
+		flow.Forward.DstIP = net.ParseIP(dst)
+		flow.Forward.SrcPort = sport
+		flow.Forward.DstPort = dport
+		flow.Reverse.Protocol = proto
+		flow.Reverse.SrcIP = net.ParseIP(dst)
+		flow.Reverse.DstIP = net.ParseIP(replyDst)
+		flow.Reverse.SrcPort = dport
+		flow.Reverse.DstPort = sport
+		flow.TimeOut = 300
+		return flow
+	}
+	list := []*netlink.ConntrackFlow{
+		newFlow(unix.IPPROTO_TCP, "10.21.0.5", "1.1.1.1", 40000, 443, "10.6.1.1"),
+		newFlow(unix.IPPROTO_UDP, "10.21.0.6", "8.8.8.8", 5353, 53, "10.6.1.1"),
+		newFlow(unix.IPPROTO_TCP, "10.21.0.7", "1.1.1.1", 40001, 443, "10.6.1.2"),
+		// not listed EIP
+		newFlow(unix.IPPROTO_TCP, "10.21.0.9", "1.1.1.1", 40002, 443, "10.6.1.3"),
+		// not TCP or UDP
+		newFlow(unix.IPPROTO_ICMP, "10.21.0.8", "1.1.1.1", 0, 0, "10.6.1.1"),
+	}
+
+	assert.Equal(t, map[string][]Flow{
+		"10.6.1.1": {
+			{
+				Family: "ipv4", Proto: "tcp", Timeout: 300,
+				Src: "10.21.0.5", Dst: "1.1.1.1", SrcPort: 40000, DstPort: 443,
+				ReplySrc: "1.1.1.1", ReplyDst: "10.6.1.1", ReplySrcPort: 443, ReplyDstPort: 40000,
+			},
+			{
+				Family: "ipv4", Proto: "udp", Timeout: 300,
+				Src: "10.21.0.6", Dst: "8.8.8.8", SrcPort: 5353, DstPort: 53,
+				ReplySrc: "8.8.8.8", ReplyDst: "10.6.1.1", ReplySrcPort: 53, ReplyDstPort: 5353,
+			},
+		},
+		"10.6.1.2": {
+			{
+				Family: "ipv4", Proto: "tcp", Timeout: 300,
+				Src: "10.21.0.7", Dst: "1.1.1.1", SrcPort: 40001, DstPort: 443,
+				ReplySrc: "1.1.1.1", ReplyDst: "10.6.1.2", ReplySrcPort: 443, ReplyDstPort: 40001,
+			},
+		},
+	}, groupFlows(list, map[string]string{"10.6.1.1": "10.6.1.1", "10.6.1.2": "10.6.1.2"}))
+}
+
+func TestCreateAttrs(t *testing.T) {
+	flow := Flow{
+		Family: "ipv4", Proto: "tcp", Timeout: 300,
+		Src: "10.21.0.5", Dst: "1.1.1.1", SrcPort: 40000, DstPort: 443,
+		ReplySrc: "1.1.1.1", ReplyDst: "10.6.1.1", ReplySrcPort: 443, ReplyDstPort: 40001,
+		Mark: 0x26000000,
+	}
+	family, attrs, err := createAttrs(flow)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(unix.AF_INET), family)
+
+	found := make(map[uint16][]byte)
+	for _, attr := range attrs {
+		found[attr.Type&nl.NLA_TYPE_MASK] = attr.Serialize()[unix.SizeofRtAttr:]
+	}
+	assert.Equal(t, be32(300), found[nl.CTA_TIMEOUT])
+	assert.Equal(t, be32(0x26000000), found[nl.CTA_MARK])
+	assert.Equal(t, be32(ipsSeenReply|ipsAssured), found[nl.CTA_STATUS])
+	assert.Contains(t, found, uint16(nl.CTA_PROTOINFO))
+
+	// the flow is source NATed to the reply destination, so the reply packets are
+	// de-NATed to the pod
+	nat, err := nl.ParseRouteAttr(found[ctaNatSrc])
+	assert.NoError(t, err)
+	natAttrs := make(map[uint16][]byte)
+	for _, attr := range nat {
+		natAttrs[attr.Attr.Type&nl.NLA_TYPE_MASK] = attr.Value
+	}
+	assert.Equal(t, []byte(net.ParseIP("10.6.1.1").To4()), natAttrs[ctaNatV4Min])
+	assert.Equal(t, []byte(net.ParseIP("10.6.1.1").To4()), natAttrs[ctaNatV4Max])
+	ports, err := nl.ParseRouteAttr(natAttrs[ctaNatProto])
+	assert.NoError(t, err)
+	if assert.Len(t, ports, 2) {
+		assert.Equal(t, uint16(40001), binary.BigEndian.Uint16(ports[0].Value))
+		assert.Equal(t, uint16(40001), binary.BigEndian.Uint16(ports[1].Value))
+	}
+
+	udp := flow
+	udp.Proto = "udp"
+	_, attrs, err = createAttrs(udp)
+	assert.NoError(t, err)
+	for _, attr := range attrs {
+		assert.NotEqual(t, uint16(nl.CTA_PROTOINFO), attr.Type&nl.NLA_TYPE_MASK)
+		if attr.Type == nl.CTA_STATUS {
+			assert.Equal(t, be32(ipsSeenReply), attr.Data)
+		}
+	}
+
+	invalid := flow
+	invalid.ReplyDst = "fd00::1"
+	_, _, err = createAttrs(invalid)
+	assert.Error(t, err)
+}
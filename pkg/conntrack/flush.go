@@ -0,0 +1,77 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package conntrack
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+)
+
+// Filter matches the flows from the source IPs of a policy. If SnatIP is set, it
+// matches the flows SNATed to the IP, otherwise it matches the flows which are not
+// SNATed and carry the Mark under MarkMask, i.e. the flows forwarded with the mark to
+// the EgressTunnel of a gateway node, the flows to ExcludeDstNets, e.g. the cluster
+// CIDRs, are skipped. MarkMask is the bits of the mark saved to the connections, the
+// other bits of the connmark belong to the other components, it is 0xffffffff if zero.
+type Filter struct {
+	SrcIPs         map[string]struct{}
+	SnatIP         net.IP
+	Mark           uint32
+	MarkMask       uint32
+	ExcludeDstNets []*net.IPNet
+}
+
+func (f *Filter) MatchConntrackFlow(flow *netlink.ConntrackFlow) bool {
+	if _, ok := f.SrcIPs[flow.Forward.SrcIP.String()]; !ok {
+		return false
+	}
+	if f.SnatIP != nil {
+		return flow.Reverse.DstIP.Equal(f.SnatIP)
+	}
+	mask := f.MarkMask
+	if mask == 0 {
+		mask = 0xffffffff
+	}
+	if flow.Mark&mask != f.Mark&mask || !flow.Reverse.DstIP.Equal(flow.Forward.SrcIP) {
+		return false
+	}
+	for _, ipNet := range f.ExcludeDstNets {
+		if ipNet.Contains(flow.Forward.DstIP) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *Filter) reason() string {
+	if f.SnatIP != nil {
+		return "snat"
+	}
+	return "mark"
+}
+
+// DeleteFlows deletes the flows matched by the filter through netlink, and returns the
+// number of the deleted flows
+func DeleteFlows(filter *Filter) (uint, error) {
+	families := []netlink.InetFamily{netlink.FAMILY_V4, netlink.FAMILY_V6}
+	if filter.SnatIP != nil {
+		families = []netlink.InetFamily{netlink.FAMILY_V6}
+		if filter.SnatIP.To4() != nil {
+			families = []netlink.InetFamily{netlink.FAMILY_V4}
+		}
+	}
+
+	var total uint
+	for _, family := range families {
+		count, err := netlink.ConntrackDeleteFilter(netlink.ConntrackTable, family, filter)
+		total += count
+		if err != nil {
+			return total, fmt.Errorf("failed to delete conntrack flows: %w", err)
+		}
+	}
+	histogramFlushedFlows.WithLabelValues(filter.reason()).Observe(float64(total))
+	return total, nil
+}
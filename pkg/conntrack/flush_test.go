@@ -0,0 +1,99 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package conntrack
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+)
+
+func TestFilterMatchConntrackFlow(t *testing.T) {
+	newFlow := func(src, replyDst string) *netlink.ConntrackFlow {
+		flow := new(netlink.ConntrackFlow)
+		flow.Forward.SrcIP = net.ParseIP(src)
+		flow.Forward.DstIP = net.ParseIP("1.1.1.1")
+		flow.Reverse.SrcIP = net.ParseIP("1.1.1.1")
+		flow.Reverse.DstIP = net.ParseIP(replyDst)
+		return flow
+	}
+	markedFlow := func(dst string, mark uint32) *netlink.ConntrackFlow {
+		flow := newFlow("10.21.0.5", "10.21.0.5")
+		flow.Forward.DstIP = net.ParseIP(dst)
+		flow.Reverse.SrcIP = net.ParseIP(dst)
+		flow.Mark = mark
+		return flow
+	}
+	srcIPs := map[string]struct{}{"10.21.0.5": {}}
+	_, clusterCIDR, _ := net.ParseCIDR("10.21.0.0/16")
+	markFilter := &Filter{SrcIPs: srcIPs, Mark: 0x26000001, ExcludeDstNets: []*net.IPNet{clusterCIDR}}
+
+	cases := map[string]struct {
+		filter *Filter
+		flow   *netlink.ConntrackFlow
+		expect bool
+	}{
+		"snat flow to the ip": {
+			filter: &Filter{SrcIPs: srcIPs, SnatIP: net.ParseIP("10.6.1.1")},
+			flow:   newFlow("10.21.0.5", "10.6.1.1"),
+			expect: true,
+		},
+		"snat flow to another ip": {
+			filter: &Filter{SrcIPs: srcIPs, SnatIP: net.ParseIP("10.6.1.1")},
+			flow:   newFlow("10.21.0.5", "10.6.1.2"),
+			expect: false,
+		},
+		"flow from another source": {
+			filter: &Filter{SrcIPs: srcIPs, SnatIP: net.ParseIP("10.6.1.1")},
+			flow:   newFlow("10.21.0.6", "10.6.1.1"),
+			expect: false,
+		},
+		"flow with the mark": {
+			filter: markFilter,
+			flow:   markedFlow("1.1.1.1", 0x26000001),
+			expect: true,
+		},
+		"flow with another mark": {
+			filter: markFilter,
+			flow:   markedFlow("1.1.1.1", 0x26000002),
+			expect: false,
+		},
+		"flow with the mark under the mask": {
+			filter: &Filter{SrcIPs: srcIPs, Mark: 0x26000001, MarkMask: 0xff000000},
+			flow:   markedFlow("1.1.1.1", 0x26004000),
+			expect: true,
+		},
+		"flow with another mark under the mask": {
+			filter: &Filter{SrcIPs: srcIPs, Mark: 0x26000001, MarkMask: 0xff000000},
+			flow:   markedFlow("1.1.1.1", 0x27000000),
+			expect: false,
+		},
+		"flow without mark": {
+			filter: markFilter,
+			flow:   markedFlow("1.1.1.1", 0),
+			expect: false,
+		},
+		"flow to the cluster cidr": {
+			filter: markFilter,
+			flow:   markedFlow("10.21.0.6", 0x26000001),
+			expect: false,
+		},
+		"snat flow is not matched by the mark filter": {
+			filter: markFilter,
+			flow: func() *netlink.ConntrackFlow {
+				flow := markedFlow("1.1.1.1", 0x26000001)
+				flow.Reverse.DstIP = net.ParseIP("10.6.1.1")
+				return flow
+			}(),
+			expect: false,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, c.expect, c.filter.MatchConntrackFlow(c.flow))
+		})
+	}
+}
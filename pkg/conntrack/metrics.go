@@ -0,0 +1,36 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package conntrack
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var histogramFlushedFlows = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "egress_conntrack_flushed_entries",
+	Help:    "Number of stale conntrack entries removed by each flush.",
+	Buckets: []float64{0, 1, 10, 100, 1000, 10000},
+}, []string{"reason"})
+
+var gaugeSnatFlows = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "egress_snat_conntrack_entries",
+	Help: "Number of conntrack entries SNATed to the EIP held by the node.",
+}, []string{"eip"})
+
+var gaugeSnatDestinationFlows = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "egress_snat_destination_conntrack_entries",
+	Help: "Number of conntrack entries SNATed to the EIP towards the destination, only the top destinations are exported.",
+}, []string{"eip", "proto", "destination"})
+
+var gaugeSnatPortUtilization = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "egress_snat_port_utilization",
+	Help: "Ratio of the source ports of the EIP used towards the destination, only the top destinations are exported.",
+}, []string{"eip", "proto", "destination"})
+
+func MetricCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		histogramFlushedFlows,
+		gaugeSnatFlows,
+		gaugeSnatDestinationFlows,
+		gaugeSnatPortUtilization,
+	}
+}
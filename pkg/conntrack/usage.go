@@ -0,0 +1,120 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package conntrack
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+)
+
+// DefaultSnatPorts is the number of the source ports the kernel picks from when no port
+// range is given to the SNAT rule, i.e. 1024-65535
+const DefaultSnatPorts = 64512
+
+// Destination is the destination of the flows SNATed to an EIP. Each flow towards the
+// destination takes a source port of the EIP, so the ports are exhausted per destination.
+type Destination struct {
+	EIP   string
+	Proto string
+	Addr  string
+}
+
+// SnatUsage is the number of the flows SNATed to an EIP
+type SnatUsage struct {
+	// Flows the number of the flows of the EIP
+	Flows int
+	// Destinations the number of the TCP and UDP flows of the EIP by destination
+	Destinations map[Destination]int
+}
+
+// ListSnatUsage lists the conntrack table through netlink, and returns the usage of the EIPs
+func ListSnatUsage(eips map[string]int) (map[string]*SnatUsage, error) {
+	var flows []*netlink.ConntrackFlow
+	for _, family := range []netlink.InetFamily{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		list, err := netlink.ConntrackTableList(netlink.ConntrackTable, family)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list conntrack flows: %w", err)
+		}
+		flows = append(flows, list...)
+	}
+	return countSnatFlows(flows, eips), nil
+}
+
+// countSnatFlows counts the flows whose reply destination is one of the EIPs, each of
+// them takes a source port of the EIP
+func countSnatFlows(flows []*netlink.ConntrackFlow, eips map[string]int) map[string]*SnatUsage {
+	res := make(map[string]*SnatUsage, len(eips))
+	for eip := range eips {
+		res[eip] = &SnatUsage{Destinations: make(map[Destination]int)}
+	}
+	for _, flow := range flows {
+		eip := flow.Reverse.DstIP.String()
+		usage, ok := res[eip]
+		if !ok {
+			continue
+		}
+		usage.Flows++
+
+		var proto string
+		switch flow.Forward.Protocol {
+		case syscall.IPPROTO_TCP:
+			proto = "tcp"
+		case syscall.IPPROTO_UDP:
+			proto = "udp"
+		default:
+			continue
+		}
+		addr := net.JoinHostPort(flow.Forward.DstIP.String(), strconv.Itoa(int(flow.Forward.DstPort)))
+		usage.Destinations[Destination{EIP: eip, Proto: proto, Addr: addr}]++
+	}
+	return res
+}
+
+// TopDestinations returns the n destinations with the most flows, sorted by the
+// number of flows in descending order
+func (u *SnatUsage) TopDestinations(n int) []Destination {
+	res := make([]Destination, 0, len(u.Destinations))
+	for dst := range u.Destinations {
+		res = append(res, dst)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		ci, cj := u.Destinations[res[i]], u.Destinations[res[j]]
+		if ci != cj {
+			return ci > cj
+		}
+		if res[i].Addr != res[j].Addr {
+			return res[i].Addr < res[j].Addr
+		}
+		return res[i].Proto < res[j].Proto
+	})
+	if n > 0 && len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
+
+// RecordSnatUsage sets the SNAT metrics of the EIPs, ports is the number of the source
+// ports of the EIPs
+func RecordSnatUsage(usages map[string]*SnatUsage, ports map[string]int, top int) {
+	gaugeSnatFlows.Reset()
+	gaugeSnatDestinationFlows.Reset()
+	gaugeSnatPortUtilization.Reset()
+	for eip, usage := range usages {
+		gaugeSnatFlows.WithLabelValues(eip).Set(float64(usage.Flows))
+		total := ports[eip]
+		if total <= 0 {
+			total = DefaultSnatPorts
+		}
+		for _, dst := range usage.TopDestinations(top) {
+			count := usage.Destinations[dst]
+			gaugeSnatDestinationFlows.WithLabelValues(eip, dst.Proto, dst.Addr).Set(float64(count))
+			gaugeSnatPortUtilization.WithLabelValues(eip, dst.Proto, dst.Addr).Set(float64(count) / float64(total))
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package conntrack
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+)
+
+func TestCountSnatFlows(t *testing.T) {
+	newFlow := func(proto uint8, dst string, dport uint16, replyDst string) *netlink.ConntrackFlow {
+		flow := new(netlink.ConntrackFlow)
+		flow.Forward.Protocol = proto
+		flow.Forward.SrcIP = net.ParseIP("10.21.0.5")
+		flow.Forward.DstIP = net.ParseIP(dst)
+		flow.Forward.DstPort = dport
+		flow.Reverse.Protocol = proto
+		flow.Reverse.SrcIP = net.ParseIP(dst)
+		flow.Reverse.DstIP = net.ParseIP(replyDst)
+		return flow
+	}
+	flows := []*netlink.ConntrackFlow{
+		newFlow(syscall.IPPROTO_TCP, "1.1.1.1", 443, "10.6.1.21"),
+		newFlow(syscall.IPPROTO_TCP, "1.1.1.1", 443, "10.6.1.21"),
+		newFlow(syscall.IPPROTO_UDP, "1.1.1.1", 53, "10.6.1.21"),
+		newFlow(syscall.IPPROTO_ICMP, "1.1.1.1", 0, "10.6.1.21"),
+		newFlow(syscall.IPPROTO_TCP, "fd00::1", 443, "fd00::21"),
+		newFlow(syscall.IPPROTO_TCP, "1.1.1.1", 443, "10.6.1.22"),
+	}
+
+	usages := countSnatFlows(flows, map[string]int{"10.6.1.21": 0, "fd00::21": 0, "10.6.1.23": 0})
+	assert.Equal(t, 4, usages["10.6.1.21"].Flows)
+	assert.Equal(t, map[Destination]int{
+		{EIP: "10.6.1.21", Proto: "tcp", Addr: "1.1.1.1:443"}: 2,
+		{EIP: "10.6.1.21", Proto: "udp", Addr: "1.1.1.1:53"}:  1,
+	}, usages["10.6.1.21"].Destinations)
+	assert.Equal(t, map[Destination]int{
+		{EIP: "fd00::21", Proto: "tcp", Addr: "[fd00::1]:443"}: 1,
+	}, usages["fd00::21"].Destinations)
+	assert.Equal(t, 0, usages["10.6.1.23"].Flows)
+	assert.NotContains(t, usages, "10.6.1.22")
+
+	assert.Equal(t, []Destination{
+		{EIP: "10.6.1.21", Proto: "tcp", Addr: "1.1.1.1:443"},
+	}, usages["10.6.1.21"].TopDestinations(1))
+}
@@ -9,11 +9,13 @@ import (
 
 	"github.com/go-logr/logr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	runtimeWebhook "sigs.k8s.io/controller-runtime/pkg/webhook"
 
+	"github.com/spidernet-io/egressgateway/pkg/cidrgroup"
 	"github.com/spidernet-io/egressgateway/pkg/config"
 	egressclusterinfo "github.com/spidernet-io/egressgateway/pkg/controller/egress_cluster_info"
 	"github.com/spidernet-io/egressgateway/pkg/controller/endpoint"
@@ -21,8 +23,11 @@ import (
 	"github.com/spidernet-io/egressgateway/pkg/controller/tunnel"
 	"github.com/spidernet-io/egressgateway/pkg/controller/webhook"
 	"github.com/spidernet-io/egressgateway/pkg/egressgateway"
+	"github.com/spidernet-io/egressgateway/pkg/lease"
 	"github.com/spidernet-io/egressgateway/pkg/logger"
+	"github.com/spidernet-io/egressgateway/pkg/portblock"
 	"github.com/spidernet-io/egressgateway/pkg/profiling"
+	"github.com/spidernet-io/egressgateway/pkg/schedule"
 	"github.com/spidernet-io/egressgateway/pkg/schema"
 	"github.com/spidernet-io/egressgateway/pkg/types"
 )
@@ -34,7 +39,14 @@ type Controller struct {
 
 func New(cfg *config.Config) (types.Service, error) {
 	log := logger.NewLogger(cfg.EnvConfig.Logger)
+	byObject := portblock.CacheByObject()
+	for obj, opts := range lease.CacheByObject(cfg.FileConfig.GatewayFailover.LeaseNamespace) {
+		byObject[obj] = opts
+	}
 	mgrOpts := manager.Options{
+		Cache: cache.Options{
+			ByObject: byObject,
+		},
 		Scheme:                  schema.GetScheme(),
 		Logger:                  log,
 		LeaderElection:          cfg.LeaderElection,
@@ -76,6 +88,16 @@ func New(cfg *config.Config) (types.Service, error) {
 		return nil, fmt.Errorf("failed to create egress gateway controller: %w", err)
 	}
 
+	err = egressgateway.NewEipProviderController(mgr, log, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create eip provider controller: %w", err)
+	}
+
+	err = egressgateway.NewPortBlockController(mgr, log, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create port block controller: %w", err)
+	}
+
 	err = tunnel.NewEgressTunnelController(mgr, log, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create egress tunnel controller: %w", err)
@@ -95,6 +117,16 @@ func New(cfg *config.Config) (types.Service, error) {
 		return nil, fmt.Errorf("failed to create cluster endpoint slice controller: %w", err)
 	}
 
+	err = cidrgroup.NewEgressCIDRGroupController(mgr, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create egress cidr group controller: %w", err)
+	}
+
+	err = schedule.NewPolicyScheduleController(mgr, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create policy schedule controller: %w", err)
+	}
+
 	return &Controller{client: mgr.GetClient(), manager: mgr}, err
 }
 
@@ -6,7 +6,9 @@ package endpoint
 import (
 	"context"
 	"fmt"
+	"net"
 	"reflect"
+	"sort"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -67,12 +69,23 @@ func (r *endpointClusterReconciler) Reconcile(ctx context.Context, req reconcile
 		podMap[types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}] = pod
 	}
 
+	nodes, err := listNodesByClusterPolicy(ctx, r.client, policy)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	nodeMap := make(map[string]corev1.Node)
+	for _, node := range nodes {
+		nodeMap[node.Name] = node
+	}
+
 	endpointSlices, err := listClusterEndpointSlices(ctx, r.client, policy.Name)
 	if err != nil {
 		return reconcile.Result{}, err
 	}
 
 	existingKeyMap := make(map[types.NamespacedName]bool)
+	existingNodeMap := make(map[string]bool)
 	slicesToUpdate := make([]v1beta1.EgressClusterEndpointSlice, 0)
 	slicesToCreate := make([]v1beta1.EgressClusterEndpointSlice, 0)
 	slicesToDelete := make([]v1beta1.EgressClusterEndpointSlice, 0)
@@ -83,15 +96,30 @@ func (r *endpointClusterReconciler) Reconcile(ctx context.Context, req reconcile
 		index := 0
 		for i := 0; i < len(epSlice.Endpoints); i++ {
 			ep := epSlice.Endpoints[i]
+			if ep.Pod == "" {
+				// the endpoint of the host network of the node
+				node, ok := nodeMap[ep.Node]
+				if !ok || existingNodeMap[ep.Node] {
+					needUpdate = true
+					continue
+				}
+				if needUpdateNodeEndpoint(node, &ep) {
+					needUpdate = true
+				}
+				existingNodeMap[ep.Node] = true
+				epSlice.Endpoints[index] = ep
+				index = index + 1
+				continue
+			}
 			key := types.NamespacedName{Namespace: ep.Namespace, Name: ep.Pod}
 			if pod, ok := podMap[key]; ok {
-				if needUpdateEndpoint(pod, &ep) {
+				if needUpdateEndpoint(pod, policy.Spec.AppliedTo.Networks, &ep) {
 					// pod changes the IP address
 					// egress ep ip list != pod list
 					needUpdate = true
 				}
 				existingKeyMap[key] = true
-				epSlice.Endpoints[index] = epSlice.Endpoints[i]
+				epSlice.Endpoints[index] = ep
 				index = index + 1
 			} else {
 				needUpdate = true
@@ -110,7 +138,15 @@ func (r *endpointClusterReconciler) Reconcile(ctx context.Context, req reconcile
 	for _, pod := range pods {
 		key := types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}
 		if _, ok := existingKeyMap[key]; !ok {
-			if ep := newEndpoint(pod); ep != nil {
+			if ep := newEndpoint(pod, policy.Spec.AppliedTo.Networks); ep != nil {
+				needToCreateEp = append(needToCreateEp, *ep)
+			}
+		}
+	}
+
+	for _, node := range nodes {
+		if !existingNodeMap[node.Name] {
+			if ep := newNodeEndpoint(node); ep != nil {
 				needToCreateEp = append(needToCreateEp, *ep)
 			}
 		}
@@ -221,7 +257,7 @@ func newClusterEndpointSlice(policy *v1beta1.EgressClusterPolicy) *v1beta1.Egres
 func listPodsByClusterPolicy(ctx context.Context, cli client.Client, policy *v1beta1.EgressClusterPolicy) ([]corev1.Pod, error) {
 	if policy.Spec.AppliedTo.NamespaceSelector == nil {
 		pods := new(corev1.PodList)
-		selector, err := metav1.LabelSelectorAsSelector(policy.Spec.AppliedTo.PodSelector)
+		selector, err := podLabelSelector(policy.Spec.AppliedTo.PodSelector, policy.Spec.AppliedTo.ServiceAccountSelector)
 		if err != nil {
 			return nil, err
 		}
@@ -232,7 +268,7 @@ func listPodsByClusterPolicy(ctx context.Context, cli client.Client, policy *v1b
 		if err != nil {
 			return nil, err
 		}
-		return pods.Items, nil
+		return filterClusterPolicyPods(ctx, cli, policy, pods.Items)
 	}
 
 	nsList := new(corev1.NamespaceList)
@@ -253,7 +289,7 @@ func listPodsByClusterPolicy(ctx context.Context, cli client.Client, policy *v1b
 
 	for _, ns := range nsList.Items {
 		pods := new(corev1.PodList)
-		selector, err := metav1.LabelSelectorAsSelector(policy.Spec.AppliedTo.PodSelector)
+		selector, err := podLabelSelector(policy.Spec.AppliedTo.PodSelector, policy.Spec.AppliedTo.ServiceAccountSelector)
 		if err != nil {
 			return nil, err
 		}
@@ -268,7 +304,81 @@ func listPodsByClusterPolicy(ctx context.Context, cli client.Client, policy *v1b
 		res = append(res, pods.Items...)
 	}
 
-	return res, nil
+	return filterClusterPolicyPods(ctx, cli, policy, res)
+}
+
+// listNodesByClusterPolicy returns the nodes whose host network traffic is selected by the policy
+func listNodesByClusterPolicy(ctx context.Context, cli client.Client, policy *v1beta1.EgressClusterPolicy) ([]corev1.Node, error) {
+	if policy.Spec.AppliedTo.NodeSelector == nil {
+		return nil, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(policy.Spec.AppliedTo.NodeSelector)
+	if err != nil {
+		return nil, err
+	}
+	nodes := new(corev1.NodeList)
+	err = cli.List(ctx, nodes, &client.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	return nodes.Items, nil
+}
+
+// nodeInternalIPs returns the internal IPs of the node, they are the source IPs of the host
+// network traffic of the node
+func nodeInternalIPs(node corev1.Node) ([]string, []string) {
+	ipv4List := make([]string, 0)
+	ipv6List := make([]string, 0)
+	for _, addr := range node.Status.Addresses {
+		if addr.Type != corev1.NodeInternalIP {
+			continue
+		}
+		ip := net.ParseIP(addr.Address)
+		if ip.To4() != nil {
+			ipv4List = append(ipv4List, addr.Address)
+		} else if ip.To16() != nil {
+			ipv6List = append(ipv6List, addr.Address)
+		}
+	}
+	sort.Strings(ipv4List)
+	sort.Strings(ipv6List)
+	return ipv4List, ipv6List
+}
+
+// newNodeEndpoint returns the endpoint of the host network of the node, it has no pod
+func newNodeEndpoint(node corev1.Node) *v1beta1.EgressEndpoint {
+	ipv4List, ipv6List := nodeInternalIPs(node)
+	if len(ipv4List) == 0 && len(ipv6List) == 0 {
+		return nil
+	}
+	return &v1beta1.EgressEndpoint{
+		IPv4: ipv4List,
+		IPv6: ipv6List,
+		Node: node.Name,
+	}
+}
+
+func needUpdateNodeEndpoint(node corev1.Node, ep *v1beta1.EgressEndpoint) bool {
+	ipv4List, ipv6List := nodeInternalIPs(node)
+	needUpdate := false
+	if !sliceEqual(ipv4List, ep.IPv4) {
+		needUpdate = true
+		ep.IPv4 = ipv4List
+	}
+	if !sliceEqual(ipv6List, ep.IPv6) {
+		needUpdate = true
+		ep.IPv6 = ipv6List
+	}
+	return needUpdate
+}
+
+// filterClusterPolicyPods removes the excluded pods and the pods whose ServiceAccounts are not selected
+func filterClusterPolicyPods(ctx context.Context, cli client.Client, policy *v1beta1.EgressClusterPolicy, pods []corev1.Pod) ([]corev1.Pod, error) {
+	pods, err := excludePods(pods, policy.Spec.AppliedTo.ExcludePodSelector)
+	if err != nil {
+		return nil, err
+	}
+	return filterPodsByServiceAccount(ctx, cli, pods, policy.Spec.AppliedTo.ServiceAccountSelector)
 }
 
 func listClusterEndpointSlices(ctx context.Context, cli client.Client, policyName string) (*v1beta1.EgressClusterEndpointSliceList, error) {
@@ -332,9 +442,76 @@ func NewEgressClusterEpSliceController(mgr manager.Manager, log logr.Logger, cfg
 		return fmt.Errorf("failed to watch EgressClusterEndpointSlice: %v", err)
 	}
 
+	if err = c.Watch(source.Kind(mgr.GetCache(), &corev1.ServiceAccount{}),
+		handler.EnqueueRequestsFromMapFunc(enqueueServiceAccountEGCP(r.client))); err != nil {
+		return fmt.Errorf("failed to watch ServiceAccount: %v", err)
+	}
+
+	if err = c.Watch(source.Kind(mgr.GetCache(), &corev1.Node{}),
+		handler.EnqueueRequestsFromMapFunc(enqueueNodeEGCP(r.client)), nodePredicate{}); err != nil {
+		return fmt.Errorf("failed to watch node: %v", err)
+	}
+
 	return nil
 }
 
+type nodePredicate struct {
+}
+
+func (p nodePredicate) Create(_ event.CreateEvent) bool {
+	return true
+}
+
+func (p nodePredicate) Delete(_ event.DeleteEvent) bool {
+	return true
+}
+
+func (p nodePredicate) Update(updateEvent event.UpdateEvent) bool {
+	oldNode, ok := updateEvent.ObjectOld.(*corev1.Node)
+	if !ok {
+		return false
+	}
+	newNode, ok := updateEvent.ObjectNew.(*corev1.Node)
+	if !ok {
+		return false
+	}
+
+	// the status of the node is updated frequently, only the labels and the addresses matter
+	if reflect.DeepEqual(oldNode.Labels, newNode.Labels) &&
+		reflect.DeepEqual(oldNode.Status.Addresses, newNode.Status.Addresses) {
+		return false
+	}
+
+	return true
+}
+
+func (p nodePredicate) Generic(_ event.GenericEvent) bool {
+	return true
+}
+
+// enqueueNodeEGCP enqueues the policies selecting the host network traffic of the nodes,
+// a policy which selected the node before its labels changed is also reconciled
+func enqueueNodeEGCP(cli client.Client) handler.MapFunc {
+	return func(ctx context.Context, _ client.Object) []reconcile.Request {
+		policyList := new(v1beta1.EgressClusterPolicyList)
+		err := cli.List(ctx, policyList)
+		if err != nil {
+			return nil
+		}
+
+		res := make([]reconcile.Request, 0)
+		for _, policy := range policyList.Items {
+			if policy.Spec.AppliedTo.NodeSelector == nil {
+				continue
+			}
+			res = append(res, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: policy.Name},
+			})
+		}
+		return res
+	}
+}
+
 type nsPredicate struct {
 }
 
@@ -424,7 +601,7 @@ func enqueueEGCP(cli client.Client) handler.MapFunc {
 		}
 
 		for _, policy := range policyList.Items {
-			selPods, err := metav1.LabelSelectorAsSelector(policy.Spec.AppliedTo.PodSelector)
+			selPods, err := podLabelSelector(policy.Spec.AppliedTo.PodSelector, policy.Spec.AppliedTo.ServiceAccountSelector)
 			if err != nil {
 				return nil
 			}
@@ -457,3 +634,25 @@ func enqueueEGCP(cli client.Client) handler.MapFunc {
 		return res
 	}
 }
+
+// enqueueServiceAccountEGCP enqueues the cluster policies selecting the pods by the labels
+// of their ServiceAccounts
+func enqueueServiceAccountEGCP(cli client.Client) handler.MapFunc {
+	return func(ctx context.Context, _ client.Object) []reconcile.Request {
+		policyList := new(v1beta1.EgressClusterPolicyList)
+		err := cli.List(ctx, policyList)
+		if err != nil {
+			return nil
+		}
+
+		res := make([]reconcile.Request, 0)
+		for _, policy := range policyList.Items {
+			sa := policy.Spec.AppliedTo.ServiceAccountSelector
+			if sa == nil || sa.Selector == nil {
+				continue
+			}
+			res = append(res, reconcile.Request{NamespacedName: types.NamespacedName{Name: policy.Name}})
+		}
+		return res
+	}
+}
@@ -920,6 +920,59 @@ func Test_listClusterEndpointSlices(t *testing.T) {
 	})
 }
 
+func Test_reconcileNodeEndpoints(t *testing.T) {
+	node := func(name, ip string, labels map[string]string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+			Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: name},
+				{Type: corev1.NodeInternalIP, Address: ip},
+			}},
+		}
+	}
+	selected := map[string]string{"egress": "host"}
+	node1 := node("node1", "172.18.0.2", selected)
+	node2 := node("node2", "172.18.0.3", nil)
+	policy := &v1beta1.EgressClusterPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "policy"},
+		Spec: v1beta1.EgressClusterPolicySpec{
+			AppliedTo: v1beta1.ClusterAppliedTo{
+				NodeSelector: &metav1.LabelSelector{MatchLabels: selected},
+			},
+		},
+	}
+	cli := fake.NewClientBuilder().WithScheme(schema.GetScheme()).WithObjects(node1, node2, policy).Build()
+	r := &endpointClusterReconciler{
+		client: cli,
+		log:    logr.Discard(),
+		config: &config.Config{FileConfig: config.FileConfig{MaxNumberEndpointPerSlice: 100}},
+	}
+	ctx := context.Background()
+	endpoints := func() []v1beta1.EgressEndpoint {
+		_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: policy.Name}})
+		assert.NoError(t, err)
+		slices, err := listClusterEndpointSlices(ctx, cli, policy.Name)
+		assert.NoError(t, err)
+		res := make([]v1beta1.EgressEndpoint, 0)
+		for _, item := range slices.Items {
+			res = append(res, item.Endpoints...)
+		}
+		return res
+	}
+
+	assert.Equal(t, []v1beta1.EgressEndpoint{{Node: "node1", IPv4: []string{"172.18.0.2"}}}, endpoints())
+
+	// the endpoint follows the internal IP of the node
+	node1.Status.Addresses[1].Address = "172.18.0.12"
+	assert.NoError(t, cli.Status().Update(ctx, node1))
+	assert.Equal(t, []v1beta1.EgressEndpoint{{Node: "node1", IPv4: []string{"172.18.0.12"}}}, endpoints())
+
+	// the endpoint is removed when the node is not selected
+	node1.Labels = nil
+	assert.NoError(t, cli.Update(ctx, node1))
+	assert.Empty(t, endpoints())
+}
+
 func Test_Update(t *testing.T) {
 	cases := map[string]struct {
 		in  event.UpdateEvent
@@ -6,9 +6,7 @@ package endpoint
 import (
 	"context"
 	"fmt"
-	"net"
 	"reflect"
-	"sort"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -89,7 +87,7 @@ func (r *endpointReconciler) Reconcile(ctx context.Context, req reconcile.Reques
 			ep := epSlice.Endpoints[i]
 			key := types.NamespacedName{Namespace: ep.Namespace, Name: ep.Pod}
 			if pod, ok := podMap[key]; ok {
-				if needUpdateEndpoint(pod, &ep) {
+				if needUpdateEndpoint(pod, policy.Spec.AppliedTo.Networks, &ep) {
 					// pod changes the IP address
 					// egress ep ip list != pod list
 					needUpdate = true
@@ -114,7 +112,7 @@ func (r *endpointReconciler) Reconcile(ctx context.Context, req reconcile.Reques
 	for _, pod := range pods.Items {
 		key := types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}
 		if _, ok := existingKeyMap[key]; !ok {
-			if ep := newEndpoint(pod); ep != nil {
+			if ep := newEndpoint(pod, policy.Spec.AppliedTo.Networks); ep != nil {
 				needToCreateEp = append(needToCreateEp, *ep)
 			}
 		}
@@ -227,19 +225,8 @@ func getEndpointSlicePrefix(name string) string {
 	return prefix
 }
 
-func newEndpoint(pod corev1.Pod) *v1beta1.EgressEndpoint {
-	ipv4List := make([]string, 0)
-	ipv6List := make([]string, 0)
-
-	for _, podIP := range pod.Status.PodIPs {
-		ip := net.ParseIP(podIP.IP)
-		if ip.To4() != nil {
-			ipv4List = append(ipv4List, podIP.IP)
-		} else if ip.To16() != nil {
-			ipv6List = append(ipv6List, podIP.IP)
-		}
-	}
-
+func newEndpoint(pod corev1.Pod, networks []string) *v1beta1.EgressEndpoint {
+	ipv4List, ipv6List := podIPs(pod, networks)
 	if len(ipv4List) == 0 && len(ipv6List) == 0 {
 		return nil
 	}
@@ -253,20 +240,8 @@ func newEndpoint(pod corev1.Pod) *v1beta1.EgressEndpoint {
 	}
 }
 
-func needUpdateEndpoint(pod corev1.Pod, ep *v1beta1.EgressEndpoint) bool {
-	expIPv4List := make([]string, 0)
-	expIPv6List := make([]string, 0)
-
-	for _, podIP := range pod.Status.PodIPs {
-		ip := net.ParseIP(podIP.IP)
-		if ip.To4() != nil {
-			expIPv4List = append(expIPv4List, podIP.IP)
-		} else if ip.To16() != nil {
-			expIPv6List = append(expIPv6List, podIP.IP)
-		}
-	}
-	sort.Strings(expIPv4List)
-	sort.Strings(expIPv6List)
+func needUpdateEndpoint(pod corev1.Pod, networks []string, ep *v1beta1.EgressEndpoint) bool {
+	expIPv4List, expIPv6List := podIPs(pod, networks)
 
 	gotIPv4List := ep.IPv4
 	gotIPv6List := ep.IPv6
@@ -305,7 +280,7 @@ func (r *endpointReconciler) initEndpoint() error {
 
 func listPodsByPolicy(ctx context.Context, cli client.Client, policy *v1beta1.EgressPolicy) (*corev1.PodList, error) {
 	pods := new(corev1.PodList)
-	selector, err := metav1.LabelSelectorAsSelector(policy.Spec.AppliedTo.PodSelector)
+	selector, err := podLabelSelector(policy.Spec.AppliedTo.PodSelector, policy.Spec.AppliedTo.ServiceAccountSelector)
 	if err != nil {
 		return pods, err
 	}
@@ -314,9 +289,81 @@ func listPodsByPolicy(ctx context.Context, cli client.Client, policy *v1beta1.Eg
 		Namespace:     policy.Namespace,
 	}
 	err = cli.List(ctx, pods, opt)
+	if err != nil {
+		return pods, err
+	}
+	pods.Items, err = excludePods(pods.Items, policy.Spec.AppliedTo.ExcludePodSelector)
+	if err != nil {
+		return pods, err
+	}
+	pods.Items, err = filterPodsByServiceAccount(ctx, cli, pods.Items, policy.Spec.AppliedTo.ServiceAccountSelector)
 	return pods, err
 }
 
+// podLabelSelector returns the label selector of the pods, all the pods are listed when
+// they are only selected by their ServiceAccounts
+func podLabelSelector(podSelector *metav1.LabelSelector, sa *v1beta1.ServiceAccountSelector) (labels.Selector, error) {
+	if podSelector == nil && sa != nil {
+		return labels.Everything(), nil
+	}
+	return metav1.LabelSelectorAsSelector(podSelector)
+}
+
+// filterPodsByServiceAccount returns the pods whose ServiceAccounts are selected
+func filterPodsByServiceAccount(ctx context.Context, cli client.Client, pods []corev1.Pod, sa *v1beta1.ServiceAccountSelector) ([]corev1.Pod, error) {
+	if sa == nil {
+		return pods, nil
+	}
+	names := make(map[string]bool, len(sa.Names))
+	for _, name := range sa.Names {
+		names[name] = true
+	}
+	selected := make(map[types.NamespacedName]bool)
+	if sa.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(sa.Selector)
+		if err != nil {
+			return nil, err
+		}
+		accounts := new(corev1.ServiceAccountList)
+		if err := cli.List(ctx, accounts, &client.ListOptions{LabelSelector: selector}); err != nil {
+			return nil, err
+		}
+		for _, item := range accounts.Items {
+			selected[types.NamespacedName{Namespace: item.Namespace, Name: item.Name}] = true
+		}
+	}
+
+	res := make([]corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		name := pod.Spec.ServiceAccountName
+		if name == "" {
+			name = "default"
+		}
+		if names[name] || selected[types.NamespacedName{Namespace: pod.Namespace, Name: name}] {
+			res = append(res, pod)
+		}
+	}
+	return res, nil
+}
+
+// excludePods returns the pods which are not matched by the excludePodSelector
+func excludePods(pods []corev1.Pod, exclude *metav1.LabelSelector) ([]corev1.Pod, error) {
+	if exclude == nil {
+		return pods, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(exclude)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if !selector.Matches(labels.Set(pod.Labels)) {
+			res = append(res, pod)
+		}
+	}
+	return res, nil
+}
+
 func listEndpointSlices(ctx context.Context, cli client.Client, namespace, policyName string) (*v1beta1.EgressEndpointSliceList, error) {
 	slices := new(v1beta1.EgressEndpointSliceList)
 	labelSelector := &metav1.LabelSelector{MatchLabels: map[string]string{
@@ -369,6 +416,11 @@ func NewEgressEndpointSliceController(mgr manager.Manager, log logr.Logger, cfg
 		return fmt.Errorf("failed to watch EgressEndpointSlice: %v", err)
 	}
 
+	if err = c.Watch(source.Kind(mgr.GetCache(), &corev1.ServiceAccount{}),
+		handler.EnqueueRequestsFromMapFunc(enqueueServiceAccount(r.client))); err != nil {
+		return fmt.Errorf("failed to watch ServiceAccount: %v", err)
+	}
+
 	return nil
 }
 
@@ -403,6 +455,7 @@ func (p podPredicate) Update(updateEvent event.UpdateEvent) bool {
 	// case by pods labels are changed
 	if reflect.DeepEqual(oldPod.Labels, newPod.Labels) &&
 		reflect.DeepEqual(oldPod.Status.PodIPs, newPod.Status.PodIPs) &&
+		oldPod.Annotations[networkStatusAnnotation] == newPod.Annotations[networkStatusAnnotation] &&
 		oldPod.Spec.NodeName != newPod.Spec.NodeName {
 		return false
 	}
@@ -430,7 +483,7 @@ func enqueuePod(cli client.Client) handler.MapFunc {
 		res := make([]reconcile.Request, 0)
 
 		for _, policy := range policyList.Items {
-			selPods, err := metav1.LabelSelectorAsSelector(policy.Spec.AppliedTo.PodSelector)
+			selPods, err := podLabelSelector(policy.Spec.AppliedTo.PodSelector, policy.Spec.AppliedTo.ServiceAccountSelector)
 			if err != nil {
 				return nil
 			}
@@ -447,3 +500,27 @@ func enqueuePod(cli client.Client) handler.MapFunc {
 		return res
 	}
 }
+
+// enqueueServiceAccount enqueues the policies selecting the pods by the labels of their
+// ServiceAccounts in the namespace of the ServiceAccount
+func enqueueServiceAccount(cli client.Client) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		policyList := new(v1beta1.EgressPolicyList)
+		err := cli.List(ctx, policyList, client.InNamespace(obj.GetNamespace()))
+		if err != nil {
+			return nil
+		}
+
+		res := make([]reconcile.Request, 0)
+		for _, policy := range policyList.Items {
+			sa := policy.Spec.AppliedTo.ServiceAccountSelector
+			if sa == nil || sa.Selector == nil {
+				continue
+			}
+			res = append(res, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: policy.Namespace, Name: policy.Name},
+			})
+		}
+		return res
+	}
+}
@@ -882,10 +882,10 @@ func Test_newEndpoint(t *testing.T) {
 					{IP: "fddd:dd::2"},
 				},
 			},
-		})
+		}, nil)
 	})
 	t.Run("no ip", func(t *testing.T) {
-		newEndpoint(corev1.Pod{})
+		newEndpoint(corev1.Pod{}, nil)
 	})
 }
 
@@ -897,7 +897,7 @@ func Test_needUpdateEndpoint(t *testing.T) {
 					{IP: "fddd:dd::2"},
 				},
 			},
-		}, &v1beta1.EgressEndpoint{})
+		}, nil, &v1beta1.EgressEndpoint{})
 	})
 	t.Run("need update ipv4", func(t *testing.T) {
 		needUpdateEndpoint(corev1.Pod{
@@ -906,7 +906,7 @@ func Test_needUpdateEndpoint(t *testing.T) {
 					{IP: "10.10.0.2"},
 				},
 			},
-		}, &v1beta1.EgressEndpoint{})
+		}, nil, &v1beta1.EgressEndpoint{})
 	})
 	t.Run("need update ipv6", func(t *testing.T) {
 		needUpdateEndpoint(corev1.Pod{
@@ -915,7 +915,7 @@ func Test_needUpdateEndpoint(t *testing.T) {
 					{IP: "fddd:dd::2"},
 				},
 			},
-		}, &v1beta1.EgressEndpoint{})
+		}, nil, &v1beta1.EgressEndpoint{})
 	})
 }
 
@@ -1788,3 +1788,108 @@ func mock_enqueuePod_LabelSelectorAsSelector_err(c client.Client) []gomonkey.Pat
 	patch1 := gomonkey.ApplyFuncReturn(metav1.LabelSelectorAsSelector, nil, errForMock)
 	return []gomonkey.Patches{*patch1}
 }
+
+// podNames returns the names of the pods
+func podNames(pods []corev1.Pod) []string {
+	res := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		res = append(res, pod.Name)
+	}
+	return res
+}
+
+func Test_listPodsExcludePodSelector(t *testing.T) {
+	app := map[string]string{"app": "nginx"}
+	direct := map[string]string{"app": "nginx", "egress": "direct"}
+	exclude := &metav1.LabelSelector{MatchLabels: map[string]string{"egress": "direct"}}
+	objs := []client.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: app}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "default", Labels: app}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod2", Namespace: "default", Labels: direct}},
+	}
+	cli := fake.NewClientBuilder().WithScheme(schema.GetScheme()).WithObjects(objs...).Build()
+
+	policy := &v1beta1.EgressPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "policy", Namespace: "default"},
+		Spec: v1beta1.EgressPolicySpec{AppliedTo: v1beta1.AppliedTo{
+			PodSelector:        &metav1.LabelSelector{MatchLabels: app},
+			ExcludePodSelector: exclude,
+		}},
+	}
+	pods, err := listPodsByPolicy(context.TODO(), cli, policy)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pod1"}, podNames(pods.Items))
+
+	for _, nsSelector := range []*metav1.LabelSelector{nil, {MatchLabels: app}} {
+		clusterPolicy := &v1beta1.EgressClusterPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "policy"},
+			Spec: v1beta1.EgressClusterPolicySpec{AppliedTo: v1beta1.ClusterAppliedTo{
+				PodSelector:        &metav1.LabelSelector{MatchLabels: app},
+				NamespaceSelector:  nsSelector,
+				ExcludePodSelector: exclude,
+			}},
+		}
+		clusterPods, err := listPodsByClusterPolicy(context.TODO(), cli, clusterPolicy)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"pod1"}, podNames(clusterPods))
+	}
+}
+
+func Test_listPodsServiceAccountSelector(t *testing.T) {
+	objs := []client.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "backup", Labels: map[string]string{"team": "ops"}}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "shipper", Namespace: "default", Labels: map[string]string{"egress": "eip"}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "default", Labels: map[string]string{"app": "log"}},
+			Spec: corev1.PodSpec{ServiceAccountName: "shipper"}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod2", Namespace: "default", Labels: map[string]string{"app": "web"}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod3", Namespace: "backup"},
+			Spec: corev1.PodSpec{ServiceAccountName: "restic"}},
+	}
+	cli := fake.NewClientBuilder().WithScheme(schema.GetScheme()).WithObjects(objs...).Build()
+	byLabels := &v1beta1.ServiceAccountSelector{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"egress": "eip"}}}
+
+	cases := map[string]struct {
+		appliedTo v1beta1.AppliedTo
+		expPods   []string
+	}{
+		"select by names": {
+			appliedTo: v1beta1.AppliedTo{ServiceAccountSelector: &v1beta1.ServiceAccountSelector{Names: []string{"default"}}},
+			expPods:   []string{"pod2"},
+		},
+		"select by labels": {
+			appliedTo: v1beta1.AppliedTo{ServiceAccountSelector: byLabels},
+			expPods:   []string{"pod1"},
+		},
+		"select together with podSelector": {
+			appliedTo: v1beta1.AppliedTo{
+				PodSelector:            &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+				ServiceAccountSelector: byLabels,
+			},
+			expPods: []string{},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			policy := &v1beta1.EgressPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "policy", Namespace: "default"},
+				Spec:       v1beta1.EgressPolicySpec{AppliedTo: c.appliedTo},
+			}
+			pods, err := listPodsByPolicy(context.TODO(), cli, policy)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expPods, podNames(pods.Items))
+		})
+	}
+
+	// the ServiceAccounts compose with the namespaceSelector
+	clusterPolicy := &v1beta1.EgressClusterPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "policy"},
+		Spec: v1beta1.EgressClusterPolicySpec{AppliedTo: v1beta1.ClusterAppliedTo{
+			NamespaceSelector:      &metav1.LabelSelector{MatchLabels: map[string]string{"team": "ops"}},
+			ServiceAccountSelector: &v1beta1.ServiceAccountSelector{Names: []string{"restic", "shipper"}},
+		}},
+	}
+	pods, err := listPodsByClusterPolicy(context.TODO(), cli, clusterPolicy)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pod3"}, podNames(pods))
+}
@@ -0,0 +1,86 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package endpoint
+
+import (
+	"encoding/json"
+	"net"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// networkStatusAnnotation is the annotation of Multus with the networks attached to the pod
+const networkStatusAnnotation = "k8s.v1.cni.cncf.io/network-status"
+
+// networkStatus is a network of the network-status annotation
+type networkStatus struct {
+	Name      string   `json:"name"`
+	Interface string   `json:"interface,omitempty"`
+	IPs       []string `json:"ips,omitempty"`
+	Default   bool     `json:"default,omitempty"`
+}
+
+// podIPs returns the IPs of the pod network of the pod, and the IPs of the attached networks
+// listed in networks. A network is named `<namespace>/<name>` of its NetworkAttachmentDefinition,
+// the namespace of the pod is used when it is omitted.
+func podIPs(pod corev1.Pod, networks []string) ([]string, []string) {
+	ips := make([]string, 0, len(pod.Status.PodIPs))
+	for _, podIP := range pod.Status.PodIPs {
+		ips = append(ips, podIP.IP)
+	}
+
+	if len(networks) > 0 {
+		wanted := make(map[string]bool, len(networks))
+		for _, network := range networks {
+			wanted[networkName(pod.Namespace, network)] = true
+		}
+		for _, status := range podNetworkStatus(pod) {
+			if wanted[networkName(pod.Namespace, status.Name)] {
+				ips = append(ips, status.IPs...)
+			}
+		}
+	}
+
+	ipv4List := make([]string, 0)
+	ipv6List := make([]string, 0)
+	seen := make(map[string]bool, len(ips))
+	for _, item := range ips {
+		if seen[item] {
+			continue
+		}
+		seen[item] = true
+		ip := net.ParseIP(item)
+		if ip.To4() != nil {
+			ipv4List = append(ipv4List, item)
+		} else if ip.To16() != nil {
+			ipv6List = append(ipv6List, item)
+		}
+	}
+	sort.Strings(ipv4List)
+	sort.Strings(ipv6List)
+	return ipv4List, ipv6List
+}
+
+// podNetworkStatus returns the networks of the network-status annotation of the pod, the
+// annotation which cannot be parsed is ignored
+func podNetworkStatus(pod corev1.Pod) []networkStatus {
+	value, ok := pod.Annotations[networkStatusAnnotation]
+	if !ok {
+		return nil
+	}
+	res := make([]networkStatus, 0)
+	if err := json.Unmarshal([]byte(value), &res); err != nil {
+		return nil
+	}
+	return res
+}
+
+func networkName(namespace, name string) string {
+	if strings.Contains(name, "/") {
+		return name
+	}
+	return namespace + "/" + name
+}
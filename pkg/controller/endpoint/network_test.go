@@ -0,0 +1,71 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package endpoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_podIPs(t *testing.T) {
+	status := `[
+		{"name": "calico", "interface": "eth0", "ips": ["10.10.0.2", "fd00::2"], "default": true},
+		{"name": "kube-system/macvlan", "interface": "net1", "ips": ["172.30.0.2"]},
+		{"name": "default/sriov", "interface": "net2", "ips": ["172.31.0.2", "fd31::2"]}
+	]`
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "pod1",
+			Annotations: map[string]string{networkStatusAnnotation: status},
+		},
+		Status: corev1.PodStatus{PodIPs: []corev1.PodIP{{IP: "10.10.0.2"}, {IP: "fd00::2"}}},
+	}
+
+	cases := map[string]struct {
+		pod      corev1.Pod
+		networks []string
+		expIPv4  []string
+		expIPv6  []string
+	}{
+		"pod network": {
+			pod:     pod,
+			expIPv4: []string{"10.10.0.2"},
+			expIPv6: []string{"fd00::2"},
+		},
+		"attached networks": {
+			pod:      pod,
+			networks: []string{"kube-system/macvlan", "sriov", "missing"},
+			expIPv4:  []string{"10.10.0.2", "172.30.0.2", "172.31.0.2"},
+			expIPv6:  []string{"fd00::2", "fd31::2"},
+		},
+		"network in the other namespace": {
+			pod:      pod,
+			networks: []string{"macvlan"},
+			expIPv4:  []string{"10.10.0.2"},
+			expIPv6:  []string{"fd00::2"},
+		},
+		"invalid annotation": {
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{networkStatusAnnotation: "{"},
+				},
+				Status: corev1.PodStatus{PodIPs: []corev1.PodIP{{IP: "10.10.0.3"}}},
+			},
+			networks: []string{"sriov"},
+			expIPv4:  []string{"10.10.0.3"},
+			expIPv6:  []string{},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ipv4List, ipv6List := podIPs(c.pod, c.networks)
+			assert.Equal(t, c.expIPv4, ipv4List)
+			assert.Equal(t, c.expIPv6, ipv6List)
+		})
+	}
+}
@@ -9,14 +9,17 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/cilium/ipam/service/ipallocator"
 	"github.com/go-logr/logr"
 	"github.com/prometheus/client_golang/prometheus"
+	coordinationv1 "k8s.io/api/coordination/v1"
 	corev1 "k8s.io/api/core/v1"
 	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
@@ -29,6 +32,7 @@ import (
 
 	"github.com/spidernet-io/egressgateway/pkg/config"
 	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/lease"
 	"github.com/spidernet-io/egressgateway/pkg/markallocator"
 	"github.com/spidernet-io/egressgateway/pkg/utils"
 )
@@ -81,6 +85,8 @@ type egReconciler struct {
 	allocatorV6 *ipallocator.Range
 	initDone    chan struct{}
 	recorder    record.EventRecorder
+	// kick runs the health check at once, when an agent reports a peer unreachable
+	kick chan struct{}
 }
 
 func (r *egReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
@@ -153,6 +159,15 @@ func (r *egReconciler) reconcileEGN(ctx context.Context, req reconcile.Request,
 		return reconcile.Result{Requeue: true}, err
 	}
 
+	// the report of the peer probe does not move the EIPs by itself, the health check
+	// still waits for the node lease to expire
+	if r.config.FileConfig.GatewayFailover.Enable && len(egresstunnel.Status.UnreachableFrom) > 0 {
+		select {
+		case r.kick <- struct{}{}:
+		default:
+		}
+	}
+
 	return reconcile.Result{Requeue: false}, nil
 }
 
@@ -222,6 +237,10 @@ func (r *egReconciler) reconcileNode(ctx context.Context, req reconcile.Request,
 				if err != nil {
 					return reconcile.Result{Requeue: true}, err
 				}
+				if phase == egressv1.EgressTunnelNodeNotReady {
+					r.recorder.Event(egressTunnel, corev1.EventTypeWarning, egressv1.ReasonNodeNotReady,
+						"EgressTunnel status changes to NodeNotReady.")
+				}
 			}
 		}
 	}
@@ -484,11 +503,19 @@ func (r *egReconciler) keepEgressTunnel(node egressv1.EgressTunnel, log logr.Log
 		log.V(1).Info("allocate next ipv6 address succeeded", "ipv6", ip)
 	}
 
+	wasReady := meta.IsStatusConditionTrue(newNode.Status.Conditions, egressv1.ConditionProgrammed)
+	if r.setTunnelConditions(newNode) {
+		needUpdate = true
+	}
+
 	if needUpdate {
 		err := r.updateEgressTunnel(*newNode)
 		if err != nil {
 			return fmt.Errorf("rebuild failed to update egress tunnel: %v", err)
 		}
+		if !wasReady && newNode.Status.Phase == egressv1.EgressTunnelReady {
+			r.recorder.Event(newNode, corev1.EventTypeNormal, egressv1.ReasonTunnelReady, "EgressTunnel is ready.")
+		}
 	}
 
 	return nil
@@ -513,6 +540,7 @@ func (r *egReconciler) updateEgressTunnel(node egressv1.EgressTunnel) error {
 	if node.Status.Tunnel.MAC == "" {
 		node.Status.Phase = egressv1.EgressTunnelPending
 	}
+	r.setTunnelConditions(&node)
 
 	err := r.client.Status().Update(context.Background(), &node)
 	if err != nil {
@@ -521,6 +549,58 @@ func (r *egReconciler) updateEgressTunnel(node egressv1.EgressTunnel) error {
 	return nil
 }
 
+// setTunnelConditions refreshes the conditions and observedGeneration of the
+// EgressTunnel status from its phase, it returns true if the status has been changed.
+func (r *egReconciler) setTunnelConditions(tunnel *egressv1.EgressTunnel) bool {
+	status := tunnel.Status
+	accepted := utils.NewCondition(egressv1.ConditionAccepted, true, egressv1.ReasonAccepted, "")
+
+	allocated := utils.NewCondition(egressv1.ConditionIPAllocated, true, egressv1.ReasonAllocated,
+		fmt.Sprintf("mark=%s mac=%s ipv4=%s ipv6=%s", status.Mark, status.Tunnel.MAC, status.Tunnel.IPv4, status.Tunnel.IPv6))
+	if status.Mark == "" || status.Tunnel.MAC == "" ||
+		(status.Tunnel.IPv4 == "" && r.allocatorV4 != nil) ||
+		(status.Tunnel.IPv6 == "" && r.allocatorV6 != nil) {
+		allocated = utils.NewCondition(egressv1.ConditionIPAllocated, false, egressv1.ReasonPending,
+			"waiting for the mark, mac and tunnel IPs to be allocated")
+	}
+
+	programmed := utils.NewCondition(egressv1.ConditionProgrammed, true, egressv1.ReasonProgrammed, "")
+	degraded := utils.NewCondition(egressv1.ConditionDegraded, false, egressv1.ReasonAsExpected, "")
+	switch status.Phase {
+	case egressv1.EgressTunnelReady:
+	case egressv1.EgressTunnelHeartbeatTimeout:
+		msg := "the agent has not reported the heartbeat in time"
+		programmed = utils.NewCondition(egressv1.ConditionProgrammed, false, egressv1.ReasonHeartbeatTimeout, msg)
+		degraded = utils.NewCondition(egressv1.ConditionDegraded, true, egressv1.ReasonHeartbeatTimeout, msg)
+	case egressv1.EgressTunnelNodeNotReady:
+		msg := "the node is not ready"
+		programmed = utils.NewCondition(egressv1.ConditionProgrammed, false, egressv1.ReasonNodeNotReady, msg)
+		degraded = utils.NewCondition(egressv1.ConditionDegraded, true, egressv1.ReasonNodeNotReady, msg)
+	case egressv1.EgressTunnelFailed:
+		msg := "the agent failed to set up the tunnel"
+		programmed = utils.NewCondition(egressv1.ConditionProgrammed, false, string(egressv1.EgressTunnelFailed), msg)
+		degraded = utils.NewCondition(egressv1.ConditionDegraded, true, string(egressv1.EgressTunnelFailed), msg)
+	default:
+		programmed = utils.NewCondition(egressv1.ConditionProgrammed, false, egressv1.ReasonPending,
+			fmt.Sprintf("the tunnel is in %s phase", status.Phase))
+	}
+
+	conditions := []metav1.Condition{accepted, allocated, programmed, degraded}
+	if r.config != nil && r.config.FileConfig.GatewayFailover.PeerProbe.Enable {
+		// the agents report the peer probe each on their own, the node is unreachable as
+		// soon as one of them can not reach it
+		reachable := utils.NewCondition(egressv1.ConditionPeerReachable, true, egressv1.ReasonPeerReachable, "")
+		if from := status.UnreachableFrom; len(from) > 0 {
+			reachable = utils.NewCondition(egressv1.ConditionPeerReachable, false, egressv1.ReasonPeerUnreachable,
+				fmt.Sprintf("unreachable from %d nodes by the peer probe: %s", len(from), strings.Join(from, ",")))
+		}
+		conditions = append(conditions, reachable)
+	}
+
+	return utils.SetConditions(&tunnel.Status.Conditions, &tunnel.Status.ObservedGeneration, tunnel.Generation,
+		conditions...)
+}
+
 func generateMACAddress(nodeName string) (string, error) {
 	h := sha1.New()
 	_, err := h.Write([]byte(nodeName + "egress"))
@@ -581,6 +661,10 @@ func (r *egReconciler) healthCheck(ctx context.Context) {
 				continue
 			}
 			t.Reset(period)
+		case <-r.kick:
+			if err := r.tunnelListCheck(ctx); err != nil {
+				r.log.Error(err, "tunnel list check")
+			}
 		}
 	}
 }
@@ -610,11 +694,30 @@ func (r *egReconciler) tunnelListCheck(ctx context.Context) error {
 			continue
 		}
 
-		if time.Now().After(tunnel.Status.LastHeartbeatTime.Add(timeout)) {
+		nodeLease, err := r.getNodeLease(ctx, tunnel.Name)
+		if err != nil {
+			r.log.Error(err, "get node lease", "node", tunnel.Name)
+			continue
+		}
+
+		lastHeartbeatTime := tunnel.Status.LastHeartbeatTime.Time
+		if r.config.FileConfig.GatewayFailover.HeartbeatMode == config.HeartbeatModeLease &&
+			nodeLease != nil && nodeLease.Spec.RenewTime != nil && nodeLease.Spec.RenewTime.After(lastHeartbeatTime) {
+			lastHeartbeatTime = nodeLease.Spec.RenewTime.Time
+		}
+
+		if time.Now().After(lastHeartbeatTime.Add(timeout)) {
 			if tunnel.Status.Phase == egressv1.EgressTunnelHeartbeatTimeout {
 				continue
 			}
+			// the EIPs are only moved after the node lease has expired, so the agent
+			// has withdrawn them
+			if lease.Held(nodeLease, time.Now()) {
+				r.log.Info("tunnel heartbeat timeout, wait for the node lease to expire", "tunnel", tunnel.Name)
+				continue
+			}
 			tunnel.Status.Phase = egressv1.EgressTunnelHeartbeatTimeout
+			r.setTunnelConditions(tunnel)
 			r.log.Info("update tunnel status to HeartbeatTimeout", "tunnel", tunnel.Name)
 			err := r.client.Status().Update(ctx, tunnel)
 			if err != nil {
@@ -623,8 +726,8 @@ func (r *egReconciler) tunnelListCheck(ctx context.Context) error {
 			}
 
 			r.recorder.Event(
-				tunnel, corev1.EventTypeNormal,
-				egressv1.ReasonStatusChanged,
+				tunnel, corev1.EventTypeWarning,
+				egressv1.ReasonHeartbeatTimeout,
 				"EgressTunnel status changes to HeartbeatTimeout.",
 			)
 		}
@@ -632,6 +735,12 @@ func (r *egReconciler) tunnelListCheck(ctx context.Context) error {
 	return nil
 }
 
+// getNodeLease returns the lease renewed by the agent of the node, it returns nil if
+// the lease does not exist.
+func (r *egReconciler) getNodeLease(ctx context.Context, node string) (*coordinationv1.Lease, error) {
+	return lease.Get(ctx, r.client, r.config.FileConfig.GatewayFailover.LeaseNamespace, node)
+}
+
 func (r *egReconciler) Start(ctx context.Context) error {
 	if r.config.FileConfig.GatewayFailover.Enable {
 		go func() {
@@ -663,6 +772,7 @@ func NewEgressTunnelController(mgr manager.Manager, log logr.Logger, cfg *config
 		doOnce:   sync.Once{},
 		mark:     mark,
 		initDone: make(chan struct{}, 1),
+		kick:     make(chan struct{}, 1),
 	}
 
 	if cfg.FileConfig.EnableIPv4 {
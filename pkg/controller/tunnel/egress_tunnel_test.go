@@ -11,11 +11,15 @@ import (
 
 	"github.com/cilium/ipam/service/ipallocator"
 	"github.com/stretchr/testify/assert"
+	coordinationv1 "k8s.io/api/coordination/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -24,6 +28,7 @@ import (
 
 	"github.com/spidernet-io/egressgateway/pkg/config"
 	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/lease"
 	"github.com/spidernet-io/egressgateway/pkg/logger"
 	"github.com/spidernet-io/egressgateway/pkg/markallocator"
 	"github.com/spidernet-io/egressgateway/pkg/schema"
@@ -76,6 +81,7 @@ func TestEgressTunnelCtrlForEgressTunnel(t *testing.T) {
 		allocatorV4: allocatorV4,
 		allocatorV6: nil,
 		initDone:    make(chan struct{}, 1),
+		recorder:    record.NewFakeRecorder(100),
 	}
 
 	reqs := []TestNodeReq{
@@ -150,6 +156,7 @@ func TestEgressTunnelCtrlForNode(t *testing.T) {
 		allocatorV4: allocatorV4,
 		allocatorV6: allocatorV6,
 		initDone:    make(chan struct{}, 1),
+		recorder:    record.NewFakeRecorder(100),
 	}
 
 	reqs := []TestNodeReq{
@@ -246,6 +253,7 @@ func TestHealthCheck(t *testing.T) {
 		allocatorV4: allocatorV4,
 		allocatorV6: allocatorV6,
 		initDone:    make(chan struct{}, 1),
+		recorder:    record.NewFakeRecorder(100),
 	}
 
 	reconciler.initDone <- struct{}{}
@@ -321,3 +329,169 @@ func TestNewEgressTunnelController(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestSetTunnelConditions(t *testing.T) {
+	r := &egReconciler{}
+	tunnel := &egressv1.EgressTunnel{
+		ObjectMeta: v1.ObjectMeta{Name: "node1", Generation: 2},
+		Status: egressv1.EgressTunnelStatus{
+			Phase: egressv1.EgressTunnelReady,
+			Mark:  "0x26000000",
+			Tunnel: egressv1.Tunnel{
+				MAC:  "66:5c:0d:5e:29:61",
+				IPv4: "10.6.0.1",
+			},
+		},
+	}
+
+	assert.True(t, r.setTunnelConditions(tunnel))
+	assert.Equal(t, int64(2), tunnel.Status.ObservedGeneration)
+	for _, c := range tunnel.Status.Conditions {
+		if c.Type == egressv1.ConditionDegraded {
+			assert.Equal(t, metav1.ConditionFalse, c.Status)
+		} else {
+			assert.Equal(t, metav1.ConditionTrue, c.Status, c.Type)
+		}
+	}
+	assert.False(t, r.setTunnelConditions(tunnel))
+
+	tunnel.Status.Phase = egressv1.EgressTunnelHeartbeatTimeout
+	assert.True(t, r.setTunnelConditions(tunnel))
+	for _, c := range tunnel.Status.Conditions {
+		switch c.Type {
+		case egressv1.ConditionProgrammed:
+			assert.Equal(t, metav1.ConditionFalse, c.Status)
+			assert.Equal(t, egressv1.ReasonHeartbeatTimeout, c.Reason)
+		case egressv1.ConditionDegraded:
+			assert.Equal(t, metav1.ConditionTrue, c.Status)
+		}
+	}
+}
+
+func TestSetTunnelConditionsPeerReachable(t *testing.T) {
+	cfg := new(config.Config)
+	cfg.FileConfig.GatewayFailover.PeerProbe.Enable = true
+	r := &egReconciler{config: cfg}
+	tunnel := &egressv1.EgressTunnel{
+		ObjectMeta: v1.ObjectMeta{Name: "node1"},
+		Status:     egressv1.EgressTunnelStatus{Phase: egressv1.EgressTunnelReady},
+	}
+
+	r.setTunnelConditions(tunnel)
+	assert.True(t, meta.IsStatusConditionTrue(tunnel.Status.Conditions, egressv1.ConditionPeerReachable))
+
+	tunnel.Status.UnreachableFrom = []string{"node2", "node3"}
+	assert.True(t, r.setTunnelConditions(tunnel))
+	condition := meta.FindStatusCondition(tunnel.Status.Conditions, egressv1.ConditionPeerReachable)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, egressv1.ReasonPeerUnreachable, condition.Reason)
+	assert.Contains(t, condition.Message, "node2,node3")
+}
+
+func TestTunnelListCheckWaitsForLease(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.FileConfig.GatewayFailover.LeaseNamespace = "egress"
+	cfg.FileConfig.GatewayFailover.EipEvictionTimeout = 15
+
+	staleHeartbeat := metav1.NewTime(time.Now().Add(-time.Minute))
+	initialObjects := []client.Object{
+		&egressv1.EgressTunnel{
+			ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+			Status:     egressv1.EgressTunnelStatus{Phase: egressv1.EgressTunnelReady, LastHeartbeatTime: staleHeartbeat},
+		},
+		&egressv1.EgressTunnel{
+			ObjectMeta: metav1.ObjectMeta{Name: "node2"},
+			Status:     egressv1.EgressTunnelStatus{Phase: egressv1.EgressTunnelReady, LastHeartbeatTime: staleHeartbeat},
+		},
+		&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "egress", Name: lease.Name("node1")},
+			Spec: coordinationv1.LeaseSpec{
+				LeaseDurationSeconds: ptr.To[int32](10),
+				RenewTime:            &metav1.MicroTime{Time: time.Now()},
+			},
+		},
+	}
+
+	builder := fake.NewClientBuilder()
+	builder.WithScheme(schema.GetScheme())
+	builder.WithObjects(initialObjects...)
+	builder.WithStatusSubresource(&egressv1.EgressTunnel{})
+	cli := builder.Build()
+
+	r := &egReconciler{
+		client:   cli,
+		log:      logger.NewLogger(cfg.EnvConfig.Logger),
+		config:   cfg,
+		recorder: record.NewFakeRecorder(100),
+	}
+	assert.NoError(t, r.tunnelListCheck(context.Background()))
+
+	expPhases := map[string]egressv1.EgressTunnelPhase{
+		// the agent still holds the node lease
+		"node1": egressv1.EgressTunnelReady,
+		"node2": egressv1.EgressTunnelHeartbeatTimeout,
+	}
+	for name, phase := range expPhases {
+		tunnel := new(egressv1.EgressTunnel)
+		assert.NoError(t, cli.Get(context.Background(), types.NamespacedName{Name: name}, tunnel))
+		assert.Equal(t, phase, tunnel.Status.Phase, name)
+	}
+}
+
+func TestTunnelListCheckLeaseMode(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.FileConfig.GatewayFailover.LeaseNamespace = "egress"
+	cfg.FileConfig.GatewayFailover.EipEvictionTimeout = 15
+	cfg.FileConfig.GatewayFailover.HeartbeatMode = config.HeartbeatModeLease
+
+	staleHeartbeat := metav1.NewTime(time.Now().Add(-time.Minute))
+	initialObjects := []client.Object{
+		&egressv1.EgressTunnel{
+			ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+			Status:     egressv1.EgressTunnelStatus{Phase: egressv1.EgressTunnelReady, LastHeartbeatTime: staleHeartbeat},
+		},
+		&egressv1.EgressTunnel{
+			ObjectMeta: metav1.ObjectMeta{Name: "node2"},
+			Status:     egressv1.EgressTunnelStatus{Phase: egressv1.EgressTunnelReady, LastHeartbeatTime: staleHeartbeat},
+		},
+		&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "egress", Name: lease.Name("node1")},
+			Spec: coordinationv1.LeaseSpec{
+				LeaseDurationSeconds: ptr.To[int32](10),
+				RenewTime:            &metav1.MicroTime{Time: time.Now().Add(-time.Second * 12)},
+			},
+		},
+		&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "egress", Name: lease.Name("node2")},
+			Spec: coordinationv1.LeaseSpec{
+				LeaseDurationSeconds: ptr.To[int32](10),
+				RenewTime:            &metav1.MicroTime{Time: time.Now().Add(-time.Second * 20)},
+			},
+		},
+	}
+
+	builder := fake.NewClientBuilder()
+	builder.WithScheme(schema.GetScheme())
+	builder.WithObjects(initialObjects...)
+	builder.WithStatusSubresource(&egressv1.EgressTunnel{})
+	cli := builder.Build()
+
+	r := &egReconciler{
+		client:   cli,
+		log:      logger.NewLogger(cfg.EnvConfig.Logger),
+		config:   cfg,
+		recorder: record.NewFakeRecorder(100),
+	}
+	assert.NoError(t, r.tunnelListCheck(context.Background()))
+
+	expPhases := map[string]egressv1.EgressTunnelPhase{
+		// the lease is renewed within eipEvictionTimeout
+		"node1": egressv1.EgressTunnelReady,
+		"node2": egressv1.EgressTunnelHeartbeatTimeout,
+	}
+	for name, phase := range expPhases {
+		tunnel := new(egressv1.EgressTunnel)
+		assert.NoError(t, cli.Get(context.Background(), types.NamespacedName{Name: name}, tunnel))
+		assert.Equal(t, phase, tunnel.Status.Phase, name)
+	}
+}
@@ -7,18 +7,23 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net"
+	"strings"
 
 	v1 "k8s.io/api/admission/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
+	"github.com/spidernet-io/egressgateway/pkg/cidrgroup"
 	"github.com/spidernet-io/egressgateway/pkg/config"
 	"github.com/spidernet-io/egressgateway/pkg/egressgateway"
 	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/schedule"
 	"github.com/spidernet-io/egressgateway/pkg/utils/ip"
 )
 
@@ -27,6 +32,7 @@ const (
 	EgressGateway       = "EgressGateway"
 	EgressPolicy        = "EgressPolicy"
 	EgressClusterPolicy = "EgressClusterPolicy"
+	EgressCIDRGroup     = "EgressCIDRGroup"
 )
 
 // ValidateHook ValidateHook
@@ -46,6 +52,8 @@ func ValidateHook(client client.Client, cfg *config.Config) *webhook.Admission {
 				return validateEgressClusterPolicy(ctx, client, req, cfg)
 			case EgressPolicy:
 				return validateEgressPolicy(ctx, client, req, cfg)
+			case EgressCIDRGroup:
+				return validateEgressCIDRGroup(ctx, client, req)
 			}
 
 			return webhook.Allowed("checked")
@@ -85,13 +93,26 @@ func validateEgressPolicy(ctx context.Context, client client.Client, req webhook
 		return webhook.Denied("podSelector and podSubnet cannot be used together")
 	}
 
-	// denied when both PodSelector and PodSubnet are empty
-	if egp.Spec.AppliedTo.PodSubnet == nil || len(egp.Spec.AppliedTo.PodSubnet) == 0 {
+	// denied when PodSelector, PodSubnet and ServiceAccountSelector are all empty
+	if (egp.Spec.AppliedTo.PodSubnet == nil || len(egp.Spec.AppliedTo.PodSubnet) == 0) && egp.Spec.AppliedTo.ServiceAccountSelector == nil {
 		if egp.Spec.AppliedTo.PodSelector == nil || (len(egp.Spec.AppliedTo.PodSelector.MatchLabels) == 0 && len(egp.Spec.AppliedTo.PodSelector.MatchExpressions) == 0) {
-			return webhook.Denied("invalid EgressPolicy, spec.appliedTo field requires at least one of spec.appliedTo.podSubnet, .spec.appliedTo.podSelector.matchLabels or .spec.appliedTo.podSelector.matchExpressions to be specified.")
+			return webhook.Denied("invalid EgressPolicy, spec.appliedTo field requires at least one of spec.appliedTo.podSubnet, .spec.appliedTo.podSelector.matchLabels, .spec.appliedTo.podSelector.matchExpressions or .spec.appliedTo.serviceAccountSelector to be specified.")
 		}
 	}
 
+	if resp := validateExcludePodSelector(egp.Spec.AppliedTo.ExcludePodSelector, len(egp.Spec.AppliedTo.PodSubnet) != 0); !resp.Allowed {
+		return resp
+	}
+	if resp := validateServiceAccountSelector(egp.Spec.AppliedTo.ServiceAccountSelector, len(egp.Spec.AppliedTo.PodSubnet) != 0); !resp.Allowed {
+		return resp
+	}
+	if resp := validateNetworks(egp.Spec.AppliedTo.Networks, len(egp.Spec.AppliedTo.PodSubnet) != 0); !resp.Allowed {
+		return resp
+	}
+	if resp := validateSchedule(egp.Spec.Schedule); !resp.Allowed {
+		return resp
+	}
+
 	if req.Operation == v1.Update {
 		oldEgp := new(egressv1.EgressPolicy)
 		err := json.Unmarshal(req.OldObject.Raw, oldEgp)
@@ -143,7 +164,13 @@ func validateEgressPolicy(ctx context.Context, client client.Client, req webhook
 		}
 	}
 
-	return validateSubnet(egp.Spec.DestSubnet)
+	if resp := validateSubnet("destSubnet", egp.Spec.DestSubnet); !resp.Allowed {
+		return resp
+	}
+	if resp := validateGroupNames("destCIDRGroups", egp.Spec.DestCIDRGroups); !resp.Allowed {
+		return resp
+	}
+	return validateSubnet("excludeDestSubnet", egp.Spec.ExcludeDestSubnet)
 }
 
 func validateEgressClusterPolicy(ctx context.Context, client client.Client, req webhook.AdmissionRequest, cfg *config.Config) webhook.AdmissionResponse {
@@ -178,13 +205,31 @@ func validateEgressClusterPolicy(ctx context.Context, client client.Client, req
 		return webhook.Denied("podSelector and podSubnet cannot be used together")
 	}
 
-	// denied when both PodSelector and PodSubnet are empty
-	if policy.Spec.AppliedTo.PodSubnet == nil || len(*policy.Spec.AppliedTo.PodSubnet) == 0 {
+	// denied when PodSelector, PodSubnet, ServiceAccountSelector and NodeSelector are all empty
+	if (policy.Spec.AppliedTo.PodSubnet == nil || len(*policy.Spec.AppliedTo.PodSubnet) == 0) && policy.Spec.AppliedTo.ServiceAccountSelector == nil &&
+		policy.Spec.AppliedTo.NodeSelector == nil {
 		if policy.Spec.AppliedTo.PodSelector == nil || (len(policy.Spec.AppliedTo.PodSelector.MatchLabels) == 0 && len(policy.Spec.AppliedTo.PodSelector.MatchExpressions) == 0) {
-			return webhook.Denied("invalid EgressClusterPolicy, spec.appliedTo field requires at least one of spec.appliedTo.podSubnet, .spec.appliedTo.podSelector.matchLabels or .spec.appliedTo.podSelector.matchExpressions to be specified.")
+			return webhook.Denied("invalid EgressClusterPolicy, spec.appliedTo field requires at least one of spec.appliedTo.podSubnet, .spec.appliedTo.podSelector.matchLabels, .spec.appliedTo.podSelector.matchExpressions, .spec.appliedTo.serviceAccountSelector or .spec.appliedTo.nodeSelector to be specified.")
 		}
 	}
 
+	podSubnet := policy.Spec.AppliedTo.PodSubnet
+	if resp := validateExcludePodSelector(policy.Spec.AppliedTo.ExcludePodSelector, podSubnet != nil && len(*podSubnet) != 0); !resp.Allowed {
+		return resp
+	}
+	if resp := validateServiceAccountSelector(policy.Spec.AppliedTo.ServiceAccountSelector, podSubnet != nil && len(*podSubnet) != 0); !resp.Allowed {
+		return resp
+	}
+	if resp := validateNetworks(policy.Spec.AppliedTo.Networks, podSubnet != nil && len(*podSubnet) != 0); !resp.Allowed {
+		return resp
+	}
+	if resp := validateSchedule(policy.Spec.Schedule); !resp.Allowed {
+		return resp
+	}
+	if resp := validateHostTraffic(policy.Spec.AppliedTo.NodeSelector, policy.Spec.AppliedTo.HostTraffic); !resp.Allowed {
+		return resp
+	}
+
 	if req.Operation == v1.Update {
 		oldPolicy := new(egressv1.EgressClusterPolicy)
 		err := json.Unmarshal(req.OldObject.Raw, oldPolicy)
@@ -237,7 +282,13 @@ func validateEgressClusterPolicy(ctx context.Context, client client.Client, req
 		}
 	}
 
-	return validateSubnet(policy.Spec.DestSubnet)
+	if resp := validateSubnet("destSubnet", policy.Spec.DestSubnet); !resp.Allowed {
+		return resp
+	}
+	if resp := validateGroupNames("destCIDRGroups", policy.Spec.DestCIDRGroups); !resp.Allowed {
+		return resp
+	}
+	return validateSubnet("excludeDestSubnet", policy.Spec.ExcludeDestSubnet)
 }
 
 // checkEGWIppools when creating the policy with the value of the field .Spec.EgressIP.UseNodeIP set to be false, the ippools of the gateway should not be empty
@@ -335,7 +386,7 @@ func checkEIPIncluded(client client.Client, ctx context.Context, ipv4, ipv6, egw
 	return true, nil
 }
 
-func validateSubnet(subnet []string) webhook.AdmissionResponse {
+func validateSubnet(field string, subnet []string) webhook.AdmissionResponse {
 	invalidList := make([]string, 0)
 	for _, subnet := range subnet {
 		ip, _, err := net.ParseCIDR(subnet)
@@ -348,7 +399,144 @@ func validateSubnet(subnet []string) webhook.AdmissionResponse {
 		}
 	}
 	if len(invalidList) > 0 {
-		return webhook.Denied(fmt.Sprintf("invalid destSubnet list: %v", invalidList))
+		return webhook.Denied(fmt.Sprintf("invalid %s list: %v", field, invalidList))
+	}
+	return webhook.Allowed("checked")
+}
+
+// validateEgressCIDRGroup denies the invalid CIDRs and the includes which make a cycle
+func validateEgressCIDRGroup(ctx context.Context, client client.Client, req webhook.AdmissionRequest) webhook.AdmissionResponse {
+	if req.Operation == v1.Delete {
+		return webhook.Allowed("checked")
+	}
+	group := new(egressv1.EgressCIDRGroup)
+	err := json.Unmarshal(req.Object.Raw, group)
+	if err != nil {
+		return webhook.Denied(fmt.Sprintf("json unmarshal EgressCIDRGroup with error: %v", err))
+	}
+
+	if resp := validateSubnet("cidrs", group.Spec.CIDRs); !resp.Allowed {
+		return resp
+	}
+	if resp := validateGroupNames("includes", group.Spec.Includes); !resp.Allowed {
+		return resp
+	}
+	if len(group.Spec.Includes) == 0 {
+		return webhook.Allowed("checked")
+	}
+
+	groups, err := cidrgroup.Groups(ctx, client)
+	if err != nil {
+		return webhook.Denied(err.Error())
+	}
+	groups[group.Name] = *group
+	if cycle := cidrgroup.FindCycle(groups, group.Name); cycle != nil {
+		return webhook.Denied(fmt.Sprintf("includes of EgressCIDRGroup make a cycle: %s", strings.Join(cycle, " -> ")))
+	}
+	return webhook.Allowed("checked")
+}
+
+// validateExcludePodSelector denies the excludePodSelector which is invalid or excludes all the pods
+func validateExcludePodSelector(selector *metav1.LabelSelector, hasPodSubnet bool) webhook.AdmissionResponse {
+	if selector == nil {
+		return webhook.Allowed("checked")
+	}
+	if hasPodSubnet {
+		return webhook.Denied("excludePodSelector cannot be used with podSubnet")
+	}
+	if len(selector.MatchLabels) == 0 && len(selector.MatchExpressions) == 0 {
+		return webhook.Denied("excludePodSelector cannot be empty, it excludes all the pods")
+	}
+	if _, err := metav1.LabelSelectorAsSelector(selector); err != nil {
+		return webhook.Denied(fmt.Sprintf("invalid excludePodSelector: %v", err))
+	}
+	return webhook.Allowed("checked")
+}
+
+// validateServiceAccountSelector denies the serviceAccountSelector which selects no ServiceAccount
+func validateServiceAccountSelector(selector *egressv1.ServiceAccountSelector, hasPodSubnet bool) webhook.AdmissionResponse {
+	if selector == nil {
+		return webhook.Allowed("checked")
+	}
+	if hasPodSubnet {
+		return webhook.Denied("serviceAccountSelector cannot be used with podSubnet")
+	}
+	if len(selector.Names) == 0 && selector.Selector == nil {
+		return webhook.Denied("serviceAccountSelector requires at least one of names or selector to be specified")
+	}
+	for _, name := range selector.Names {
+		if name == "" {
+			return webhook.Denied("invalid serviceAccountSelector.names: the name cannot be empty")
+		}
+	}
+	if selector.Selector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(selector.Selector); err != nil {
+			return webhook.Denied(fmt.Sprintf("invalid serviceAccountSelector.selector: %v", err))
+		}
+	}
+	return webhook.Allowed("checked")
+}
+
+// validateNetworks denies the networks which are not `<namespace>/<name>` or `<name>`
+func validateNetworks(networks []string, hasPodSubnet bool) webhook.AdmissionResponse {
+	if len(networks) == 0 {
+		return webhook.Allowed("checked")
+	}
+	if hasPodSubnet {
+		return webhook.Denied("networks cannot be used with podSubnet")
+	}
+	for _, network := range networks {
+		parts := strings.Split(network, "/")
+		if len(parts) > 2 || parts[0] == "" || parts[len(parts)-1] == "" {
+			return webhook.Denied(fmt.Sprintf("invalid networks: %q is not <namespace>/<name> or <name>", network))
+		}
+	}
+	return webhook.Allowed("checked")
+}
+
+// validateSchedule denies the schedule whose cron expression, duration or time zone is invalid
+func validateSchedule(s *egressv1.Schedule) webhook.AdmissionResponse {
+	if s == nil {
+		return webhook.Allowed("checked")
+	}
+	if _, err := schedule.Parse(*s); err != nil {
+		return webhook.Denied(fmt.Sprintf("invalid schedule: %v", err))
+	}
+	return webhook.Allowed("checked")
+}
+
+// validateHostTraffic checks the nodeSelector and the filter of the host network traffic
+func validateHostTraffic(selector *metav1.LabelSelector, traffic *egressv1.HostTraffic) webhook.AdmissionResponse {
+	if selector == nil {
+		if traffic != nil {
+			return webhook.Denied("hostTraffic cannot be used without nodeSelector")
+		}
+		return webhook.Allowed("checked")
+	}
+	if _, err := metav1.LabelSelectorAsSelector(selector); err != nil {
+		return webhook.Denied(fmt.Sprintf("invalid nodeSelector: %v", err))
+	}
+	if traffic == nil {
+		return webhook.Allowed("checked")
+	}
+	for _, uid := range traffic.UIDs {
+		if uid < 0 || uid > math.MaxUint32 {
+			return webhook.Denied(fmt.Sprintf("invalid hostTraffic.uids: %d is not a valid uid", uid))
+		}
+	}
+	for _, path := range traffic.CgroupPaths {
+		if path == "" || strings.ContainsAny(path, " \t\n") {
+			return webhook.Denied(fmt.Sprintf("invalid hostTraffic.cgroupPaths: %q is not a valid cgroup path", path))
+		}
+	}
+	return webhook.Allowed("checked")
+}
+
+func validateGroupNames(field string, names []string) webhook.AdmissionResponse {
+	for _, name := range names {
+		if name == "" {
+			return webhook.Denied(fmt.Sprintf("invalid %s list: the group name cannot be empty", field))
+		}
 	}
 	return webhook.Allowed("checked")
 }
@@ -7,9 +7,11 @@ import (
 	"context"
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -44,6 +46,78 @@ func TestValidateEgressGateway(t *testing.T) {
 			},
 			expAllow: false,
 		},
+		"EgressGateway with node affinity": {
+			existingResources: []runtime.Object{
+				&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"egress": "true"}}},
+				&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}},
+			},
+			newResource: &v1beta1.EgressGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "eg-test",
+				},
+				Spec: v1beta1.EgressGatewaySpec{
+					Ippools: v1beta1.Ippools{
+						IPv4: []string{"10.6.1.1-10.6.1.10"},
+						NodeAffinity: []v1beta1.EipNodeAffinity{
+							{IPs: []string{"10.6.1.1-10.6.1.5"}, Nodes: []string{"node1", "node3"}},
+						},
+					},
+					NodeSelector: v1beta1.NodeSelector{
+						Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"egress": "true"}},
+					},
+				},
+			},
+			expAllow:      true,
+			expErrMessage: "",
+		},
+		"EgressGateway node affinity IP not in ippools": {
+			existingResources: []runtime.Object{
+				&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"egress": "true"}}},
+				&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}},
+			},
+			newResource: &v1beta1.EgressGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "eg-test",
+				},
+				Spec: v1beta1.EgressGatewaySpec{
+					Ippools: v1beta1.Ippools{
+						IPv4: []string{"10.6.1.1-10.6.1.10"},
+						NodeAffinity: []v1beta1.EipNodeAffinity{
+							{IPs: []string{"10.6.1.0/28"}, Nodes: []string{"node1"}},
+						},
+					},
+					NodeSelector: v1beta1.NodeSelector{
+						Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"egress": "true"}},
+					},
+				},
+			},
+			expAllow:      false,
+			expErrMessage: "spec.ippools.nodeAffinity[0].ips 10.6.1.0/28 is not covered by ippools",
+		},
+		"EgressGateway node affinity without eligible node": {
+			existingResources: []runtime.Object{
+				&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"egress": "true"}}},
+				&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}},
+			},
+			newResource: &v1beta1.EgressGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "eg-test",
+				},
+				Spec: v1beta1.EgressGatewaySpec{
+					Ippools: v1beta1.Ippools{
+						IPv4: []string{"10.6.1.1-10.6.1.10"},
+						NodeAffinity: []v1beta1.EipNodeAffinity{
+							{IPs: []string{"10.6.1.1"}, Nodes: []string{"node2"}},
+						},
+					},
+					NodeSelector: v1beta1.NodeSelector{
+						Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"egress": "true"}},
+					},
+				},
+			},
+			expAllow:      false,
+			expErrMessage: "none of the nodes [node2] of spec.ippools.nodeAffinity[0] is selected by spec.nodeSelector",
+		},
 	}
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
@@ -52,6 +126,7 @@ func TestValidateEgressGateway(t *testing.T) {
 
 			builder := fake.NewClientBuilder()
 			builder.WithScheme(schema.GetScheme())
+			builder.WithRuntimeObjects(c.existingResources...)
 			cli := builder.Build()
 			conf := &config.Config{
 				FileConfig: config.FileConfig{
@@ -184,6 +259,124 @@ func TestValidateEgressPolicy(t *testing.T) {
 			},
 			expAllow: false,
 		},
+		"invalid excludeDestSubnet": {
+			existingResources: nil,
+			spec: v1beta1.EgressPolicySpec{
+				EgressGatewayName: "test",
+				AppliedTo: v1beta1.AppliedTo{
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"app": "test"},
+					},
+				},
+				ExcludeDestSubnet: []string{
+					"10.0.0.0",
+				},
+			},
+			expAllow: false,
+		},
+		"empty excludePodSelector": {
+			existingResources: nil,
+			spec: v1beta1.EgressPolicySpec{
+				EgressGatewayName: "test",
+				AppliedTo: v1beta1.AppliedTo{
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"app": "test"},
+					},
+					ExcludePodSelector: &metav1.LabelSelector{},
+				},
+			},
+			expAllow:      false,
+			expErrMessage: "excludePodSelector cannot be empty, it excludes all the pods",
+		},
+		"excludePodSelector with podSubnet": {
+			existingResources: nil,
+			spec: v1beta1.EgressPolicySpec{
+				EgressGatewayName: "test",
+				AppliedTo: v1beta1.AppliedTo{
+					PodSubnet: []string{"10.21.0.0/16"},
+					ExcludePodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"egress": "direct"},
+					},
+				},
+			},
+			expAllow:      false,
+			expErrMessage: "excludePodSelector cannot be used with podSubnet",
+		},
+		"serviceAccountSelector without podSelector": {
+			existingResources: []client.Object{
+				&v1beta1.EgressGateway{
+					ObjectMeta: metav1.ObjectMeta{Name: "test"},
+					Spec: v1beta1.EgressGatewaySpec{
+						Ippools: v1beta1.Ippools{IPv4: []string{"10.6.1.21-10.6.1.22"}},
+					},
+				},
+			},
+			spec: v1beta1.EgressPolicySpec{
+				EgressGatewayName: "test",
+				AppliedTo: v1beta1.AppliedTo{
+					ServiceAccountSelector: &v1beta1.ServiceAccountSelector{Names: []string{"backup"}},
+				},
+			},
+			expAllow: true,
+		},
+		"empty serviceAccountSelector": {
+			existingResources: nil,
+			spec: v1beta1.EgressPolicySpec{
+				EgressGatewayName: "test",
+				AppliedTo: v1beta1.AppliedTo{
+					ServiceAccountSelector: &v1beta1.ServiceAccountSelector{},
+				},
+			},
+			expAllow:      false,
+			expErrMessage: "serviceAccountSelector requires at least one of names or selector to be specified",
+		},
+		"invalid networks": {
+			existingResources: nil,
+			spec: v1beta1.EgressPolicySpec{
+				EgressGatewayName: "test",
+				AppliedTo: v1beta1.AppliedTo{
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"app": "test"},
+					},
+					Networks: []string{"kube-system/macvlan", "/macvlan"},
+				},
+			},
+			expAllow:      false,
+			expErrMessage: "invalid networks: \"/macvlan\" is not <namespace>/<name> or <name>",
+		},
+		"invalid schedule": {
+			existingResources: nil,
+			spec: v1beta1.EgressPolicySpec{
+				EgressGatewayName: "test",
+				AppliedTo: v1beta1.AppliedTo{
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"app": "test"},
+					},
+				},
+				Schedule: &v1beta1.Schedule{
+					Cron:     "0 1 * * *",
+					Duration: metav1.Duration{Duration: time.Hour},
+					TimeZone: "Mars/Base",
+				},
+			},
+			expAllow: false,
+		},
+		"schedule duration is too long": {
+			existingResources: nil,
+			spec: v1beta1.EgressPolicySpec{
+				EgressGatewayName: "test",
+				AppliedTo: v1beta1.AppliedTo{
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"app": "test"},
+					},
+				},
+				Schedule: &v1beta1.Schedule{
+					Cron:     "0 1 1 1 *",
+					Duration: metav1.Duration{Duration: 6 * 365 * 24 * time.Hour},
+				},
+			},
+			expAllow: false,
+		},
 		"case4 empty EgressGatewayName": {
 			existingResources: nil,
 			spec: v1beta1.EgressPolicySpec{
@@ -752,6 +945,55 @@ func TestValidateEgressClusterPolicy(t *testing.T) {
 			},
 			expAllow: false,
 		},
+		"host traffic of the nodes": {
+			existingResources: []client.Object{
+				&v1beta1.EgressGateway{
+					ObjectMeta: metav1.ObjectMeta{Name: "test"},
+					Spec: v1beta1.EgressGatewaySpec{
+						Ippools: v1beta1.Ippools{IPv4: []string{"172.18.1.2-172.18.1.5"}},
+					},
+				},
+			},
+			spec: v1beta1.EgressClusterPolicySpec{
+				EgressGatewayName: "test",
+				AppliedTo: v1beta1.ClusterAppliedTo{
+					NodeSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"egress": "host"},
+					},
+					HostTraffic: &v1beta1.HostTraffic{
+						UIDs:        []int64{0, 1000},
+						CgroupPaths: []string{"system.slice/backup.service"},
+					},
+				},
+			},
+			expAllow: true,
+		},
+		"hostTraffic without nodeSelector": {
+			existingResources: nil,
+			spec: v1beta1.EgressClusterPolicySpec{
+				EgressGatewayName: "test",
+				AppliedTo: v1beta1.ClusterAppliedTo{
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"app": "test"},
+					},
+					HostTraffic: &v1beta1.HostTraffic{UIDs: []int64{1000}},
+				},
+			},
+			expAllow:      false,
+			expErrMessage: "hostTraffic cannot be used without nodeSelector",
+		},
+		"invalid uid of hostTraffic": {
+			existingResources: nil,
+			spec: v1beta1.EgressClusterPolicySpec{
+				EgressGatewayName: "test",
+				AppliedTo: v1beta1.ClusterAppliedTo{
+					NodeSelector: &metav1.LabelSelector{},
+					HostTraffic:  &v1beta1.HostTraffic{UIDs: []int64{-1}},
+				},
+			},
+			expAllow:      false,
+			expErrMessage: "invalid hostTraffic.uids: -1 is not a valid uid",
+		},
 	}
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
@@ -982,3 +1224,65 @@ func TestUpdateEgressClusterPolicy(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateEgressCIDRGroup(t *testing.T) {
+	ctx := context.Background()
+
+	cases := map[string]struct {
+		existingResources []client.Object
+		spec              v1beta1.EgressCIDRGroupSpec
+		expAllow          bool
+		expErrMessage     string
+	}{
+		"valid group": {
+			spec:     v1beta1.EgressCIDRGroupSpec{CIDRs: []string{"10.6.0.0/16", "fd00::/64"}, Includes: []string{"other"}},
+			expAllow: true,
+		},
+		"invalid cidrs": {
+			spec:     v1beta1.EgressCIDRGroupSpec{CIDRs: []string{"10.6.0.0"}},
+			expAllow: false,
+		},
+		"include itself": {
+			spec:          v1beta1.EgressCIDRGroupSpec{Includes: []string{"group"}},
+			expAllow:      false,
+			expErrMessage: "includes of EgressCIDRGroup make a cycle: group -> group",
+		},
+		"include cycle": {
+			existingResources: []client.Object{
+				&v1beta1.EgressCIDRGroup{
+					ObjectMeta: metav1.ObjectMeta{Name: "other"},
+					Spec:       v1beta1.EgressCIDRGroupSpec{Includes: []string{"group"}},
+				},
+			},
+			spec:          v1beta1.EgressCIDRGroupSpec{Includes: []string{"other"}},
+			expAllow:      false,
+			expErrMessage: "includes of EgressCIDRGroup make a cycle: group -> other -> group",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			group := &v1beta1.EgressCIDRGroup{
+				ObjectMeta: metav1.ObjectMeta{Name: "group"},
+				Spec:       c.spec,
+			}
+			raw, err := json.Marshal(group)
+			assert.NoError(t, err)
+
+			cli := fake.NewClientBuilder().WithScheme(schema.GetScheme()).WithObjects(c.existingResources...).Build()
+			validator := ValidateHook(cli, &config.Config{})
+			resp := validator.Handle(ctx, admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Name:      group.Name,
+					Kind:      metav1.GroupVersionKind{Kind: "EgressCIDRGroup"},
+					Operation: admissionv1.Create,
+					Object:    runtime.RawExtension{Raw: raw},
+				},
+			})
+
+			assert.Equal(t, c.expAllow, resp.Allowed)
+			if c.expErrMessage != "" {
+				assert.Equal(t, c.expErrMessage, resp.AdmissionResponse.Result.Message)
+			}
+		})
+	}
+}
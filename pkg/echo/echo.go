@@ -0,0 +1,204 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+// Package echo implements a lightweight UDP echo protocol, the agents probe the gateway
+// nodes over the underlay to detect the failure of a peer in sub-second, without the
+// round-trips to the API server.
+package echo
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+var magic = []byte("EGWE")
+
+const (
+	typeRequest byte = 1
+	typeReply   byte = 2
+
+	packetLen = 13
+)
+
+type peer struct {
+	addr      *net.UDPAddr
+	seq       uint64
+	lastReply time.Time
+	alive     bool
+}
+
+// Prober sends echo requests to the peers and answers the echo requests of the peers
+// on the same UDP socket. A peer is dead when it does not reply within the timeout,
+// the peers which have never replied are unknown.
+type Prober struct {
+	listen   string
+	interval time.Duration
+	timeout  time.Duration
+	onChange func(name string, alive bool)
+	log      logr.Logger
+
+	mu    sync.Mutex
+	peers map[string]*peer
+}
+
+// New returns a prober listening on the given address, onChange is called when a peer
+// becomes alive or dead.
+func New(listen string, interval, timeout time.Duration, onChange func(name string, alive bool), log logr.Logger) *Prober {
+	return &Prober{
+		listen:   listen,
+		interval: interval,
+		timeout:  timeout,
+		onChange: onChange,
+		log:      log,
+		peers:    make(map[string]*peer),
+	}
+}
+
+// SetPeers replaces the peers to probe, the state of the existing peers is kept if
+// their address does not change.
+func (p *Prober) SetPeers(peers map[string]*net.UDPAddr) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, item := range p.peers {
+		if addr, ok := peers[name]; !ok || addr.String() != item.addr.String() {
+			delete(p.peers, name)
+		}
+	}
+	for name, addr := range peers {
+		if _, ok := p.peers[name]; !ok {
+			p.peers[name] = &peer{addr: addr}
+		}
+	}
+}
+
+// Alive reports whether the peer is alive, known is false if the peer is not probed or
+// has never replied.
+func (p *Prober) Alive(name string) (alive bool, known bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	item, ok := p.peers[name]
+	if !ok || item.lastReply.IsZero() {
+		return false, false
+	}
+	return item.alive, true
+}
+
+func (p *Prober) Start(ctx context.Context) error {
+	addr, err := net.ResolveUDPAddr("udp", p.listen)
+	if err != nil {
+		return fmt.Errorf("failed to resolve echo address %s: %w", p.listen, err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen echo address %s: %w", p.listen, err)
+	}
+	p.log.Info("start peer echo", "address", conn.LocalAddr().String(), "interval", p.interval, "timeout", p.timeout)
+
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+	go p.receive(conn)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			p.probe(conn, time.Now())
+		}
+	}
+}
+
+func (p *Prober) probe(conn *net.UDPConn, now time.Time) {
+	var changed []string
+	p.mu.Lock()
+	for name, item := range p.peers {
+		item.seq++
+		if _, err := conn.WriteToUDP(encode(typeRequest, item.seq), item.addr); err != nil {
+			p.log.V(1).Info("failed to send echo request", "peer", name, "error", err.Error())
+		}
+		if item.alive && now.Sub(item.lastReply) > p.timeout {
+			item.alive = false
+			changed = append(changed, name)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, name := range changed {
+		p.log.Info("peer echo timeout", "peer", name)
+		p.onChange(name, false)
+	}
+}
+
+func (p *Prober) receive(conn *net.UDPConn) {
+	buf := make([]byte, 64)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			p.log.V(1).Info("failed to read echo packet", "error", err.Error())
+			continue
+		}
+		kind, seq, ok := decode(buf[:n])
+		if !ok {
+			continue
+		}
+		switch kind {
+		case typeRequest:
+			if _, err := conn.WriteToUDP(encode(typeReply, seq), from); err != nil {
+				p.log.V(1).Info("failed to send echo reply", "peer", from.String(), "error", err.Error())
+			}
+		case typeReply:
+			p.handleReply(from, time.Now())
+		}
+	}
+}
+
+func (p *Prober) handleReply(from *net.UDPAddr, now time.Time) {
+	var changed []string
+	p.mu.Lock()
+	for name, item := range p.peers {
+		if !item.addr.IP.Equal(from.IP) || item.addr.Port != from.Port {
+			continue
+		}
+		item.lastReply = now
+		if !item.alive {
+			item.alive = true
+			changed = append(changed, name)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, name := range changed {
+		p.log.Info("peer echo replied", "peer", name)
+		p.onChange(name, true)
+	}
+}
+
+func encode(kind byte, seq uint64) []byte {
+	buf := make([]byte, packetLen)
+	copy(buf, magic)
+	buf[4] = kind
+	binary.BigEndian.PutUint64(buf[5:], seq)
+	return buf
+}
+
+func decode(buf []byte) (byte, uint64, bool) {
+	if len(buf) != packetLen || !bytes.Equal(buf[:4], magic) {
+		return 0, 0, false
+	}
+	return buf[4], binary.BigEndian.Uint64(buf[5:]), true
+}
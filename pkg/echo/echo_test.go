@@ -0,0 +1,67 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package echo
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProber(t *testing.T) {
+	changes := make(chan bool, 10)
+	onChange := func(name string, alive bool) {
+		if name == "b" {
+			changes <- alive
+		}
+	}
+
+	a := New("127.0.0.1:47901", time.Millisecond*50, time.Millisecond*150, onChange, logr.Discard())
+	b := New("127.0.0.1:47902", time.Millisecond*50, time.Millisecond*150, func(string, bool) {}, logr.Discard())
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	defer cancelA()
+	ctxB, cancelB := context.WithCancel(context.Background())
+	go func() { _ = a.Start(ctxA) }()
+	go func() { _ = b.Start(ctxB) }()
+
+	_, known := a.Alive("b")
+	assert.False(t, known)
+
+	a.SetPeers(map[string]*net.UDPAddr{"b": {IP: net.ParseIP("127.0.0.1"), Port: 47902}})
+	select {
+	case alive := <-changes:
+		assert.True(t, alive)
+	case <-time.After(time.Second * 2):
+		t.Fatal("peer b should be alive")
+	}
+	alive, known := a.Alive("b")
+	assert.True(t, known)
+	assert.True(t, alive)
+
+	cancelB()
+	select {
+	case alive := <-changes:
+		assert.False(t, alive)
+	case <-time.After(time.Second * 2):
+		t.Fatal("peer b should be dead")
+	}
+	alive, known = a.Alive("b")
+	assert.True(t, known)
+	assert.False(t, alive)
+}
+
+func TestDecode(t *testing.T) {
+	kind, seq, ok := decode(encode(typeReply, 42))
+	assert.True(t, ok)
+	assert.Equal(t, typeReply, kind)
+	assert.Equal(t, uint64(42), seq)
+
+	_, _, ok = decode([]byte("not an echo packet"))
+	assert.False(t, ok)
+}
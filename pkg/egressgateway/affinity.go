@@ -0,0 +1,117 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package egressgateway
+
+import (
+	"math/rand"
+	"net"
+	"slices"
+
+	egress "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/utils/ip"
+)
+
+// eipNodeAllowed reports whether the EIP can be placed on the node according to
+// spec.ippools.nodeAffinity. The node IP entries and the EIPs which are not covered
+// by any affinity can be placed on any node.
+func eipNodeAllowed(ippools egress.Ippools, ipv4, ipv6, node string) bool {
+	if len(ippools.NodeAffinity) == 0 {
+		return true
+	}
+	for _, eip := range []string{ipv4, ipv6} {
+		if eip == "" {
+			continue
+		}
+		matched := false
+		allowed := false
+		for _, item := range ippools.NodeAffinity {
+			ok, err := ip.CheckIPIncluded(eip, item.IPs)
+			if err != nil || !ok {
+				continue
+			}
+			matched = true
+			if slices.Contains(item.Nodes, node) {
+				allowed = true
+				break
+			}
+		}
+		if matched && !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// selectNode returns the index of the ready node with the least EIPs which is
+// allowed for the EIP, it returns -1 if there is no such node.
+func selectNode(gateway *egress.EgressGateway, ipv4, ipv6 string) int {
+	nIndex := -1
+	eipNum := -1
+	for nodeIndex, node := range gateway.Status.NodeList {
+		if node.Status != string(egress.EgressTunnelReady) {
+			continue
+		}
+		if !eipNodeAllowed(gateway.Spec.Ippools, ipv4, ipv6, node.Name) {
+			continue
+		}
+		if eipNum == -1 || eipNum > len(node.Eips) {
+			eipNum = len(node.Eips)
+			nIndex = nodeIndex
+		}
+	}
+	return nIndex
+}
+
+// pickFreeIP picks a random free IP, if spec.ippools.nodeAffinity is set, the IP
+// must be eligible, i.e. it has a ready node to be placed on.
+func pickFreeIP(gateway *egress.EgressGateway, randObj *rand.Rand, free []net.IP, eligible func(ip string) bool) (string, bool) {
+	if len(gateway.Spec.Ippools.NodeAffinity) == 0 {
+		return free[randObj.Intn(len(free))].String(), true
+	}
+	for _, i := range randObj.Perm(len(free)) {
+		if eligible(free[i].String()) {
+			return free[i].String(), true
+		}
+	}
+	return "", false
+}
+
+// moveEip moves the EIP entry to the target node and returns the new index of the entry
+func moveEip(gateway *egress.EgressGateway, nodeIndex, eipIndex, target int) int {
+	from := &gateway.Status.NodeList[nodeIndex]
+	eip := from.Eips[eipIndex]
+	from.Eips = append(from.Eips[:eipIndex], from.Eips[eipIndex+1:]...)
+	eip.HomeNode = ""
+	to := &gateway.Status.NodeList[target]
+	to.Eips = append(to.Eips, eip)
+	return len(to.Eips) - 1
+}
+
+// enforceNodeAffinity moves the EIPs placed on nodes which are not allowed by
+// spec.ippools.nodeAffinity, e.g. the affinity is added after the EIPs are assigned.
+// The EIPs stay where they are if there is no allowed ready node for them.
+func enforceNodeAffinity(gateway *egress.EgressGateway) []eipMove {
+	if len(gateway.Spec.Ippools.NodeAffinity) == 0 {
+		return nil
+	}
+	var moves []eipMove
+	for nodeIndex := range gateway.Status.NodeList {
+		for eipIndex := 0; eipIndex < len(gateway.Status.NodeList[nodeIndex].Eips); {
+			node := gateway.Status.NodeList[nodeIndex]
+			eip := node.Eips[eipIndex]
+			if isNodeIPEip(eip) || eipNodeAllowed(gateway.Spec.Ippools, eip.IPv4, eip.IPv6, node.Name) {
+				eipIndex++
+				continue
+			}
+			target := selectNode(gateway, eip.IPv4, eip.IPv6)
+			if target == -1 {
+				eipIndex++
+				continue
+			}
+			moveEip(gateway, nodeIndex, eipIndex, target)
+			moves = append(moves, eipMove{eip: eip, from: node.Name, to: gateway.Status.NodeList[target].Name})
+		}
+	}
+	return moves
+}
@@ -0,0 +1,107 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package egressgateway
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	egress "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+func TestMoveEipToReadyNodeWithAffinity(t *testing.T) {
+	gateway := &egress.EgressGateway{
+		Spec: egress.EgressGatewaySpec{
+			Ippools: egress.Ippools{
+				IPv4: []string{"10.6.1.1-10.6.1.10"},
+				NodeAffinity: []egress.EipNodeAffinity{
+					{IPs: []string{"10.6.1.1-10.6.1.2"}, Nodes: []string{"node1", "node2"}},
+					{IPs: []string{"10.6.1.3"}, Nodes: []string{"node1"}},
+				},
+			},
+		},
+		Status: egress.EgressGatewayStatus{NodeList: []egress.EgressIPStatus{
+			{Name: "node1", Status: "HeartbeatTimeout"},
+			{Name: "node2", Status: "Ready", Eips: []egress.Eips{{IPv4: "10.6.1.5"}}},
+			{Name: "node3", Status: "Ready"},
+		}},
+	}
+
+	assert.True(t, eipNodeAllowed(gateway.Spec.Ippools, "10.6.1.1", "", "node2"))
+	assert.False(t, eipNodeAllowed(gateway.Spec.Ippools, "10.6.1.1", "", "node3"))
+	assert.True(t, eipNodeAllowed(gateway.Spec.Ippools, "10.6.1.9", "", "node3"))
+
+	needMoveIPs := []egress.Eips{{IPv4: "10.6.1.1"}, {IPv4: "10.6.1.3"}, {IPv4: "10.6.1.9"}}
+	moves := moveEipToReadyNode(gateway, &needMoveIPs)
+
+	assert.Equal(t, []eipMove{
+		{eip: egress.Eips{IPv4: "10.6.1.1"}, to: "node2"},
+		{eip: egress.Eips{IPv4: "10.6.1.9"}, to: "node3"},
+	}, moves)
+	// 10.6.1.3 can only be placed on node1
+	assert.Equal(t, []egress.Eips{{IPv4: "10.6.1.3"}}, needMoveIPs)
+}
+
+func TestEnforceNodeAffinity(t *testing.T) {
+	gateway := &egress.EgressGateway{
+		Spec: egress.EgressGatewaySpec{
+			Ippools: egress.Ippools{
+				IPv4: []string{"10.6.1.1-10.6.1.10"},
+				NodeAffinity: []egress.EipNodeAffinity{
+					{IPs: []string{"10.6.1.1"}, Nodes: []string{"node2"}},
+					{IPs: []string{"10.6.1.2"}, Nodes: []string{"node3"}},
+				},
+			},
+		},
+		Status: egress.EgressGatewayStatus{NodeList: []egress.EgressIPStatus{
+			{Name: "node1", Status: "Ready", Eips: []egress.Eips{
+				{IPv4: "10.6.1.1", Policies: []egress.Policy{{Name: "p1"}}},
+				{IPv4: "10.6.1.2"},
+				{IPv4: "10.6.1.5"},
+			}},
+			{Name: "node2", Status: "Ready"},
+			{Name: "node3", Status: "HeartbeatTimeout"},
+		}},
+	}
+
+	moves := enforceNodeAffinity(gateway)
+	assert.Equal(t, []eipMove{
+		{eip: egress.Eips{IPv4: "10.6.1.1", Policies: []egress.Policy{{Name: "p1"}}}, from: "node1", to: "node2"},
+	}, moves)
+	// 10.6.1.2 stays as node3 is not ready
+	assert.Equal(t, []egress.Eips{{IPv4: "10.6.1.2"}, {IPv4: "10.6.1.5"}}, gateway.Status.NodeList[0].Eips)
+	assert.Equal(t, []egress.Eips{{IPv4: "10.6.1.1", Policies: []egress.Policy{{Name: "p1"}}}}, gateway.Status.NodeList[1].Eips)
+}
+
+func TestAssignIPReuseWithAffinity(t *testing.T) {
+	gateway := &egress.EgressGateway{
+		Spec: egress.EgressGatewaySpec{
+			Ippools: egress.Ippools{
+				IPv4:         []string{"10.6.1.1-10.6.1.10"},
+				NodeAffinity: []egress.EipNodeAffinity{{IPs: []string{"10.6.1.1"}, Nodes: []string{"node2"}}},
+			},
+		},
+		Status: egress.EgressGatewayStatus{NodeList: []egress.EgressIPStatus{
+			{Name: "node1", Status: "Ready", Eips: []egress.Eips{{IPv4: "10.6.1.1", Policies: []egress.Policy{{Name: "p1"}}}}},
+			{Name: "node2", Status: "Ready"},
+		}},
+	}
+
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "p2"}}
+	assignedIP, err := assignIP(gateway, req, egress.EgressIP{IPv4: "10.6.1.1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "node2", assignedIP.Node)
+	assert.Empty(t, gateway.Status.NodeList[0].Eips)
+	assert.Equal(t, []egress.Eips{{IPv4: "10.6.1.1", Policies: []egress.Policy{{Name: "p1"}, {Name: "p2"}}}},
+		gateway.Status.NodeList[1].Eips)
+
+	// no ready node is allowed for the EIP
+	gateway.Status.NodeList[0].Eips, gateway.Status.NodeList[1].Eips = gateway.Status.NodeList[1].Eips, nil
+	gateway.Status.NodeList[1].Status = "HeartbeatTimeout"
+	_, err = assignIP(gateway, reconcile.Request{NamespacedName: types.NamespacedName{Name: "p3"}}, egress.EgressIP{IPv4: "10.6.1.1"})
+	assert.ErrorIs(t, err, ErrNoReadyNode)
+}
@@ -0,0 +1,159 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package egressgateway
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	egress "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/utils"
+)
+
+var (
+	// ErrNoReadyNode there is no ready node in the EgressGateway to place the EIP
+	ErrNoReadyNode = errors.New("no ready gateway node")
+	// ErrIPPoolExhausted all the IPs of the EgressGateway ippools have been allocated
+	ErrIPPoolExhausted = errors.New("ip pool exhausted")
+)
+
+// allocateFailedReason converts the error returned by assignIP to a condition reason
+func allocateFailedReason(err error) string {
+	switch {
+	case err == nil, errors.Is(err, ErrNoReadyNode):
+		return egress.ReasonNoReadyGatewayNode
+	case errors.Is(err, ErrIPPoolExhausted):
+		return egress.ReasonIPPoolExhausted
+	default:
+		return egress.ReasonAllocateFailed
+	}
+}
+
+// setPolicyConditions refreshes the conditions and observedGeneration of a policy
+// status from the allocation result, it returns true if the status has been changed.
+// gateway is nil when the referenced EgressGateway does not exist.
+func setPolicyConditions(status *egress.EgressPolicyStatus, generation int64,
+	gateway *egress.EgressGateway, assignedIP *AssignedIP, allocErr error) bool {
+
+	var accepted, allocated, programmed, degraded metav1.Condition
+
+	switch {
+	case gateway == nil:
+		msg := "the referenced EgressGateway is not found"
+		accepted = utils.NewCondition(egress.ConditionAccepted, false, egress.ReasonGatewayNotFound, msg)
+		allocated = utils.NewCondition(egress.ConditionIPAllocated, false, egress.ReasonGatewayNotFound, msg)
+		programmed = utils.NewCondition(egress.ConditionProgrammed, false, egress.ReasonGatewayNotFound, msg)
+		degraded = utils.NewCondition(egress.ConditionDegraded, true, egress.ReasonGatewayNotFound, msg)
+	case allocErr != nil || assignedIP == nil || assignedIP.Node == "":
+		reason := allocateFailedReason(allocErr)
+		msg := fmt.Sprintf("EgressGateway %s has no ready node to place the egress IP", gateway.Name)
+		if allocErr != nil {
+			msg = allocErr.Error()
+		}
+		accepted = utils.NewCondition(egress.ConditionAccepted, true, egress.ReasonAccepted, "")
+		allocated = utils.NewCondition(egress.ConditionIPAllocated, false, reason, msg)
+		programmed = utils.NewCondition(egress.ConditionProgrammed, false, reason, msg)
+		degraded = utils.NewCondition(egress.ConditionDegraded, true, reason, msg)
+	default:
+		msg := fmt.Sprintf("use the IP of node %s", assignedIP.Node)
+		if assignedIP.IPv4 != "" || assignedIP.IPv6 != "" {
+			msg = fmt.Sprintf("EIP ipv4=%q ipv6=%q is assigned to node %s", assignedIP.IPv4, assignedIP.IPv6, assignedIP.Node)
+		}
+		accepted = utils.NewCondition(egress.ConditionAccepted, true, egress.ReasonAccepted, "")
+		allocated = utils.NewCondition(egress.ConditionIPAllocated, true, egress.ReasonAllocated, msg)
+
+		nodeStatus := ""
+		for _, node := range gateway.Status.NodeList {
+			if node.Name == assignedIP.Node {
+				nodeStatus = node.Status
+				break
+			}
+		}
+		if egress.EgressTunnelReady.IsEqual(nodeStatus) {
+			programmed = utils.NewCondition(egress.ConditionProgrammed, true, egress.ReasonProgrammed, "")
+			degraded = utils.NewCondition(egress.ConditionDegraded, false, egress.ReasonAsExpected, "")
+		} else {
+			msg := fmt.Sprintf("the assigned node %s is not ready, status: %s", assignedIP.Node, nodeStatus)
+			programmed = utils.NewCondition(egress.ConditionProgrammed, false, egress.ReasonNodeNotReady, msg)
+			degraded = utils.NewCondition(egress.ConditionDegraded, true, egress.ReasonNodeNotReady, msg)
+		}
+	}
+
+	return utils.SetConditions(&status.Conditions, &status.ObservedGeneration, generation,
+		accepted, allocated, programmed, degraded)
+}
+
+// setBlockedCondition refreshes the Blocked condition of a policy status, it should be called
+// after setPolicyConditions. The traffic of the policy is blocked when its failurePolicy is
+// closed, it is in a window of its schedule and no gateway node is assigned to it. It returns
+// whether the policy is blocked and whether the status has been changed.
+func setBlockedCondition(status *egress.EgressPolicyStatus, generation int64,
+	failurePolicy string, node string, active bool) (bool, bool) {
+
+	if failurePolicy != egress.FailurePolicyClosed {
+		changed := meta.FindStatusCondition(status.Conditions, egress.ConditionBlocked) != nil
+		meta.RemoveStatusCondition(&status.Conditions, egress.ConditionBlocked)
+		return false, changed
+	}
+
+	blocked := false
+	condition := utils.NewCondition(egress.ConditionBlocked, false, egress.ReasonAsExpected, "")
+	switch {
+	case !active:
+		condition = utils.NewCondition(egress.ConditionBlocked, false, egress.ReasonOutOfWindow,
+			"the policy is out of the windows of its schedule, the traffic uses the node IP")
+	case node == "":
+		blocked = true
+		reason, msg := egress.ReasonNoReadyGatewayNode, "no gateway node is assigned to the policy"
+		if programmed := meta.FindStatusCondition(status.Conditions, egress.ConditionProgrammed); programmed != nil {
+			reason, msg = programmed.Reason, programmed.Message
+		}
+		condition = utils.NewCondition(egress.ConditionBlocked, true, reason, msg)
+	}
+	condition.ObservedGeneration = generation
+	return blocked, meta.SetStatusCondition(&status.Conditions, condition)
+}
+
+// setGatewayConditions refreshes the conditions and observedGeneration of the
+// EgressGateway status, it should be called after the ip usage is updated.
+func setGatewayConditions(gateway *egress.EgressGateway) bool {
+	usage := gateway.Status.IPUsage
+	exhausted := (usage.IPv4Total > 0 && usage.IPv4Free <= 0) || (usage.IPv6Total > 0 && usage.IPv6Free <= 0)
+	readyCount := gateway.Status.ReadyCount()
+	notReadyCount := len(gateway.Status.NodeList) - readyCount
+
+	accepted := utils.NewCondition(egress.ConditionAccepted, true, egress.ReasonAccepted, "")
+
+	allocated := utils.NewCondition(egress.ConditionIPAllocated, true, egress.ReasonAllocated,
+		fmt.Sprintf("free ipv4: %d, free ipv6: %d", usage.IPv4Free, usage.IPv6Free))
+	if exhausted {
+		allocated = utils.NewCondition(egress.ConditionIPAllocated, false, egress.ReasonIPPoolExhausted,
+			"all the IPs of the ippools have been allocated")
+	}
+
+	programmed := utils.NewCondition(egress.ConditionProgrammed, true, egress.ReasonProgrammed,
+		fmt.Sprintf("%d of %d gateway nodes are ready", readyCount, len(gateway.Status.NodeList)))
+	if readyCount == 0 {
+		programmed = utils.NewCondition(egress.ConditionProgrammed, false, egress.ReasonNoReadyGatewayNode,
+			"no gateway node is ready")
+	}
+
+	degraded := utils.NewCondition(egress.ConditionDegraded, false, egress.ReasonAsExpected, "")
+	switch {
+	case readyCount == 0:
+		degraded = utils.NewCondition(egress.ConditionDegraded, true, egress.ReasonNoReadyGatewayNode, "no gateway node is ready")
+	case notReadyCount > 0:
+		degraded = utils.NewCondition(egress.ConditionDegraded, true, egress.ReasonNodeNotReady,
+			fmt.Sprintf("%d of %d gateway nodes are not ready", notReadyCount, len(gateway.Status.NodeList)))
+	case exhausted:
+		degraded = utils.NewCondition(egress.ConditionDegraded, true, egress.ReasonIPPoolExhausted,
+			"all the IPs of the ippools have been allocated")
+	}
+
+	return utils.SetConditions(&gateway.Status.Conditions, &gateway.Status.ObservedGeneration, gateway.Generation,
+		accepted, allocated, programmed, degraded)
+}
@@ -0,0 +1,54 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package egressgateway
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	egress "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+func TestSetBlockedCondition(t *testing.T) {
+	gateway := &egress.EgressGateway{ObjectMeta: metav1.ObjectMeta{Name: "gw1"}}
+	cases := map[string]struct {
+		failurePolicy string
+		node          string
+		active        bool
+		expBlocked    bool
+		expStatus     metav1.ConditionStatus
+		expReason     string
+	}{
+		"open policy":           {failurePolicy: egress.FailurePolicyOpen, active: true},
+		"closed with node":      {failurePolicy: egress.FailurePolicyClosed, node: "node1", active: true, expStatus: metav1.ConditionFalse, expReason: egress.ReasonAsExpected},
+		"closed without node":   {failurePolicy: egress.FailurePolicyClosed, active: true, expBlocked: true, expStatus: metav1.ConditionTrue, expReason: egress.ReasonNoReadyGatewayNode},
+		"closed out of windows": {failurePolicy: egress.FailurePolicyClosed, expStatus: metav1.ConditionFalse, expReason: egress.ReasonOutOfWindow},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			status := new(egress.EgressPolicyStatus)
+			setPolicyConditions(status, 1, gateway, &AssignedIP{Node: c.node}, nil)
+			blocked, changed := setBlockedCondition(status, 1, c.failurePolicy, c.node, c.active)
+			assert.Equal(t, c.expBlocked, blocked)
+
+			condition := meta.FindStatusCondition(status.Conditions, egress.ConditionBlocked)
+			if c.expStatus == "" {
+				assert.False(t, changed)
+				assert.Nil(t, condition)
+				return
+			}
+			assert.True(t, changed)
+			assert.Equal(t, c.expStatus, condition.Status)
+			assert.Equal(t, c.expReason, condition.Reason)
+
+			// the condition is removed when the policy becomes open
+			_, changed = setBlockedCondition(status, 2, egress.FailurePolicyOpen, c.node, c.active)
+			assert.True(t, changed)
+			assert.Nil(t, meta.FindStatusCondition(status.Conditions, egress.ConditionBlocked))
+		})
+	}
+}
@@ -17,6 +17,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
@@ -28,15 +29,24 @@ import (
 	"github.com/spidernet-io/egressgateway/pkg/config"
 	"github.com/spidernet-io/egressgateway/pkg/constant"
 	egress "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/lease"
+	"github.com/spidernet-io/egressgateway/pkg/schedule"
 	"github.com/spidernet-io/egressgateway/pkg/utils"
 	"github.com/spidernet-io/egressgateway/pkg/utils/ip"
 )
 
 type egnReconciler struct {
-	client client.Client
-	log    logr.Logger
-	config *config.Config
-	cli    client.Client
+	client   client.Client
+	log      logr.Logger
+	config   *config.Config
+	cli      client.Client
+	recorder record.EventRecorder
+	// failbackPending the `<gateway>/<node>` whose failback waits for spec.failback.delaySeconds,
+	// the failback only runs when the node turns ready and on the requeues after it
+	failbackPending *utils.SyncMap[string, struct{}]
+	// movePending the `<gateway>/<node>` whose EIPs wait for the node lease to expire before
+	// they are moved, it holds the expiry of the lease seen when the move was required
+	movePending *utils.SyncMap[string, time.Time]
 }
 
 func (r *egnReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
@@ -85,37 +95,51 @@ func (r *egnReconciler) reconcileTunnel(ctx context.Context, req reconcile.Reque
 			return reconcile.Result{Requeue: true}, err
 		}
 
+		var requeueAfter time.Duration
 		for _, egw := range egwList.Items {
 			var needMoveIPs []egress.Eips
 			needUpdate := false
 			for nodeIndex, node := range egw.Status.NodeList {
 				if node.Name == req.Name {
+					wait, err := r.moveGrace(ctx, egw.Name, node)
+					if err != nil {
+						return reconcile.Result{Requeue: true}, err
+					}
+					if wait > 0 {
+						log.Info("tunnel deleted, wait for the node lease to expire", "gateway", egw.Name, "wait", wait)
+						if requeueAfter == 0 || wait < requeueAfter {
+							requeueAfter = wait
+						}
+						break
+					}
 					needUpdate = true
-					needMoveIPs = append(needMoveIPs, node.Eips...)
+					needMoveIPs = append(needMoveIPs, withHomeNode(node.Eips, node.Name)...)
 					egw.Status.NodeList = append(egw.Status.NodeList[:nodeIndex], egw.Status.NodeList[nodeIndex+1:]...)
 					break
 				}
 			}
+			var moves []eipMove
 			if len(needMoveIPs) > 0 {
-				moveEipToReadyNode(&egw, &needMoveIPs)
+				moves = moveEipToReadyNode(&egw, &needMoveIPs)
 			}
 			if needUpdate {
 				err := updateGatewayStatusWithUsage(ctx, r.client, &egw)
 				if err != nil {
 					return reconcile.Result{Requeue: true}, err
 				}
+				r.recordMoved(ctx, &egw, moves, needMoveIPs)
 				// sync all policy status
 				err = updateAllPolicyStatus(ctx, r.client, &egw)
 				if err != nil {
 					return reconcile.Result{Requeue: true}, err
 				}
-				err = cleanPolicyStatus(ctx, r.client, needMoveIPs)
+				err = cleanPolicyStatus(ctx, r.client, &egw, needMoveIPs)
 				if err != nil {
 					return reconcile.Result{Requeue: true}, err
 				}
 			}
 		}
-		return reconcile.Result{}, nil
+		return reconcile.Result{RequeueAfter: requeueAfter}, nil
 	}
 
 	fmt.Println("update tunnel")
@@ -126,9 +150,12 @@ func (r *egnReconciler) reconcileTunnel(ctx context.Context, req reconcile.Reque
 		return reconcile.Result{Requeue: true}, err
 	}
 
+	var requeueAfter time.Duration
 	for _, egw := range egwList.Items {
 		var needMoveIPs []egress.Eips
 		needUpdate := false
+		statusChanged := false
+		becameReady := false
 		for nodeIndex, node := range egw.Status.NodeList {
 			// case 2, tunnel update
 			if node.Name == req.Name {
@@ -136,9 +163,11 @@ func (r *egnReconciler) reconcileTunnel(ctx context.Context, req reconcile.Reque
 					// case 2.1: other status (e.g. NodeNotReady) -> Ready
 					if tunnel.Status.Phase.IsNotEqual(node.Status) {
 						needUpdate = true
+						statusChanged = true
+						becameReady = true
 						egw.Status.NodeList[nodeIndex].Status = tunnel.Status.Phase.String()
-						if egw.Status.ReadyCount() == 1 {
-							// if it is the first tunnel in the node list,
+						if egw.Status.ReadyCount() == 1 || len(egw.Spec.Ippools.NodeAffinity) > 0 {
+							// if it is the first tunnel in the node list, or the EIPs are pinned to nodes,
 							// we need do more (list all policy, recheck all)
 							res, err := r.checkAndUpdateAllPolicyIfNeedWhenFirstNodeReady(ctx, req, log, &egw)
 							if err != nil {
@@ -150,41 +179,55 @@ func (r *egnReconciler) reconcileTunnel(ctx context.Context, req reconcile.Reque
 					// case 2.2: ready -> not ready / statue not sync
 					//           move ip
 					if len(node.Eips) > 0 {
-						// need move ip
+						// need move ip, remember the home node for the preemptive failback
 						needUpdate = true
-						needMoveIPs = append(needMoveIPs, node.Eips...)
+						needMoveIPs = append(needMoveIPs, withHomeNode(node.Eips, node.Name)...)
 						egw.Status.NodeList[nodeIndex].Eips = make([]egress.Eips, 0)
 					}
 					// check state are sync
 					if tunnel.Status.Phase.IsNotEqual(node.Status) {
 						needUpdate = true
+						statusChanged = true
 						egw.Status.NodeList[nodeIndex].Status = tunnel.Status.Phase.String()
 					}
 				}
 				break
 			}
 		}
+		var moves []eipMove
 		if len(needMoveIPs) > 0 {
-			moveEipToReadyNode(&egw, &needMoveIPs)
+			moves = moveEipToReadyNode(&egw, &needMoveIPs)
+		}
+		failbackMoves, wait := r.failbackIfNeed(&egw, tunnel, becameReady)
+		if len(failbackMoves) > 0 {
+			needUpdate = true
+		}
+		if wait > 0 && (requeueAfter == 0 || wait < requeueAfter) {
+			requeueAfter = wait
 		}
 		if needUpdate {
 			err := updateGatewayStatusWithUsage(ctx, r.client, &egw)
 			if err != nil {
 				return reconcile.Result{Requeue: true}, err
 			}
+			if statusChanged {
+				r.recordNodeStatus(&egw, tunnel.Name, tunnel.Status.Phase)
+			}
+			r.recordMoved(ctx, &egw, moves, needMoveIPs)
+			r.recordMoved(ctx, &egw, failbackMoves, nil)
 			// sync all policy status
 			err = updateAllPolicyStatus(ctx, r.client, &egw)
 			if err != nil {
 				return reconcile.Result{Requeue: true}, err
 			}
-			err = cleanPolicyStatus(ctx, r.client, needMoveIPs)
+			err = cleanPolicyStatus(ctx, r.client, &egw, needMoveIPs)
 			if err != nil {
 				return reconcile.Result{Requeue: true}, err
 			}
 		}
 	}
 
-	return reconcile.Result{}, nil
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
 }
 
 func (r *egnReconciler) checkAndUpdateAllPolicyIfNeedWhenFirstNodeReady(ctx context.Context,
@@ -231,6 +274,13 @@ func (r *egnReconciler) reAssignEgressPolicyIP(ctx context.Context,
 	if assignedIP == nil {
 		assignedIP, err = assignIP(gateway, req, policy.Spec.EgressIP)
 		if err != nil {
+			changed, e := updateEgressPolicyStatusIfNeed(ctx, r.client, policy, gateway, nil, err)
+			if e != nil {
+				r.log.Error(e, "failed to update policy status")
+			}
+			if changed {
+				r.recordAllocateFailed(gateway, policy, req.String(), err)
+			}
 			return reconcile.Result{Requeue: true}, err
 		}
 		if assignedIP == nil {
@@ -244,12 +294,13 @@ func (r *egnReconciler) reAssignEgressPolicyIP(ctx context.Context,
 		//if err != nil {
 		//	return reconcile.Result{Requeue: true}, err
 		//}
-		err := updateEgressPolicyStatusIfNeed(ctx, r.client, policy, assignedIP)
+		_, err := updateEgressPolicyStatusIfNeed(ctx, r.client, policy, gateway, assignedIP, nil)
 		if err != nil {
 			return reconcile.Result{Requeue: true}, err
 		}
+		r.recordAllocated(gateway, policy, req.String(), assignedIP)
 	} else {
-		err := updateEgressPolicyStatusIfNeed(ctx, r.client, policy, assignedIP)
+		_, err := updateEgressPolicyStatusIfNeed(ctx, r.client, policy, gateway, assignedIP, nil)
 		if err != nil {
 			return reconcile.Result{Requeue: true}, err
 		}
@@ -267,17 +318,25 @@ func (r *egnReconciler) reAssignEgressClusterPolicyIP(ctx context.Context,
 	if assignedIP == nil {
 		assignedIP, err = assignIP(gateway, req, policy.Spec.EgressIP)
 		if err != nil {
+			changed, e := updateEgressClusterPolicyStatusIfNeed(ctx, r.client, policy, gateway, nil, err)
+			if e != nil {
+				r.log.Error(e, "failed to update policy status")
+			}
+			if changed {
+				r.recordAllocateFailed(gateway, policy, req.Name, err)
+			}
 			return reconcile.Result{Requeue: true}, err
 		}
 		if assignedIP == nil {
 			return reconcile.Result{Requeue: true}, fmt.Errorf("not enough ip")
 		}
-		err := updateEgressClusterPolicyStatusIfNeed(ctx, r.client, policy, assignedIP)
+		_, err := updateEgressClusterPolicyStatusIfNeed(ctx, r.client, policy, gateway, assignedIP, nil)
 		if err != nil {
 			return reconcile.Result{Requeue: true}, err
 		}
+		r.recordAllocated(gateway, policy, req.Name, assignedIP)
 	} else {
-		err := updateEgressClusterPolicyStatusIfNeed(ctx, r.client, policy, assignedIP)
+		_, err := updateEgressClusterPolicyStatusIfNeed(ctx, r.client, policy, gateway, assignedIP, nil)
 		if err != nil {
 			return reconcile.Result{Requeue: true}, err
 		}
@@ -310,6 +369,7 @@ func (r *egnReconciler) reconcileNode(ctx context.Context, req reconcile.Request
 		return reconcile.Result{Requeue: true}, err
 	}
 
+	var requeueAfter time.Duration
 	for _, egw := range egwList.Items {
 		selector, err := metav1.LabelSelectorAsSelector(egw.Spec.NodeSelector.Selector)
 		if err != nil {
@@ -322,6 +382,7 @@ func (r *egnReconciler) reconcileNode(ctx context.Context, req reconcile.Request
 			// case2.1: label match
 			// case2.1.1: not in list, add it
 			// case2.1.1: already int list, do nothing
+			r.movePending.Delete(egw.Name + "/" + node.Name)
 			var find bool
 			for _, item := range egw.Status.NodeList {
 				if item.Name == node.Name {
@@ -360,33 +421,77 @@ func (r *egnReconciler) reconcileNode(ctx context.Context, req reconcile.Request
 			// case2.2.1: already int list, delete it
 			for nodeIndex, item := range egw.Status.NodeList {
 				if item.Name == node.Name {
+					wait, err := r.moveGrace(ctx, egw.Name, item)
+					if err != nil {
+						return reconcile.Result{Requeue: true}, err
+					}
+					if wait > 0 {
+						log.Info("node does not match the gateway, wait for the node lease to expire", "gateway", egw.Name, "wait", wait)
+						if requeueAfter == 0 || wait < requeueAfter {
+							requeueAfter = wait
+						}
+						break
+					}
 					needUpdate = true
-					needMoveIPs = item.Eips
+					needMoveIPs = withHomeNode(item.Eips, item.Name)
 					egw.Status.NodeList = append(egw.Status.NodeList[:nodeIndex], egw.Status.NodeList[nodeIndex+1:]...)
 					break
 				}
 			}
 		}
+		var moves []eipMove
 		if len(needMoveIPs) > 0 {
-			moveEipToReadyNode(&egw, &needMoveIPs)
+			moves = moveEipToReadyNode(&egw, &needMoveIPs)
 		}
 		if needUpdate {
 			err := updateGatewayStatusWithUsage(ctx, r.client, &egw)
 			if err != nil {
 				return reconcile.Result{Requeue: true}, err
 			}
+			r.recordMoved(ctx, &egw, moves, needMoveIPs)
 			// sync all policy status
 			err = updateAllPolicyStatus(ctx, r.client, &egw)
 			if err != nil {
 				return reconcile.Result{Requeue: true}, err
 			}
-			err = cleanPolicyStatus(ctx, r.client, needMoveIPs)
+			err = cleanPolicyStatus(ctx, r.client, &egw, needMoveIPs)
 			if err != nil {
 				return reconcile.Result{Requeue: true}, err
 			}
 		}
 	}
-	return reconcile.Result{}, nil
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// moveGrace returns how long the EIPs placed on the node must wait before they are moved
+// to the other nodes of the gateway. The agent of the node keeps announcing them until
+// its lease expires, so the EIPs of a deleted node, or of a node which no longer matches
+// the gateway, are only moved after the lease seen when the move was first required has
+// expired, the same as the tunnel health check waits for it on the heartbeat timeout.
+func (r *egnReconciler) moveGrace(ctx context.Context, gateway string, node egress.EgressIPStatus) (time.Duration, error) {
+	if len(node.Eips) == 0 || r.config == nil || !r.config.FileConfig.GatewayFailover.Enable {
+		return 0, nil
+	}
+	key := gateway + "/" + node.Name
+	now := time.Now()
+	expiry, pending := r.movePending.Load(key)
+	if !pending {
+		nodeLease, err := lease.Get(ctx, r.client, r.config.FileConfig.GatewayFailover.LeaseNamespace, node.Name)
+		if err != nil {
+			return 0, err
+		}
+		remaining := lease.Remaining(nodeLease, now)
+		if remaining == 0 {
+			return 0, nil
+		}
+		expiry = now.Add(remaining)
+		r.movePending.Store(key, expiry)
+	}
+	if wait := expiry.Sub(now); wait > 0 {
+		return wait, nil
+	}
+	r.movePending.Delete(key)
+	return 0, nil
 }
 
 func updateAllPolicyStatus(ctx context.Context, cli client.Client, egw *egress.EgressGateway) error {
@@ -408,7 +513,7 @@ func updateAllPolicyStatus(ctx context.Context, cli client.Client, egw *egress.E
 					if err != nil {
 						return err
 					}
-					err = updateEgressPolicyStatusIfNeed(ctx, cli, policy, assignedIP)
+					_, err = updateEgressPolicyStatusIfNeed(ctx, cli, policy, egw, assignedIP, nil)
 					if err != nil {
 						return err
 					}
@@ -418,7 +523,7 @@ func updateAllPolicyStatus(ctx context.Context, cli client.Client, egw *egress.E
 					if err != nil {
 						return err
 					}
-					err = updateEgressClusterPolicyStatusIfNeed(ctx, cli, policy, assignedIP)
+					_, err = updateEgressClusterPolicyStatusIfNeed(ctx, cli, policy, egw, assignedIP, nil)
 					if err != nil {
 						return err
 					}
@@ -429,7 +534,7 @@ func updateAllPolicyStatus(ctx context.Context, cli client.Client, egw *egress.E
 	return nil
 }
 
-func cleanPolicyStatus(ctx context.Context, cli client.Client, eips []egress.Eips) error {
+func cleanPolicyStatus(ctx context.Context, cli client.Client, egw *egress.EgressGateway, eips []egress.Eips) error {
 	assignedIP := &AssignedIP{}
 	for _, eip := range eips {
 		for _, p := range eip.Policies {
@@ -440,7 +545,7 @@ func cleanPolicyStatus(ctx context.Context, cli client.Client, eips []egress.Eip
 					return err
 				}
 				assignedIP.UseNodeIP = policy.Spec.EgressIP.UseNodeIP
-				err = updateEgressPolicyStatusIfNeed(ctx, cli, policy, assignedIP)
+				_, err = updateEgressPolicyStatusIfNeed(ctx, cli, policy, egw, assignedIP, nil)
 				if err != nil {
 					return err
 				}
@@ -451,7 +556,7 @@ func cleanPolicyStatus(ctx context.Context, cli client.Client, eips []egress.Eip
 					return err
 				}
 				assignedIP.UseNodeIP = policy.Spec.EgressIP.UseNodeIP
-				err = updateEgressClusterPolicyStatusIfNeed(ctx, cli, policy, assignedIP)
+				_, err = updateEgressClusterPolicyStatusIfNeed(ctx, cli, policy, egw, assignedIP, nil)
 				if err != nil {
 					return err
 				}
@@ -527,7 +632,7 @@ func (r *egnReconciler) reconcileGateway(ctx context.Context, req reconcile.Requ
 				}
 				// case 1.1: node exists, but tunnel not exists, set statue to pending
 				if egress.EgressTunnelPending.IsNotEqual(node.Status) {
-					needMoveIPs = append(needMoveIPs, node.Eips...)
+					needMoveIPs = append(needMoveIPs, withHomeNode(node.Eips, node.Name)...)
 					// sync status
 					egw.Status.NodeList[i].Status = egress.EgressTunnelPending.String()
 					egw.Status.NodeList[i].Eips = []egress.Eips{}
@@ -544,7 +649,7 @@ func (r *egnReconciler) reconcileGateway(ctx context.Context, req reconcile.Requ
 			// case 1.3: status has been synchronized, do nothing
 			i++
 		} else {
-			needMoveIPs = append(needMoveIPs, node.Eips...)
+			needMoveIPs = append(needMoveIPs, withHomeNode(node.Eips, node.Name)...)
 			needUpdate = true
 			// Remove the element by shifting the subsequent elements forward and reducing the length of the slice.
 			copy(egw.Status.NodeList[i:], egw.Status.NodeList[i+1:])
@@ -574,8 +679,13 @@ func (r *egnReconciler) reconcileGateway(ctx context.Context, req reconcile.Requ
 		})
 	}
 
+	var moves []eipMove
 	if len(needMoveIPs) > 0 {
-		moveEipToReadyNode(egw, &needMoveIPs)
+		moves = moveEipToReadyNode(egw, &needMoveIPs)
+	}
+	if affinityMoves := enforceNodeAffinity(egw); len(affinityMoves) > 0 {
+		moves = append(moves, affinityMoves...)
+		needUpdate = true
 	}
 
 	if beforeReadyCount == 0 {
@@ -585,6 +695,10 @@ func (r *egnReconciler) reconcileGateway(ctx context.Context, req reconcile.Requ
 		}
 	}
 
+	if egw.Status.ObservedGeneration != egw.Generation {
+		needUpdate = true
+	}
+
 	// first create egw update usage
 	if (egw.Status.IPUsage.IPv4Total == 0 && len(egw.Spec.Ippools.IPv4) != 0) ||
 		(egw.Status.IPUsage.IPv6Total == 0 || len(egw.Spec.Ippools.IPv6) != 0) {
@@ -597,12 +711,13 @@ func (r *egnReconciler) reconcileGateway(ctx context.Context, req reconcile.Requ
 		if err != nil {
 			return reconcile.Result{Requeue: true}, err
 		}
+		r.recordMoved(ctx, egw, moves, needMoveIPs)
 		// sync all policy status
 		err = updateAllPolicyStatus(ctx, r.client, egw)
 		if err != nil {
 			return reconcile.Result{Requeue: true}, err
 		}
-		err = cleanPolicyStatus(ctx, r.client, needMoveIPs)
+		err = cleanPolicyStatus(ctx, r.client, egw, needMoveIPs)
 		if err != nil {
 			return reconcile.Result{Requeue: true}, err
 		}
@@ -611,56 +726,45 @@ func (r *egnReconciler) reconcileGateway(ctx context.Context, req reconcile.Requ
 	return reconcile.Result{}, nil
 }
 
-func moveEipToReadyNode(gateway *egress.EgressGateway, needMoveIPs *[]egress.Eips) {
-	if gateway.Status.ReadyCount() <= 0 {
-		return
-	}
-
-	minEipNodeIndex := -1
-	minEipCount := -1
-	useNodeIPIndex := -1
-
-	for i, node := range gateway.Status.NodeList {
-		if node.Status == "Ready" {
-			eipCount := len(node.Eips)
-			if minEipCount == -1 || eipCount < minEipCount {
-				minEipNodeIndex = i
-				minEipCount = eipCount
-				for tmp, eip := range node.Eips {
-					if eip.IPv4 == "" && eip.IPv6 == "" {
-						useNodeIPIndex = tmp
-					}
-				}
-			}
+// moveEipToReadyNode moves each EIP to its standby node if it is ready, otherwise to the
+// ready node with the least EIPs which is allowed by spec.ippools.nodeAffinity, the EIPs
+// which can not be moved are kept in needMoveIPs.
+func moveEipToReadyNode(gateway *egress.EgressGateway, needMoveIPs *[]egress.Eips) []eipMove {
+	var moves []eipMove
+	var remain []egress.Eips
+	for _, eip := range *needMoveIPs {
+		// the standby node has pre-installed the datapath of the EIP
+		index := standbyIndex(gateway, eip)
+		if index == -1 {
+			index = selectNode(gateway, eip.IPv4, eip.IPv6)
+		}
+		if index == -1 {
+			// case: no healthy nodes to move(migrate) eip, do nothing
+			remain = append(remain, eip)
+			continue
 		}
-	}
-
-	if minEipNodeIndex != -1 {
-		for _, eip := range *needMoveIPs {
-			if eip.IPv4 == "" && eip.IPv6 == "" {
-				// case 1: move user node ip case
-				if useNodeIPIndex != -1 {
-					// case: append policy to target node
-					gateway.Status.NodeList[minEipNodeIndex].Eips[useNodeIPIndex].Policies = append(
-						gateway.Status.NodeList[minEipNodeIndex].Eips[useNodeIPIndex].Policies,
-						eip.Policies...,
-					)
-				} else {
-					// case: need create new
-					useNodeIPIndex = len(gateway.Status.NodeList[minEipNodeIndex].Eips)
-					gateway.Status.NodeList[minEipNodeIndex].Eips = append(
-						gateway.Status.NodeList[minEipNodeIndex].Eips,
-						egress.Eips{IPv4: "", IPv6: "", Policies: eip.Policies},
-					)
+		target := &gateway.Status.NodeList[index]
+		if isNodeIPEip(eip) {
+			// case 1: move user node ip case, append policy to the node ip entry of target node
+			found := false
+			for i := range target.Eips {
+				if isNodeIPEip(target.Eips[i]) {
+					target.Eips[i].Policies = append(target.Eips[i].Policies, eip.Policies...)
+					found = true
+					break
 				}
-			} else {
-				// case 2: move eip case
-				gateway.Status.NodeList[minEipNodeIndex].Eips = append(gateway.Status.NodeList[minEipNodeIndex].Eips, eip)
 			}
+			if !found {
+				target.Eips = append(target.Eips, egress.Eips{IPv4: "", IPv6: "", Policies: eip.Policies})
+			}
+		} else {
+			// case 2: move eip case
+			target.Eips = append(target.Eips, eip)
 		}
-		*needMoveIPs = nil
+		moves = append(moves, eipMove{eip: eip, to: target.Name})
 	}
-	// case: no healthy nodes to move(migrate) eip, do nothing
+	*needMoveIPs = remain
+	return moves
 }
 
 func (r *egnReconciler) reconcileEgressClusterPolicy(ctx context.Context, req reconcile.Request, log logr.Logger) (reconcile.Result, error) {
@@ -675,6 +779,7 @@ func (r *egnReconciler) reconcileEgressClusterPolicy(ctx context.Context, req re
 	}
 	deleted = deleted || !policy.GetDeletionTimestamp().IsZero()
 	if deleted {
+		gaugePolicyBlocked.DeleteLabelValues(req.Namespace, req.Name)
 		return r.reconcileDeletePolicy(ctx, req, policy.Spec.EgressGatewayName, log)
 	}
 
@@ -686,12 +791,22 @@ func (r *egnReconciler) reconcileEgressClusterPolicy(ctx context.Context, req re
 			if !errors.IsNotFound(err) {
 				return reconcile.Result{Requeue: true}, err
 			}
+			if _, e := updateEgressClusterPolicyStatusIfNeed(ctx, r.client, policy, nil, nil, nil); e != nil {
+				log.Error(e, "failed to update policy status")
+			}
 			return reconcile.Result{Requeue: false}, fmt.Errorf("reconcile EgressPolicy %s, not found egress gateway: %s", req, gatewayName)
 		}
 		assignedIP := getAssignedIP(gateway, req.Namespace, req.Name)
 		if assignedIP == nil {
 			assignedIP, err = assignIP(gateway, req, policy.Spec.EgressIP)
 			if err != nil {
+				changed, e := updateEgressClusterPolicyStatusIfNeed(ctx, r.client, policy, gateway, nil, err)
+				if e != nil {
+					log.Error(e, "failed to update policy status")
+				}
+				if changed {
+					r.recordAllocateFailed(gateway, policy, req.Name, err)
+				}
 				return reconcile.Result{Requeue: true}, err
 			}
 			if assignedIP == nil {
@@ -701,12 +816,13 @@ func (r *egnReconciler) reconcileEgressClusterPolicy(ctx context.Context, req re
 			if err != nil {
 				return reconcile.Result{Requeue: true}, err
 			}
-			err := updateEgressClusterPolicyStatusIfNeed(ctx, r.client, policy, assignedIP)
+			_, err := updateEgressClusterPolicyStatusIfNeed(ctx, r.client, policy, gateway, assignedIP, nil)
 			if err != nil {
 				return reconcile.Result{Requeue: true}, err
 			}
+			r.recordAllocated(gateway, policy, req.Name, assignedIP)
 		} else {
-			err := updateEgressClusterPolicyStatusIfNeed(ctx, r.client, policy, assignedIP)
+			_, err := updateEgressClusterPolicyStatusIfNeed(ctx, r.client, policy, gateway, assignedIP, nil)
 			if err != nil {
 				return reconcile.Result{Requeue: true}, err
 			}
@@ -729,6 +845,7 @@ func (r *egnReconciler) reconcileDeletePolicy(ctx context.Context, req reconcile
 			return reconcile.Result{Requeue: false}, nil
 		}
 		for _, gateway := range gatewayList.Items {
+			released := getAssignedIP(&gateway, req.Namespace, req.Name)
 			update, err := deleteEgressPolicy(&gateway, req.Namespace, req.Name)
 			if err != nil {
 				return reconcile.Result{Requeue: true}, err
@@ -738,6 +855,7 @@ func (r *egnReconciler) reconcileDeletePolicy(ctx context.Context, req reconcile
 				if err != nil {
 					return reconcile.Result{Requeue: true}, err
 				}
+				r.recordReleased(&gateway, req.Name, released)
 				break
 			}
 		}
@@ -751,6 +869,7 @@ func (r *egnReconciler) reconcileDeletePolicy(ctx context.Context, req reconcile
 			return reconcile.Result{Requeue: false}, nil
 		}
 		if gateway.Name != "" {
+			released := getAssignedIP(gateway, req.Namespace, req.Name)
 			update, err := deleteEgressPolicy(gateway, req.Namespace, req.Name)
 			if err != nil {
 				return reconcile.Result{Requeue: true}, err
@@ -760,6 +879,7 @@ func (r *egnReconciler) reconcileDeletePolicy(ctx context.Context, req reconcile
 				if err != nil {
 					return reconcile.Result{Requeue: true}, err
 				}
+				r.recordReleased(gateway, req.Name, released)
 			}
 		}
 	}
@@ -779,6 +899,7 @@ func (r *egnReconciler) reconcileEgressPolicy(ctx context.Context, req reconcile
 	deleted = deleted || !policy.GetDeletionTimestamp().IsZero()
 
 	if deleted {
+		gaugePolicyBlocked.DeleteLabelValues(req.Namespace, req.Name)
 		egwName := ""
 		if policy != nil && policy.Spec.EgressGatewayName != "" {
 			egwName = policy.Spec.EgressGatewayName
@@ -796,6 +917,7 @@ func (r *egnReconciler) reconcileEgressPolicy(ctx context.Context, req reconcile
 				return reconcile.Result{Requeue: false}, nil
 			}
 			for _, gateway := range gatewayList.Items {
+				released := getAssignedIP(&gateway, req.Namespace, req.Name)
 				update, err := deleteEgressPolicy(&gateway, req.Namespace, req.Name)
 				if err != nil {
 					return reconcile.Result{Requeue: true}, err
@@ -805,6 +927,7 @@ func (r *egnReconciler) reconcileEgressPolicy(ctx context.Context, req reconcile
 					if err != nil {
 						return reconcile.Result{Requeue: true}, err
 					}
+					r.recordReleased(&gateway, req.String(), released)
 					break
 				}
 			}
@@ -818,6 +941,7 @@ func (r *egnReconciler) reconcileEgressPolicy(ctx context.Context, req reconcile
 				return reconcile.Result{Requeue: false}, nil
 			}
 			if gateway.Name != "" {
+				released := getAssignedIP(gateway, req.Namespace, req.Name)
 				update, err := deleteEgressPolicy(gateway, req.Namespace, req.Name)
 				if err != nil {
 					return reconcile.Result{Requeue: true}, err
@@ -827,6 +951,7 @@ func (r *egnReconciler) reconcileEgressPolicy(ctx context.Context, req reconcile
 					if err != nil {
 						return reconcile.Result{Requeue: true}, err
 					}
+					r.recordReleased(gateway, req.String(), released)
 				}
 			}
 		}
@@ -841,12 +966,22 @@ func (r *egnReconciler) reconcileEgressPolicy(ctx context.Context, req reconcile
 			if !errors.IsNotFound(err) {
 				return reconcile.Result{Requeue: true}, err
 			}
+			if _, e := updateEgressPolicyStatusIfNeed(ctx, r.client, policy, nil, nil, nil); e != nil {
+				log.Error(e, "failed to update policy status")
+			}
 			return reconcile.Result{Requeue: false}, fmt.Errorf("reconcile EgressPolicy %s, not found egress gateway: %s", req, gatewayName)
 		}
 		assignedIP := getAssignedIP(gateway, req.Namespace, req.Name)
 		if assignedIP == nil {
 			assignedIP, err = assignIP(gateway, req, policy.Spec.EgressIP)
 			if err != nil {
+				changed, e := updateEgressPolicyStatusIfNeed(ctx, r.client, policy, gateway, nil, err)
+				if e != nil {
+					log.Error(e, "failed to update policy status")
+				}
+				if changed {
+					r.recordAllocateFailed(gateway, policy, req.String(), err)
+				}
 				return reconcile.Result{Requeue: true}, err
 			}
 			if assignedIP == nil {
@@ -860,12 +995,13 @@ func (r *egnReconciler) reconcileEgressPolicy(ctx context.Context, req reconcile
 			//if err != nil {
 			//	return reconcile.Result{Requeue: true}, err
 			//}
-			err := updateEgressPolicyStatusIfNeed(ctx, r.client, policy, assignedIP)
+			_, err := updateEgressPolicyStatusIfNeed(ctx, r.client, policy, gateway, assignedIP, nil)
 			if err != nil {
 				return reconcile.Result{Requeue: true}, err
 			}
+			r.recordAllocated(gateway, policy, req.String(), assignedIP)
 		} else {
-			err := updateEgressPolicyStatusIfNeed(ctx, r.client, policy, assignedIP)
+			_, err := updateEgressPolicyStatusIfNeed(ctx, r.client, policy, gateway, assignedIP, nil)
 			if err != nil {
 				return reconcile.Result{Requeue: true}, err
 			}
@@ -877,20 +1013,7 @@ func (r *egnReconciler) reconcileEgressPolicy(ctx context.Context, req reconcile
 
 func assignIP(from *egress.EgressGateway, req reconcile.Request, specEgressIP egress.EgressIP) (*AssignedIP, error) {
 	// apply node policy to select node
-	nIndex := -1
-	eipNum := -1
-	for nodeIndex, node := range from.Status.NodeList {
-		if node.Status != string(egress.EgressTunnelReady) {
-			continue
-		}
-		if eipNum == -1 {
-			eipNum = len(node.Eips)
-			nIndex = nodeIndex
-		} else if eipNum > len(node.Eips) {
-			eipNum = len(node.Eips)
-			nIndex = nodeIndex
-		}
-	}
+	nIndex := selectNode(from, "", "")
 
 	// case1
 	if specEgressIP.UseNodeIP {
@@ -920,7 +1043,7 @@ func assignIP(from *egress.EgressGateway, req reconcile.Request, specEgressIP eg
 				UseNodeIP: true,
 			}, nil
 		}
-		return nil, nil
+		return nil, fmt.Errorf("EgressGateway %s does not have an available Node: %w", from.Name, ErrNoReadyNode)
 	}
 
 	// case2 reuse eip
@@ -929,13 +1052,23 @@ func assignIP(from *egress.EgressGateway, req reconcile.Request, specEgressIP eg
 		for nodeIndex, node := range from.Status.NodeList {
 			for eipIndex, eip := range node.Eips {
 				if eip.IPv4 == specEgressIP.IPv4 || eip.IPv6 == specEgressIP.IPv6 {
+					if !eipNodeAllowed(from.Spec.Ippools, eip.IPv4, eip.IPv6, node.Name) {
+						// the node affinity is changed after the EIP is assigned
+						target := selectNode(from, eip.IPv4, eip.IPv6)
+						if target == -1 {
+							return nil, fmt.Errorf("EgressGateway %s does not have an available Node for EIP ipv4=%q ipv6=%q: %w",
+								from.Name, eip.IPv4, eip.IPv6, ErrNoReadyNode)
+						}
+						eipIndex = moveEip(from, nodeIndex, eipIndex, target)
+						nodeIndex = target
+					}
 					from.Status.NodeList[nodeIndex].Eips[eipIndex].Policies = append(
 						from.Status.NodeList[nodeIndex].Eips[eipIndex].Policies, egress.Policy{
 							Name:      req.Name,
 							Namespace: req.Namespace,
 						})
 					return &AssignedIP{
-						Node:      node.Name,
+						Node:      from.Status.NodeList[nodeIndex].Name,
 						IPv4:      eip.IPv4,
 						IPv6:      eip.IPv6,
 						UseNodeIP: false,
@@ -948,6 +1081,9 @@ func assignIP(from *egress.EgressGateway, req reconcile.Request, specEgressIP eg
 	// case3 assign new IP use eip assign policy
 	//
 	if specEgressIP.AllocatorPolicy == egress.EipAllocatorRR {
+		if nIndex == -1 {
+			return nil, fmt.Errorf("EgressGateway %s does not have an available Node: %w", from.Name, ErrNoReadyNode)
+		}
 		randObj := rand.New(rand.NewSource(time.Now().UnixNano()))
 		assignedIP := &AssignedIP{
 			Node:      "",
@@ -985,9 +1121,15 @@ func assignIP(from *egress.EgressGateway, req reconcile.Request, specEgressIP eg
 				}
 				freeIpv4s := ip.IPsDiffSet(ipv4s, useIpv4s, false)
 				if len(freeIpv4s) == 0 {
-					return nil, fmt.Errorf("EgressGateway %s does not have enough IPs to allocate for Policy %s/%s", from.Name, req.Namespace, req.Name)
+					return nil, fmt.Errorf("EgressGateway %s does not have enough IPs to allocate for Policy %s/%s: %w", from.Name, req.Namespace, req.Name, ErrIPPoolExhausted)
+				}
+				ipv4, ok := pickFreeIP(from, randObj, freeIpv4s, func(ip string) bool {
+					return selectNode(from, ip, "") != -1
+				})
+				if !ok {
+					return nil, fmt.Errorf("EgressGateway %s does not have an available Node for the free IPv4s: %w", from.Name, ErrNoReadyNode)
 				}
-				assignedIP.IPv4 = freeIpv4s[randObj.Intn(len(freeIpv4s))].String()
+				assignedIP.IPv4 = ipv4
 			}
 		}
 
@@ -1021,12 +1163,23 @@ func assignIP(from *egress.EgressGateway, req reconcile.Request, specEgressIP eg
 				}
 				freeIpv6s := ip.IPsDiffSet(ipv6s, useIpv6s, false)
 				if len(freeIpv6s) == 0 {
-					return nil, fmt.Errorf("EgressGateway %s does not have enough IPs to allocate for Policy %s/%s", from.Name, req.Namespace, req.Name)
+					return nil, fmt.Errorf("EgressGateway %s does not have enough IPs to allocate for Policy %s/%s: %w", from.Name, req.Namespace, req.Name, ErrIPPoolExhausted)
 				}
-				assignedIP.IPv6 = freeIpv6s[randObj.Intn(len(freeIpv6s))].String()
+				ipv6, ok := pickFreeIP(from, randObj, freeIpv6s, func(ip string) bool {
+					return selectNode(from, assignedIP.IPv4, ip) != -1
+				})
+				if !ok {
+					return nil, fmt.Errorf("EgressGateway %s does not have an available Node for the free IPv6s: %w", from.Name, ErrNoReadyNode)
+				}
+				assignedIP.IPv6 = ipv6
 			}
 		}
 
+		nIndex = selectNode(from, assignedIP.IPv4, assignedIP.IPv6)
+		if nIndex == -1 {
+			return nil, fmt.Errorf("EgressGateway %s does not have an available Node for EIP ipv4=%q ipv6=%q: %w",
+				from.Name, assignedIP.IPv4, assignedIP.IPv6, ErrNoReadyNode)
+		}
 		assignedIP.Node = from.Status.NodeList[nIndex].Name
 		// append assignedIP to egw
 		from.Status.NodeList[nIndex].Eips = append(
@@ -1067,6 +1220,9 @@ func assignIP(from *egress.EgressGateway, req reconcile.Request, specEgressIP eg
 				if node.Status != string(egress.EgressTunnelReady) {
 					continue
 				}
+				if !eipNodeAllowed(from.Spec.Ippools, assignedIP.IPv4, assignedIP.IPv6, node.Name) {
+					continue
+				}
 				from.Status.NodeList[i].Eips = append(
 					from.Status.NodeList[i].Eips,
 					egress.Eips{
@@ -1080,7 +1236,7 @@ func assignIP(from *egress.EgressGateway, req reconcile.Request, specEgressIP eg
 			}
 		}
 		if assignedIP.Node == "" {
-			return nil, fmt.Errorf("EgressGateway %s does not have an available Node", from.Name)
+			return nil, fmt.Errorf("EgressGateway %s does not have an available Node: %w", from.Name, ErrNoReadyNode)
 		}
 
 		return assignedIP, nil
@@ -1119,8 +1275,20 @@ func getAssignedIP(from *egress.EgressGateway, policyNs, policyName string) *Ass
 	return nil
 }
 
-func updateEgressPolicyStatusIfNeed(ctx context.Context, cli client.Client, policy *egress.EgressPolicy, assignedIP *AssignedIP) error {
-	if policy.Status.Eip.Ipv4 != assignedIP.IPv4 || policy.Status.Eip.Ipv6 != assignedIP.IPv6 || policy.Status.Node != assignedIP.Node {
+// updateEgressPolicyStatusIfNeed updates the eip, node and conditions of the policy status,
+// gateway is nil if the referenced EgressGateway is not found, allocErr is the error of assignIP.
+// It returns whether the conditions of the policy have been changed.
+func updateEgressPolicyStatusIfNeed(ctx context.Context, cli client.Client, policy *egress.EgressPolicy,
+	gateway *egress.EgressGateway, assignedIP *AssignedIP, allocErr error) (bool, error) {
+	if assignedIP == nil {
+		assignedIP = &AssignedIP{}
+	}
+	changed := setPolicyConditions(&policy.Status, policy.Generation, gateway, assignedIP, allocErr)
+	blocked, blockedChanged := setBlockedCondition(&policy.Status, policy.Generation, policy.Spec.FailurePolicy,
+		assignedIP.Node, schedule.IsActive(policy.Spec.Schedule, policy.Status))
+	setPolicyBlocked(policy.Namespace, policy.Name, policy.Spec.FailurePolicy, blocked)
+	changed = changed || blockedChanged
+	if changed || policy.Status.Eip.Ipv4 != assignedIP.IPv4 || policy.Status.Eip.Ipv6 != assignedIP.IPv6 || policy.Status.Node != assignedIP.Node {
 		policy.Status.Eip.Ipv4 = assignedIP.IPv4
 		policy.Status.Eip.Ipv6 = assignedIP.IPv6
 		policy.Status.Node = assignedIP.Node
@@ -1132,24 +1300,34 @@ func updateEgressPolicyStatusIfNeed(ctx context.Context, cli client.Client, poli
 				err := cli.Get(ctx, types.NamespacedName{Namespace: policy.Namespace, Name: policy.Name}, policy)
 				if err != nil {
 					if !errors.IsNotFound(err) {
-						return nil
+						return changed, nil
 					}
-					return err
+					return changed, err
 				}
 				newPolicy.Status = policy.Status
 				err = cli.Status().Update(ctx, policy)
 				if err != nil {
-					return err
+					return changed, err
 				}
 			}
-			return err
+			return changed, err
 		}
 	}
-	return nil
+	return changed, nil
 }
 
-func updateEgressClusterPolicyStatusIfNeed(ctx context.Context, cli client.Client, policy *egress.EgressClusterPolicy, assignedIP *AssignedIP) error {
-	if policy.Status.Eip.Ipv4 != assignedIP.IPv4 || policy.Status.Eip.Ipv6 != assignedIP.IPv6 || policy.Status.Node != assignedIP.Node {
+// updateEgressClusterPolicyStatusIfNeed is the EgressClusterPolicy version of updateEgressPolicyStatusIfNeed
+func updateEgressClusterPolicyStatusIfNeed(ctx context.Context, cli client.Client, policy *egress.EgressClusterPolicy,
+	gateway *egress.EgressGateway, assignedIP *AssignedIP, allocErr error) (bool, error) {
+	if assignedIP == nil {
+		assignedIP = &AssignedIP{}
+	}
+	changed := setPolicyConditions(&policy.Status, policy.Generation, gateway, assignedIP, allocErr)
+	blocked, blockedChanged := setBlockedCondition(&policy.Status, policy.Generation, policy.Spec.FailurePolicy,
+		assignedIP.Node, schedule.IsActive(policy.Spec.Schedule, policy.Status))
+	setPolicyBlocked(policy.Namespace, policy.Name, policy.Spec.FailurePolicy, blocked)
+	changed = changed || blockedChanged
+	if changed || policy.Status.Eip.Ipv4 != assignedIP.IPv4 || policy.Status.Eip.Ipv6 != assignedIP.IPv6 || policy.Status.Node != assignedIP.Node {
 		policy.Status.Eip.Ipv4 = assignedIP.IPv4
 		policy.Status.Eip.Ipv6 = assignedIP.IPv6
 		policy.Status.Node = assignedIP.Node
@@ -1160,20 +1338,20 @@ func updateEgressClusterPolicyStatusIfNeed(ctx context.Context, cli client.Clien
 				err := cli.Get(ctx, types.NamespacedName{Namespace: policy.Namespace, Name: policy.Name}, policy)
 				if err != nil {
 					if !errors.IsNotFound(err) {
-						return nil
+						return changed, nil
 					}
-					return err
+					return changed, err
 				}
 				newPolicy.Status = policy.Status
 				err = cli.Status().Update(ctx, policy)
 				if err != nil {
-					return err
+					return changed, err
 				}
 			}
-			return err
+			return changed, err
 		}
 	}
-	return nil
+	return changed, nil
 }
 
 func updateGatewayStatusWithUsage(ctx context.Context, cli client.Client, gateway *egress.EgressGateway) error {
@@ -1188,6 +1366,8 @@ func updateGatewayStatusWithUsage(ctx context.Context, cli client.Client, gatewa
 	gateway.Status.IPUsage.IPv6Free = ipv6sFree
 	gateway.Status.IPUsage.IPv4Total = ipv4sTotal
 	gateway.Status.IPUsage.IPv6Total = ipv6sTotal
+	assignStandbyNodes(gateway)
+	setGatewayConditions(gateway)
 	err = cli.Status().Update(ctx, gateway)
 	if err != nil {
 		return err
@@ -1237,10 +1417,14 @@ func NewEgressGatewayController(mgr manager.Manager, log logr.Logger, cfg *confi
 		return fmt.Errorf("cfg can not be nil")
 	}
 	r := &egnReconciler{
-		client: mgr.GetClient(),
-		log:    log,
-		config: cfg,
-		cli:    client,
+		client:   mgr.GetClient(),
+		log:      log,
+		config:   cfg,
+		cli:      client,
+		recorder: mgr.GetEventRecorderFor("egress-gateway"),
+
+		failbackPending: utils.NewSyncMap[string, struct{}](),
+		movePending:     utils.NewSyncMap[string, time.Time](),
 	}
 
 	c, err := controller.New("egressGateway", mgr,
@@ -1376,6 +1560,10 @@ func (p egressPolicyPredicate) Update(updateEvent event.UpdateEvent) bool {
 	if !reflect.DeepEqual(oldObj.Spec, newObj.Spec) {
 		return true
 	}
+	// the Blocked condition follows the windows of the schedule
+	if schedule.IsActive(oldObj.Spec.Schedule, oldObj.Status) != schedule.IsActive(newObj.Spec.Schedule, newObj.Status) {
+		return true
+	}
 	return false
 }
 func (p egressPolicyPredicate) Generic(_ event.GenericEvent) bool { return true }
@@ -1396,6 +1584,10 @@ func (p egressClusterPolicyPredicate) Update(updateEvent event.UpdateEvent) bool
 	if !reflect.DeepEqual(oldObj.Spec, newObj.Spec) {
 		return true
 	}
+	// the Blocked condition follows the windows of the schedule
+	if schedule.IsActive(oldObj.Spec.Schedule, oldObj.Status) != schedule.IsActive(newObj.Spec.Schedule, newObj.Status) {
+		return true
+	}
 	return false
 }
 func (p egressClusterPolicyPredicate) Generic(_ event.GenericEvent) bool { return true }
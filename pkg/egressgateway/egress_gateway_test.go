@@ -0,0 +1,68 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package egressgateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/spidernet-io/egressgateway/pkg/config"
+	egress "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/lease"
+	"github.com/spidernet-io/egressgateway/pkg/schema"
+	"github.com/spidernet-io/egressgateway/pkg/utils"
+)
+
+func TestMoveGrace(t *testing.T) {
+	nodeLease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: lease.Name("node1")},
+		Spec: coordinationv1.LeaseSpec{
+			LeaseDurationSeconds: ptr.To[int32](10),
+			RenewTime:            &metav1.MicroTime{Time: time.Now()},
+		},
+	}
+	cli := fake.NewClientBuilder().WithScheme(schema.GetScheme()).WithObjects(nodeLease).Build()
+	cfg := new(config.Config)
+	cfg.FileConfig.GatewayFailover.Enable = true
+	cfg.FileConfig.GatewayFailover.LeaseNamespace = "default"
+	r := &egnReconciler{client: cli, log: logr.Discard(), config: cfg, movePending: utils.NewSyncMap[string, time.Time]()}
+
+	node := egress.EgressIPStatus{Name: "node1", Eips: []egress.Eips{{IPv4: "10.6.1.21"}}}
+
+	// the agent still holds the lease
+	wait, err := r.moveGrace(context.Background(), "egw", node)
+	assert.NoError(t, err)
+	assert.Greater(t, wait, time.Second*9)
+
+	// the renewals after the move was required do not extend the wait
+	nodeLease.Spec.RenewTime = &metav1.MicroTime{Time: time.Now().Add(time.Minute)}
+	assert.NoError(t, cli.Update(context.Background(), nodeLease))
+	wait, err = r.moveGrace(context.Background(), "egw", node)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, wait, time.Second*10)
+
+	// the lease seen when the move was required has expired
+	r.movePending.Store("egw/node1", time.Now().Add(-time.Second))
+	wait, err = r.moveGrace(context.Background(), "egw", node)
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+	_, pending := r.movePending.Load("egw/node1")
+	assert.False(t, pending)
+
+	// the node without EIPs, or without lease, is removed at once
+	wait, err = r.moveGrace(context.Background(), "egw", egress.EgressIPStatus{Name: "node1"})
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+	wait, err = r.moveGrace(context.Background(), "egw", egress.EgressIPStatus{Name: "node2", Eips: node.Eips})
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+}
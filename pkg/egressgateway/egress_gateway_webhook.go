@@ -13,7 +13,9 @@ import (
 
 	admissionv1 "k8s.io/api/admission/v1"
 	v1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
@@ -21,6 +23,7 @@ import (
 	"github.com/spidernet-io/egressgateway/pkg/config"
 	"github.com/spidernet-io/egressgateway/pkg/constant"
 	egress "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/portblock"
 	"github.com/spidernet-io/egressgateway/pkg/utils/ip"
 )
 
@@ -146,6 +149,34 @@ func (egw *EgressGatewayWebhook) EgressGatewayValidate(ctx context.Context, req
 		return webhook.Denied(err.Error())
 	}
 
+	err = validateNodeAffinity(ctx, egw.Client, newEg, ipv4s, ipv6s)
+	if err != nil {
+		return webhook.Denied(err.Error())
+	}
+
+	err = validateUplinks(newEg, ipv4s, ipv6s)
+	if err != nil {
+		return webhook.Denied(err.Error())
+	}
+
+	err = validateVirtualRouterID(newEg, egwList)
+	if err != nil {
+		return webhook.Denied(err.Error())
+	}
+
+	if newEg.Spec.Snat.PortRange != "" {
+		if _, _, err := newEg.Spec.Snat.Ports(); err != nil {
+			return webhook.Denied(fmt.Sprintf("spec.snat.portRange: %v", err))
+		}
+	}
+	if size := int(newEg.Spec.Snat.PortBlockSize); size > 0 {
+		first, last, err := portblock.Range(newEg.Spec.Snat)
+		// the last block of the range is shared by the source IPs without a block
+		if err == nil && 2*size > last-first+1 {
+			return webhook.Denied(fmt.Sprintf("spec.snat.portBlockSize %d exceeds half of the port range %d-%d", size, first, last))
+		}
+	}
+
 	// only for update
 	if req.Operation == v1.Update {
 		oldEgressGateway := new(egress.EgressGateway)
@@ -197,6 +228,165 @@ func (egw *EgressGatewayWebhook) EgressGatewayValidate(ctx context.Context, req
 	return webhook.Allowed("checked")
 }
 
+// validateNodeAffinity checks the IPs of spec.ippools.nodeAffinity are covered by the ippools,
+// and every pinned EIP has at least one node selected by spec.nodeSelector.
+func validateNodeAffinity(ctx context.Context, cli client.Client, gateway *egress.EgressGateway, ipv4s, ipv6s []net.IP) error {
+	if len(gateway.Spec.Ippools.NodeAffinity) == 0 {
+		return nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(gateway.Spec.NodeSelector.Selector)
+	if err != nil {
+		return fmt.Errorf("failed to parse spec.nodeSelector.selector: %v", err)
+	}
+	nodeList := new(corev1.NodeList)
+	err = cli.List(ctx, nodeList, &client.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %v", err)
+	}
+	selected := make(map[string]struct{}, len(nodeList.Items))
+	for _, node := range nodeList.Items {
+		selected[node.Name] = struct{}{}
+	}
+
+	for i, item := range gateway.Spec.Ippools.NodeAffinity {
+		err := validateIPsCovered(fmt.Sprintf("spec.ippools.nodeAffinity[%d].ips", i), item.IPs, ipv4s, ipv6s)
+		if err != nil {
+			return err
+		}
+
+		eligible := false
+		for _, node := range item.Nodes {
+			if _, ok := selected[node]; ok {
+				eligible = true
+				break
+			}
+		}
+		if !eligible {
+			return fmt.Errorf("none of the nodes %v of spec.ippools.nodeAffinity[%d] is selected by spec.nodeSelector", item.Nodes, i)
+		}
+	}
+	return nil
+}
+
+// validateIPsCovered checks the single IPs, IP ranges or CIDRs are covered by the ippools
+func validateIPsCovered(field string, ipRanges []string, ipv4s, ipv6s []net.IP) error {
+	if len(ipRanges) == 0 {
+		return fmt.Errorf("%s is empty", field)
+	}
+	for _, ipRange := range ipRanges {
+		version := constant.IPv4
+		pool := ipv4s
+		if _, cidr, err := net.ParseCIDR(ipRange); err == nil {
+			if cidr.IP.To4() == nil {
+				version = constant.IPv6
+				pool = ipv6s
+			}
+		} else if ip.IsIPv6IPRange(ipRange) {
+			version = constant.IPv6
+			pool = ipv6s
+		} else if !ip.IsIPv4IPRange(ipRange) {
+			return fmt.Errorf("%s %s is not a valid IP, IP range or CIDR", field, ipRange)
+		}
+		ips, err := ip.ConvertCidrOrIPrangeToIPs([]string{ipRange}, version)
+		if err != nil {
+			return fmt.Errorf("%s %s: %v", field, ipRange, err)
+		}
+		if len(ip.IPsDiffSet(ips, pool, false)) > 0 {
+			return fmt.Errorf("%s %s is not covered by ippools", field, ipRange)
+		}
+	}
+	return nil
+}
+
+// validateUplinks checks the IPs of spec.ippools.uplinks are covered by the ippools,
+// and the next hops are valid IPs of their families.
+func validateUplinks(gateway *egress.EgressGateway, ipv4s, ipv6s []net.IP) error {
+	for i, item := range gateway.Spec.Ippools.Uplinks {
+		err := validateIPsCovered(fmt.Sprintf("spec.ippools.uplinks[%d].ips", i), item.IPs, ipv4s, ipv6s)
+		if err != nil {
+			return err
+		}
+		if item.Interface == "" {
+			return fmt.Errorf("spec.ippools.uplinks[%d].interface is empty", i)
+		}
+		if item.VlanID < 0 || item.VlanID > 4094 {
+			return fmt.Errorf("spec.ippools.uplinks[%d].vlanID %d is not in 1-4094", i, item.VlanID)
+		}
+		if item.NextHopIPv4 != "" {
+			if ok, _ := ip.IsIPv4(item.NextHopIPv4); !ok {
+				return fmt.Errorf("spec.ippools.uplinks[%d].nextHopIPv4 %s is not a valid IPv4", i, item.NextHopIPv4)
+			}
+		}
+		if item.NextHopIPv6 != "" {
+			if ok, _ := ip.IsIPv6(item.NextHopIPv6); !ok {
+				return fmt.Errorf("spec.ippools.uplinks[%d].nextHopIPv6 %s is not a valid IPv6", i, item.NextHopIPv6)
+			}
+		}
+	}
+	return nil
+}
+
+// validateVirtualRouterID checks the EIPs of the EgressGateway have different virtual router
+// ids, and the ids are not used by other EgressGateways, the EIPs would have the same
+// virtual MAC otherwise
+func validateVirtualRouterID(gateway *egress.EgressGateway, egwList *egress.EgressGatewayList) error {
+	if gateway.Spec.Ippools.VirtualRouterID == 0 {
+		return nil
+	}
+	ids, err := virtualRouterIDs(gateway)
+	if err != nil {
+		return err
+	}
+	for _, item := range egwList.Items {
+		if item.Name == gateway.Name || item.Spec.Ippools.VirtualRouterID == 0 {
+			continue
+		}
+		otherIDs, err := virtualRouterIDs(&item)
+		if err != nil {
+			return err
+		}
+		for version, items := range ids {
+			for id, eip := range items {
+				if other, ok := otherIDs[version][id]; ok {
+					return fmt.Errorf("spec.ippools.virtualRouterID %d of %s overlaps with %s of EgressGateway %s",
+						id, eip, other, item.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// virtualRouterIDs returns the EIPs of the EgressGateway by their virtual router ids, the
+// IPv4 and IPv6 EIPs have different virtual MACs, so their ids are apart
+func virtualRouterIDs(gateway *egress.EgressGateway) (map[constant.IPVersion]map[int]string, error) {
+	res := make(map[constant.IPVersion]map[int]string)
+	for version, ranges := range map[constant.IPVersion][]string{
+		constant.IPv4: gateway.Spec.Ippools.IPv4,
+		constant.IPv6: gateway.Spec.Ippools.IPv6,
+	} {
+		merged, err := ip.MergeIPRanges(version, ranges)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := ip.ParseIPRanges(version, merged)
+		if err != nil {
+			return nil, err
+		}
+		res[version] = make(map[int]string, len(ips))
+		for _, eip := range ips {
+			id := gateway.Spec.Ippools.EipVirtualRouterID(eip)
+			if other, ok := res[version][id]; ok {
+				return nil, fmt.Errorf("spec.ippools.virtualRouterID: %s and %s of EgressGateway %s have the same virtual router id %d",
+					other, eip, gateway.Name, id)
+			}
+			res[version][id] = eip.String()
+		}
+	}
+	return res, nil
+}
+
 func buildClusterIPMap(egwList *egress.EgressGatewayList, skipName string) (map[string]map[string]struct{}, error) {
 	res := make(map[string]map[string]struct{})
 	for _, item := range egwList.Items {
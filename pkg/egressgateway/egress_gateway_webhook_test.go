@@ -0,0 +1,44 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package egressgateway
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	egress "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+func TestValidateVirtualRouterID(t *testing.T) {
+	gateway := func(name string, id int32, ipv4 ...string) egress.EgressGateway {
+		return egress.EgressGateway{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       egress.EgressGatewaySpec{Ippools: egress.Ippools{IPv4: ipv4, VirtualRouterID: id}},
+		}
+	}
+	others := &egress.EgressGatewayList{Items: []egress.EgressGateway{
+		gateway("other", 1, "10.6.2.21-10.6.2.22"),
+		gateway("disabled", 0, "10.6.3.30"),
+	}}
+
+	cases := map[string]struct {
+		gateway egress.EgressGateway
+		err     bool
+	}{
+		"disabled":              {gateway: gateway("gw", 0, "10.6.1.21")},
+		"no overlap":            {gateway: gateway("gw", 1, "10.6.1.30-10.6.1.31")},
+		"overlap with other":    {gateway: gateway("gw", 1, "10.6.1.22"), err: true},
+		"id shifted":            {gateway: gateway("gw", 10, "10.6.1.21-10.6.1.22")},
+		"same id in the ippool": {gateway: gateway("gw", 1, "10.6.1.1", "10.6.2.1"), err: true},
+		"update itself":         {gateway: gateway("other", 1, "10.6.2.21-10.6.2.23")},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := validateVirtualRouterID(&c.gateway, others)
+			assert.Equal(t, c.err, err != nil, err)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package egressgateway
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	egress "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+// getPolicyObject fetches the policy recorded in the EgressGateway status, it is used as the
+// involved object of events, `kubectl describe` matches the events by the UID of the object.
+func (r *egnReconciler) getPolicyObject(ctx context.Context, p egress.Policy) (client.Object, error) {
+	var obj client.Object = new(egress.EgressClusterPolicy)
+	if p.Namespace != "" {
+		obj = new(egress.EgressPolicy)
+	}
+	if err := r.client.Get(ctx, types.NamespacedName{Namespace: p.Namespace, Name: p.Name}, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func eipString(ipv4, ipv6 string) string {
+	if ipv4 == "" && ipv6 == "" {
+		return "node IP"
+	}
+	return "EIP ipv4=" + ipv4 + " ipv6=" + ipv6
+}
+
+// recordAllocated records the EIP allocation on the policy and the EgressGateway
+func (r *egnReconciler) recordAllocated(gateway *egress.EgressGateway, policy runtime.Object, policyName string, assignedIP *AssignedIP) {
+	if r.recorder == nil || assignedIP == nil {
+		return
+	}
+	eip := eipString(assignedIP.IPv4, assignedIP.IPv6)
+	r.recorder.Eventf(policy, corev1.EventTypeNormal, egress.ReasonEIPAllocated,
+		"%s is allocated from EgressGateway %s on node %s", eip, gateway.Name, assignedIP.Node)
+	r.recorder.Eventf(gateway, corev1.EventTypeNormal, egress.ReasonEIPAllocated,
+		"%s is allocated to policy %s on node %s", eip, policyName, assignedIP.Node)
+}
+
+// recordAllocateFailed records the failure of assignIP, e.g. the ippool is exhausted, it is
+// called when the conditions of the policy change, so a failing allocation is not recorded
+// on every requeue
+func (r *egnReconciler) recordAllocateFailed(gateway *egress.EgressGateway, policy runtime.Object, policyName string, err error) {
+	if r.recorder == nil || err == nil {
+		return
+	}
+	reason := allocateFailedReason(err)
+	r.recorder.Eventf(policy, corev1.EventTypeWarning, reason, "failed to allocate EIP: %v", err)
+	r.recorder.Eventf(gateway, corev1.EventTypeWarning, reason, "failed to allocate EIP for policy %s: %v", policyName, err)
+}
+
+// recordReleased records the EIP release of a deleted policy on the EgressGateway
+func (r *egnReconciler) recordReleased(gateway *egress.EgressGateway, policyName string, assignedIP *AssignedIP) {
+	if r.recorder == nil || assignedIP == nil {
+		return
+	}
+	r.recorder.Eventf(gateway, corev1.EventTypeNormal, egress.ReasonEIPReleased,
+		"%s is released from policy %s on node %s", eipString(assignedIP.IPv4, assignedIP.IPv6), policyName, assignedIP.Node)
+}
+
+// recordMoved records the EIPs moved by failover or failback, stranded are the EIPs
+// which can not be moved because there is no ready node for them.
+func (r *egnReconciler) recordMoved(ctx context.Context, gateway *egress.EgressGateway, moves []eipMove, stranded []egress.Eips) {
+	if r.recorder == nil {
+		return
+	}
+	if len(stranded) > 0 {
+		r.recorder.Eventf(gateway, corev1.EventTypeWarning, egress.ReasonNoReadyGatewayNode,
+			"%d EIPs can not be moved, there is no ready gateway node for them", len(stranded))
+	}
+	for _, move := range moves {
+		msg := fmt.Sprintf("%s is moved to node %s", eipString(move.eip.IPv4, move.eip.IPv6), move.to)
+		if move.from != "" {
+			msg = fmt.Sprintf("%s is moved from node %s to node %s", eipString(move.eip.IPv4, move.eip.IPv6), move.from, move.to)
+		}
+		r.recorder.Event(gateway, corev1.EventTypeNormal, egress.ReasonEIPMoved, msg)
+		for _, p := range move.eip.Policies {
+			policy, err := r.getPolicyObject(ctx, p)
+			if err != nil {
+				r.log.V(1).Info("skip the event of the policy", "policy", p, "error", err)
+				continue
+			}
+			r.recorder.Event(policy, corev1.EventTypeNormal, egress.ReasonEIPMoved, msg)
+		}
+	}
+}
+
+// recordNodeStatus records the status change of a gateway node on the EgressGateway
+func (r *egnReconciler) recordNodeStatus(gateway *egress.EgressGateway, node string, phase egress.EgressTunnelPhase) {
+	if r.recorder == nil {
+		return
+	}
+	if phase == egress.EgressTunnelReady {
+		r.recorder.Eventf(gateway, corev1.EventTypeNormal, egress.ReasonTunnelReady, "gateway node %s is ready", node)
+		return
+	}
+	r.recorder.Eventf(gateway, corev1.EventTypeWarning, egress.ReasonNodeNotReady, "gateway node %s is not ready, status: %s", node, phase)
+}
@@ -0,0 +1,47 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package egressgateway
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	egress "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/schema"
+)
+
+func TestRecordAllocateFailedOnce(t *testing.T) {
+	gateway := &egress.EgressGateway{ObjectMeta: metav1.ObjectMeta{Name: "egw"}}
+	policy := &egress.EgressClusterPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "c1"},
+		Spec: egress.EgressClusterPolicySpec{
+			EgressGatewayName: "egw",
+			EgressIP:          egress.EgressIP{UseNodeIP: true},
+		},
+	}
+	cli := fake.NewClientBuilder().WithScheme(schema.GetScheme()).
+		WithObjects(gateway, policy).WithStatusSubresource(policy).Build()
+
+	recorder := record.NewFakeRecorder(100)
+	r := &egnReconciler{client: cli, log: logr.Discard(), recorder: recorder}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "c1"}}
+
+	// the gateway has no ready node, the failure is recorded on the policy and the gateway
+	_, err := r.reAssignEgressClusterPolicyIP(context.Background(), req, gateway, policy)
+	assert.Error(t, err)
+	assert.Len(t, recorder.Events, 2)
+
+	// the requeue with the same error records nothing
+	_, err = r.reAssignEgressClusterPolicyIP(context.Background(), req, gateway, policy)
+	assert.Error(t, err)
+	assert.Len(t, recorder.Events, 2)
+}
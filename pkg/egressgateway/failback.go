@@ -0,0 +1,188 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package egressgateway
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	egress "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+type eipMove struct {
+	eip  egress.Eips
+	from string
+	to   string
+}
+
+// failbackIfNeed runs the failback when the node of the tunnel turns ready, or when the
+// failback of the node is waiting for the delay. The heartbeats of a ready tunnel do not
+// trigger it, or the EIPs would keep moving in the rebalance mode.
+func (r *egnReconciler) failbackIfNeed(gateway *egress.EgressGateway, tunnel *egress.EgressTunnel, becameReady bool) ([]eipMove, time.Duration) {
+	key := gateway.Name + "/" + tunnel.Name
+	if _, pending := r.failbackPending.Load(key); !pending && !becameReady {
+		return nil, 0
+	}
+	moves, wait := failback(gateway, tunnel, time.Now())
+	if wait > 0 {
+		r.failbackPending.Store(key, struct{}{})
+	} else {
+		r.failbackPending.Delete(key)
+	}
+	return moves, wait
+}
+
+// failback applies the failback mode of the gateway when the EgressTunnel of one of its
+// nodes is ready. It returns the EIPs moved in the gateway status, or the time to wait
+// if the node has not been ready for spec.failback.delaySeconds.
+func failback(gateway *egress.EgressGateway, tunnel *egress.EgressTunnel, now time.Time) ([]eipMove, time.Duration) {
+	mode := gateway.Spec.Failback.Mode
+	if mode != egress.FailbackPreemptive && mode != egress.FailbackRebalance {
+		return nil, 0
+	}
+	if tunnel.Status.Phase != egress.EgressTunnelReady {
+		return nil, 0
+	}
+	found := false
+	for _, node := range gateway.Status.NodeList {
+		if node.Name == tunnel.Name && egress.EgressTunnelReady.IsEqual(node.Status) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, 0
+	}
+
+	if delay := time.Duration(gateway.Spec.Failback.DelaySeconds) * time.Second; delay > 0 {
+		readySince := now
+		cond := meta.FindStatusCondition(tunnel.Status.Conditions, egress.ConditionProgrammed)
+		if cond != nil && cond.Status == metav1.ConditionTrue {
+			readySince = cond.LastTransitionTime.Time
+		}
+		if wait := readySince.Add(delay).Sub(now); wait > 0 {
+			return nil, wait
+		}
+	}
+
+	if mode == egress.FailbackPreemptive {
+		return failbackToHomeNode(gateway, tunnel.Name), 0
+	}
+	return rebalanceEips(gateway), 0
+}
+
+// withHomeNode remembers the node the EIPs are placed on before they are moved by the
+// failover, the preemptive failback moves them back to it
+func withHomeNode(eips []egress.Eips, node string) []egress.Eips {
+	res := make([]egress.Eips, 0, len(eips))
+	for _, eip := range eips {
+		if eip.HomeNode == "" {
+			eip.HomeNode = node
+		}
+		res = append(res, eip)
+	}
+	return res
+}
+
+// failbackToHomeNode moves the EIPs whose home node is the given node back to it
+func failbackToHomeNode(gateway *egress.EgressGateway, home string) []eipMove {
+	homeIndex := -1
+	for i, node := range gateway.Status.NodeList {
+		if node.Name == home {
+			homeIndex = i
+			break
+		}
+	}
+	if homeIndex == -1 {
+		return nil
+	}
+
+	var moves []eipMove
+	for i, node := range gateway.Status.NodeList {
+		if i == homeIndex {
+			continue
+		}
+		keep := make([]egress.Eips, 0, len(node.Eips))
+		for _, eip := range node.Eips {
+			if eip.HomeNode != home || isNodeIPEip(eip) ||
+				!eipNodeAllowed(gateway.Spec.Ippools, eip.IPv4, eip.IPv6, home) {
+				keep = append(keep, eip)
+				continue
+			}
+			eip.HomeNode = ""
+			gateway.Status.NodeList[homeIndex].Eips = append(gateway.Status.NodeList[homeIndex].Eips, eip)
+			moves = append(moves, eipMove{eip: eip, from: node.Name, to: home})
+		}
+		gateway.Status.NodeList[i].Eips = keep
+	}
+	return moves
+}
+
+// rebalanceEips evens out the EIP counts across the ready nodes, the node IP entries
+// are bound to their node and never moved, the EIPs are only moved to the nodes allowed
+// by spec.ippools.nodeAffinity.
+func rebalanceEips(gateway *egress.EgressGateway) []eipMove {
+	var moves []eipMove
+	// pinned are the nodes whose EIPs can not be moved to the least busy node
+	pinned := make(map[int]struct{})
+	for {
+		maxIndex, minIndex := -1, -1
+		maxCount, minCount := 0, 0
+		for i, node := range gateway.Status.NodeList {
+			if !egress.EgressTunnelReady.IsEqual(node.Status) {
+				continue
+			}
+			count := countMovableEips(node.Eips)
+			if _, ok := pinned[i]; !ok && (maxIndex == -1 || count > maxCount) {
+				maxIndex, maxCount = i, count
+			}
+			if minIndex == -1 || count < minCount {
+				minIndex, minCount = i, count
+			}
+		}
+		if maxIndex == -1 || maxCount-minCount <= 1 {
+			return moves
+		}
+
+		from := &gateway.Status.NodeList[maxIndex]
+		to := &gateway.Status.NodeList[minIndex]
+		moved := false
+		for i := len(from.Eips) - 1; i >= 0; i-- {
+			eip := from.Eips[i]
+			if isNodeIPEip(eip) || !eipNodeAllowed(gateway.Spec.Ippools, eip.IPv4, eip.IPv6, to.Name) {
+				continue
+			}
+			from.Eips = append(from.Eips[:i], from.Eips[i+1:]...)
+			eip.HomeNode = ""
+			to.Eips = append(to.Eips, eip)
+			moves = append(moves, eipMove{eip: eip, from: from.Name, to: to.Name})
+			moved = true
+			break
+		}
+		if !moved {
+			// the EIPs of the busiest node are pinned to other nodes, try the next busiest one
+			pinned[maxIndex] = struct{}{}
+			continue
+		}
+		// the moves change the least busy node, the pinned nodes may be movable again
+		pinned = make(map[int]struct{})
+	}
+}
+
+func countMovableEips(eips []egress.Eips) int {
+	count := 0
+	for _, eip := range eips {
+		if !isNodeIPEip(eip) {
+			count++
+		}
+	}
+	return count
+}
+
+// isNodeIPEip the entry groups the policies which use the node IP
+func isNodeIPEip(eip egress.Eips) bool {
+	return eip.IPv4 == "" && eip.IPv6 == ""
+}
@@ -0,0 +1,169 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package egressgateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	egress "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/utils"
+)
+
+func readyTunnel(name string, since time.Time) *egress.EgressTunnel {
+	return &egress.EgressTunnel{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: egress.EgressTunnelStatus{
+			Phase: egress.EgressTunnelReady,
+			Conditions: []metav1.Condition{{
+				Type:               egress.ConditionProgrammed,
+				Status:             metav1.ConditionTrue,
+				LastTransitionTime: metav1.NewTime(since),
+			}},
+		},
+	}
+}
+
+func TestFailback(t *testing.T) {
+	now := time.Now()
+
+	cases := map[string]struct {
+		gateway  *egress.EgressGateway
+		tunnel   *egress.EgressTunnel
+		expMoves int
+		expWait  bool
+		expEips  map[string]int
+	}{
+		"none": {
+			gateway: &egress.EgressGateway{
+				Status: egress.EgressGatewayStatus{NodeList: []egress.EgressIPStatus{
+					{Name: "node1", Status: "Ready"},
+					{Name: "node2", Status: "Ready", Eips: []egress.Eips{{IPv4: "10.6.1.1", HomeNode: "node1"}}},
+				}},
+			},
+			tunnel:  readyTunnel("node1", now.Add(-time.Hour)),
+			expEips: map[string]int{"node1": 0, "node2": 1},
+		},
+		"preemptive waits for the delay": {
+			gateway: &egress.EgressGateway{
+				Spec: egress.EgressGatewaySpec{Failback: egress.Failback{Mode: egress.FailbackPreemptive, DelaySeconds: 60}},
+				Status: egress.EgressGatewayStatus{NodeList: []egress.EgressIPStatus{
+					{Name: "node1", Status: "Ready"},
+					{Name: "node2", Status: "Ready", Eips: []egress.Eips{{IPv4: "10.6.1.1", HomeNode: "node1"}}},
+				}},
+			},
+			tunnel:  readyTunnel("node1", now.Add(-time.Second*10)),
+			expWait: true,
+			expEips: map[string]int{"node1": 0, "node2": 1},
+		},
+		"preemptive moves back to the home node": {
+			gateway: &egress.EgressGateway{
+				Spec: egress.EgressGatewaySpec{Failback: egress.Failback{Mode: egress.FailbackPreemptive, DelaySeconds: 60}},
+				Status: egress.EgressGatewayStatus{NodeList: []egress.EgressIPStatus{
+					{Name: "node1", Status: "Ready"},
+					{Name: "node2", Status: "Ready", Eips: []egress.Eips{
+						{IPv4: "10.6.1.1", HomeNode: "node1"},
+						{IPv4: "10.6.1.2"},
+						{Policies: []egress.Policy{{Name: "p1"}}, HomeNode: "node1"},
+					}},
+				}},
+			},
+			tunnel:   readyTunnel("node1", now.Add(-time.Minute*2)),
+			expMoves: 1,
+			expEips:  map[string]int{"node1": 1, "node2": 2},
+		},
+		"rebalance": {
+			gateway: &egress.EgressGateway{
+				Spec: egress.EgressGatewaySpec{Failback: egress.Failback{Mode: egress.FailbackRebalance}},
+				Status: egress.EgressGatewayStatus{NodeList: []egress.EgressIPStatus{
+					{Name: "node1", Status: "Ready"},
+					{Name: "node2", Status: "Ready", Eips: []egress.Eips{
+						{IPv4: "10.6.1.1"}, {IPv4: "10.6.1.2"}, {IPv4: "10.6.1.3"}, {IPv4: "10.6.1.4"},
+					}},
+					{Name: "node3", Status: "HeartbeatTimeout"},
+				}},
+			},
+			tunnel:   readyTunnel("node1", now),
+			expMoves: 2,
+			expEips:  map[string]int{"node1": 2, "node2": 2, "node3": 0},
+		},
+		"rebalance skips the pinned node": {
+			gateway: &egress.EgressGateway{
+				Spec: egress.EgressGatewaySpec{
+					Failback: egress.Failback{Mode: egress.FailbackRebalance},
+					Ippools: egress.Ippools{NodeAffinity: []egress.EipNodeAffinity{
+						{IPs: []string{"10.6.1.1-10.6.1.4"}, Nodes: []string{"node2"}},
+					}},
+				},
+				Status: egress.EgressGatewayStatus{NodeList: []egress.EgressIPStatus{
+					{Name: "node1", Status: "Ready"},
+					{Name: "node2", Status: "Ready", Eips: []egress.Eips{
+						{IPv4: "10.6.1.1"}, {IPv4: "10.6.1.2"}, {IPv4: "10.6.1.3"}, {IPv4: "10.6.1.4"},
+					}},
+					{Name: "node3", Status: "Ready", Eips: []egress.Eips{
+						{IPv4: "10.6.1.5"}, {IPv4: "10.6.1.6"}, {IPv4: "10.6.1.7"},
+					}},
+				}},
+			},
+			tunnel:   readyTunnel("node1", now),
+			expMoves: 1,
+			expEips:  map[string]int{"node1": 1, "node2": 4, "node3": 2},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			moves, wait := failback(c.gateway, c.tunnel, now)
+			assert.Equal(t, c.expMoves, len(moves))
+			assert.Equal(t, c.expWait, wait > 0)
+			for _, node := range c.gateway.Status.NodeList {
+				assert.Equal(t, c.expEips[node.Name], len(node.Eips), node.Name)
+				for _, eip := range node.Eips {
+					if eip.IPv4 != "" && node.Name == "node1" {
+						assert.Empty(t, eip.HomeNode)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFailbackIfNeed(t *testing.T) {
+	r := &egnReconciler{failbackPending: utils.NewSyncMap[string, struct{}]()}
+	newGateway := func() *egress.EgressGateway {
+		return &egress.EgressGateway{
+			ObjectMeta: metav1.ObjectMeta{Name: "gw1"},
+			Spec:       egress.EgressGatewaySpec{Failback: egress.Failback{Mode: egress.FailbackRebalance, DelaySeconds: 60}},
+			Status: egress.EgressGatewayStatus{NodeList: []egress.EgressIPStatus{
+				{Name: "node1", Status: "Ready"},
+				{Name: "node2", Status: "Ready", Eips: []egress.Eips{{IPv4: "10.6.1.1"}, {IPv4: "10.6.1.2"}}},
+			}},
+		}
+	}
+
+	// the heartbeats of a ready tunnel do not trigger the failback
+	moves, wait := r.failbackIfNeed(newGateway(), readyTunnel("node1", time.Now().Add(-time.Hour)), false)
+	assert.Empty(t, moves)
+	assert.Zero(t, wait)
+
+	// the node turns ready, the failback waits for the delay
+	moves, wait = r.failbackIfNeed(newGateway(), readyTunnel("node1", time.Now()), true)
+	assert.Empty(t, moves)
+	assert.True(t, wait > 0)
+
+	// the requeue after the delay runs the pending failback once
+	moves, _ = r.failbackIfNeed(newGateway(), readyTunnel("node1", time.Now().Add(-time.Hour)), false)
+	assert.Len(t, moves, 1)
+	moves, _ = r.failbackIfNeed(newGateway(), readyTunnel("node1", time.Now().Add(-time.Hour)), false)
+	assert.Empty(t, moves)
+}
+
+func TestWithHomeNode(t *testing.T) {
+	eips := withHomeNode([]egress.Eips{{IPv4: "10.6.1.1"}, {IPv4: "10.6.1.2", HomeNode: "node3"}}, "node1")
+	assert.Equal(t, "node1", eips[0].HomeNode)
+	assert.Equal(t, "node3", eips[1].HomeNode)
+}
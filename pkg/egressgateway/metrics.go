@@ -0,0 +1,33 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package egressgateway
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	egress "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+var gaugePolicyBlocked = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "egress_policy_blocked",
+	Help: "Whether the traffic of the policy with the closed failurePolicy is blocked, 1 is blocked.",
+}, []string{"namespace", "name"})
+
+var PolicyMetricCollectors = []prometheus.Collector{
+	gaugePolicyBlocked,
+}
+
+// setPolicyBlocked exports the blocked state of the policy, only the policies with the
+// closed failurePolicy are exported
+func setPolicyBlocked(namespace, name, failurePolicy string, blocked bool) {
+	if failurePolicy != egress.FailurePolicyClosed {
+		gaugePolicyBlocked.DeleteLabelValues(namespace, name)
+		return
+	}
+	value := 0.0
+	if blocked {
+		value = 1
+	}
+	gaugePolicyBlocked.WithLabelValues(namespace, name).Set(value)
+}
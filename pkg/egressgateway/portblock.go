@@ -0,0 +1,243 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package egressgateway
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/spidernet-io/egressgateway/pkg/config"
+	egress "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/portblock"
+)
+
+// portBlockReconciler maintains the port block allocation table of the EgressGateway, which
+// gives each source IP of the policies a fixed block of the source ports of their EIP. Every
+// allocated and released block is logged, so the owner of a connection from an EIP can be
+// traced afterwards.
+type portBlockReconciler struct {
+	client    client.Client
+	log       logr.Logger
+	namespace string
+	recorder  record.EventRecorder
+}
+
+func (r *portBlockReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	log := r.log.WithValues("name", req.Name)
+	log.V(1).Info("reconcile")
+
+	cm := new(corev1.ConfigMap)
+	cmKey := types.NamespacedName{Namespace: r.namespace, Name: portblock.ConfigMapName(req.Name)}
+	err := r.client.Get(ctx, cmKey, cm)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return reconcile.Result{}, err
+		}
+		cm = nil
+	}
+	var existing []portblock.Block
+	if cm != nil {
+		existing, err = portblock.Decode(cm)
+		if err != nil {
+			log.Error(err, "discard the invalid port block allocation table")
+		}
+	}
+
+	gateway := new(egress.EgressGateway)
+	err = r.client.Get(ctx, req.NamespacedName, gateway)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return reconcile.Result{}, err
+		}
+		gateway = nil
+	}
+	if gateway == nil || gateway.Spec.Snat.PortBlockSize == 0 {
+		if cm == nil {
+			return reconcile.Result{}, nil
+		}
+		logBlocks(log, nil, existing)
+		return reconcile.Result{}, client.IgnoreNotFound(r.client.Delete(ctx, cm))
+	}
+
+	first, last, err := portblock.Range(gateway.Spec.Snat)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	size := int(gateway.Spec.Snat.PortBlockSize)
+
+	var blocks []portblock.Block
+	for _, node := range gateway.Status.NodeList {
+		for _, eip := range node.Eips {
+			ipv4, ipv6, err := r.eipSources(ctx, eip.Policies)
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+			for _, item := range []struct {
+				eip     string
+				sources []portblock.Source
+			}{{eip.IPv4, ipv4}, {eip.IPv6, ipv6}} {
+				if item.eip == "" {
+					continue
+				}
+				allocated, exhausted := portblock.Allocate(item.eip, existing, item.sources, first, last, size)
+				blocks = append(blocks, allocated...)
+				if len(exhausted) > 0 {
+					log.Info("port blocks of the EIP are exhausted", "eip", item.eip, "sources", len(exhausted))
+					r.recorder.Eventf(gateway, corev1.EventTypeWarning, "PortBlocksExhausted",
+						"port blocks of %s are exhausted, %d source IPs share the ports %s", item.eip, len(exhausted),
+						portblock.Fallback(first, last, size))
+				}
+			}
+		}
+	}
+	portblock.Sort(blocks)
+
+	data, err := portblock.Encode(blocks)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if cm != nil && cm.Data[portblock.DataKey] == data {
+		return reconcile.Result{}, nil
+	}
+	if cm == nil {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: cmKey.Namespace,
+			Name:      cmKey.Name,
+			Labels:    map[string]string{portblock.LabelPortBlocks: gateway.Name},
+		}}
+		if err := controllerutil.SetControllerReference(gateway, cm, r.client.Scheme()); err != nil {
+			return reconcile.Result{}, err
+		}
+		cm.Data = map[string]string{portblock.DataKey: data}
+		err = r.client.Create(ctx, cm)
+	} else {
+		cm.Data = map[string]string{portblock.DataKey: data}
+		err = r.client.Update(ctx, cm)
+	}
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to update port block allocation table: %w", err)
+	}
+	logBlocks(log, blocks, existing)
+	return reconcile.Result{}, nil
+}
+
+// eipSources returns the IPv4 and IPv6 source IPs of the policies
+func (r *portBlockReconciler) eipSources(ctx context.Context, policies []egress.Policy) ([]portblock.Source, []portblock.Source, error) {
+	var ipv4, ipv6 []portblock.Source
+	for _, p := range policies {
+		selector := client.MatchingLabels{egress.LabelPolicyName: p.Name}
+		var endpoints []egress.EgressEndpoint
+		policy := p.Name
+		if p.Namespace != "" {
+			policy = p.Namespace + "/" + p.Name
+			slices := new(egress.EgressEndpointSliceList)
+			if err := r.client.List(ctx, slices, client.InNamespace(p.Namespace), selector); err != nil {
+				return nil, nil, fmt.Errorf("failed to list endpoint slices of %s: %w", policy, err)
+			}
+			for _, item := range slices.Items {
+				endpoints = append(endpoints, item.Endpoints...)
+			}
+		} else {
+			slices := new(egress.EgressClusterEndpointSliceList)
+			if err := r.client.List(ctx, slices, selector); err != nil {
+				return nil, nil, fmt.Errorf("failed to list cluster endpoint slices of %s: %w", policy, err)
+			}
+			for _, item := range slices.Items {
+				endpoints = append(endpoints, item.Endpoints...)
+			}
+		}
+		for _, ep := range endpoints {
+			pod := ep.Namespace + "/" + ep.Pod
+			if ep.Pod == "" {
+				// the host network of the node has no pod
+				pod = ""
+			}
+			for _, ip := range ep.IPv4 {
+				ipv4 = append(ipv4, portblock.Source{IP: ip, Policy: policy, Pod: pod})
+			}
+			for _, ip := range ep.IPv6 {
+				ipv6 = append(ipv6, portblock.Source{IP: ip, Policy: policy, Pod: pod})
+			}
+		}
+	}
+	return ipv4, ipv6, nil
+}
+
+// logBlocks logs the NAT mappings which are allocated and released
+func logBlocks(log logr.Logger, cur, old []portblock.Block) {
+	allocated, released := portblock.Diff(old, cur)
+	for _, b := range released {
+		log.Info("release snat port block", "eip", b.EIP, "ports", b.Ports, "source", b.Source, "pod", b.Pod, "policy", b.Policy)
+	}
+	for _, b := range allocated {
+		log.Info("allocate snat port block", "eip", b.EIP, "ports", b.Ports, "source", b.Source, "pod", b.Pod, "policy", b.Policy)
+	}
+}
+
+// NewPortBlockController returns the controller which maintains the port block allocation
+// tables of the EgressGateways
+func NewPortBlockController(mgr manager.Manager, log logr.Logger, cfg *config.Config) error {
+	r := &portBlockReconciler{
+		client:    mgr.GetClient(),
+		log:       log.WithName("port-block"),
+		namespace: cfg.PodNamespace,
+		recorder:  mgr.GetEventRecorderFor("port-block"),
+	}
+	c, err := controller.New("portBlock", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+	if err := c.Watch(source.Kind(mgr.GetCache(), &egress.EgressGateway{}), &handler.EnqueueRequestForObject{}); err != nil {
+		return fmt.Errorf("failed to watch EgressGateway: %w", err)
+	}
+	if err := c.Watch(source.Kind(mgr.GetCache(), &egress.EgressEndpointSlice{}),
+		handler.EnqueueRequestsFromMapFunc(r.sliceGateway)); err != nil {
+		return fmt.Errorf("failed to watch EgressEndpointSlice: %w", err)
+	}
+	if err := c.Watch(source.Kind(mgr.GetCache(), &egress.EgressClusterEndpointSlice{}),
+		handler.EnqueueRequestsFromMapFunc(r.sliceGateway)); err != nil {
+		return fmt.Errorf("failed to watch EgressClusterEndpointSlice: %w", err)
+	}
+	return nil
+}
+
+// sliceGateway maps the endpoint slice to the EgressGateway of its policy
+func (r *portBlockReconciler) sliceGateway(ctx context.Context, obj client.Object) []reconcile.Request {
+	name, ok := obj.GetLabels()[egress.LabelPolicyName]
+	if !ok {
+		return nil
+	}
+	var gateway string
+	if obj.GetNamespace() != "" {
+		policy := new(egress.EgressPolicy)
+		if err := r.client.Get(ctx, types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}, policy); err != nil {
+			return nil
+		}
+		gateway = policy.Spec.EgressGatewayName
+	} else {
+		policy := new(egress.EgressClusterPolicy)
+		if err := r.client.Get(ctx, types.NamespacedName{Name: name}, policy); err != nil {
+			return nil
+		}
+		gateway = policy.Spec.EgressGatewayName
+	}
+	if gateway == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: gateway}}}
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package egressgateway
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	egress "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/portblock"
+	"github.com/spidernet-io/egressgateway/pkg/schema"
+)
+
+func TestPortBlockReconcile(t *testing.T) {
+	gateway := &egress.EgressGateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "egw"},
+		Spec:       egress.EgressGatewaySpec{Snat: egress.Snat{PortRange: "20000-21499", PortBlockSize: 500}},
+		Status: egress.EgressGatewayStatus{NodeList: []egress.EgressIPStatus{
+			{Name: "node1", Eips: []egress.Eips{
+				{IPv4: "10.6.1.21", Policies: []egress.Policy{{Name: "p1", Namespace: "default"}, {Name: "c1"}}},
+			}},
+		}},
+	}
+	slice := &egress.EgressEndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Name: "p1-abc", Namespace: "default", Labels: map[string]string{egress.LabelPolicyName: "p1"}},
+		Endpoints: []egress.EgressEndpoint{
+			{Namespace: "default", Pod: "a", IPv4: []string{"10.21.0.9"}},
+			{Namespace: "default", Pod: "b", IPv4: []string{"10.21.0.10"}},
+		},
+	}
+	clusterSlice := &egress.EgressClusterEndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Name: "c1-abc", Labels: map[string]string{egress.LabelPolicyName: "c1"}},
+		Endpoints: []egress.EgressEndpoint{
+			{Namespace: "kube-system", Pod: "c", IPv4: []string{"10.21.0.11"}},
+		},
+	}
+	cli := fake.NewClientBuilder().WithScheme(schema.GetScheme()).
+		WithObjects(gateway, slice, clusterSlice).Build()
+
+	recorder := record.NewFakeRecorder(100)
+	r := &portBlockReconciler{
+		client:    cli,
+		log:       logr.Discard(),
+		namespace: "egressgateway",
+		recorder:  recorder,
+	}
+	ctx := context.Background()
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "egw"}}
+	cmKey := types.NamespacedName{Namespace: "egressgateway", Name: portblock.ConfigMapName("egw")}
+	blocks := func() []portblock.Block {
+		cm := new(corev1.ConfigMap)
+		assert.NoError(t, cli.Get(ctx, cmKey, cm))
+		assert.Equal(t, "egw", cm.Labels[portblock.LabelPortBlocks])
+		res, err := portblock.Decode(cm)
+		assert.NoError(t, err)
+		return res
+	}
+
+	// the third source gets no block
+	_, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, []portblock.Block{
+		{EIP: "10.6.1.21", Source: "10.21.0.9", Ports: "20000-20499", Policy: "default/p1", Pod: "default/a"},
+		{EIP: "10.6.1.21", Source: "10.21.0.10", Ports: "20500-20999", Policy: "default/p1", Pod: "default/b"},
+	}, blocks())
+	assert.Len(t, recorder.Events, 1)
+
+	// the block of the deleted pod is given to the waiting source
+	slice.Endpoints = slice.Endpoints[1:]
+	assert.NoError(t, cli.Update(ctx, slice))
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, []portblock.Block{
+		{EIP: "10.6.1.21", Source: "10.21.0.11", Ports: "20000-20499", Policy: "c1", Pod: "kube-system/c"},
+		{EIP: "10.6.1.21", Source: "10.21.0.10", Ports: "20500-20999", Policy: "default/p1", Pod: "default/b"},
+	}, blocks())
+
+	// the port block is disabled
+	assert.NoError(t, cli.Get(ctx, req.NamespacedName, gateway))
+	gateway.Spec.Snat.PortBlockSize = 0
+	assert.NoError(t, cli.Update(ctx, gateway))
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	err = cli.Get(ctx, cmKey, new(corev1.ConfigMap))
+	assert.True(t, apierrors.IsNotFound(err))
+}
@@ -0,0 +1,293 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package egressgateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/spidernet-io/egressgateway/pkg/config"
+	"github.com/spidernet-io/egressgateway/pkg/eipprovider"
+	egress "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/utils"
+)
+
+// attachedAnnotation is the annotation of the EgressGateway with the EIPs attached by the
+// eip provider, the EIPs released or moved while the controller is down are diffed against
+// it after the controller restarts
+const attachedAnnotation = "egressgateway.spidernet.io/attached-eips"
+
+// attachment is an EIP of the EgressGateway and the node it is placed on
+type attachment struct {
+	ipv4     string
+	ipv6     string
+	node     string
+	policies []egress.Policy
+}
+
+// attachedEip is an EIP in the attachedAnnotation
+type attachedEip struct {
+	IPv4 string `json:"ipv4,omitempty"`
+	IPv6 string `json:"ipv6,omitempty"`
+	Node string `json:"node"`
+}
+
+// eipProviderReconciler calls the eip provider when the EIPs in the EgressGateway status
+// are allocated, moved or released, and reflects the result in the policy conditions
+type eipProviderReconciler struct {
+	client   client.Client
+	log      logr.Logger
+	provider eipprovider.Provider
+	recorder record.EventRecorder
+	// attached is the EIPs attached by the provider of the EgressGateways, it is loaded
+	// from the attachedAnnotation when the EgressGateway is reconciled for the first time
+	attached map[string]map[string]attachment
+	// failures is the last error of attaching the EIPs of the EgressGateways, the
+	// AttachFailed event is only recorded when the error changes
+	failures map[string]map[string]string
+}
+
+func (r *eipProviderReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	log := r.log.WithValues("name", req.Name)
+	log.V(1).Info("reconcile")
+
+	desired := make(map[string]attachment)
+	gateway := new(egress.EgressGateway)
+	err := r.client.Get(ctx, req.NamespacedName, gateway)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return reconcile.Result{}, err
+		}
+		gateway = nil
+	} else {
+		desired = gatewayAttachments(gateway)
+	}
+
+	attached, ok := r.attached[req.Name]
+	if !ok {
+		attached = loadAttachments(gateway, log)
+	}
+	failures := r.failures[req.Name]
+	if failures == nil {
+		failures = make(map[string]string)
+	}
+	for key := range failures {
+		if _, ok := desired[key]; !ok {
+			delete(failures, key)
+		}
+	}
+	failed := make(map[string]error)
+	for key, cur := range attached {
+		if _, ok := desired[key]; ok {
+			continue
+		}
+		event := eipprovider.Event{Gateway: req.Name, IPv4: cur.ipv4, IPv6: cur.ipv6, Node: cur.node}
+		if err := r.provider.Release(ctx, event); err != nil {
+			log.Error(err, "failed to release EIP", "ipv4", cur.ipv4, "ipv6", cur.ipv6)
+			failed[key] = err
+			continue
+		}
+		log.Info("EIP is released by eip provider", "ipv4", cur.ipv4, "ipv6", cur.ipv6, "node", cur.node)
+		delete(attached, key)
+	}
+	for key, want := range desired {
+		event := eipprovider.Event{Gateway: req.Name, IPv4: want.ipv4, IPv6: want.ipv6, Node: want.node}
+		cur, ok := attached[key]
+		switch {
+		case !ok:
+			err = r.provider.Allocate(ctx, event)
+		case cur.node != want.node:
+			event.PreviousNode = cur.node
+			err = r.provider.Move(ctx, event)
+		default:
+			err = nil
+		}
+		if err != nil {
+			log.Error(err, "failed to attach EIP", "ipv4", want.ipv4, "ipv6", want.ipv6, "node", want.node)
+			failed[key] = err
+			if gateway != nil && failures[key] != err.Error() {
+				r.recorder.Eventf(gateway, corev1.EventTypeWarning, egress.ReasonAttachFailed,
+					"failed to attach %s to node %s: %v", eipString(want.ipv4, want.ipv6), want.node, err)
+			}
+			failures[key] = err.Error()
+			continue
+		}
+		delete(failures, key)
+		attached[key] = want
+	}
+
+	var errs []error
+	if gateway != nil {
+		if err := r.saveAttachments(ctx, gateway, attached); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(attached) == 0 && gateway == nil {
+		delete(r.attached, req.Name)
+	} else {
+		r.attached[req.Name] = attached
+	}
+	if len(failures) == 0 {
+		delete(r.failures, req.Name)
+	} else {
+		r.failures[req.Name] = failures
+	}
+
+	for key, want := range desired {
+		for _, p := range want.policies {
+			if err := r.setAttachedCondition(ctx, p, want, failed[key]); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	for _, err := range failed {
+		errs = append(errs, err)
+	}
+	return reconcile.Result{}, errors.Join(errs...)
+}
+
+// gatewayAttachments returns the EIPs placed on the nodes of the EgressGateway, the
+// policies which use the node IP are skipped
+func gatewayAttachments(gateway *egress.EgressGateway) map[string]attachment {
+	res := make(map[string]attachment)
+	for _, node := range gateway.Status.NodeList {
+		for _, eip := range node.Eips {
+			if eip.IPv4 == "" && eip.IPv6 == "" {
+				continue
+			}
+			res[eip.IPv4+"/"+eip.IPv6] = attachment{ipv4: eip.IPv4, ipv6: eip.IPv6, node: node.Name, policies: eip.Policies}
+		}
+	}
+	return res
+}
+
+// loadAttachments returns the EIPs in the attachedAnnotation of the EgressGateway
+func loadAttachments(gateway *egress.EgressGateway, log logr.Logger) map[string]attachment {
+	res := make(map[string]attachment)
+	if gateway == nil || gateway.Annotations[attachedAnnotation] == "" {
+		return res
+	}
+	var eips []attachedEip
+	if err := json.Unmarshal([]byte(gateway.Annotations[attachedAnnotation]), &eips); err != nil {
+		log.Error(err, "failed to parse the attached EIPs, all the EIPs are allocated again")
+		return res
+	}
+	for _, eip := range eips {
+		res[eip.IPv4+"/"+eip.IPv6] = attachment{ipv4: eip.IPv4, ipv6: eip.IPv6, node: eip.Node}
+	}
+	return res
+}
+
+// saveAttachments stores the attached EIPs in the attachedAnnotation of the EgressGateway
+func (r *eipProviderReconciler) saveAttachments(ctx context.Context, gateway *egress.EgressGateway, attached map[string]attachment) error {
+	eips := make([]attachedEip, 0, len(attached))
+	for _, item := range attached {
+		eips = append(eips, attachedEip{IPv4: item.ipv4, IPv6: item.ipv6, Node: item.node})
+	}
+	sort.Slice(eips, func(i, j int) bool {
+		return eips[i].IPv4+"/"+eips[i].IPv6 < eips[j].IPv4+"/"+eips[j].IPv6
+	})
+	value := ""
+	if len(eips) > 0 {
+		raw, err := json.Marshal(eips)
+		if err != nil {
+			return err
+		}
+		value = string(raw)
+	}
+	if gateway.Annotations[attachedAnnotation] == value {
+		return nil
+	}
+	if value == "" {
+		delete(gateway.Annotations, attachedAnnotation)
+	} else {
+		if gateway.Annotations == nil {
+			gateway.Annotations = make(map[string]string)
+		}
+		gateway.Annotations[attachedAnnotation] = value
+	}
+	if err := r.client.Update(ctx, gateway); err != nil {
+		return fmt.Errorf("failed to save the attached EIPs of EgressGateway %s: %w", gateway.Name, err)
+	}
+	return nil
+}
+
+// setAttachedCondition sets the EIPAttached condition of the policy
+func (r *eipProviderReconciler) setAttachedCondition(ctx context.Context, p egress.Policy, eip attachment, attachErr error) error {
+	cond := utils.NewCondition(egress.ConditionEIPAttached, true, egress.ReasonAttached,
+		fmt.Sprintf("%s is attached to node %s", eipString(eip.ipv4, eip.ipv6), eip.node))
+	if attachErr != nil {
+		cond = utils.NewCondition(egress.ConditionEIPAttached, false, egress.ReasonAttachFailed, attachErr.Error())
+	}
+
+	var obj client.Object
+	var status *egress.EgressPolicyStatus
+	var generation int64
+	key := types.NamespacedName{Namespace: p.Namespace, Name: p.Name}
+	if p.Namespace != "" {
+		policy := new(egress.EgressPolicy)
+		if err := r.client.Get(ctx, key, policy); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		obj, status, generation = policy, &policy.Status, policy.Generation
+	} else {
+		policy := new(egress.EgressClusterPolicy)
+		if err := r.client.Get(ctx, key, policy); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		obj, status, generation = policy, &policy.Status, policy.Generation
+	}
+
+	// the observedGeneration of the status is maintained by the egress gateway controller
+	cond.ObservedGeneration = generation
+	if !meta.SetStatusCondition(&status.Conditions, cond) {
+		return nil
+	}
+	return r.client.Status().Update(ctx, obj)
+}
+
+// NewEipProviderController returns the controller which calls the eip provider, it is not
+// created if no eip provider is configured
+func NewEipProviderController(mgr manager.Manager, log logr.Logger, cfg *config.Config) error {
+	provider, err := eipprovider.New(cfg.FileConfig.EipProvider)
+	if err != nil {
+		return err
+	}
+	if provider == nil {
+		return nil
+	}
+
+	r := &eipProviderReconciler{
+		client:   mgr.GetClient(),
+		log:      log.WithName("eip-provider"),
+		provider: provider,
+		recorder: mgr.GetEventRecorderFor("eip-provider"),
+		attached: make(map[string]map[string]attachment),
+		failures: make(map[string]map[string]string),
+	}
+	c, err := controller.New("eipProvider", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+	if err := c.Watch(source.Kind(mgr.GetCache(), &egress.EgressGateway{}), &handler.EnqueueRequestForObject{}); err != nil {
+		return fmt.Errorf("failed to watch EgressGateway: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package egressgateway
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/spidernet-io/egressgateway/pkg/eipprovider"
+	egress "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/schema"
+)
+
+type fakeProvider struct {
+	events []eipprovider.Event
+	err    error
+}
+
+func (p *fakeProvider) record(op eipprovider.Op, event eipprovider.Event) error {
+	if p.err != nil {
+		return p.err
+	}
+	event.Op = op
+	p.events = append(p.events, event)
+	return nil
+}
+
+func (p *fakeProvider) Allocate(_ context.Context, event eipprovider.Event) error {
+	return p.record(eipprovider.OpAllocate, event)
+}
+
+func (p *fakeProvider) Move(_ context.Context, event eipprovider.Event) error {
+	return p.record(eipprovider.OpMove, event)
+}
+
+func (p *fakeProvider) Release(_ context.Context, event eipprovider.Event) error {
+	return p.record(eipprovider.OpRelease, event)
+}
+
+func TestEipProviderReconcile(t *testing.T) {
+	gateway := &egress.EgressGateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "egw"},
+		Status: egress.EgressGatewayStatus{NodeList: []egress.EgressIPStatus{
+			{Name: "node1", Eips: []egress.Eips{
+				{IPv4: "10.6.1.21", Policies: []egress.Policy{{Name: "p1", Namespace: "default"}}},
+				{Policies: []egress.Policy{{Name: "p2", Namespace: "default"}}},
+			}},
+		}},
+	}
+	policy := &egress.EgressPolicy{ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "default"}}
+	cli := fake.NewClientBuilder().WithScheme(schema.GetScheme()).
+		WithObjects(gateway, policy).WithStatusSubresource(gateway, policy).Build()
+
+	provider := &fakeProvider{}
+	recorder := record.NewFakeRecorder(100)
+	r := &eipProviderReconciler{
+		client:   cli,
+		log:      logr.Discard(),
+		provider: provider,
+		recorder: recorder,
+		attached: make(map[string]map[string]attachment),
+		failures: make(map[string]map[string]string),
+	}
+	ctx := context.Background()
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "egw"}}
+	condition := func() *metav1.Condition {
+		p := new(egress.EgressPolicy)
+		assert.NoError(t, cli.Get(ctx, types.NamespacedName{Name: "p1", Namespace: "default"}, p))
+		return meta.FindStatusCondition(p.Status.Conditions, egress.ConditionEIPAttached)
+	}
+
+	// the attach fails
+	provider.err = errors.New("router is down")
+	_, err := r.Reconcile(ctx, req)
+	assert.Error(t, err)
+	assert.Equal(t, metav1.ConditionFalse, condition().Status)
+	// the event is only recorded when the error changes
+	_, err = r.Reconcile(ctx, req)
+	assert.Error(t, err)
+	assert.Len(t, recorder.Events, 1)
+
+	// allocate
+	provider.err = nil
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, []eipprovider.Event{
+		{Op: eipprovider.OpAllocate, Gateway: "egw", IPv4: "10.6.1.21", Node: "node1"},
+	}, provider.events)
+	assert.Equal(t, metav1.ConditionTrue, condition().Status)
+
+	// nothing changes
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Len(t, provider.events, 1)
+
+	// move
+	assert.NoError(t, cli.Get(ctx, req.NamespacedName, gateway))
+	gateway.Status.NodeList = []egress.EgressIPStatus{
+		{Name: "node1"},
+		{Name: "node2", Eips: []egress.Eips{{IPv4: "10.6.1.21", Policies: []egress.Policy{{Name: "p1", Namespace: "default"}}}}},
+	}
+	assert.NoError(t, cli.Status().Update(ctx, gateway))
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, eipprovider.Event{Op: eipprovider.OpMove, Gateway: "egw", IPv4: "10.6.1.21", Node: "node2", PreviousNode: "node1"},
+		provider.events[1])
+
+	// the EIP is moved while the controller is down
+	r = &eipProviderReconciler{
+		client:   cli,
+		log:      logr.Discard(),
+		provider: provider,
+		recorder: recorder,
+		attached: make(map[string]map[string]attachment),
+		failures: make(map[string]map[string]string),
+	}
+	assert.NoError(t, cli.Get(ctx, req.NamespacedName, gateway))
+	assert.Equal(t, `[{"ipv4":"10.6.1.21","node":"node2"}]`, gateway.Annotations[attachedAnnotation])
+	gateway.Status.NodeList = []egress.EgressIPStatus{
+		{Name: "node1", Eips: []egress.Eips{{IPv4: "10.6.1.21", Policies: []egress.Policy{{Name: "p1", Namespace: "default"}}}}},
+		{Name: "node2"},
+	}
+	assert.NoError(t, cli.Status().Update(ctx, gateway))
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, eipprovider.Event{Op: eipprovider.OpMove, Gateway: "egw", IPv4: "10.6.1.21", Node: "node1", PreviousNode: "node2"},
+		provider.events[2])
+
+	// release
+	assert.NoError(t, cli.Get(ctx, req.NamespacedName, gateway))
+	assert.NoError(t, cli.Delete(ctx, gateway))
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, eipprovider.Event{Op: eipprovider.OpRelease, Gateway: "egw", IPv4: "10.6.1.21", Node: "node1"},
+		provider.events[3])
+	assert.Empty(t, r.attached)
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package egressgateway
+
+import (
+	egress "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+// assignStandbyNodes designates a standby node for each EIP in the gateway status, the
+// agent of the standby node pre-installs the datapath of the EIP to take it over. A
+// standby node is kept as long as it is ready and allowed for the EIP, otherwise the
+// allowed ready node with the least standby EIPs is picked. The node IP entries are
+// bound to their node and have no standby node.
+func assignStandbyNodes(gateway *egress.EgressGateway) {
+	count := make(map[string]int)
+	for i := range gateway.Status.NodeList {
+		node := &gateway.Status.NodeList[i]
+		for j := range node.Eips {
+			eip := &node.Eips[j]
+			if isNodeIPEip(*eip) || eip.StandbyNode == node.Name || standbyIndex(gateway, *eip) == -1 {
+				eip.StandbyNode = ""
+				continue
+			}
+			count[eip.StandbyNode]++
+		}
+	}
+
+	for i := range gateway.Status.NodeList {
+		node := &gateway.Status.NodeList[i]
+		for j := range node.Eips {
+			eip := &node.Eips[j]
+			if eip.StandbyNode != "" || isNodeIPEip(*eip) {
+				continue
+			}
+			standby := ""
+			for _, candidate := range gateway.Status.NodeList {
+				if candidate.Name == node.Name || !egress.EgressTunnelReady.IsEqual(candidate.Status) ||
+					!eipNodeAllowed(gateway.Spec.Ippools, eip.IPv4, eip.IPv6, candidate.Name) {
+					continue
+				}
+				if standby == "" || count[candidate.Name] < count[standby] {
+					standby = candidate.Name
+				}
+			}
+			if standby != "" {
+				eip.StandbyNode = standby
+				count[standby]++
+			}
+		}
+	}
+}
+
+// standbyIndex returns the index of the standby node of the EIP if it is ready and
+// allowed for the EIP, otherwise it returns -1.
+func standbyIndex(gateway *egress.EgressGateway, eip egress.Eips) int {
+	if eip.StandbyNode == "" {
+		return -1
+	}
+	for i, node := range gateway.Status.NodeList {
+		if node.Name != eip.StandbyNode {
+			continue
+		}
+		if !egress.EgressTunnelReady.IsEqual(node.Status) ||
+			!eipNodeAllowed(gateway.Spec.Ippools, eip.IPv4, eip.IPv6, node.Name) {
+			return -1
+		}
+		return i
+	}
+	return -1
+}
@@ -0,0 +1,57 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package egressgateway
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	egress "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+func TestAssignStandbyNodes(t *testing.T) {
+	gateway := &egress.EgressGateway{
+		Spec: egress.EgressGatewaySpec{
+			Ippools: egress.Ippools{
+				IPv4: []string{"10.6.1.1-10.6.1.10"},
+				NodeAffinity: []egress.EipNodeAffinity{
+					{IPs: []string{"10.6.1.4"}, Nodes: []string{"node1", "node3"}},
+				},
+			},
+		},
+		Status: egress.EgressGatewayStatus{NodeList: []egress.EgressIPStatus{
+			{Name: "node1", Status: "Ready", Eips: []egress.Eips{
+				{IPv4: "10.6.1.1", StandbyNode: "node2"},
+				{IPv4: "10.6.1.2", StandbyNode: "node4"},
+				{IPv4: "10.6.1.3", StandbyNode: "node1"},
+				{IPv4: "10.6.1.4"},
+				{Policies: []egress.Policy{{Name: "p1"}}, StandbyNode: "node2"},
+			}},
+			{Name: "node2", Status: "Ready"},
+			{Name: "node3", Status: "Ready"},
+			{Name: "node4", Status: "HeartbeatTimeout"},
+		}},
+	}
+
+	assignStandbyNodes(gateway)
+
+	eips := gateway.Status.NodeList[0].Eips
+	// kept
+	assert.Equal(t, "node2", eips[0].StandbyNode)
+	// node4 is not ready, node1 is the active node
+	assert.Equal(t, "node3", eips[1].StandbyNode)
+	assert.Equal(t, "node2", eips[2].StandbyNode)
+	// pinned to node1 and node3
+	assert.Equal(t, "node3", eips[3].StandbyNode)
+	// node IP entry
+	assert.Empty(t, eips[4].StandbyNode)
+
+	// the standby node is preferred on failover
+	gateway.Status.NodeList[0].Status = "HeartbeatTimeout"
+	needMoveIPs := []egress.Eips{eips[0], eips[1]}
+	moves := moveEipToReadyNode(gateway, &needMoveIPs)
+	assert.Equal(t, []eipMove{{eip: eips[0], to: "node2"}, {eip: eips[1], to: "node3"}}, moves)
+	assert.Empty(t, needMoveIPs)
+}
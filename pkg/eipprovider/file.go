@@ -0,0 +1,98 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package eipprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// File is a fake provider for testing, it keeps the attached EIPs in a JSON file, the
+// file maps the EIPs to their latest events
+type File struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+func (f *File) Allocate(_ context.Context, event Event) error {
+	event.Op = OpAllocate
+	return f.update(event)
+}
+
+func (f *File) Move(_ context.Context, event Event) error {
+	event.Op = OpMove
+	return f.update(event)
+}
+
+func (f *File) Release(_ context.Context, event Event) error {
+	event.Op = OpRelease
+	return f.update(event)
+}
+
+// List returns the attached EIPs
+func (f *File) List() (map[string]Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.read()
+}
+
+func (f *File) update(event Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	attached, err := f.read()
+	if err != nil {
+		return err
+	}
+	key := event.IPv4 + "/" + event.IPv6
+	if event.Op == OpRelease {
+		delete(attached, key)
+	} else {
+		attached[key] = event
+	}
+
+	data, err := json.MarshalIndent(attached, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), ".eip-provider-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+func (f *File) read() (map[string]Event, error) {
+	attached := make(map[string]Event)
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return attached, nil
+		}
+		return nil, err
+	}
+	if len(data) == 0 {
+		return attached, nil
+	}
+	if err := json.Unmarshal(data, &attached); err != nil {
+		return nil, err
+	}
+	return attached, nil
+}
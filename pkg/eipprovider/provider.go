@@ -0,0 +1,62 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+// Package eipprovider informs the external systems, e.g. a router API or an IPAM,
+// when an EIP is allocated, moved to another node or released, for the environments
+// in which an EIP is only reachable after the external system has attached it.
+package eipprovider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spidernet-io/egressgateway/pkg/config"
+)
+
+// Op is the operation on the EIP
+type Op string
+
+const (
+	OpAllocate Op = "allocate"
+	OpMove     Op = "move"
+	OpRelease  Op = "release"
+)
+
+// Event describes the EIP and the node it is placed on
+type Event struct {
+	Op      Op     `json:"op"`
+	Gateway string `json:"gateway"`
+	IPv4    string `json:"ipv4,omitempty"`
+	IPv6    string `json:"ipv6,omitempty"`
+	// Node is the node the EIP is placed on, it is the node the EIP is released from
+	// for the release operation
+	Node string `json:"node"`
+	// PreviousNode is the node the EIP is moved from
+	PreviousNode string `json:"previousNode,omitempty"`
+}
+
+// Provider attaches the EIPs to the external system, the calls should be idempotent,
+// the calls may be repeated after a failure or when the controller restarts
+type Provider interface {
+	// Allocate is called when the EIP is allocated and placed on a node
+	Allocate(ctx context.Context, event Event) error
+	// Move is called when the EIP is moved to another node
+	Move(ctx context.Context, event Event) error
+	// Release is called when the EIP is released
+	Release(ctx context.Context, event Event) error
+}
+
+// New returns the provider of the config, it is nil if no provider is configured
+func New(cfg config.EipProvider) (Provider, error) {
+	switch cfg.Type {
+	case "":
+		return nil, nil
+	case config.EipProviderWebhook:
+		return NewWebhook(cfg.URL, time.Duration(cfg.TimeoutSeconds)*time.Second), nil
+	case config.EipProviderFile:
+		return NewFile(cfg.Path), nil
+	default:
+		return nil, fmt.Errorf("unknown eip provider type %q", cfg.Type)
+	}
+}
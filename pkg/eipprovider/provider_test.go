@@ -0,0 +1,75 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package eipprovider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/spidernet-io/egressgateway/pkg/config"
+)
+
+func TestWebhook(t *testing.T) {
+	var got []Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := Event{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		got = append(got, event)
+		if event.Node == "bad" {
+			http.Error(w, "router rejected", http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	w := NewWebhook(server.URL, time.Second)
+	ctx := context.Background()
+	assert.NoError(t, w.Allocate(ctx, Event{Gateway: "egw", IPv4: "10.6.1.21", Node: "node1"}))
+	assert.NoError(t, w.Move(ctx, Event{Gateway: "egw", IPv4: "10.6.1.21", Node: "node2", PreviousNode: "node1"}))
+	assert.NoError(t, w.Release(ctx, Event{Gateway: "egw", IPv4: "10.6.1.21", Node: "node2"}))
+	err := w.Allocate(ctx, Event{Gateway: "egw", IPv4: "10.6.1.22", Node: "bad"})
+	assert.ErrorContains(t, err, "router rejected")
+
+	assert.Equal(t, []Op{OpAllocate, OpMove, OpRelease, OpAllocate}, []Op{got[0].Op, got[1].Op, got[2].Op, got[3].Op})
+	assert.Equal(t, "node1", got[1].PreviousNode)
+}
+
+func TestFile(t *testing.T) {
+	f := NewFile(filepath.Join(t.TempDir(), "eips.json"))
+	ctx := context.Background()
+
+	attached, err := f.List()
+	assert.NoError(t, err)
+	assert.Empty(t, attached)
+
+	assert.NoError(t, f.Allocate(ctx, Event{Gateway: "egw", IPv4: "10.6.1.21", Node: "node1"}))
+	assert.NoError(t, f.Allocate(ctx, Event{Gateway: "egw", IPv4: "10.6.1.22", IPv6: "fd00::22", Node: "node1"}))
+	assert.NoError(t, f.Move(ctx, Event{Gateway: "egw", IPv4: "10.6.1.21", Node: "node2", PreviousNode: "node1"}))
+	assert.NoError(t, f.Release(ctx, Event{Gateway: "egw", IPv4: "10.6.1.22", IPv6: "fd00::22", Node: "node1"}))
+
+	attached, err = f.List()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Event{
+		"10.6.1.21/": {Op: OpMove, Gateway: "egw", IPv4: "10.6.1.21", Node: "node2", PreviousNode: "node1"},
+	}, attached)
+}
+
+func TestNew(t *testing.T) {
+	p, err := New(config.EipProvider{})
+	assert.NoError(t, err)
+	assert.Nil(t, p)
+
+	p, err = New(config.EipProvider{Type: config.EipProviderFile, Path: "/tmp/eips.json"})
+	assert.NoError(t, err)
+	assert.IsType(t, &File{}, p)
+
+	_, err = New(config.EipProvider{Type: "bgp"})
+	assert.Error(t, err)
+}
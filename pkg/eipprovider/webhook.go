@@ -0,0 +1,62 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package eipprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Webhook posts the events to an HTTP endpoint as JSON, the EIP is attached if the
+// endpoint responds with a 2xx status code
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhook(url string, timeout time.Duration) *Webhook {
+	return &Webhook{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (w *Webhook) Allocate(ctx context.Context, event Event) error {
+	event.Op = OpAllocate
+	return w.post(ctx, event)
+}
+
+func (w *Webhook) Move(ctx context.Context, event Event) error {
+	event.Op = OpMove
+	return w.post(ctx, event)
+}
+
+func (w *Webhook) Release(ctx context.Context, event Event) error {
+	event.Op = OpRelease
+	return w.post(ctx, event)
+}
+
+func (w *Webhook) post(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to %s EIP: %w", event.Op, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to %s EIP: %s %s", event.Op, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -293,6 +293,9 @@ func (runner *runner) createSet(set *IPSet, ignoreExistErr bool) error {
 	if set.SetType == BitmapPort {
 		args = append(args, "range", set.PortRange)
 	}
+	if set.SetType == ListSet {
+		args = append(args, "size", strconv.Itoa(set.MaxElem))
+	}
 	if ignoreExistErr {
 		args = append(args, "-exist")
 	}
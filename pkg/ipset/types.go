@@ -29,6 +29,9 @@ const (
 	// HashNet represents the `hash:Net` type ipset. The hash:net set type uses a hash to store different sized IP network addresses.  Network ad‐
 	// dress with zero prefix size cannot be stored in this type of sets.
 	HashNet Type = "hash:net"
+	// ListSet represents the `list:set` type ipset. The list:set type uses a simple list in which you can store
+	// set names. A packet matches the set when it matches any of the member sets.
+	ListSet Type = "list:set"
 )
 
 // DefaultPortRange defines the default bitmap:port valid port range.
@@ -55,4 +58,5 @@ var ValidIPSetTypes = []Type{
 	HashIPPortNet,
 	HashIP,
 	HashNet,
+	ListSet,
 }
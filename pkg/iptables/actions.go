@@ -19,6 +19,7 @@ package iptables
 
 import (
 	"fmt"
+	"strings"
 )
 
 type Action interface {
@@ -146,7 +147,9 @@ func (g DNATAction) String() string {
 }
 
 type SNATAction struct {
-	ToAddr   string
+	ToAddr string
+	// ToPorts the port range, e.g. `20000-60000`, the rule must match tcp or udp
+	ToPorts  string
 	TypeSNAT struct{}
 }
 
@@ -155,11 +158,21 @@ func (g SNATAction) ToFragment(features *Options) string {
 	if features.SNATFullyRandom {
 		fullyRand = " --random-fully"
 	}
-	return fmt.Sprintf("--jump SNAT --to-source %s%s", g.ToAddr, fullyRand)
+	return fmt.Sprintf("--jump SNAT --to-source %s%s", g.toSource(), fullyRand)
+}
+
+func (g SNATAction) toSource() string {
+	if g.ToPorts == "" {
+		return g.ToAddr
+	}
+	if strings.Contains(g.ToAddr, ":") {
+		return fmt.Sprintf("[%s]:%s", g.ToAddr, g.ToPorts)
+	}
+	return fmt.Sprintf("%s:%s", g.ToAddr, g.ToPorts)
 }
 
 func (g SNATAction) String() string {
-	return fmt.Sprintf("SNAT->%s", g.ToAddr)
+	return fmt.Sprintf("SNAT->%s", g.toSource())
 }
 
 type MasqAction struct {
@@ -81,6 +81,16 @@ func (m MatchCriteria) NotMarkMatchesWithMask(mark, mask uint32) MatchCriteria {
 	return append(m, fmt.Sprintf("-m mark ! --mark %#x/%#x", mark, mask))
 }
 
+func (m MatchCriteria) NotConnmarkMatchesWithMask(mark, mask uint32) MatchCriteria {
+	if mask == 0 {
+		panic("Bug: mask is 0.")
+	}
+	if mark&mask != mark {
+		panic("Bug: mark is not contained in mask")
+	}
+	return append(m, fmt.Sprintf("-m connmark ! --mark %#x/%#x", mark, mask))
+}
+
 func (m MatchCriteria) InInterface(ifaceMatch string) MatchCriteria {
 	return append(m, fmt.Sprintf("--in-interface %s", ifaceMatch))
 }
@@ -313,6 +323,17 @@ func (m MatchCriteria) CTDirectionOriginal(direction Direction) MatchCriteria {
 	return append(m, fmt.Sprintf("-m conntrack --ctdir %s", direction))
 }
 
+// OwnerUID matches the locally generated packets of the processes run by the user, it is
+// only valid in the OUTPUT and POSTROUTING chains.
+func (m MatchCriteria) OwnerUID(uid int64) MatchCriteria {
+	return append(m, fmt.Sprintf("-m owner --uid-owner %d", uid))
+}
+
+// CgroupPath matches the locally generated packets of the processes in the cgroup v2 path.
+func (m MatchCriteria) CgroupPath(path string) MatchCriteria {
+	return append(m, fmt.Sprintf("-m cgroup --path %s", path))
+}
+
 // VXLANVNI matches on the VNI contained within the VXLAN header.  It assumes that this is indeed a VXLAN
 // packet; i.e. it should be used with a protocol==UDP and port==VXLAN port match.
 //
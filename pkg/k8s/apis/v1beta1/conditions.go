@@ -0,0 +1,60 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package v1beta1
+
+// condition types shared by EgressGateway, EgressPolicy, EgressClusterPolicy and EgressTunnel
+const (
+	// ConditionAccepted the spec of the object has been accepted by the controller
+	ConditionAccepted = "Accepted"
+	// ConditionIPAllocated the object has got the addresses it needs (EIP, tunnel IP, mark)
+	ConditionIPAllocated = "IPAllocated"
+	// ConditionProgrammed the datapath for the object is expected to be in place on a ready node
+	ConditionProgrammed = "Programmed"
+	// ConditionDegraded the object is working, but not as expected
+	ConditionDegraded = "Degraded"
+	// ConditionEIPAttached the eip provider has attached the EIP of the policy to the node,
+	// it is only set when an eip provider is configured
+	ConditionEIPAttached = "EIPAttached"
+	// ConditionActive the policy is in a window of its schedule, it is only set when the policy
+	// has a schedule
+	ConditionActive = "Active"
+	// ConditionBlocked the traffic of the policy is blocked because no gateway node is
+	// assigned to it, it is only set when the failurePolicy of the policy is closed
+	ConditionBlocked = "Blocked"
+	// ConditionPeerReachable no agent reports the node unreachable by the peer probe in
+	// status.unreachableFrom, it is only set when the peer probe is enabled, the EIPs are
+	// still moved only after the node lease expired
+	ConditionPeerReachable = "PeerReachable"
+)
+
+// condition reasons
+const (
+	ReasonAccepted           = "Accepted"
+	ReasonAllocated          = "Allocated"
+	ReasonProgrammed         = "Programmed"
+	ReasonAsExpected         = "AsExpected"
+	ReasonPending            = "Pending"
+	ReasonGatewayNotFound    = "GatewayNotFound"
+	ReasonNoReadyGatewayNode = "NoReadyGatewayNode"
+	ReasonIPPoolExhausted    = "IPPoolExhausted"
+	ReasonAllocateFailed     = "AllocateFailed"
+	ReasonNodeNotReady       = "NodeNotReady"
+	ReasonHeartbeatTimeout   = "HeartbeatTimeout"
+	ReasonAttached           = "Attached"
+	ReasonAttachFailed       = "AttachFailed"
+	ReasonInWindow           = "InWindow"
+	ReasonOutOfWindow        = "OutOfWindow"
+	ReasonInvalidSchedule    = "InvalidSchedule"
+	ReasonPeerReachable      = "PeerReachable"
+	ReasonPeerUnreachable    = "PeerUnreachable"
+)
+
+// event reasons, the condition reasons above are also used for events
+const (
+	ReasonEIPAllocated = "EIPAllocated"
+	ReasonEIPReleased  = "EIPReleased"
+	ReasonEIPMoved     = "EIPMoved"
+	ReasonTunnelReady  = "TunnelReady"
+	ReasonEIPConflict  = "EIPConflict"
+)
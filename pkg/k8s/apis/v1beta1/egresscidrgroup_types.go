@@ -0,0 +1,47 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package v1beta1
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+// EgressCIDRGroupList contains a list of EgressCIDRGroup
+// +kubebuilder:object:root=true
+type EgressCIDRGroupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []EgressCIDRGroup `json:"items"`
+}
+
+// EgressCIDRGroup is a named list of destination CIDRs shared by the policies
+// +kubebuilder:resource:categories={egresscidrgroup},path="egresscidrgroups",singular="egresscidrgroup",scope="Cluster",shortName={egcg}
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+type EgressCIDRGroup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	// +kubebuilder:validation:Optional
+	Spec EgressCIDRGroupSpec `json:"spec,omitempty"`
+	// +kubebuilder:validation:Optional
+	Status EgressCIDRGroupStatus `json:"status,omitempty"`
+}
+
+type EgressCIDRGroupSpec struct {
+	// +kubebuilder:validation:Optional
+	CIDRs []string `json:"cidrs,omitempty"`
+	// Includes the names of the other EgressCIDRGroups whose CIDRs are part of this group
+	// +kubebuilder:validation:Optional
+	Includes []string `json:"includes,omitempty"`
+}
+
+type EgressCIDRGroupStatus struct {
+	// Policies the policies which reference the group, directly or through other groups
+	// +kubebuilder:validation:Optional
+	Policies []Policy `json:"policies,omitempty"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EgressCIDRGroup{}, &EgressCIDRGroupList{})
+}
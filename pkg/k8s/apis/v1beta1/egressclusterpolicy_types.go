@@ -42,17 +42,70 @@ type EgressClusterPolicySpec struct {
 	AppliedTo ClusterAppliedTo `json:"appliedTo"`
 	// +kubebuilder:validation:Optional
 	DestSubnet []string `json:"destSubnet"`
+	// ExcludeDestSubnet the traffic to these subnets does not go through the EgressGateway
+	// and keeps the node IP, even if it matches destSubnet
+	// +kubebuilder:validation:Optional
+	ExcludeDestSubnet []string `json:"excludeDestSubnet,omitempty"`
+	// DestCIDRGroups the names of the EgressCIDRGroups whose CIDRs are destinations too
+	// +kubebuilder:validation:Optional
+	DestCIDRGroups []string `json:"destCIDRGroups,omitempty"`
 	// +kubebuilder:validation:Optional
 	Priority uint64 `json:"priority,omitempty"`
+	// Schedule the time windows of the policy, the traffic only goes through the EgressGateway
+	// in the windows and uses the node IP out of them. The policy is always active when it is not set.
+	// +kubebuilder:validation:Optional
+	Schedule *Schedule `json:"schedule,omitempty"`
+	// FailurePolicy what happens to the traffic of the policy when no gateway node is assigned
+	// to it, `open` lets the traffic use the node IP, `closed` blocks the traffic
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=open;closed
+	// +kubebuilder:default:=open
+	FailurePolicy string `json:"failurePolicy,omitempty"`
+	// FailureAction how the traffic is blocked when failurePolicy is closed, `drop` discards
+	// the traffic silently, `reject` replies with an ICMP error so the clients fail fast
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=drop;reject
+	// +kubebuilder:default:=drop
+	FailureAction string `json:"failureAction,omitempty"`
 }
 
 type ClusterAppliedTo struct {
 	// +kubebuilder:validation:Optional
 	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+	// ExcludePodSelector the pods matched by it are excluded from the pods selected by podSelector
+	// +kubebuilder:validation:Optional
+	ExcludePodSelector *metav1.LabelSelector `json:"excludePodSelector,omitempty"`
+	// ServiceAccountSelector selects the pods by their ServiceAccounts, together with podSelector
+	// and namespaceSelector
+	// +kubebuilder:validation:Optional
+	ServiceAccountSelector *ServiceAccountSelector `json:"serviceAccountSelector,omitempty"`
 	// +kubebuilder:validation:Optional
 	PodSubnet *[]string `json:"podSubnet,omitempty"`
+	// Networks the Multus networks attached to the selected pods, their IPs are the source IPs
+	// of the policy besides the IPs of the pod network. A network is `<namespace>/<name>` of
+	// its NetworkAttachmentDefinition, the namespace of the pod is used when it is omitted.
+	// +kubebuilder:validation:Optional
+	Networks []string `json:"networks,omitempty"`
 	// +kubebuilder:validation:Optional
 	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// NodeSelector selects the nodes whose host network traffic is sent to the EgressGateway
+	// +kubebuilder:validation:Optional
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty"`
+	// HostTraffic filters the host network traffic of the nodes selected by nodeSelector, all
+	// the host network traffic of the nodes matches when it is not set
+	// +kubebuilder:validation:Optional
+	HostTraffic *HostTraffic `json:"hostTraffic,omitempty"`
+}
+
+// HostTraffic selects the host network traffic by the processes sending it, the traffic
+// matches when it is sent by one of the users or from one of the cgroups
+type HostTraffic struct {
+	// UIDs the users of the processes
+	// +kubebuilder:validation:Optional
+	UIDs []int64 `json:"uids,omitempty"`
+	// CgroupPaths the cgroup v2 paths of the processes, relative to the cgroup root
+	// +kubebuilder:validation:Optional
+	CgroupPaths []string `json:"cgroupPaths,omitempty"`
 }
 
 func init() {
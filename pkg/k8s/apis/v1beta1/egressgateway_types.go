@@ -4,6 +4,11 @@
 package v1beta1
 
 import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -43,6 +48,85 @@ type EgressGatewaySpec struct {
 	Ippools Ippools `json:"ippools,omitempty"`
 	// +kubebuilder:validation:Required
 	NodeSelector NodeSelector `json:"nodeSelector,omitempty"`
+	// +kubebuilder:validation:Optional
+	Failback Failback `json:"failback,omitempty"`
+	// Snat tunes the SNAT of the traffic of the EIPs on the gateway nodes
+	// +kubebuilder:validation:Optional
+	Snat Snat `json:"snat,omitempty"`
+}
+
+type Snat struct {
+	// PortRange the source ports the TCP and UDP traffic is SNATed to, e.g. `20000-60000`,
+	// the kernel picks the ports from 1024-65535 if it is empty
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^[0-9]+-[0-9]+$`
+	PortRange string `json:"portRange,omitempty"`
+	// PortBlockSize gives each source IP of the policies a fixed block of this number of
+	// ports of the EIP within the port range, the allocation table is published in a
+	// ConfigMap, so a connection from the EIP can be traced back to its pod
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=65535
+	PortBlockSize int32 `json:"portBlockSize,omitempty"`
+}
+
+// Ports returns the first and the last port of the port range
+func (s Snat) Ports() (int, int, error) {
+	first, last, ok := strings.Cut(s.PortRange, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid port range %q", s.PortRange)
+	}
+	start, err := strconv.Atoi(first)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q: %w", s.PortRange, err)
+	}
+	end, err := strconv.Atoi(last)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q: %w", s.PortRange, err)
+	}
+	if start < 1 || end > 65535 || start > end {
+		return 0, 0, fmt.Errorf("port range %q is not within 1-65535", s.PortRange)
+	}
+	return start, end, nil
+}
+
+// EipVirtualRouterID returns the virtual router id of the EIP, it only depends on the last
+// byte of the EIP, so it does not change when the ippools are edited. It is 0 if the
+// virtual MAC is not enabled.
+func (p Ippools) EipVirtualRouterID(eip net.IP) int {
+	if p.VirtualRouterID == 0 {
+		return 0
+	}
+	var last byte
+	if ip4 := eip.To4(); ip4 != nil {
+		last = ip4[3]
+	} else if ip16 := eip.To16(); ip16 != nil {
+		last = ip16[15]
+	}
+	return (int(p.VirtualRouterID)+int(last)-1)%255 + 1
+}
+
+// FailbackMode how the EIPs are redistributed after a gateway node recovers
+type FailbackMode string
+
+const (
+	// FailbackNone the EIPs stay on the node they have been moved to
+	FailbackNone FailbackMode = "none"
+	// FailbackPreemptive the EIPs return to their home node once it has been ready for delaySeconds
+	FailbackPreemptive FailbackMode = "preemptive"
+	// FailbackRebalance the EIPs are evened out across the ready nodes
+	FailbackRebalance FailbackMode = "rebalance"
+)
+
+type Failback struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=none;preemptive;rebalance
+	// +kubebuilder:default=none
+	Mode FailbackMode `json:"mode,omitempty"`
+	// DelaySeconds is the time the recovered node must stay ready before the EIPs are moved
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	DelaySeconds int64 `json:"delaySeconds,omitempty"`
 }
 
 type Ippools struct {
@@ -54,6 +138,57 @@ type Ippools struct {
 	Ipv4DefaultEIP string `json:"ipv4DefaultEIP,omitempty"`
 	// +kubebuilder:validation:Optional
 	Ipv6DefaultEIP string `json:"ipv6DefaultEIP,omitempty"`
+	// NodeAffinity pins EIPs to nodes, the EIPs which are not covered can be placed on any node
+	// +kubebuilder:validation:Optional
+	NodeAffinity []EipNodeAffinity `json:"nodeAffinity,omitempty"`
+	// Uplinks route the traffic of the EIPs through a dedicated uplink of the gateway nodes,
+	// the EIPs which are not covered use the main routing table
+	// +kubebuilder:validation:Optional
+	Uplinks []EipUplink `json:"uplinks,omitempty"`
+	// VirtualRouterID gives each EIP a stable virtual MAC following the VRRP convention,
+	// 00:00:5e:00:01:<id> for IPv4 and 00:00:5e:00:02:<id> for IPv6, the id of an EIP is
+	// derived from its last byte, (virtualRouterID + <last byte> - 1) % 255 + 1, so it does
+	// not change with the ippool. It only takes effect in the layer2 eipMode.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=255
+	VirtualRouterID int32 `json:"virtualRouterID,omitempty"`
+}
+
+type EipNodeAffinity struct {
+	// IPs single IPs, IP ranges or CIDRs of the ippools
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	IPs []string `json:"ips"`
+	// Nodes the EIPs can only be placed on these nodes
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	Nodes []string `json:"nodes"`
+}
+
+type EipUplink struct {
+	// IPs single IPs, IP ranges or CIDRs of the ippools
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	IPs []string `json:"ips"`
+	// Interface the interface of the gateway nodes the traffic of the EIPs leaves through,
+	// it is the parent interface if vlanID is set
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Interface string `json:"interface"`
+	// VlanID the agent creates the VLAN sub-interface of the interface on the gateway nodes
+	// which hold the EIPs, the EIPs, and their virtual MAC interfaces if virtualRouterID is
+	// set, are configured, announced and routed through it
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=4094
+	VlanID int32 `json:"vlanID,omitempty"`
+	// NextHopIPv4 the IPv4 next hop of the uplink, the destinations are on-link if it is empty
+	// +kubebuilder:validation:Optional
+	NextHopIPv4 string `json:"nextHopIPv4,omitempty"`
+	// NextHopIPv6 the IPv6 next hop of the uplink, the destinations are on-link if it is empty
+	// +kubebuilder:validation:Optional
+	NextHopIPv6 string `json:"nextHopIPv6,omitempty"`
 }
 
 type NodeSelector struct {
@@ -68,6 +203,12 @@ type EgressGatewayStatus struct {
 	NodeList []EgressIPStatus `json:"nodeList,omitempty"`
 	// +kubebuilder:validation:Optional
 	IPUsage IPUsage `json:"ipUsage,omitempty"`
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// +kubebuilder:validation:Optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 type IPUsage struct {
@@ -116,6 +257,13 @@ type Eips struct {
 	IPv6 string `json:"ipv6,omitempty"`
 	// +kubebuilder:validation:Optional
 	Policies []Policy `json:"policies,omitempty"`
+	// HomeNode is the node the EIP was placed on before the failover, it is used by the preemptive failback
+	// +kubebuilder:validation:Optional
+	HomeNode string `json:"homeNode,omitempty"`
+	// StandbyNode is the node which pre-installs the datapath of the EIP, it takes over
+	// the EIP as soon as the agent of the active node is not alive
+	// +kubebuilder:validation:Optional
+	StandbyNode string `json:"standbyNode,omitempty"`
 }
 
 type Policy struct {
@@ -42,8 +42,31 @@ type EgressPolicySpec struct {
 	AppliedTo AppliedTo `json:"appliedTo"`
 	// +kubebuilder:validation:Optional
 	DestSubnet []string `json:"destSubnet"`
+	// ExcludeDestSubnet the traffic to these subnets does not go through the EgressGateway
+	// and keeps the node IP, even if it matches destSubnet
+	// +kubebuilder:validation:Optional
+	ExcludeDestSubnet []string `json:"excludeDestSubnet,omitempty"`
+	// DestCIDRGroups the names of the EgressCIDRGroups whose CIDRs are destinations too
+	// +kubebuilder:validation:Optional
+	DestCIDRGroups []string `json:"destCIDRGroups,omitempty"`
 	// +kubebuilder:validation:Optional
 	Priority uint64 `json:"priority,omitempty"`
+	// Schedule the time windows of the policy, the traffic only goes through the EgressGateway
+	// in the windows and uses the node IP out of them. The policy is always active when it is not set.
+	// +kubebuilder:validation:Optional
+	Schedule *Schedule `json:"schedule,omitempty"`
+	// FailurePolicy what happens to the traffic of the policy when no gateway node is assigned
+	// to it, `open` lets the traffic use the node IP, `closed` blocks the traffic
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=open;closed
+	// +kubebuilder:default:=open
+	FailurePolicy string `json:"failurePolicy,omitempty"`
+	// FailureAction how the traffic is blocked when failurePolicy is closed, `drop` discards
+	// the traffic silently, `reject` replies with an ICMP error so the clients fail fast
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=drop;reject
+	// +kubebuilder:default:=drop
+	FailureAction string `json:"failureAction,omitempty"`
 }
 
 type EgressPolicyStatus struct {
@@ -51,6 +74,15 @@ type EgressPolicyStatus struct {
 	Eip Eip `json:"eip,omitempty"`
 	// +kubebuilder:validation:Optional
 	Node string `json:"node,omitempty"`
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// +kubebuilder:validation:Optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// NextTransitionTime the time the policy enters or leaves the window of its schedule
+	// +kubebuilder:validation:Optional
+	NextTransitionTime *metav1.Time `json:"nextTransitionTime,omitempty"`
 }
 
 type Eip struct {
@@ -76,8 +108,41 @@ type EgressIP struct {
 type AppliedTo struct {
 	// +kubebuilder:validation:Optional
 	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+	// ExcludePodSelector the pods matched by it are excluded from the pods selected by podSelector
+	// +kubebuilder:validation:Optional
+	ExcludePodSelector *metav1.LabelSelector `json:"excludePodSelector,omitempty"`
+	// ServiceAccountSelector selects the pods by their ServiceAccounts, together with podSelector
+	// +kubebuilder:validation:Optional
+	ServiceAccountSelector *ServiceAccountSelector `json:"serviceAccountSelector,omitempty"`
 	// +kubebuilder:validation:Optional
 	PodSubnet []string `json:"podSubnet,omitempty"`
+	// Networks the Multus networks attached to the selected pods, their IPs are the source IPs
+	// of the policy besides the IPs of the pod network. A network is `<namespace>/<name>` of
+	// its NetworkAttachmentDefinition, the namespace of the pod is used when it is omitted.
+	// +kubebuilder:validation:Optional
+	Networks []string `json:"networks,omitempty"`
+}
+
+// ServiceAccountSelector selects the ServiceAccounts by names or labels, a pod is selected
+// when its ServiceAccount matches any of them
+type ServiceAccountSelector struct {
+	// +kubebuilder:validation:Optional
+	Names []string `json:"names,omitempty"`
+	// +kubebuilder:validation:Optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// Schedule the windows start at the times of the cron expression and last for the duration
+type Schedule struct {
+	// Cron the cron expression of the starts of the windows, `minute hour day-of-month month day-of-week`
+	// +kubebuilder:validation:Required
+	Cron string `json:"cron"`
+	// Duration the length of the windows, e.g. `2h`
+	// +kubebuilder:validation:Required
+	Duration metav1.Duration `json:"duration"`
+	// TimeZone the IANA time zone of the cron expression, e.g. `Asia/Shanghai`, it is UTC when not set
+	// +kubebuilder:validation:Optional
+	TimeZone string `json:"timeZone,omitempty"`
 }
 
 func init() {
@@ -94,3 +159,13 @@ const (
 	// The unassigned EIP is preferred. If no EIP is available, select one at random
 	EipAllocatorRR = "rr"
 )
+
+const (
+	// FailurePolicyOpen the traffic uses the node IP when the policy has no gateway node
+	FailurePolicyOpen = "open"
+	// FailurePolicyClosed the traffic is blocked when the policy has no gateway node
+	FailurePolicyClosed = "closed"
+
+	FailureActionDrop   = "drop"
+	FailureActionReject = "reject"
+)
@@ -44,6 +44,17 @@ type EgressTunnelStatus struct {
 	Mark string `json:"mark,omitempty"`
 	// +kubebuilder:validation:Optional
 	LastHeartbeatTime metav1.Time `json:"lastHeartbeatTime,omitempty"`
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// UnreachableFrom the nodes whose agent can not reach the node by the peer probe, each
+	// agent only adds or removes its own node, it is only set when the peer probe is enabled
+	// +kubebuilder:validation:Optional
+	// +listType=set
+	UnreachableFrom []string `json:"unreachableFrom,omitempty"`
+	// +kubebuilder:validation:Optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 type Tunnel struct {
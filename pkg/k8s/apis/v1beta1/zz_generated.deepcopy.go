@@ -17,11 +17,26 @@ func (in *AppliedTo) DeepCopyInto(out *AppliedTo) {
 		*out = new(v1.LabelSelector)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.ExcludePodSelector != nil {
+		in, out := &in.ExcludePodSelector, &out.ExcludePodSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ServiceAccountSelector != nil {
+		in, out := &in.ServiceAccountSelector, &out.ServiceAccountSelector
+		*out = new(ServiceAccountSelector)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.PodSubnet != nil {
 		in, out := &in.PodSubnet, &out.PodSubnet
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Networks != nil {
+		in, out := &in.Networks, &out.Networks
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppliedTo.
@@ -57,6 +72,16 @@ func (in *ClusterAppliedTo) DeepCopyInto(out *ClusterAppliedTo) {
 		*out = new(v1.LabelSelector)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.ExcludePodSelector != nil {
+		in, out := &in.ExcludePodSelector, &out.ExcludePodSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ServiceAccountSelector != nil {
+		in, out := &in.ServiceAccountSelector, &out.ServiceAccountSelector
+		*out = new(ServiceAccountSelector)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.PodSubnet != nil {
 		in, out := &in.PodSubnet, &out.PodSubnet
 		*out = new([]string)
@@ -66,11 +91,26 @@ func (in *ClusterAppliedTo) DeepCopyInto(out *ClusterAppliedTo) {
 			copy(*out, *in)
 		}
 	}
+	if in.Networks != nil {
+		in, out := &in.Networks, &out.Networks
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.NamespaceSelector != nil {
 		in, out := &in.NamespaceSelector, &out.NamespaceSelector
 		*out = new(v1.LabelSelector)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HostTraffic != nil {
+		in, out := &in.HostTraffic, &out.HostTraffic
+		*out = new(HostTraffic)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAppliedTo.
@@ -83,6 +123,110 @@ func (in *ClusterAppliedTo) DeepCopy() *ClusterAppliedTo {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EgressCIDRGroup) DeepCopyInto(out *EgressCIDRGroup) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressCIDRGroup.
+func (in *EgressCIDRGroup) DeepCopy() *EgressCIDRGroup {
+	if in == nil {
+		return nil
+	}
+	out := new(EgressCIDRGroup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *EgressCIDRGroup) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EgressCIDRGroupList) DeepCopyInto(out *EgressCIDRGroupList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]EgressCIDRGroup, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressCIDRGroupList.
+func (in *EgressCIDRGroupList) DeepCopy() *EgressCIDRGroupList {
+	if in == nil {
+		return nil
+	}
+	out := new(EgressCIDRGroupList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *EgressCIDRGroupList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EgressCIDRGroupSpec) DeepCopyInto(out *EgressCIDRGroupSpec) {
+	*out = *in
+	if in.CIDRs != nil {
+		in, out := &in.CIDRs, &out.CIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Includes != nil {
+		in, out := &in.Includes, &out.Includes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressCIDRGroupSpec.
+func (in *EgressCIDRGroupSpec) DeepCopy() *EgressCIDRGroupSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EgressCIDRGroupSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EgressCIDRGroupStatus) DeepCopyInto(out *EgressCIDRGroupStatus) {
+	*out = *in
+	if in.Policies != nil {
+		in, out := &in.Policies, &out.Policies
+		*out = make([]Policy, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressCIDRGroupStatus.
+func (in *EgressCIDRGroupStatus) DeepCopy() *EgressCIDRGroupStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(EgressCIDRGroupStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EgressClusterEndpointSlice) DeepCopyInto(out *EgressClusterEndpointSlice) {
 	*out = *in
@@ -272,7 +416,7 @@ func (in *EgressClusterPolicy) DeepCopyInto(out *EgressClusterPolicy) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressClusterPolicy.
@@ -335,6 +479,21 @@ func (in *EgressClusterPolicySpec) DeepCopyInto(out *EgressClusterPolicySpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.ExcludeDestSubnet != nil {
+		in, out := &in.ExcludeDestSubnet, &out.ExcludeDestSubnet
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DestCIDRGroups != nil {
+		in, out := &in.DestCIDRGroups, &out.DestCIDRGroups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(Schedule)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressClusterPolicySpec.
@@ -500,6 +659,8 @@ func (in *EgressGatewaySpec) DeepCopyInto(out *EgressGatewaySpec) {
 	*out = *in
 	in.Ippools.DeepCopyInto(&out.Ippools)
 	in.NodeSelector.DeepCopyInto(&out.NodeSelector)
+	out.Failback = in.Failback
+	out.Snat = in.Snat
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressGatewaySpec.
@@ -523,6 +684,13 @@ func (in *EgressGatewayStatus) DeepCopyInto(out *EgressGatewayStatus) {
 		}
 	}
 	out.IPUsage = in.IPUsage
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressGatewayStatus.
@@ -578,7 +746,7 @@ func (in *EgressPolicy) DeepCopyInto(out *EgressPolicy) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressPolicy.
@@ -641,6 +809,21 @@ func (in *EgressPolicySpec) DeepCopyInto(out *EgressPolicySpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.ExcludeDestSubnet != nil {
+		in, out := &in.ExcludeDestSubnet, &out.ExcludeDestSubnet
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DestCIDRGroups != nil {
+		in, out := &in.DestCIDRGroups, &out.DestCIDRGroups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(Schedule)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressPolicySpec.
@@ -657,6 +840,17 @@ func (in *EgressPolicySpec) DeepCopy() *EgressPolicySpec {
 func (in *EgressPolicyStatus) DeepCopyInto(out *EgressPolicyStatus) {
 	*out = *in
 	out.Eip = in.Eip
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.NextTransitionTime != nil {
+		in, out := &in.NextTransitionTime, &out.NextTransitionTime
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressPolicyStatus.
@@ -748,6 +942,18 @@ func (in *EgressTunnelStatus) DeepCopyInto(out *EgressTunnelStatus) {
 	*out = *in
 	out.Tunnel = in.Tunnel
 	in.LastHeartbeatTime.DeepCopyInto(&out.LastHeartbeatTime)
+	if in.UnreachableFrom != nil {
+		in, out := &in.UnreachableFrom, &out.UnreachableFrom
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressTunnelStatus.
@@ -775,6 +981,51 @@ func (in *Eip) DeepCopy() *Eip {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EipNodeAffinity) DeepCopyInto(out *EipNodeAffinity) {
+	*out = *in
+	if in.IPs != nil {
+		in, out := &in.IPs, &out.IPs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EipNodeAffinity.
+func (in *EipNodeAffinity) DeepCopy() *EipNodeAffinity {
+	if in == nil {
+		return nil
+	}
+	out := new(EipNodeAffinity)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EipUplink) DeepCopyInto(out *EipUplink) {
+	*out = *in
+	if in.IPs != nil {
+		in, out := &in.IPs, &out.IPs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EipUplink.
+func (in *EipUplink) DeepCopy() *EipUplink {
+	if in == nil {
+		return nil
+	}
+	out := new(EipUplink)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Eips) DeepCopyInto(out *Eips) {
 	*out = *in
@@ -795,6 +1046,46 @@ func (in *Eips) DeepCopy() *Eips {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Failback) DeepCopyInto(out *Failback) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Failback.
+func (in *Failback) DeepCopy() *Failback {
+	if in == nil {
+		return nil
+	}
+	out := new(Failback)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HostTraffic) DeepCopyInto(out *HostTraffic) {
+	*out = *in
+	if in.UIDs != nil {
+		in, out := &in.UIDs, &out.UIDs
+		*out = make([]int64, len(*in))
+		copy(*out, *in)
+	}
+	if in.CgroupPaths != nil {
+		in, out := &in.CgroupPaths, &out.CgroupPaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HostTraffic.
+func (in *HostTraffic) DeepCopy() *HostTraffic {
+	if in == nil {
+		return nil
+	}
+	out := new(HostTraffic)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IPListPair) DeepCopyInto(out *IPListPair) {
 	*out = *in
@@ -848,6 +1139,20 @@ func (in *Ippools) DeepCopyInto(out *Ippools) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.NodeAffinity != nil {
+		in, out := &in.NodeAffinity, &out.NodeAffinity
+		*out = make([]EipNodeAffinity, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Uplinks != nil {
+		in, out := &in.Uplinks, &out.Uplinks
+		*out = make([]EipUplink, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Ippools.
@@ -910,6 +1215,62 @@ func (in *Policy) DeepCopy() *Policy {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Schedule) DeepCopyInto(out *Schedule) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Schedule.
+func (in *Schedule) DeepCopy() *Schedule {
+	if in == nil {
+		return nil
+	}
+	out := new(Schedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountSelector) DeepCopyInto(out *ServiceAccountSelector) {
+	*out = *in
+	if in.Names != nil {
+		in, out := &in.Names, &out.Names
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountSelector.
+func (in *ServiceAccountSelector) DeepCopy() *ServiceAccountSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Snat) DeepCopyInto(out *Snat) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Snat.
+func (in *Snat) DeepCopy() *Snat {
+	if in == nil {
+		return nil
+	}
+	out := new(Snat)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Tunnel) DeepCopyInto(out *Tunnel) {
 	*out = *in
@@ -66,6 +66,12 @@ func (a *Announce) interfaceScan() {
 	}
 }
 
+// Rescan scans the interfaces right away, so the interfaces created for the EIPs
+// are answered without waiting for the next scan.
+func (a *Announce) Rescan() {
+	a.updateInterfaces()
+}
+
 // updateInterfaces is used to scan network interfaces, update the arps and ndps lists in
 // the Announcement object to respond to ARP and NDP requests, and exclude some unnecessary
 // interfaces.
@@ -0,0 +1,35 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package layer2
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/mdlayher/arp"
+	"github.com/mdlayher/ndp"
+)
+
+// Gratuitous sends a gratuitous ARP, or an unsolicited neighbor advertisement for an
+// IPv6 address, for the ip on the interface, so the neighbours update their caches
+// once the ip is configured on the interface of another node
+func Gratuitous(ifi *net.Interface, ip net.IP) error {
+	if ip.To4() != nil {
+		client, err := arp.Dial(ifi)
+		if err != nil {
+			return fmt.Errorf("dialing ARP on %q: %s", ifi.Name, err)
+		}
+		defer client.Close()
+		a := &arpResponder{intf: ifi.Name, hardwareAddr: ifi.HardwareAddr, conn: client}
+		return a.Gratuitous(ip)
+	}
+
+	conn, _, err := ndp.Dial(ifi, ndp.LinkLocal)
+	if err != nil {
+		return fmt.Errorf("dialing NDP on %q: %s", ifi.Name, err)
+	}
+	defer conn.Close()
+	n := &ndpResponder{intf: ifi.Name, hardwareAddr: ifi.HardwareAddr, conn: conn}
+	return n.Gratuitous(ip)
+}
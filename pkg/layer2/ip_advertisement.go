@@ -69,3 +69,17 @@ func (i *IPAdvertisement) matchInterface(intf string) bool {
 	}
 	return i.interfaces.Has(intf)
 }
+
+// IP returns the advertised address
+func (i *IPAdvertisement) IP() net.IP {
+	return i.ip
+}
+
+// Interfaces returns the interfaces the address is advertised on, it is empty if the
+// address is advertised on all the interfaces
+func (i *IPAdvertisement) Interfaces() []string {
+	if i.allInterfaces {
+		return nil
+	}
+	return sets.List(i.interfaces)
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package lease
+
+import (
+	"context"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const namePrefix = "egressgateway-node-"
+
+// Name returns the name of the lease renewed by the agent of the node, the agent holds
+// the EIPs placed on the node only as long as it renews the lease.
+func Name(node string) string {
+	return namePrefix + node
+}
+
+// Get returns the lease renewed by the agent of the node, it returns nil if the lease
+// does not exist.
+func Get(ctx context.Context, reader client.Reader, namespace, node string) (*coordinationv1.Lease, error) {
+	lease := new(coordinationv1.Lease)
+	err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: Name(node)}, lease)
+	if err != nil {
+		if apierr.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return lease, nil
+}
+
+// Held reports whether the lease has not expired at the given time
+func Held(lease *coordinationv1.Lease, now time.Time) bool {
+	return Remaining(lease, now) > 0
+}
+
+// Remaining returns how long the lease is still held after the given time, the EIPs
+// of the node must not be moved before, as its agent may still announce them.
+func Remaining(lease *coordinationv1.Lease, now time.Time) time.Duration {
+	if lease == nil || lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return 0
+	}
+	duration := time.Second * time.Duration(*lease.Spec.LeaseDurationSeconds)
+	if remaining := lease.Spec.RenewTime.Add(duration).Sub(now); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// CacheByObject scopes the Lease cache to the namespace of the node leases, otherwise the
+// cache watches the leases of all the namespaces, e.g. the ones renewed by every kubelet
+func CacheByObject(namespace string) map[client.Object]cache.ByObject {
+	return map[client.Object]cache.ByObject{
+		&coordinationv1.Lease{}: {Namespaces: map[string]cache.Config{namespace: {}}},
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package lease
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/spidernet-io/egressgateway/pkg/schema"
+)
+
+func TestHeld(t *testing.T) {
+	now := time.Now()
+
+	cases := map[string]struct {
+		lease *coordinationv1.Lease
+		exp   bool
+	}{
+		"nil": {},
+		"never renewed": {
+			lease: &coordinationv1.Lease{Spec: coordinationv1.LeaseSpec{LeaseDurationSeconds: ptr.To[int32](10)}},
+		},
+		"renewed": {
+			lease: &coordinationv1.Lease{Spec: coordinationv1.LeaseSpec{
+				LeaseDurationSeconds: ptr.To[int32](10),
+				RenewTime:            &metav1.MicroTime{Time: now.Add(-time.Second * 5)},
+			}},
+			exp: true,
+		},
+		"expired": {
+			lease: &coordinationv1.Lease{Spec: coordinationv1.LeaseSpec{
+				LeaseDurationSeconds: ptr.To[int32](10),
+				RenewTime:            &metav1.MicroTime{Time: now.Add(-time.Second * 11)},
+			}},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, c.exp, Held(c.lease, now))
+		})
+	}
+}
+
+func TestRemaining(t *testing.T) {
+	now := time.Now()
+	l := &coordinationv1.Lease{Spec: coordinationv1.LeaseSpec{
+		LeaseDurationSeconds: ptr.To[int32](10),
+		RenewTime:            &metav1.MicroTime{Time: now.Add(-time.Second * 4)},
+	}}
+	assert.Equal(t, time.Second*6, Remaining(l, now))
+	assert.Equal(t, time.Duration(0), Remaining(l, now.Add(time.Second*7)))
+	assert.Equal(t, time.Duration(0), Remaining(nil, now))
+}
+
+func TestGet(t *testing.T) {
+	l := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: Name("node1")}}
+	cli := fake.NewClientBuilder().WithScheme(schema.GetScheme()).WithObjects(l).Build()
+
+	got, err := Get(context.Background(), cli, "default", "node1")
+	assert.NoError(t, err)
+	assert.NotNil(t, got)
+
+	got, err = Get(context.Background(), cli, "default", "node2")
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
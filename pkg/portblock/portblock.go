@@ -0,0 +1,266 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+// Package portblock allocates fixed blocks of the source ports of the EIPs to the source
+// IPs of the policies, like the port block allocation of CGNAT, so the source port of a
+// connection from an EIP identifies the pod it comes from.
+package portblock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+const (
+	// LabelPortBlocks labels the ConfigMaps of the allocation tables
+	LabelPortBlocks = "spidernet.io/snat-port-blocks"
+	// DataKey is the key of the allocation table in the ConfigMap
+	DataKey = "portBlocks"
+
+	// the ports the kernel picks from when no port range is set
+	defaultFirstPort = 1024
+	defaultLastPort  = 65535
+)
+
+// Block is the source ports of an EIP allocated to a source IP
+type Block struct {
+	EIP    string `json:"eip"`
+	Source string `json:"source"`
+	Ports  string `json:"ports"`
+	// Policy is the policy of the source IP, `<namespace>/<name>` for the EgressPolicy
+	Policy string `json:"policy"`
+	// Pod is the pod of the source IP, `<namespace>/<name>`, it is empty for the IP of a node
+	Pod string `json:"pod,omitempty"`
+}
+
+// Source is a source IP of the policies which use an EIP
+type Source struct {
+	IP     string
+	Policy string
+	Pod    string
+}
+
+// ConfigMapName returns the name of the ConfigMap of the allocation table of the EgressGateway
+func ConfigMapName(gateway string) string {
+	return "egress-snat-port-blocks-" + gateway
+}
+
+// CacheByObject restricts the cached ConfigMaps to the allocation tables
+func CacheByObject() map[client.Object]cache.ByObject {
+	return map[client.Object]cache.ByObject{
+		&corev1.ConfigMap{}: {Label: labels.SelectorFromSet(nil).Add(exists(LabelPortBlocks))},
+	}
+}
+
+func exists(key string) labels.Requirement {
+	req, _ := labels.NewRequirement(key, selection.Exists, nil)
+	return *req
+}
+
+// Range returns the first and the last port the blocks are carved from
+func Range(snat egressv1.Snat) (int, int, error) {
+	if snat.PortRange == "" {
+		return defaultFirstPort, defaultLastPort, nil
+	}
+	return snat.Ports()
+}
+
+// Fallback returns the ports shared by the sources which get no block, it is the last block
+// of the range with the ports left over, which is never allocated, so the sources without a
+// block never take the ports of the others. It is the whole range if there are no blocks.
+func Fallback(first, last, size int) string {
+	total := blockCount(first, last, size)
+	if total == 0 {
+		return fmt.Sprintf("%d-%d", first, last)
+	}
+	return fmt.Sprintf("%d-%d", first+total*size, last)
+}
+
+// blockCount returns the number of the blocks of the range which can be allocated
+func blockCount(first, last, size int) int {
+	if size <= 0 || (last-first+1)/size < 2 {
+		return 0
+	}
+	return (last-first+1)/size - 1
+}
+
+// Allocate allocates the port blocks of the EIP to the sources. The block of a source which
+// still uses the EIP is kept, the new sources get the free blocks with the lowest ports in
+// the order of their IPs. It returns the blocks and the sources which get no block as the
+// blocks are exhausted, they share the Fallback ports.
+func Allocate(eip string, existing []Block, sources []Source, first, last, size int) ([]Block, []Source) {
+	total := blockCount(first, last, size)
+	if total == 0 {
+		return nil, sources
+	}
+
+	wanted := make(map[string]Source, len(sources))
+	for _, src := range sources {
+		if _, ok := wanted[src.IP]; !ok {
+			wanted[src.IP] = src
+		}
+	}
+
+	used := make(map[int]bool)
+	res := make([]Block, 0, len(wanted))
+	for _, block := range existing {
+		if block.EIP != eip {
+			continue
+		}
+		src, ok := wanted[block.Source]
+		if !ok {
+			continue
+		}
+		index, ok := blockIndex(block.Ports, first, size, total)
+		if !ok || used[index] {
+			continue
+		}
+		used[index] = true
+		delete(wanted, block.Source)
+		res = append(res, Block{EIP: eip, Source: src.IP, Ports: block.Ports, Policy: src.Policy, Pod: src.Pod})
+	}
+
+	pending := make([]Source, 0, len(wanted))
+	for _, src := range wanted {
+		pending = append(pending, src)
+	}
+	sortSources(pending)
+
+	var exhausted []Source
+	index := 0
+	for _, src := range pending {
+		for index < total && used[index] {
+			index++
+		}
+		if index >= total {
+			exhausted = append(exhausted, src)
+			continue
+		}
+		used[index] = true
+		start := first + index*size
+		res = append(res, Block{
+			EIP:    eip,
+			Source: src.IP,
+			Ports:  fmt.Sprintf("%d-%d", start, start+size-1),
+			Policy: src.Policy,
+			Pod:    src.Pod,
+		})
+	}
+	Sort(res)
+	return res, exhausted
+}
+
+// blockIndex returns the index of the block of the ports, it is false if the ports are
+// not a block of the range, e.g. the port range or the block size has been changed
+func blockIndex(ports string, first, size, total int) (int, bool) {
+	startStr, endStr, ok := strings.Cut(ports, "-")
+	if !ok {
+		return 0, false
+	}
+	start, err := strconv.Atoi(startStr)
+	if err != nil {
+		return 0, false
+	}
+	end, err := strconv.Atoi(endStr)
+	if err != nil {
+		return 0, false
+	}
+	if start < first || (start-first)%size != 0 || end != start+size-1 {
+		return 0, false
+	}
+	index := (start - first) / size
+	return index, index < total
+}
+
+// Diff returns the blocks which are allocated and released from old to cur
+func Diff(old, cur []Block) (allocated, released []Block) {
+	key := func(b Block) string { return b.EIP + "|" + b.Source + "|" + b.Ports + "|" + b.Policy + "|" + b.Pod }
+	oldSet := make(map[string]bool, len(old))
+	for _, b := range old {
+		oldSet[key(b)] = true
+	}
+	curSet := make(map[string]bool, len(cur))
+	for _, b := range cur {
+		curSet[key(b)] = true
+		if !oldSet[key(b)] {
+			allocated = append(allocated, b)
+		}
+	}
+	for _, b := range old {
+		if !curSet[key(b)] {
+			released = append(released, b)
+		}
+	}
+	return allocated, released
+}
+
+// Sort sorts the blocks by the EIP and the ports
+func Sort(blocks []Block) {
+	sort.Slice(blocks, func(i, j int) bool {
+		if blocks[i].EIP != blocks[j].EIP {
+			return blocks[i].EIP < blocks[j].EIP
+		}
+		return portStart(blocks[i].Ports) < portStart(blocks[j].Ports)
+	})
+}
+
+func portStart(ports string) int {
+	start, _, _ := strings.Cut(ports, "-")
+	res, _ := strconv.Atoi(start)
+	return res
+}
+
+func sortSources(sources []Source) {
+	sort.Slice(sources, func(i, j int) bool {
+		a, b := net.ParseIP(sources[i].IP), net.ParseIP(sources[j].IP)
+		if a == nil || b == nil {
+			return sources[i].IP < sources[j].IP
+		}
+		return string(a.To16()) < string(b.To16())
+	})
+}
+
+// Decode returns the allocation table in the ConfigMap
+func Decode(cm *corev1.ConfigMap) ([]Block, error) {
+	raw, ok := cm.Data[DataKey]
+	if !ok || raw == "" {
+		return nil, nil
+	}
+	var blocks []Block
+	if err := json.Unmarshal([]byte(raw), &blocks); err != nil {
+		return nil, fmt.Errorf("failed to decode port blocks of %s/%s: %w", cm.Namespace, cm.Name, err)
+	}
+	return blocks, nil
+}
+
+// Encode returns the allocation table stored in the ConfigMap, one block per line
+func Encode(blocks []Block) (string, error) {
+	var b strings.Builder
+	b.WriteString("[\n")
+	for i, block := range blocks {
+		raw, err := json.Marshal(block)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString("  ")
+		b.Write(raw)
+		if i < len(blocks)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("]\n")
+	return b.String(), nil
+}
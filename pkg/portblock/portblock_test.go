@@ -0,0 +1,109 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package portblock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+func TestAllocate(t *testing.T) {
+	const eip = "10.6.1.21"
+	src := func(ip, pod string) Source { return Source{IP: ip, Policy: "default/p1", Pod: "default/" + pod} }
+	block := func(ip, pod, ports string) Block {
+		return Block{EIP: eip, Source: ip, Ports: ports, Policy: "default/p1", Pod: "default/" + pod}
+	}
+
+	cases := map[string]struct {
+		existing  []Block
+		sources   []Source
+		expect    []Block
+		exhausted []Source
+	}{
+		"allocate in the order of the ips": {
+			sources: []Source{src("10.21.0.10", "b"), src("10.21.0.9", "a")},
+			expect:  []Block{block("10.21.0.9", "a", "1000-1099"), block("10.21.0.10", "b", "1100-1199")},
+		},
+		"keep the existing blocks": {
+			existing: []Block{block("10.21.0.10", "b", "1100-1199"), block("10.21.0.9", "a", "1000-1099")},
+			sources:  []Source{src("10.21.0.10", "b"), src("10.21.0.11", "c")},
+			expect:   []Block{block("10.21.0.11", "c", "1000-1099"), block("10.21.0.10", "b", "1100-1199")},
+		},
+		"the pod of the ip is updated": {
+			existing: []Block{block("10.21.0.9", "a", "1100-1199")},
+			sources:  []Source{src("10.21.0.9", "a2")},
+			expect:   []Block{block("10.21.0.9", "a2", "1100-1199")},
+		},
+		"block out of the range is reallocated": {
+			existing: []Block{block("10.21.0.9", "a", "1050-1149"), block("10.21.0.10", "b", "2000-2099")},
+			sources:  []Source{src("10.21.0.9", "a"), src("10.21.0.10", "b")},
+			expect:   []Block{block("10.21.0.9", "a", "1000-1099"), block("10.21.0.10", "b", "1100-1199")},
+		},
+		"blocks are exhausted": {
+			sources:   []Source{src("10.21.0.9", "a"), src("10.21.0.10", "b"), src("10.21.0.11", "c")},
+			expect:    []Block{block("10.21.0.9", "a", "1000-1099"), block("10.21.0.10", "b", "1100-1199")},
+			exhausted: []Source{src("10.21.0.11", "c")},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			blocks, exhausted := Allocate(eip, c.existing, c.sources, 1000, 1349, 100)
+			assert.Equal(t, c.expect, blocks)
+			assert.Equal(t, c.exhausted, exhausted)
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := Block{EIP: "10.6.1.21", Source: "10.21.0.9", Ports: "1000-1099"}
+	b := Block{EIP: "10.6.1.21", Source: "10.21.0.10", Ports: "1100-1199"}
+	c := Block{EIP: "10.6.1.21", Source: "10.21.0.11", Ports: "1100-1199"}
+	allocated, released := Diff([]Block{a, b}, []Block{a, c})
+	assert.Equal(t, []Block{c}, allocated)
+	assert.Equal(t, []Block{b}, released)
+
+	// the source ip is reused by another pod
+	d := Block{EIP: "10.6.1.21", Source: "10.21.0.9", Ports: "1000-1099", Pod: "default/d"}
+	allocated, released = Diff([]Block{a}, []Block{d})
+	assert.Equal(t, []Block{d}, allocated)
+	assert.Equal(t, []Block{a}, released)
+}
+
+func TestFallback(t *testing.T) {
+	assert.Equal(t, "1200-1349", Fallback(1000, 1349, 100))
+	assert.Equal(t, "1100-1199", Fallback(1000, 1199, 100))
+	// no blocks are allocated from the range
+	assert.Equal(t, "1000-1149", Fallback(1000, 1149, 100))
+	assert.Equal(t, "1000-1149", Fallback(1000, 1149, 0))
+}
+
+func TestEncodeDecode(t *testing.T) {
+	blocks := []Block{
+		{EIP: "10.6.1.21", Source: "10.21.0.9", Ports: "1000-1099", Policy: "default/p1", Pod: "default/a"},
+		{EIP: "fd00::21", Source: "fd00:21::9", Ports: "1000-1099", Policy: "c1"},
+	}
+	raw, err := Encode(blocks)
+	assert.NoError(t, err)
+	got, err := Decode(&corev1.ConfigMap{Data: map[string]string{DataKey: raw}})
+	assert.NoError(t, err)
+	assert.Equal(t, blocks, got)
+
+	got, err = Decode(&corev1.ConfigMap{})
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestRange(t *testing.T) {
+	first, last, err := Range(egressv1.Snat{})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1024, 65535}, []int{first, last})
+
+	first, last, err = Range(egressv1.Snat{PortRange: "20000-29999"})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{20000, 29999}, []int{first, last})
+}
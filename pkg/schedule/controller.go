@@ -0,0 +1,154 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/utils"
+)
+
+// scheduleReconciler flips the Active condition of the scheduled policies at the boundaries
+// of their windows
+type scheduleReconciler struct {
+	client client.Client
+	log    logr.Logger
+	now    func() time.Time
+}
+
+func (r *scheduleReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	kind, newReq, err := utils.ParseKindWithReq(req)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	log := r.log.WithValues("kind", kind, "name", newReq.Name, "namespace", newReq.Namespace)
+	log.V(1).Info("reconcile")
+
+	var obj client.Object
+	switch kind {
+	case "EgressPolicy":
+		obj = new(egressv1.EgressPolicy)
+	case "EgressClusterPolicy":
+		obj = new(egressv1.EgressClusterPolicy)
+	default:
+		return reconcile.Result{}, nil
+	}
+	if err := r.client.Get(ctx, newReq.NamespacedName, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	var schedule *egressv1.Schedule
+	var status *egressv1.EgressPolicyStatus
+	switch policy := obj.(type) {
+	case *egressv1.EgressPolicy:
+		schedule, status = policy.Spec.Schedule, &policy.Status
+	case *egressv1.EgressClusterPolicy:
+		schedule, status = policy.Spec.Schedule, &policy.Status
+	}
+
+	now := r.now()
+	next, changed := setActiveCondition(status, obj.GetGeneration(), schedule, now)
+	if changed {
+		if err := r.client.Status().Update(ctx, obj); err != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to update status of %s %s: %w", kind, newReq.Name, err)
+		}
+	}
+	if next.IsZero() {
+		return reconcile.Result{}, nil
+	}
+	// the timer may fire early, the reconciliation after the boundary flips the condition
+	return reconcile.Result{RequeueAfter: next.Sub(now) + time.Second}, nil
+}
+
+// setActiveCondition refreshes the Active condition and the next transition time of the
+// policy status, it returns the next transition time and whether the status has been changed
+func setActiveCondition(status *egressv1.EgressPolicyStatus, generation int64,
+	schedule *egressv1.Schedule, now time.Time) (time.Time, bool) {
+
+	if schedule == nil {
+		changed := meta.FindStatusCondition(status.Conditions, egressv1.ConditionActive) != nil ||
+			status.NextTransitionTime != nil
+		meta.RemoveStatusCondition(&status.Conditions, egressv1.ConditionActive)
+		status.NextTransitionTime = nil
+		return time.Time{}, changed
+	}
+
+	var condition metav1.Condition
+	var next time.Time
+	window, err := Parse(*schedule)
+	if err != nil {
+		condition = utils.NewCondition(egressv1.ConditionActive, false, egressv1.ReasonInvalidSchedule, err.Error())
+	} else {
+		var active bool
+		active, next = window.State(now)
+		if active {
+			condition = utils.NewCondition(egressv1.ConditionActive, true, egressv1.ReasonInWindow,
+				"the policy is in a window of its schedule")
+		} else {
+			condition = utils.NewCondition(egressv1.ConditionActive, false, egressv1.ReasonOutOfWindow,
+				"the policy is out of the windows of its schedule, the traffic uses the node IP")
+		}
+	}
+	condition.ObservedGeneration = generation
+	changed := meta.SetStatusCondition(&status.Conditions, condition)
+
+	var nextTime *metav1.Time
+	if !next.IsZero() {
+		nextTime = &metav1.Time{Time: next}
+	}
+	if !nextTime.Equal(status.NextTransitionTime) {
+		status.NextTransitionTime = nextTime
+		changed = true
+	}
+	return next, changed
+}
+
+// IsActive returns true when the policy is in a window of its schedule, the policy without a
+// schedule is always active, the scheduled policy is inactive until the Active condition is set
+func IsActive(schedule *egressv1.Schedule, status egressv1.EgressPolicyStatus) bool {
+	if schedule == nil {
+		return true
+	}
+	return meta.IsStatusConditionTrue(status.Conditions, egressv1.ConditionActive)
+}
+
+// NewPolicyScheduleController returns the controller which maintains the Active condition of
+// the scheduled policies
+func NewPolicyScheduleController(mgr manager.Manager, log logr.Logger) error {
+	r := &scheduleReconciler{
+		client: mgr.GetClient(),
+		log:    log.WithName("policy-schedule"),
+		now:    time.Now,
+	}
+	c, err := controller.New("policySchedule", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+	if err := c.Watch(source.Kind(mgr.GetCache(), &egressv1.EgressPolicy{}),
+		handler.EnqueueRequestsFromMapFunc(utils.KindToMapFlat("EgressPolicy"))); err != nil {
+		return fmt.Errorf("failed to watch EgressPolicy: %w", err)
+	}
+	if err := c.Watch(source.Kind(mgr.GetCache(), &egressv1.EgressClusterPolicy{}),
+		handler.EnqueueRequestsFromMapFunc(utils.KindToMapFlat("EgressClusterPolicy"))); err != nil {
+		return fmt.Errorf("failed to watch EgressClusterPolicy: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+// Package schedule resolves the time windows of the scheduled policies, and maintains the
+// Active condition and the next transition time of the policies.
+package schedule
+
+import (
+	"fmt"
+	"time"
+	// the controller image may have no time zone database
+	_ "time/tzdata"
+
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+)
+
+// maxWindows limits the overlapped windows merged into one
+const maxWindows = 1000
+
+// MaxDuration limits the duration of the windows, the start of a window is searched within
+// the 5 years of Cron.Next, a longer window would never be found
+const MaxDuration = 366 * 24 * time.Hour
+
+// Window is the parsed schedule of a policy
+type Window struct {
+	cron     *Cron
+	duration time.Duration
+	location *time.Location
+}
+
+// Parse parses the schedule of a policy
+func Parse(s egressv1.Schedule) (*Window, error) {
+	cron, err := ParseCron(s.Cron)
+	if err != nil {
+		return nil, err
+	}
+	if s.Duration.Duration <= 0 {
+		return nil, fmt.Errorf("invalid duration %q, it should be positive", s.Duration.Duration)
+	}
+	if s.Duration.Duration > MaxDuration {
+		return nil, fmt.Errorf("invalid duration %q, it should be no longer than %s", s.Duration.Duration, MaxDuration)
+	}
+	location := time.UTC
+	if s.TimeZone != "" {
+		location, err = time.LoadLocation(s.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %w", s.TimeZone, err)
+		}
+	}
+	return &Window{cron: cron, duration: s.Duration.Duration, location: location}, nil
+}
+
+// State returns whether now is in a window, and the time the state changes. The next time
+// is zero when the state does not change, the windows which overlap are merged.
+func (w *Window) State(now time.Time) (bool, time.Time) {
+	now = now.In(w.location)
+	// the window started after now-duration covers now if it started before now
+	start := w.cron.Next(now.Add(-w.duration))
+	if start.IsZero() {
+		return false, time.Time{}
+	}
+	if start.After(now) {
+		return false, start
+	}
+
+	end := start.Add(w.duration)
+	for i := 0; i < maxWindows; i++ {
+		next := w.cron.Next(start)
+		if next.IsZero() || next.After(end) {
+			return true, end
+		}
+		start = next
+		if next.Add(w.duration).After(end) {
+			end = next.Add(w.duration)
+		}
+	}
+	return true, time.Time{}
+}
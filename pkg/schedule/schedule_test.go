@@ -0,0 +1,176 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package schedule
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	egressv1 "github.com/spidernet-io/egressgateway/pkg/k8s/apis/v1beta1"
+	"github.com/spidernet-io/egressgateway/pkg/schema"
+)
+
+func TestParseCron(t *testing.T) {
+	cases := map[string]bool{
+		"0 1 * * *":           true,
+		"*/15 0-6 1,15 * 1-5": true,
+		"30 2 * * 7":          true,
+		"0 1 * *":             false,
+		"60 1 * * *":          false,
+		"0 5-1 * * *":         false,
+		"0 */0 * * *":         false,
+		"0 1 * JAN *":         false,
+	}
+	for expr, valid := range cases {
+		t.Run(expr, func(t *testing.T) {
+			_, err := ParseCron(expr)
+			assert.Equal(t, valid, err == nil, err)
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		res, err := time.Parse(time.RFC3339, s)
+		assert.NoError(t, err)
+		return res
+	}
+	cases := map[string]struct {
+		expr      string
+		from, exp string
+	}{
+		"same day":             {expr: "0 1 * * *", from: "2024-03-01T00:30:15Z", exp: "2024-03-01T01:00:00Z"},
+		"next day":             {expr: "0 1 * * *", from: "2024-03-01T01:00:00Z", exp: "2024-03-02T01:00:00Z"},
+		"step":                 {expr: "*/20 * * * *", from: "2024-03-01T00:41:00Z", exp: "2024-03-01T01:00:00Z"},
+		"sunday is 7":          {expr: "0 0 * * 7", from: "2024-03-01T00:00:00Z", exp: "2024-03-03T00:00:00Z"},
+		"day of month or week": {expr: "0 0 15 * 1", from: "2024-03-01T00:00:00Z", exp: "2024-03-04T00:00:00Z"},
+		"leap day":             {expr: "0 0 29 2 *", from: "2024-03-01T00:00:00Z", exp: "2028-02-29T00:00:00Z"},
+		"no time":              {expr: "0 0 30 2 *", from: "2024-03-01T00:00:00Z"},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			cron, err := ParseCron(c.expr)
+			assert.NoError(t, err)
+			next := cron.Next(at(c.from))
+			if c.exp == "" {
+				assert.True(t, next.IsZero())
+				return
+			}
+			assert.Equal(t, at(c.exp), next)
+		})
+	}
+}
+
+func TestWindowState(t *testing.T) {
+	// the windows start at 01:00 in Shanghai, 17:00 UTC, and last for 2 hours
+	window, err := Parse(egressv1.Schedule{
+		Cron:     "0 1 * * *",
+		Duration: metav1.Duration{Duration: 2 * time.Hour},
+		TimeZone: "Asia/Shanghai",
+	})
+	assert.NoError(t, err)
+
+	at := func(s string) time.Time {
+		res, err := time.Parse(time.RFC3339, s)
+		assert.NoError(t, err)
+		return res
+	}
+	cases := map[string]struct {
+		now    string
+		active bool
+		next   string
+	}{
+		"before the window": {now: "2024-03-01T16:00:00Z", next: "2024-03-01T17:00:00Z"},
+		"window starts":     {now: "2024-03-01T17:00:00Z", active: true, next: "2024-03-01T19:00:00Z"},
+		"in the window":     {now: "2024-03-01T18:30:00Z", active: true, next: "2024-03-01T19:00:00Z"},
+		"window ends":       {now: "2024-03-01T19:00:00Z", next: "2024-03-02T17:00:00Z"},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			active, next := window.State(at(c.now))
+			assert.Equal(t, c.active, active)
+			assert.True(t, at(c.next).Equal(next), next)
+		})
+	}
+
+	// the overlapped windows are merged
+	window, err = Parse(egressv1.Schedule{Cron: "0 * * * *", Duration: metav1.Duration{Duration: 90 * time.Minute}})
+	assert.NoError(t, err)
+	active, next := window.State(at("2024-03-01T10:10:00Z"))
+	assert.True(t, active)
+	assert.True(t, next.IsZero())
+
+	_, err = Parse(egressv1.Schedule{Cron: "0 1 * * *", Duration: metav1.Duration{Duration: time.Hour}, TimeZone: "Mars/Base"})
+	assert.Error(t, err)
+	_, err = Parse(egressv1.Schedule{Cron: "0 1 * * *"})
+	assert.Error(t, err)
+	_, err = Parse(egressv1.Schedule{Cron: "0 1 * * *", Duration: metav1.Duration{Duration: MaxDuration + time.Hour}})
+	assert.Error(t, err)
+}
+
+func TestIsActive(t *testing.T) {
+	s := &egressv1.Schedule{Cron: "0 1 * * *", Duration: metav1.Duration{Duration: time.Hour}}
+	assert.True(t, IsActive(nil, egressv1.EgressPolicyStatus{}))
+	// the condition has not been set by the controller
+	assert.False(t, IsActive(s, egressv1.EgressPolicyStatus{}))
+	status := egressv1.EgressPolicyStatus{Conditions: []metav1.Condition{{Type: egressv1.ConditionActive, Status: metav1.ConditionTrue}}}
+	assert.True(t, IsActive(s, status))
+	status.Conditions[0].Status = metav1.ConditionFalse
+	assert.False(t, IsActive(s, status))
+}
+
+func TestReconcile(t *testing.T) {
+	policy := &egressv1.EgressPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "default"},
+		Spec: egressv1.EgressPolicySpec{Schedule: &egressv1.Schedule{
+			Cron:     "0 1 * * *",
+			Duration: metav1.Duration{Duration: 2 * time.Hour},
+		}},
+	}
+	cli := fake.NewClientBuilder().WithScheme(schema.GetScheme()).
+		WithObjects(policy).WithStatusSubresource(policy).Build()
+
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	r := &scheduleReconciler{client: cli, log: logr.Discard(), now: func() time.Time { return now }}
+	ctx := context.Background()
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "EgressPolicy/default", Name: "p1"}}
+	status := func() egressv1.EgressPolicyStatus {
+		res := new(egressv1.EgressPolicy)
+		assert.NoError(t, cli.Get(ctx, types.NamespacedName{Namespace: "default", Name: "p1"}, res))
+		return res.Status
+	}
+
+	res, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour+time.Second, res.RequeueAfter)
+	assert.True(t, meta.IsStatusConditionFalse(status().Conditions, egressv1.ConditionActive))
+	assert.True(t, status().NextTransitionTime.Time.Equal(now.Add(time.Hour)))
+
+	now = now.Add(time.Hour + time.Second)
+	res, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, res.RequeueAfter)
+	assert.True(t, meta.IsStatusConditionTrue(status().Conditions, egressv1.ConditionActive))
+	assert.True(t, IsActive(policy.Spec.Schedule, status()))
+
+	// the condition is removed with the schedule
+	policy = new(egressv1.EgressPolicy)
+	assert.NoError(t, cli.Get(ctx, types.NamespacedName{Namespace: "default", Name: "p1"}, policy))
+	policy.Spec.Schedule = nil
+	assert.NoError(t, cli.Update(ctx, policy))
+	res, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Zero(t, res.RequeueAfter)
+	assert.Nil(t, meta.FindStatusCondition(status().Conditions, egressv1.ConditionActive))
+	assert.Nil(t, status().NextTransitionTime)
+}
@@ -0,0 +1,38 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NewCondition returns a condition with the given type, status, reason and message
+func NewCondition(conditionType string, status bool, reason, message string) metav1.Condition {
+	res := metav1.Condition{
+		Type:    conditionType,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	}
+	if status {
+		res.Status = metav1.ConditionTrue
+	}
+	return res
+}
+
+// SetConditions sets the conditions and the observedGeneration of a status,
+// the lastTransitionTime is kept if the condition status is not changed.
+// It returns true if anything has been changed.
+func SetConditions(conditions *[]metav1.Condition, observedGeneration *int64, generation int64, items ...metav1.Condition) bool {
+	changed := *observedGeneration != generation
+	*observedGeneration = generation
+	for _, item := range items {
+		item.ObservedGeneration = generation
+		if meta.SetStatusCondition(conditions, item) {
+			changed = true
+		}
+	}
+	return changed
+}
@@ -0,0 +1,57 @@
+// Copyright 2022 Authors of spidernet-io
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetConditions(t *testing.T) {
+	var conditions []metav1.Condition
+	var observedGeneration int64
+
+	changed := SetConditions(&conditions, &observedGeneration, 1,
+		NewCondition("Ready", true, "Ready", ""),
+		NewCondition("Degraded", false, "AsExpected", ""),
+	)
+	if !changed {
+		t.Fatal("expected changed for new conditions")
+	}
+	if observedGeneration != 1 || len(conditions) != 2 {
+		t.Fatalf("got observedGeneration=%d conditions=%v", observedGeneration, conditions)
+	}
+	if !meta.IsStatusConditionTrue(conditions, "Ready") {
+		t.Fatal("expected Ready=True")
+	}
+	transition := meta.FindStatusCondition(conditions, "Ready").LastTransitionTime
+
+	changed = SetConditions(&conditions, &observedGeneration, 1,
+		NewCondition("Ready", true, "Ready", ""),
+		NewCondition("Degraded", false, "AsExpected", ""),
+	)
+	if changed {
+		t.Fatal("expected no change for same conditions")
+	}
+
+	changed = SetConditions(&conditions, &observedGeneration, 2,
+		NewCondition("Ready", true, "Ready", ""),
+	)
+	if !changed {
+		t.Fatal("expected changed for new generation")
+	}
+	ready := meta.FindStatusCondition(conditions, "Ready")
+	if ready.ObservedGeneration != 2 || !ready.LastTransitionTime.Equal(&transition) {
+		t.Fatalf("unexpected Ready condition %v", ready)
+	}
+
+	changed = SetConditions(&conditions, &observedGeneration, 2,
+		NewCondition("Ready", false, "NotReady", "node down"),
+	)
+	if !changed || !meta.IsStatusConditionFalse(conditions, "Ready") {
+		t.Fatalf("expected Ready=False, got %v", conditions)
+	}
+}